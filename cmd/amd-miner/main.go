@@ -3,9 +3,10 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin"
@@ -14,19 +15,34 @@ import (
 	"github.com/gurupras/go-cryptonight-miner/gpu-miner/gpucontext"
 	miner "github.com/gurupras/go-cryptonight-miner/miner"
 	mineros "github.com/gurupras/go-cryptonight-miner/miner-os"
-	stratum "github.com/gurupras/go-stratum-client"
 	colorable "github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
-	yaml "gopkg.in/yaml.v2"
 )
 
 var (
-	app        = kingpin.New("cpuminer", "CPU Cryptonight miner")
-	config     = app.Flag("config-file", "YAML config file").Short('c').Required().String()
-	verbose    = app.Flag("verbose", "Enable verbose log messages").Short('v').Bool()
-	debug      = app.Flag("debug", "Enable miner debugging log messages").Short('d').Default("false").Bool()
-	useC       = app.Flag("use C", "Use C functions to intialize OpenCL  rather than Golang").Short('C').Default("false").Bool()
-	cpuprofile = app.Flag("cpuprofile", "Run CPU profiler").String()
+	app         = kingpin.New("cpuminer", "CPU Cryptonight miner")
+	config      = app.Flag("config-file", "YAML config file").Short('c').Required().String()
+	verbose     = app.Flag("verbose", "Enable verbose log messages").Short('v').Bool()
+	debug       = app.Flag("debug", "Enable miner debugging log messages").Short('d').Default("false").Bool()
+	useC        = app.Flag("use C", "Use C functions to intialize OpenCL  rather than Golang").Short('C').Default("false").Bool()
+	cpuprofile  = app.Flag("cpuprofile", "Run CPU profiler and write the profile to this file when interrupted").String()
+	pprofListen = app.Flag("pprof-listen", "Serve net/http/pprof profiles on this address").String()
+	maxHashRate = app.Flag("max-hashrate", "Limit the aggregate hashrate to this many H/s").Float64()
+	quiet       = app.Flag("quiet", "Do not log the periodic hashrate lines").Short('q').Bool()
+	printEvery  = app.Flag("print-samples", "Log the hashrate every this many hashrate samples instead of every 30 seconds").Int()
+	workerTag   = app.Flag("worker-tag", "Tag shares with this worker name, {id} is replaced with the thread id").String()
+	rateUnit    = app.Flag("hashrate-unit", "Log the hashrate in H/s, kH/s, MH/s or auto to pick one by the hashrate").String()
+	firstShare  = app.Flag("first-share-timeout", "Warn if no share is accepted this many seconds after connecting").Int()
+	shareLog    = app.Flag("share-log", "Append a JSON record of every submitted share and the response of the pool to this file").String()
+	stagger     = app.Flag("thread-stagger", "Milliseconds to wait between starting one miner thread and the next, to spread out scratchpad allocations").Int()
+	reportPower = app.Flag("report-power", "Read the power draw of the GPUs and CPUs where possible and report the H/s per watt").Bool()
+	grace       = app.Flag("shutdown-grace", "Seconds to wait on shutdown for shares already found to be answered by the pool. A negative value exits right away").Int()
+	retries     = app.Flag("retries", "Exit with code 3 after this many consecutive failed attempts to connect to the pool. 0 retries forever").Int()
+	pauseActive = app.Flag("pause-when-active", "Pause mining while the machine is in use").Bool()
+	userAgent   = app.Flag("user-agent", "Identify as this agent to the pool").String()
+	apiAddress  = app.Flag("api-bind", "Serve the status and control API on this address").String()
+	nonceOffset = app.Flag("nonce-offset", "Start mining at this nonce, to shard the nonce space among rigs").Uint64()
+	nonceStride = app.Flag("nonce-stride", "Mine this many nonces from --nonce-offset. Must fit in the low 24 bits with nicehash").Uint64()
 )
 
 func main() {
@@ -61,18 +77,148 @@ func main() {
 		log.Fatalf("Failed to read config file: %v", err)
 	}
 	var config miner.Config
-	if err := yaml.Unmarshal(configData, &config); err != nil {
+	warnings, err := miner.ParseConfig(configData, &config)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
 		log.Fatalf("Failed to parse yaml into valid config: %v", err)
 	}
+	if err := config.LoadCredentials(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	warnings, err = config.CheckMinerSections(false, true)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	miner.SetupColors(config.Colors)
+	if *quiet {
+		config.Quiet = true
+	}
+	miner.SetQuiet(config.Quiet)
+	if *printEvery > 0 {
+		config.PrintSamples = *printEvery
+	}
+	miner.SetPrintSamples(config.PrintSamples)
+	if len(*rateUnit) != 0 {
+		config.HashRateUnit = *rateUnit
+	}
+	if len(config.HashRateUnit) != 0 {
+		if err := miner.SetHashRateUnit(config.HashRateUnit); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if len(*pprofListen) != 0 {
+		config.PprofAddress = *pprofListen
+	}
+	if len(config.PprofAddress) != 0 {
+		if err := miner.StartPprof(config.PprofAddress); err != nil {
+			log.Fatalf("Failed to start pprof: %v", err)
+		}
+	}
+	if len(*userAgent) != 0 {
+		config.UserAgent = *userAgent
+	}
+	if len(config.UserAgent) != 0 {
+		miner.Agent = config.UserAgent
+	}
+	if *pauseActive {
+		config.PauseWhenActive = true
+	}
 
-	sc := stratum.New()
+	if config.Background && !mineros.IsDaemon() {
+		if config.LogFile == nil {
+			log.Warnf("Running in background without a log file, log messages will be discarded")
+		}
+		pid, err := mineros.Daemonize()
+		if err != nil {
+			log.Fatalf("Failed to run in background: %v", err)
+		}
+		log.Infof("Running in background with pid %d", pid)
+		return
+	}
+
+	if f, err := miner.SetupLogFile(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
+
+	miner.SetupSyslog(&config)
+
+	if len(*shareLog) != 0 {
+		config.ShareLog = *shareLog
+	}
+	if *retries > 0 {
+		config.Retries = *retries
+	}
+	if f, err := miner.SetupShareLog(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
+	if config.MinShareDifficulty > 0 {
+		log.Infof("Only submitting shares of at least diff %d", config.MinShareDifficulty)
+		miner.SetSubmitPolicy(miner.NewMinDifficultyPolicy(config.MinShareDifficulty))
+	}
+	if *reportPower {
+		config.ReportPower = true
+	}
+	if config.ReportPower {
+		meters := make([]miner.PowerMeter, 0)
+		for _, meter := range mineros.PowerMeters() {
+			log.Infof("Reading the power draw of %v", meter.Name())
+			meters = append(meters, meter)
+		}
+		if len(meters) == 0 {
+			log.Warnf("The power draw can't be read, not reporting efficiency")
+		}
+		miner.DefaultPowerTracker.SetMeters(meters)
+	}
+
+	if len(config.PIDFile) != 0 {
+		if err := mineros.WritePIDFile(config.PIDFile); err != nil {
+			log.Fatalf("Failed to write PID file: %v", err)
+		}
+		defer os.Remove(config.PIDFile)
+	}
+
+	if *maxHashRate > 0 {
+		config.MaxHashRate = *maxHashRate
+	}
+	if *nonceOffset != 0 {
+		config.NonceOffset = *nonceOffset
+	}
+	if *nonceStride != 0 {
+		config.NonceStride = *nonceStride
+	}
+	if err := config.ApplyNonceShard(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := amdgpu.CheckDevices(config.OpenCLPlatform); err != nil {
+		log.Fatalf("%v. To mine on the CPU instead, use the CPU miner or the combined miner", err)
+	}
+
+	miner.LoginAlgorithms = miner.NegotiatedAlgorithms(config.Algorithm, gpuminer.CanHash)
+
+	engine, err := miner.NewEngine(&config)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	provider := engine.Provider()
 
 	hashrateChan := make(chan *miner.HashRate, 10)
 	go miner.RunDefaultHashRateTrackers(hashrateChan)
+	go miner.RunStatsCollector()
+	mineros.HandleResetSignal(miner.ResetStats)
 
 	numMiners := len(config.Threads)
 	miners := make([]miner.Interface, numMiners)
 	gpuContexts := make([]*gpucontext.GPUContext, numMiners)
+	gpuMiners := make([]*gpuminer.GPUMiner, numMiners)
 
 	for i := 0; i < numMiners; i++ {
 		threadInfo := config.Threads[i]
@@ -92,41 +238,135 @@ func main() {
 			}
 			threadInfo.Index = idx
 		}
-		miner := gpuminer.NewGPUMiner(sc, threadInfo.Index, threadInfo.Intensity, threadInfo.WorkSize)
+		miner := gpuminer.NewGPUMiner(provider, threadInfo.Index, threadInfo.Intensity, threadInfo.WorkSize)
+		algo := threadInfo.Algorithm
+		if len(algo) == 0 {
+			algo = config.Algorithm
+		}
+		if err := miner.SetAlgorithm(algo); err != nil {
+			log.Fatalf("miner-%d: %v", miner.Id(), err)
+		}
+		log.Infof("miner-%d: GPU #%d algo %v", miner.Id(), threadInfo.Index, miner.Algorithm())
 		miner.RegisterHashrateListener(hashrateChan)
+		miner.SetMaxHashRate(config.MaxHashRate / float64(numMiners))
 		gpuContexts[i] = miner.Context
 		miners[i] = miner
+		gpuMiners[i] = miner
 		miner.SetDebug(*debug)
+		miner.SetBatchSize(threadInfo.BatchSize)
+		miner.SetPinnedResults(threadInfo.PinnedResults)
+		miner.SetBufferSets(threadInfo.BufferSets)
+		miner.SetPollInterval(time.Duration(threadInfo.PollInterval) * time.Microsecond)
+		miner.SetWarmup(threadInfo.WarmupFraction, time.Duration(threadInfo.WarmupSeconds)*time.Second)
+	}
+
+	if len(*workerTag) != 0 {
+		config.WorkerTag = *workerTag
+	}
+	for i, m := range miners {
+		template := config.Threads[i].WorkerTag
+		if len(template) == 0 {
+			template = config.WorkerTag
+		}
+		if len(template) != 0 {
+			tag := miner.WorkerTag(template, m.Id())
+			log.Infof("miner-%d: Tagging shares as %v", m.Id(), tag)
+			miner.DefaultWorkerTags.SetTag(m.Id(), tag)
+		}
 	}
 
 	if err := amdgpu.InitOpenCL(gpuContexts, numMiners, config.OpenCLPlatform); err != nil {
 		log.Fatalf("Failed to initialize OpenCL: %v", err)
 	}
 
+	banner := miner.NewBanner(&config)
+	banner.CPU, _ = mineros.CPUModel()
+	banner.CPUFeatures, _ = mineros.CPUFeatures()
+	for _, ctx := range gpuContexts {
+		banner.Devices = append(banner.Devices, miner.BannerDevice{Index: ctx.DeviceIndex, Name: ctx.Name, Memory: amdgpu.DeviceMemory(ctx)})
+	}
+	miner.LogBanner(banner)
+
+	gpuminer.ComputeErrorLimit = config.ComputeErrorLimit
+	gpuminer.ComputeErrorIntensityStep = config.ComputeErrorIntensityStep
+	gpuminer.MaxPendingResults = config.MaxPendingResults
 	go gpuminer.RunHashChecker()
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	for i := 0; i < numMiners; i++ {
-		go miners[i].Run()
+	if *stagger > 0 {
+		config.ThreadStagger = *stagger
+	}
+	miner.StartMiners(miners, time.Duration(config.ThreadStagger)*time.Millisecond)
+
+	go miner.NewAlgoSwitcher(config.AlgoPerf, miners).Run()
+
+	if len(*apiAddress) != 0 {
+		config.APIAddress = *apiAddress
+	}
+	if len(config.APIAddress) != 0 {
+		api, err := miner.NewAPIServer(config.APIAddress)
+		if err != nil {
+			log.Fatalf("Failed to start API: %v", err)
+		}
+		gpuminer.RegisterAPI(api, gpuMiners)
+		go api.Run()
+	}
+
+	if config.WatchdogTimeout > 0 {
+		log.Infof("Restarting miners that stall for more than %ds", config.WatchdogTimeout)
+		go miner.NewWatchdog(time.Duration(config.WatchdogTimeout)*time.Second, miners).Run()
+	}
+
+	if *firstShare > 0 {
+		config.FirstShareTimeout = *firstShare
+	}
+	if config.FirstShareTimeout > 0 {
+		go miner.NewFirstShareCheck(time.Duration(config.FirstShareTimeout)*time.Second, config.Algorithm).Run()
+	}
+
+	if config.PauseWhenActive {
+		log.Infof("Pausing miners while the machine is in use, resuming after %ds idle", config.IdleThreshold)
+		go miner.NewIdleGuard(time.Duration(config.IdleThreshold)*time.Second, miners, mineros.UserIdleTime).Run()
 	}
 
 	// responseChan := make(chan *stratum.Response)
 	//
 	// sc.RegisterResponseListener(responseChan)
 
-	pool := config.Pools[0]
-	if err := sc.Connect(pool.Url); err != nil {
-		log.Fatalf("Failed to connect to url :%v  - %v", pool.Url, err)
+	if err := engine.Start(); err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	if err := sc.Authorize(pool.User, pool.Pass); err != nil {
-		log.Fatalf("Failed to authorize with server: %v", err)
+	if config.Retries > 0 {
+		// Let a supervisor decide whether to restart rather than looping forever
+		go func() {
+			<-engine.Exhausted()
+			log.Errorf("Failed to connect to %v in %d attempts, exiting", engine.Pool().Url, config.Retries)
+			os.Exit(miner.ExitReconnectsExhausted)
+		}()
 	}
 
+	if config.RejectThreshold > 0 && len(config.Pools) > 1 {
+		log.Infof("Failing over when more than %.0f%% of shares are rejected", config.RejectThreshold*100)
+		go miner.NewFailover(engine, config.RejectThreshold, time.Duration(config.RejectWindow)*time.Second, time.Duration(config.FailbackCooldown)*time.Second).Run()
+	}
+
+	// Mine until interrupted, then give the shares already found a chance
+	// to be answered. A second interrupt exits right away
+	interrupt := make(chan os.Signal, 2)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	go func() {
+		<-interrupt
+		os.Exit(1)
+	}()
+	if *grace != 0 {
+		config.ShutdownGrace = *grace
+	}
+	if config.ShutdownGrace > 0 {
+		miner.Shutdown(miners, time.Duration(config.ShutdownGrace)*time.Second, gpuminer.PendingResults)
+	}
 	if *cpuprofile != "" {
-		time.Sleep(300 * time.Second)
-	} else {
-		wg.Wait() // blocks forever
+		// The deferred StopCPUProfile writes out the profile
+		log.Infof("Stopping CPU profiling")
 	}
 }
@@ -4,33 +4,81 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin"
 	cpuminer "github.com/gurupras/go-cryptonight-miner/cpu-miner"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	"github.com/gurupras/go-cryptonight-miner/miner"
-	stratum "github.com/gurupras/go-stratum-client"
+	mineros "github.com/gurupras/go-cryptonight-miner/miner-os"
 	colorable "github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
-	yaml "gopkg.in/yaml.v2"
 )
 
 var (
-	app        = kingpin.New("cpuminer", "CPU Cryptonight miner")
-	config     = app.Flag("config-file", "YAML config file").Short('c').String()
-	url        = app.Flag("url", "URL of the pool").Short('o').String()
-	username   = app.Flag("username", "Username (usually the wallet address)").Short('u').String()
-	password   = app.Flag("password", "Password").Short('p').Default("go-cryptonight-miner").String()
-	threads    = app.Flag("threads", "Number of threads to run").Short('t').Default(fmt.Sprintf("%d", runtime.NumCPU())).Int()
-	cpuprofile = app.Flag("cpuprofile", "Run CPU profiler").String()
-	verbose    = app.Flag("verbose", "Enable verbose log messages").Short('v').Bool()
+	app         = kingpin.New("cpuminer", "CPU Cryptonight miner")
+	config      = app.Flag("config-file", "YAML config file").Short('c').String()
+	url         = app.Flag("url", "URL of the pool").Short('o').String()
+	username    = app.Flag("username", "Username (usually the wallet address)").Short('u').String()
+	password    = app.Flag("password", "Password").Short('p').Default("go-cryptonight-miner").String()
+	proxy       = app.Flag("proxy", "Connect through a proxy (socks5://[user:pass@]host:port or unix:///path/to/socket)").Short('x').String()
+	bind        = app.Flag("bind", "Connect to the pool from this local IP address or network interface").String()
+	threads     = app.Flag("threads", "Number of threads to run").Short('t').Default(fmt.Sprintf("%d", runtime.NumCPU())).Int()
+	cpuprofile  = app.Flag("cpuprofile", "Run CPU profiler and write the profile to this file when interrupted").String()
+	pprofListen = app.Flag("pprof-listen", "Serve net/http/pprof profiles on this address").String()
+	maxHashRate = app.Flag("max-hashrate", "Limit the aggregate hashrate to this many H/s").Float64()
+	quiet       = app.Flag("quiet", "Do not log the periodic hashrate lines").Short('q').Bool()
+	printEvery  = app.Flag("print-samples", "Log the hashrate every this many hashrate samples instead of every 30 seconds").Int()
+	workerTag   = app.Flag("worker-tag", "Tag shares with this worker name, {id} is replaced with the thread id").String()
+	rateUnit    = app.Flag("hashrate-unit", "Log the hashrate in H/s, kH/s, MH/s or auto to pick one by the hashrate").String()
+	firstShare  = app.Flag("first-share-timeout", "Warn if no share is accepted this many seconds after connecting").Int()
+	shareLog    = app.Flag("share-log", "Append a JSON record of every submitted share and the response of the pool to this file").String()
+	stagger     = app.Flag("thread-stagger", "Milliseconds to wait between starting one miner thread and the next, to spread out scratchpad allocations").Int()
+	reportPower = app.Flag("report-power", "Read the power draw of the GPUs and CPUs where possible and report the H/s per watt").Bool()
+	grace       = app.Flag("shutdown-grace", "Seconds to wait on shutdown for shares already found to be answered by the pool. A negative value exits right away").Int()
+	retries     = app.Flag("retries", "Exit with code 3 after this many consecutive failed attempts to connect to the pool. 0 retries forever").Int()
+	background  = app.Flag("background", "Run the miner in the background").Short('B').Bool()
+	pidFile     = app.Flag("pid-file", "Write the process id to this file").String()
+	logFile     = app.Flag("log-file", "Write log messages to this file").String()
+	replay      = app.Flag("replay", "Mine the jobs found in a file of captured stratum messages instead of connecting to a pool").String()
+	replayCheck = app.Flag("replay-verify", "Verify the shares found in the replay file and exit").Bool()
+	verbose     = app.Flag("verbose", "Enable verbose log messages").Short('v').Bool()
+	userAgent   = app.Flag("user-agent", "Identify as this agent to the pool").String()
+	maxMemory   = app.Flag("max-memory", "Run only as many threads as fit their scratchpads in this many MB").Int()
+	rxLight     = app.Flag("rx-light", "Hash RandomX in light mode on all threads, against the 256MB cache instead of the 2080MB dataset").Bool()
+	apiAddress  = app.Flag("api-bind", "Serve the status and control API on this address").String()
+	sweep       = app.Flag("benchmark-sweep", "Measure the hashrate with 1 up to --threads threads, recommend a thread count and exit").Bool()
+	sweepTime   = app.Flag("benchmark-time", "Seconds to measure each thread count for in --benchmark-sweep").Default("20").Int()
+	benchJSON   = app.Flag("benchmark-json", "Write the results of --benchmark-sweep as JSON to this file, - for stdout").String()
+	benchBase   = app.Flag("benchmark-baseline", "Fail if the hashrate of --benchmark-sweep regressed compared to this JSON report").String()
+	benchThresh = app.Flag("benchmark-threshold", "Fraction the hashrate may drop below --benchmark-baseline before failing").Default("0.05").Float64()
+	stdin       = app.Flag("stdin", "Read '<blob> <target>' jobs from stdin and print the first nonce and hash found for each").Bool()
+	jobTimeout  = app.Flag("timeout", "Seconds to search for a nonce for each job read with --stdin. 0 means no timeout").Default("0").Int()
+	nonceOffset = app.Flag("nonce-offset", "Start mining at this nonce, to shard the nonce space among rigs").Uint64()
+	nonceStride = app.Flag("nonce-stride", "Mine this many nonces from --nonce-offset. Must fit in the low 24 bits with nicehash").Uint64()
+
+	mineCmd     = app.Command("mine", "Mine on the configured pool").Default()
+	verifyCmd   = app.Command("verify", "Hash a blob with a nonce and check the hash against the expected one, e.g. of a rejected share")
+	verifyBlob  = verifyCmd.Arg("blob", "Hashing blob in hex").Required().String()
+	verifyNonce = verifyCmd.Arg("nonce", "Nonce in hex, as submitted to the pool").Required().String()
+	verifyHash  = verifyCmd.Arg("hash", "Expected hash in hex").Required().String()
+	verifyAlgo  = verifyCmd.Flag("algo", "Algorithm to hash with").Default(miner.DefaultAlgorithm).String()
+	verifyHt    = verifyCmd.Flag("height", "Block height of the job, for cn/r").Uint64()
+	testPoolCmd = app.Command("test-pool", "Connect to each configured pool in turn and compare their connect time, latency and difficulty")
+	testPings   = testPoolCmd.Flag("pings", "Number of keepalive round trips to time on each pool").Default(fmt.Sprintf("%d", miner.DefaultProbePings)).Int()
+
+	benchCmd     = app.Command("benchmark", "Measure the hashrate of the threads with every algorithm, print a table of them and exit")
+	benchSeconds = benchCmd.Flag("seconds", "Seconds to measure each algorithm for").Default("20").Int()
+	benchAlgos   = benchCmd.Flag("algo", "Algorithm to measure, can be repeated. Defaults to all algorithms the CPU miner implements").Strings()
 )
 
 func main() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+	benchmark := command == benchCmd.FullCommand()
 
 	if *verbose {
 		log.SetLevel(log.DebugLevel)
@@ -55,7 +103,85 @@ func main() {
 
 	// Start all logic here
 
-	if len(*config) == 0 {
+	if command == verifyCmd.FullCommand() {
+		v, err := cpuminer.VerifyShare(*verifyAlgo, *verifyBlob, *verifyNonce, *verifyHash, *verifyHt)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(v)
+		if !v.Match {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *sweep {
+		log.Infof("benchmark: Measuring up to %d threads, %ds each", *threads, *sweepTime)
+		results, err := cpuminer.BenchmarkSweep(*threads, time.Duration(*sweepTime)*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to run benchmark: %v", err)
+		}
+		cpuminer.WriteSweepTable(os.Stdout, results)
+		if *benchJSON == "" && *benchBase == "" {
+			return
+		}
+		cpu, err := mineros.CPUModel()
+		if err != nil {
+			log.Warnf("Failed to get the CPU model: %v", err)
+		}
+		report := cpuminer.NewBenchmarkReport(results, miner.DefaultAlgorithm, cpu)
+		if *benchJSON != "" {
+			if err := writeBenchmarkReport(*benchJSON, report); err != nil {
+				log.Fatalf("Failed to write benchmark report: %v", err)
+			}
+		}
+		if *benchBase != "" {
+			f, err := os.Open(*benchBase)
+			if err != nil {
+				log.Fatalf("Failed to open benchmark baseline: %v", err)
+			}
+			baseline, err := cpuminer.ReadBenchmarkReport(f)
+			f.Close()
+			if err != nil {
+				log.Fatalf("Failed to read benchmark baseline: %v", err)
+			}
+			if err := cpuminer.CompareBenchmarks(baseline, report, *benchThresh); err != nil {
+				log.Fatalf("%v", err)
+			}
+			log.Infof("benchmark: No regression compared to %v", *benchBase)
+		}
+		return
+	}
+
+	if *stdin {
+		solver, err := cpuminer.NewSolver(*threads)
+		if err != nil {
+			log.Fatalf("Failed to set up hashing: %v", err)
+		}
+		if err := solver.SolveJobs(os.Stdin, os.Stdout, time.Duration(*jobTimeout)*time.Second); err != nil {
+			log.Fatalf("Failed to read jobs: %v", err)
+		}
+		return
+	}
+
+	if len(*replay) != 0 && *replayCheck {
+		f, err := os.Open(*replay)
+		if err != nil {
+			log.Fatalf("Failed to open replay file: %v", err)
+		}
+		matched, mismatched, err := cpuminer.VerifyCapture(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to read replay file: %v", err)
+		}
+		log.Infof("replay: %d shares matched, %d did not", matched, mismatched)
+		if mismatched > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(*config) == 0 && len(*replay) == 0 && !benchmark {
 		if len(*url) == 0 || len(*username) == 0 {
 			log.Fatalf("Must specify config or url, username and password")
 		}
@@ -84,14 +210,172 @@ pools:
 		log.Debugf("minConfig: %v", minConfig)
 	}
 	var config miner.Config
-	if err := yaml.Unmarshal(configData, &config); err != nil {
+	warnings, err := miner.ParseConfig(configData, &config)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
 		log.Fatalf("Failed to parse yaml into valid config: %v", err)
 	}
+	if err := config.LoadCredentials(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	warnings, err = config.CheckMinerSections(true, false)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	miner.SetupColors(config.Colors)
+	if *quiet {
+		config.Quiet = true
+	}
+	miner.SetQuiet(config.Quiet)
+	if *printEvery > 0 {
+		config.PrintSamples = *printEvery
+	}
+	miner.SetPrintSamples(config.PrintSamples)
+	if len(*rateUnit) != 0 {
+		config.HashRateUnit = *rateUnit
+	}
+	if len(config.HashRateUnit) != 0 {
+		if err := miner.SetHashRateUnit(config.HashRateUnit); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if len(*pprofListen) != 0 {
+		config.PprofAddress = *pprofListen
+	}
+	if len(config.PprofAddress) != 0 {
+		if err := miner.StartPprof(config.PprofAddress); err != nil {
+			log.Fatalf("Failed to start pprof: %v", err)
+		}
+	}
+	if len(*userAgent) != 0 {
+		config.UserAgent = *userAgent
+	}
+	if len(config.UserAgent) != 0 {
+		miner.Agent = config.UserAgent
+	}
+
+	if command == testPoolCmd.FullCommand() {
+		if len(*proxy) != 0 {
+			config.Proxy = *proxy
+		}
+		if len(*bind) != 0 {
+			config.BindAddress = *bind
+		}
+		probes, err := miner.ProbePools(&config, *testPings)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		miner.WritePoolProbes(os.Stdout, probes)
+		return
+	}
+
+	if len(*logFile) != 0 {
+		config.LogFile = logFile
+	}
+
+	if *background {
+		config.Background = true
+	}
+	if len(*pidFile) != 0 {
+		config.PIDFile = *pidFile
+	}
+
+	if config.Background && !mineros.IsDaemon() && !benchmark {
+		if config.LogFile == nil {
+			log.Warnf("Running in background without a log file, log messages will be discarded")
+		}
+		pid, err := mineros.Daemonize()
+		if err != nil {
+			log.Fatalf("Failed to run in background: %v", err)
+		}
+		log.Infof("Running in background with pid %d", pid)
+		return
+	}
+
+	if f, err := miner.SetupLogFile(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
 
-	sc := stratum.New()
+	miner.SetupSyslog(&config)
+
+	if len(*shareLog) != 0 {
+		config.ShareLog = *shareLog
+	}
+	if *retries > 0 {
+		config.Retries = *retries
+	}
+	if f, err := miner.SetupShareLog(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
+	if config.MinShareDifficulty > 0 {
+		log.Infof("Only submitting shares of at least diff %d", config.MinShareDifficulty)
+		miner.SetSubmitPolicy(miner.NewMinDifficultyPolicy(config.MinShareDifficulty))
+	}
+	if *reportPower {
+		config.ReportPower = true
+	}
+	if config.ReportPower {
+		meters := make([]miner.PowerMeter, 0)
+		for _, meter := range mineros.PowerMeters() {
+			log.Infof("Reading the power draw of %v", meter.Name())
+			meters = append(meters, meter)
+		}
+		if len(meters) == 0 {
+			log.Warnf("The power draw can't be read, not reporting efficiency")
+		}
+		miner.DefaultPowerTracker.SetMeters(meters)
+	}
+
+	if len(config.PIDFile) != 0 {
+		if err := mineros.WritePIDFile(config.PIDFile); err != nil {
+			log.Fatalf("Failed to write PID file: %v", err)
+		}
+		defer os.Remove(config.PIDFile)
+	}
+
+	cpuAlgo := config.CPUAlgorithm
+	if len(cpuAlgo) == 0 {
+		cpuAlgo = config.Algorithm
+	}
+	miner.LoginAlgorithms = miner.NegotiatedAlgorithms(cpuAlgo, cpuminer.CanHash)
+
+	var (
+		provider     miner.WorkProvider
+		engine       *miner.Engine
+		replaySource *miner.ReplaySource
+	)
+	if benchmark {
+		// Benchmarks hash a job of their own rather than connecting to the pool
+		provider = miner.NewBenchmarkSource()
+	} else if len(*replay) != 0 {
+		f, err := os.Open(*replay)
+		if err != nil {
+			log.Fatalf("Failed to open replay file: %v", err)
+		}
+		defer f.Close()
+		replaySource = miner.NewReplaySource(f, 10*time.Second)
+		provider = replaySource
+	} else {
+		var err error
+		if engine, err = miner.NewEngine(&config); err != nil {
+			log.Fatalf("%v", err)
+		}
+		provider = engine.Provider()
+	}
 
 	hashrateChan := make(chan *miner.HashRate, 10)
 	go miner.RunDefaultHashRateTrackers(hashrateChan)
+	go miner.RunStatsCollector()
+	mineros.HandleResetSignal(miner.ResetStats)
 
 	if config.CPUThreads == 0 {
 		if *threads != 0 {
@@ -101,37 +385,195 @@ pools:
 		}
 	}
 
+	if *maxHashRate > 0 {
+		config.MaxHashRate = *maxHashRate
+	}
+
+	if *maxMemory > 0 {
+		config.MaxMemory = *maxMemory
+	}
+	if *rxLight {
+		config.CPURandomXModes = []string{miner.RandomXLight}
+	}
+	if threads := miner.FitThreads(config.CPUThreads, cpuAlgo, config.MaxMemory); threads != config.CPUThreads {
+		log.Warnf("Reducing threads from %d to %d to fit %v scratchpads in %dMB", config.CPUThreads, threads, cpuAlgo, config.MaxMemory)
+		config.CPUThreads = threads
+	}
+
+	if *nonceOffset != 0 {
+		config.NonceOffset = *nonceOffset
+	}
+	if *nonceStride != 0 {
+		config.NonceStride = *nonceStride
+	}
+	if err := config.ApplyNonceShard(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	numMiners := config.CPUThreads
+	if err := mineros.ReserveHugePages(cpuminer.HugePagesSize(uint32(numMiners), uint32(config.CPURandomXLightThreads(numMiners)), cpuAlgo)); err != nil {
+		log.Warnf("Huge pages: %v", err)
+	}
 	miners := make([]miner.Interface, numMiners)
 	for i := 0; i < numMiners; i++ {
-		miner := cpuminer.NewXMRigCPUMiner(sc)
+		miner := cpuminer.NewSwitchingCPUMiner(provider, config.CPURandomXMode(i) == miner.RandomXLight)
+		if err := miner.SetAlgorithm(cpuAlgo); err != nil {
+			log.Fatalf("miner-%d: %v", miner.Id(), err)
+		}
+		log.Infof("miner-%d: algo %v", miner.Id(), miner.Algorithm())
 		miner.RegisterHashrateListener(hashrateChan)
+		miner.SetMaxHashRate(config.MaxHashRate / float64(numMiners))
 		miners[i] = miner
 	}
 	log.Infof("# Threads: %v", numMiners)
+	if len(*workerTag) != 0 {
+		config.WorkerTag = *workerTag
+	}
+	if len(config.WorkerTag) != 0 {
+		for _, m := range miners {
+			tag := miner.WorkerTag(config.WorkerTag, m.Id())
+			log.Infof("miner-%d: Tagging shares as %v", m.Id(), tag)
+			miner.DefaultWorkerTags.SetTag(m.Id(), tag)
+		}
+	}
+	if err := cpuminer.SetupMemory(cpuAlgo); err != nil {
+		log.Fatalf("Failed to allocate hugepages: %v", err)
+	}
+	banner := miner.NewBanner(&config)
+	banner.Algorithm = cpuAlgo
+	banner.Threads = numMiners
+	banner.CPU, _ = mineros.CPUModel()
+	banner.CPUFeatures, _ = mineros.CPUFeatures()
+	banner.HugePages = "unavailable"
+	if xmrig_crypto.HugePagesEnabled() {
+		banner.HugePages = "enabled"
+	}
+	miner.LogBanner(banner)
+	if config.MaxHashRate > 0 {
+		log.Infof("Limiting hashrate to %vH/s", config.MaxHashRate)
+	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	for i := 0; i < numMiners; i++ {
-		go miners[i].Run()
+	if *stagger > 0 {
+		config.ThreadStagger = *stagger
+	}
+	if benchmark {
+		runBenchmark(miners, &config)
+		return
+	}
+	miner.StartMiners(miners, time.Duration(config.ThreadStagger)*time.Millisecond)
+
+	go miner.NewAlgoSwitcher(config.AlgoPerf, miners).Run()
+
+	if len(*apiAddress) != 0 {
+		config.APIAddress = *apiAddress
+	}
+	if len(config.APIAddress) != 0 {
+		api, err := miner.NewAPIServer(config.APIAddress)
+		if err != nil {
+			log.Fatalf("Failed to start API: %v", err)
+		}
+		go api.Run()
+	}
+
+	if config.WatchdogTimeout > 0 {
+		log.Infof("Restarting miners that stall for more than %ds", config.WatchdogTimeout)
+		go miner.NewWatchdog(time.Duration(config.WatchdogTimeout)*time.Second, miners).Run()
+	}
+
+	if *firstShare > 0 {
+		config.FirstShareTimeout = *firstShare
+	}
+	if config.FirstShareTimeout > 0 {
+		go miner.NewFirstShareCheck(time.Duration(config.FirstShareTimeout)*time.Second, config.Algorithm).Run()
 	}
 
 	// responseChan := make(chan *stratum.Response)
 	//
 	// sc.RegisterResponseListener(responseChan)
 
-	pool := config.Pools[0]
-	if err := sc.Connect(pool.Url); err != nil {
-		log.Fatalf("Failed to connect to url :%v  - %v", *url, err)
+	if len(*proxy) != 0 {
+		config.Proxy = *proxy
+	}
+	if len(*bind) != 0 {
+		config.BindAddress = *bind
+	}
+
+	if replaySource != nil {
+		log.Infof("Replaying jobs from %v", *replay)
+		if err := replaySource.Run(); err != nil {
+			log.Fatalf("Failed to read replay file: %v", err)
+		}
+		log.Infof("replay: Done")
+		return
+	} else if err := engine.Start(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if config.Retries > 0 {
+		// Let a supervisor decide whether to restart rather than looping forever
+		go func() {
+			<-engine.Exhausted()
+			log.Errorf("Failed to connect to %v in %d attempts, exiting", engine.Pool().Url, config.Retries)
+			os.Exit(miner.ExitReconnectsExhausted)
+		}()
 	}
 
-	if err := sc.Authorize(pool.User, pool.Pass); err != nil {
-		log.Fatalf("Failed to authorize with server: %v", err)
+	if config.RejectThreshold > 0 && len(config.Pools) > 1 {
+		log.Infof("Failing over when more than %.0f%% of shares are rejected", config.RejectThreshold*100)
+		go miner.NewFailover(engine, config.RejectThreshold, time.Duration(config.RejectWindow)*time.Second, time.Duration(config.FailbackCooldown)*time.Second).Run()
 	}
 
+	// Mine until interrupted, then give the shares already found a chance
+	// to be answered. A second interrupt exits right away
+	interrupt := make(chan os.Signal, 2)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	go func() {
+		<-interrupt
+		os.Exit(1)
+	}()
+	if *grace != 0 {
+		config.ShutdownGrace = *grace
+	}
+	if config.ShutdownGrace > 0 {
+		miner.Shutdown(miners, time.Duration(config.ShutdownGrace)*time.Second, nil)
+	}
 	if *cpuprofile != "" {
-		time.Sleep(300 * time.Second)
-	} else {
-		wg.Wait() // blocks forever
+		// The deferred StopCPUProfile writes out the profile
+		log.Infof("Stopping CPU profiling")
+	}
+}
+
+// writeBenchmarkReport writes report to path, or to stdout if path is -
+func writeBenchmarkReport(path string, report *cpuminer.BenchmarkReport) error {
+	if path == "-" {
+		return cpuminer.WriteBenchmarkReport(os.Stdout, report)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cpuminer.WriteBenchmarkReport(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runBenchmark measures the hashrate of all the miners together with every
+// algorithm, and prints a table of it
+func runBenchmark(miners []miner.Interface, config *miner.Config) {
+	algos := *benchAlgos
+	if len(algos) == 0 {
+		for _, algo := range miner.SupportedAlgorithms {
+			if cpuminer.CanHash(algo) {
+				algos = append(algos, algo)
+			}
+		}
 	}
+	columns := []miner.BenchmarkColumn{{Name: "CPU", Miners: miners, CanHash: cpuminer.CanHash}}
+	benchmark := miner.NewBenchmark(columns, config.AlgoPerf, time.Duration(*benchSeconds)*time.Second)
+	miner.StartMiners(miners, time.Duration(config.ThreadStagger)*time.Millisecond)
+	results := benchmark.Run(algos)
+	miner.WriteBenchmarkTable(os.Stdout, []string{"CPU"}, results)
 }
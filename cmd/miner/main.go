@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	cpuminer "github.com/gurupras/go-cryptonight-miner/cpu-miner"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	gpuminer "github.com/gurupras/go-cryptonight-miner/gpu-miner"
+	amdgpu "github.com/gurupras/go-cryptonight-miner/gpu-miner/amd"
+	"github.com/gurupras/go-cryptonight-miner/gpu-miner/gpucontext"
+	miner "github.com/gurupras/go-cryptonight-miner/miner"
+	mineros "github.com/gurupras/go-cryptonight-miner/miner-os"
+	colorable "github.com/mattn/go-colorable"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	app         = kingpin.New("miner", "CPU and GPU Cryptonight miner")
+	config      = app.Flag("config-file", "YAML config file").Short('c').Required().String()
+	verbose     = app.Flag("verbose", "Enable verbose log messages").Short('v').Bool()
+	debug       = app.Flag("debug", "Enable miner debugging log messages").Short('d').Default("false").Bool()
+	useC        = app.Flag("use C", "Use C functions to intialize OpenCL  rather than Golang").Short('C').Default("false").Bool()
+	cpuThreads  = app.Flag("cpu-threads", "Number of CPU threads to run alongside the GPU threads of the config").Short('t').Int()
+	cpuprofile  = app.Flag("cpuprofile", "Run CPU profiler and write the profile to this file when interrupted").String()
+	pprofListen = app.Flag("pprof-listen", "Serve net/http/pprof profiles on this address").String()
+	maxHashRate = app.Flag("max-hashrate", "Limit the aggregate hashrate to this many H/s").Float64()
+	maxMemory   = app.Flag("max-memory", "Run only as many CPU threads as fit their scratchpads in this many MB").Int()
+	rxLight     = app.Flag("rx-light", "Hash RandomX in light mode on all CPU threads, against the 256MB cache instead of the 2080MB dataset").Bool()
+	quiet       = app.Flag("quiet", "Do not log the periodic hashrate lines").Short('q').Bool()
+	printEvery  = app.Flag("print-samples", "Log the hashrate every this many hashrate samples instead of every 30 seconds").Int()
+	workerTag   = app.Flag("worker-tag", "Tag shares with this worker name, {id} is replaced with the thread id").String()
+	rateUnit    = app.Flag("hashrate-unit", "Log the hashrate in H/s, kH/s, MH/s or auto to pick one by the hashrate").String()
+	firstShare  = app.Flag("first-share-timeout", "Warn if no share is accepted this many seconds after connecting").Int()
+	shareLog    = app.Flag("share-log", "Append a JSON record of every submitted share and the response of the pool to this file").String()
+	stagger     = app.Flag("thread-stagger", "Milliseconds to wait between starting one miner thread and the next, to spread out scratchpad allocations").Int()
+	reportPower = app.Flag("report-power", "Read the power draw of the GPUs and CPUs where possible and report the H/s per watt").Bool()
+	grace       = app.Flag("shutdown-grace", "Seconds to wait on shutdown for shares already found to be answered by the pool. A negative value exits right away").Int()
+	retries     = app.Flag("retries", "Exit with code 3 after this many consecutive failed attempts to connect to the pool. 0 retries forever").Int()
+	pauseActive = app.Flag("pause-when-active", "Pause mining while the machine is in use").Bool()
+	userAgent   = app.Flag("user-agent", "Identify as this agent to the pool").String()
+	apiAddress  = app.Flag("api-bind", "Serve the status and control API on this address").String()
+	nonceOffset = app.Flag("nonce-offset", "Start mining at this nonce, to shard the nonce space among rigs").Uint64()
+	nonceStride = app.Flag("nonce-stride", "Mine this many nonces from --nonce-offset. Must fit in the low 24 bits with nicehash").Uint64()
+
+	mineCmd      = app.Command("mine", "Mine on the configured pool").Default()
+	benchCmd     = app.Command("benchmark", "Measure the hashrate of the CPU threads and of each GPU thread of the config with every algorithm, print a table of them and exit")
+	benchSeconds = benchCmd.Flag("seconds", "Seconds to measure each algorithm for").Default("20").Int()
+	benchAlgos   = benchCmd.Flag("algo", "Algorithm to measure, can be repeated. Defaults to all supported algorithms").Strings()
+)
+
+func main() {
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+	benchmark := command == benchCmd.FullCommand()
+
+	if runtime.GOOS == "windows" {
+		log.SetFormatter(&log.TextFormatter{ForceColors: true})
+		log.SetOutput(colorable.NewColorableStdout())
+	}
+
+	amdgpu.UseC = *useC
+
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			log.Fatalf("Failed to create cpuprofile file: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("Failed to start CPU profile: %v", err)
+		}
+		log.Infof("Starting CPU profiling")
+		defer pprof.StopCPUProfile()
+	}
+
+	// Parse config file and extract necessary fields
+	configData, err := ioutil.ReadFile(*config)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+	var config miner.Config
+	warnings, err := miner.ParseConfig(configData, &config)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
+		log.Fatalf("Failed to parse yaml into valid config: %v", err)
+	}
+	if err := config.LoadCredentials(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *cpuThreads > 0 {
+		config.CPUThreads = *cpuThreads
+	}
+	// Mine on the CPU alone rather than not at all when there are no GPUs
+	if len(config.Threads) > 0 {
+		if err := amdgpu.CheckDevices(config.OpenCLPlatform); err != nil {
+			log.Warnf("%v", err)
+			config.Threads = nil
+			if config.CPUThreads == 0 {
+				config.CPUThreads = runtime.NumCPU()
+			}
+			log.Warnf("Falling back to mining on %d CPU threads", config.CPUThreads)
+		}
+	}
+	warnings, err = config.CheckMinerSections(true, true)
+	for _, warning := range warnings {
+		log.Warnf("Config: %v", warning)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	miner.SetupColors(config.Colors)
+	if *quiet {
+		config.Quiet = true
+	}
+	miner.SetQuiet(config.Quiet)
+	if *printEvery > 0 {
+		config.PrintSamples = *printEvery
+	}
+	miner.SetPrintSamples(config.PrintSamples)
+	if len(*rateUnit) != 0 {
+		config.HashRateUnit = *rateUnit
+	}
+	if len(config.HashRateUnit) != 0 {
+		if err := miner.SetHashRateUnit(config.HashRateUnit); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if len(*pprofListen) != 0 {
+		config.PprofAddress = *pprofListen
+	}
+	if len(config.PprofAddress) != 0 {
+		if err := miner.StartPprof(config.PprofAddress); err != nil {
+			log.Fatalf("Failed to start pprof: %v", err)
+		}
+	}
+	if len(*userAgent) != 0 {
+		config.UserAgent = *userAgent
+	}
+	if len(config.UserAgent) != 0 {
+		miner.Agent = config.UserAgent
+	}
+	if *pauseActive {
+		config.PauseWhenActive = true
+	}
+
+	if config.Background && !mineros.IsDaemon() && !benchmark {
+		if config.LogFile == nil {
+			log.Warnf("Running in background without a log file, log messages will be discarded")
+		}
+		pid, err := mineros.Daemonize()
+		if err != nil {
+			log.Fatalf("Failed to run in background: %v", err)
+		}
+		log.Infof("Running in background with pid %d", pid)
+		return
+	}
+
+	if f, err := miner.SetupLogFile(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
+
+	miner.SetupSyslog(&config)
+
+	if len(*shareLog) != 0 {
+		config.ShareLog = *shareLog
+	}
+	if *retries > 0 {
+		config.Retries = *retries
+	}
+	if f, err := miner.SetupShareLog(&config); err != nil {
+		log.Fatalf("%v", err)
+	} else if f != nil {
+		defer f.Close()
+	}
+	if config.MinShareDifficulty > 0 {
+		log.Infof("Only submitting shares of at least diff %d", config.MinShareDifficulty)
+		miner.SetSubmitPolicy(miner.NewMinDifficultyPolicy(config.MinShareDifficulty))
+	}
+	if *reportPower {
+		config.ReportPower = true
+	}
+	if config.ReportPower {
+		meters := make([]miner.PowerMeter, 0)
+		for _, meter := range mineros.PowerMeters() {
+			log.Infof("Reading the power draw of %v", meter.Name())
+			meters = append(meters, meter)
+		}
+		if len(meters) == 0 {
+			log.Warnf("The power draw can't be read, not reporting efficiency")
+		}
+		miner.DefaultPowerTracker.SetMeters(meters)
+	}
+
+	if len(config.PIDFile) != 0 {
+		if err := mineros.WritePIDFile(config.PIDFile); err != nil {
+			log.Fatalf("Failed to write PID file: %v", err)
+		}
+		defer os.Remove(config.PIDFile)
+	}
+
+	if *maxHashRate > 0 {
+		config.MaxHashRate = *maxHashRate
+	}
+	if *nonceOffset != 0 {
+		config.NonceOffset = *nonceOffset
+	}
+	if *nonceStride != 0 {
+		config.NonceStride = *nonceStride
+	}
+	if err := config.ApplyNonceShard(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	cpuAlgo := config.CPUAlgorithm
+	if len(cpuAlgo) == 0 {
+		cpuAlgo = config.Algorithm
+	}
+	if *maxMemory > 0 {
+		config.MaxMemory = *maxMemory
+	}
+	if *rxLight {
+		config.CPURandomXModes = []string{miner.RandomXLight}
+	}
+	if config.CPUThreads > 0 {
+		if threads := miner.FitThreads(config.CPUThreads, cpuAlgo, config.MaxMemory); threads != config.CPUThreads {
+			log.Warnf("Reducing CPU threads from %d to %d to fit %v scratchpads in %dMB", config.CPUThreads, threads, cpuAlgo, config.MaxMemory)
+			config.CPUThreads = threads
+		}
+	}
+
+	// Offer the pool the algorithms that either the GPUs or the CPU can hash
+	miner.LoginAlgorithms = miner.NegotiatedAlgorithms(config.Algorithm, func(algo string) bool {
+		return (len(config.Threads) > 0 && gpuminer.CanHash(algo)) || (config.CPUThreads > 0 && cpuminer.CanHash(algo))
+	})
+
+	// Benchmarks hash a job of their own rather than connecting to the pool
+	var (
+		engine   *miner.Engine
+		provider miner.WorkProvider
+	)
+	if benchmark {
+		provider = miner.NewBenchmarkSource()
+	} else {
+		if engine, err = miner.NewEngine(&config); err != nil {
+			log.Fatalf("%v", err)
+		}
+		provider = engine.Provider()
+	}
+
+	// All miners feed one set of trackers, and the hashrate of the CPU and
+	// the GPU miners is broken down after the hashrate lines
+	hashrateChan := make(chan *miner.HashRate, 10)
+	cpuHashrateChan := miner.NewHashRateGroup("cpu", hashrateChan)
+	gpuHashrateChan := miner.NewHashRateGroup("gpu", hashrateChan)
+	go miner.RunDefaultHashRateTrackers(hashrateChan)
+	go miner.RunStatsCollector()
+	mineros.HandleResetSignal(miner.ResetStats)
+
+	numGPUMiners := len(config.Threads)
+	numCPUMiners := config.CPUThreads
+	numMiners := numGPUMiners + numCPUMiners
+	miners := make([]miner.Interface, 0, numMiners)
+	gpuContexts := make([]*gpucontext.GPUContext, numGPUMiners)
+	gpuMiners := make([]*gpuminer.GPUMiner, numGPUMiners)
+	// Worker tag templates of the miners, by their position in miners
+	tagTemplates := make([]string, 0, numMiners)
+
+	if len(*workerTag) != 0 {
+		config.WorkerTag = *workerTag
+	}
+
+	for i := 0; i < numGPUMiners; i++ {
+		threadInfo := config.Threads[i]
+		if threadInfo.DeviceIndex != nil {
+			// We need to figure out the Index for this thread via OpenCL using
+			// something akin to clinfo to find the BDF (Bus, Device, Function)
+			instanceId := config.DeviceInstanceIDs[*threadInfo.DeviceIndex]
+			// First get the PCI Bus, Device, Function from the system for this instance
+			topology, err := mineros.GetPCITopology(instanceId)
+			if err != nil {
+				log.Fatalf("Failed to get topology information for device-instance-id: '%v'", instanceId)
+			}
+			// Now call OpenCL commands to find the device that matches this topology
+			idx, err := amdgpu.FindIndexMatchingTopology(topology)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			threadInfo.Index = idx
+		}
+		miner := gpuminer.NewGPUMiner(provider, threadInfo.Index, threadInfo.Intensity, threadInfo.WorkSize)
+		algo := threadInfo.Algorithm
+		if len(algo) == 0 {
+			algo = config.Algorithm
+		}
+		if err := miner.SetAlgorithm(algo); err != nil {
+			log.Fatalf("miner-%d: %v", miner.Id(), err)
+		}
+		log.Infof("miner-%d: GPU #%d algo %v", miner.Id(), threadInfo.Index, miner.Algorithm())
+		miner.RegisterHashrateListener(gpuHashrateChan)
+		miner.SetMaxHashRate(config.MaxHashRate / float64(numMiners))
+		gpuContexts[i] = miner.Context
+		gpuMiners[i] = miner
+		miners = append(miners, miner)
+		miner.SetDebug(*debug)
+		miner.SetBatchSize(threadInfo.BatchSize)
+		miner.SetPinnedResults(threadInfo.PinnedResults)
+		miner.SetBufferSets(threadInfo.BufferSets)
+		miner.SetPollInterval(time.Duration(threadInfo.PollInterval) * time.Microsecond)
+		miner.SetWarmup(threadInfo.WarmupFraction, time.Duration(threadInfo.WarmupSeconds)*time.Second)
+		template := threadInfo.WorkerTag
+		if len(template) == 0 {
+			template = config.WorkerTag
+		}
+		tagTemplates = append(tagTemplates, template)
+	}
+
+	if numCPUMiners > 0 {
+		if err := mineros.ReserveHugePages(cpuminer.HugePagesSize(uint32(numCPUMiners), uint32(config.CPURandomXLightThreads(numCPUMiners)), cpuAlgo)); err != nil {
+			log.Warnf("Huge pages: %v", err)
+		}
+	}
+	for i := 0; i < numCPUMiners; i++ {
+		miner := cpuminer.NewSwitchingCPUMiner(provider, config.CPURandomXMode(i) == miner.RandomXLight)
+		if err := miner.SetAlgorithm(cpuAlgo); err != nil {
+			log.Fatalf("miner-%d: %v", miner.Id(), err)
+		}
+		log.Infof("miner-%d: CPU algo %v", miner.Id(), miner.Algorithm())
+		miner.RegisterHashrateListener(cpuHashrateChan)
+		miner.SetMaxHashRate(config.MaxHashRate / float64(numMiners))
+		miners = append(miners, miner)
+		tagTemplates = append(tagTemplates, config.WorkerTag)
+	}
+	log.Infof("# Threads: %d GPU, %d CPU", numGPUMiners, numCPUMiners)
+
+	for i, m := range miners {
+		if template := tagTemplates[i]; len(template) != 0 {
+			tag := miner.WorkerTag(template, m.Id())
+			log.Infof("miner-%d: Tagging shares as %v", m.Id(), tag)
+			miner.DefaultWorkerTags.SetTag(m.Id(), tag)
+		}
+	}
+
+	if numGPUMiners > 0 {
+		if err := amdgpu.InitOpenCL(gpuContexts, numGPUMiners, config.OpenCLPlatform); err != nil {
+			log.Fatalf("Failed to initialize OpenCL: %v", err)
+		}
+	}
+	if numCPUMiners > 0 {
+		if err := cpuminer.SetupMemory(cpuAlgo); err != nil {
+			log.Fatalf("Failed to allocate hugepages: %v", err)
+		}
+	}
+
+	banner := miner.NewBanner(&config)
+	banner.Threads = numCPUMiners
+	banner.CPU, _ = mineros.CPUModel()
+	banner.CPUFeatures, _ = mineros.CPUFeatures()
+	if numCPUMiners > 0 {
+		banner.HugePages = "unavailable"
+		if xmrig_crypto.HugePagesEnabled() {
+			banner.HugePages = "enabled"
+		}
+	}
+	for _, ctx := range gpuContexts {
+		banner.Devices = append(banner.Devices, miner.BannerDevice{Index: ctx.DeviceIndex, Name: ctx.Name, Memory: amdgpu.DeviceMemory(ctx)})
+	}
+	miner.LogBanner(banner)
+	if config.MaxHashRate > 0 {
+		log.Infof("Limiting hashrate to %vH/s", config.MaxHashRate)
+	}
+
+	if numGPUMiners > 0 {
+		gpuminer.ComputeErrorLimit = config.ComputeErrorLimit
+		gpuminer.ComputeErrorIntensityStep = config.ComputeErrorIntensityStep
+		gpuminer.MaxPendingResults = config.MaxPendingResults
+		go gpuminer.RunHashChecker()
+	}
+
+	if *stagger > 0 {
+		config.ThreadStagger = *stagger
+	}
+	if benchmark {
+		runBenchmark(miners, numGPUMiners, gpuContexts, &config)
+		return
+	}
+	miner.StartMiners(miners, time.Duration(config.ThreadStagger)*time.Millisecond)
+
+	go miner.NewAlgoSwitcher(config.AlgoPerf, miners).Run()
+
+	if len(*apiAddress) != 0 {
+		config.APIAddress = *apiAddress
+	}
+	if len(config.APIAddress) != 0 {
+		api, err := miner.NewAPIServer(config.APIAddress)
+		if err != nil {
+			log.Fatalf("Failed to start API: %v", err)
+		}
+		gpuminer.RegisterAPI(api, gpuMiners)
+		go api.Run()
+	}
+
+	if config.WatchdogTimeout > 0 {
+		log.Infof("Restarting miners that stall for more than %ds", config.WatchdogTimeout)
+		go miner.NewWatchdog(time.Duration(config.WatchdogTimeout)*time.Second, miners).Run()
+	}
+
+	if *firstShare > 0 {
+		config.FirstShareTimeout = *firstShare
+	}
+	if config.FirstShareTimeout > 0 {
+		go miner.NewFirstShareCheck(time.Duration(config.FirstShareTimeout)*time.Second, config.Algorithm).Run()
+	}
+
+	if config.PauseWhenActive {
+		log.Infof("Pausing miners while the machine is in use, resuming after %ds idle", config.IdleThreshold)
+		go miner.NewIdleGuard(time.Duration(config.IdleThreshold)*time.Second, miners, mineros.UserIdleTime).Run()
+	}
+
+	if err := engine.Start(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if config.Retries > 0 {
+		// Let a supervisor decide whether to restart rather than looping forever
+		go func() {
+			<-engine.Exhausted()
+			log.Errorf("Failed to connect to %v in %d attempts, exiting", engine.Pool().Url, config.Retries)
+			os.Exit(miner.ExitReconnectsExhausted)
+		}()
+	}
+
+	if config.RejectThreshold > 0 && len(config.Pools) > 1 {
+		log.Infof("Failing over when more than %.0f%% of shares are rejected", config.RejectThreshold*100)
+		go miner.NewFailover(engine, config.RejectThreshold, time.Duration(config.RejectWindow)*time.Second, time.Duration(config.FailbackCooldown)*time.Second).Run()
+	}
+
+	// Mine until interrupted, then give the shares already found a chance
+	// to be answered. A second interrupt exits right away
+	interrupt := make(chan os.Signal, 2)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	go func() {
+		<-interrupt
+		os.Exit(1)
+	}()
+	if *grace != 0 {
+		config.ShutdownGrace = *grace
+	}
+	if config.ShutdownGrace > 0 {
+		miner.Shutdown(miners, time.Duration(config.ShutdownGrace)*time.Second, gpuminer.PendingResults)
+	}
+	if *cpuprofile != "" {
+		// The deferred StopCPUProfile writes out the profile
+		log.Infof("Stopping CPU profiling")
+	}
+}
+
+// runBenchmark measures the hashrate of all the CPU miners together and of
+// each GPU miner with every algorithm, and prints a table of them. The first
+// numGPUMiners of miners are the GPU miners
+func runBenchmark(miners []miner.Interface, numGPUMiners int, gpuContexts []*gpucontext.GPUContext, config *miner.Config) {
+	gpuMiners := miners[:numGPUMiners]
+	cpuMiners := miners[numGPUMiners:]
+	columns := make([]miner.BenchmarkColumn, 0, len(gpuMiners)+1)
+	if len(cpuMiners) > 0 {
+		columns = append(columns, miner.BenchmarkColumn{Name: "CPU", Miners: cpuMiners, CanHash: cpuminer.CanHash})
+	}
+	for i, m := range gpuMiners {
+		name := fmt.Sprintf("GPU #%d", gpuContexts[i].DeviceIndex)
+		columns = append(columns, miner.BenchmarkColumn{Name: name, Miners: []miner.Interface{m}, CanHash: gpuminer.CanHash})
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	algos := *benchAlgos
+	if len(algos) == 0 {
+		algos = miner.SupportedAlgorithms
+	}
+
+	benchmark := miner.NewBenchmark(columns, config.AlgoPerf, time.Duration(*benchSeconds)*time.Second)
+	miner.StartMiners(miners, time.Duration(config.ThreadStagger)*time.Millisecond)
+	results := benchmark.Run(algos)
+	miner.WriteBenchmarkTable(os.Stdout, names, results)
+}
@@ -0,0 +1,149 @@
+package cpuminer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	// Algorithms that register themselves with the miner package
+	_ "github.com/gurupras/go-cryptonight-miner/cpu-miner/argon2"
+	_ "github.com/gurupras/go-cryptonight-miner/cpu-miner/astrobwt"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// AlgorithmCPUMiner hashes every algorithm that is registered with
+// miner.RegisterAlgorithm and has no miner of its own, like the Chukwa
+// algorithms and AstroBWT. Each thread keeps the memory of its algorithms,
+// which lives on the Go heap. Cryptonight and RandomX have their own miners,
+// which share their scratchpads and dataset between threads
+type AlgorithmCPUMiner struct {
+	*CPUMiner
+	hasher *miner.AlgorithmHasher
+}
+
+func NewAlgorithmCPUMiner(provider miner.WorkProvider) miner.Interface {
+	miner := New(provider)
+	return &AlgorithmCPUMiner{
+		miner,
+		nil,
+	}
+}
+
+// SetAlgorithm sets the algorithm this miner runs, which has to be a
+// registered algorithm without a miner of its own
+func (m *AlgorithmCPUMiner) SetAlgorithm(algo string) error {
+	if algorithmFamily(algo) != familyAlgorithm {
+		return fmt.Errorf("Algorithm '%v' is not implemented by the algorithm miner", miner.NormalizeAlgorithm(algo))
+	}
+	return m.Miner.SetAlgorithm(algo)
+}
+
+func (m *AlgorithmCPUMiner) Run() error {
+	nonceRange := miner.RigNonceShard.Partition(m.Id(), miner.MinerCount())
+	nonces := miner.NonceCounter{}
+	workLock := sync.Mutex{}
+	work := xmrig_crypto.NewXMRigWork()
+	work.Nicehash = miner.RigNicehash
+	var newWork *stratum.Work
+	// What the algorithms need to know about work
+	job := &miner.AlgorithmJob{}
+
+	workChan := make(chan *stratum.Work, 0)
+
+	initialWg := sync.WaitGroup{}
+	initialWg.Add(1)
+	gotFirstJob := false
+
+	m.WorkProvider.RegisterWorkListener(workChan)
+	go func() {
+		for work := range workChan {
+			workLock.Lock()
+			newWork = work
+			m.LogNewWork(m.WorkProvider, newWork)
+			if !gotFirstJob {
+				gotFirstJob = true
+				initialWg.Done()
+			}
+			workLock.Unlock()
+		}
+	}()
+
+	// Job whose blob failed validation, so that it is only logged once
+	var rejected *stratum.Work
+
+	// Returns true if new work was consumed
+	consumeWork := func() bool {
+		workLock.Lock()
+		defer workLock.Unlock()
+		if !miner.IsNewJob(work.Work, newWork) || newWork == rejected {
+			return false
+		}
+		if err := xmrig_crypto.ValidateBlob(newWork.Data, newWork.Size); err != nil {
+			log.Errorf("miner-%d: Skipping job %v: %v", m.Id(), newWork.JobID, err)
+			rejected = newWork
+			return false
+		}
+		stratum.WorkCopy(work.Work, newWork)
+		job = miner.NewAlgorithmJob(m.Algorithm(), newWork.JobID)
+		nonces.Reset(nonceRange)
+		return true
+	}
+
+	waitForWork := func() {
+		for !consumeWork() {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	initialWg.Wait()
+	consumeWork()
+	if m.hasher == nil {
+		m.hasher = miner.NewAlgorithmHasher()
+	}
+
+	algo := miner.NormalizeAlgorithm(m.Algorithm())
+	for {
+		select {
+		case <-m.Restarting():
+			// SetAlgorithm restarts the miner when the algorithm changes,
+			// which may be to another one within the family
+			algo = miner.NormalizeAlgorithm(m.Algorithm())
+			if algorithmFamily(algo) != familyAlgorithm {
+				return errAlgorithmSwitched
+			}
+			// The algorithms don't need to be set up again
+			log.Infof("miner-%d: Restarting", m.Id())
+		default:
+		}
+
+		nonce, ok := nonces.Next()
+		if !ok {
+			log.Warnf("miner-%d: Exhausted nonces for job %v, waiting for new job", m.Id(), work.JobID)
+			waitForWork()
+			continue
+		}
+		work.SetNonce(nonce)
+		job.Algorithm = algo
+		hashBytes, err := m.hasher.Hash(job, work.Data[:work.Size])
+		if err != nil {
+			log.Errorf("miner-%d: Failed to hash job %v with %v, waiting for new job: %v", m.Id(), work.JobID, algo, err)
+			waitForWork()
+			continue
+		}
+		// The registered algorithms take about a millisecond or more per
+		// hash, so each one is reported
+		m.InformHashrate(1)
+
+		if miner.MeetsTarget(work.JobID, work.Target, hashBytes) {
+			m.SubmitWork(work, hashBytes)
+		}
+		consumeWork()
+	}
+}
+
+func (m *AlgorithmCPUMiner) SubmitWork(work *xmrig_crypto.XMRigWork, hashBytes []byte) error {
+	return m.submitShare(work, hashBytes)
+}
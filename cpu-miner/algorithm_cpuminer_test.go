@@ -0,0 +1,33 @@
+package cpuminer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlgorithmMiner(t *testing.T) {
+	require := require.New(t)
+
+	provider := &countingProvider{}
+	_, ok := NewMiner(provider, "chukwa", false).(*AlgorithmCPUMiner)
+	require.True(ok)
+	_, ok = NewMiner(provider, "astrobwt", false).(*AlgorithmCPUMiner)
+	require.True(ok)
+
+	m := NewAlgorithmCPUMiner(provider)
+	require.Nil(m.SetAlgorithm("argon2/chukwav2"))
+	// Switching within the family doesn't need another miner
+	require.Nil(m.SetAlgorithm("astrobwt/dero"))
+	require.NotNil(m.SetAlgorithm("cn-pico/trtl"))
+	require.NotNil(m.SetAlgorithm("rx/0"))
+	require.NotNil(NewXMRigCPUMiner(provider).SetAlgorithm("argon2/chukwa"))
+	require.NotNil(NewXMRigCPUMiner(provider).SetAlgorithm("astrobwt"))
+	require.NotNil(NewRandomXCPUMiner(provider).SetAlgorithm("argon2/chukwa"))
+	require.True(CanHash("astrobwt"))
+
+	require.Equal(0, HugePagesSize(4, 0, "argon2/chukwa"))
+	require.Equal(0, HugePagesSize(4, 0, "astrobwt"))
+	require.Nil(SetupMemory("argon2/chukwav2"))
+	require.Nil(SetupMemory("astrobwt"))
+}
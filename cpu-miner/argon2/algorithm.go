@@ -0,0 +1,47 @@
+package argon2
+
+import (
+	"fmt"
+
+	"github.com/gurupras/go-cryptonight-miner/miner"
+)
+
+// chukwaParams maps the Chukwa algorithms, as named by
+// miner.NormalizeAlgorithm, onto their Argon2id parameters
+var chukwaParams = map[string]Params{
+	"argon2/chukwa":   Chukwa,
+	"argon2/chukwav2": ChukwaV2,
+}
+
+func init() {
+	for name := range chukwaParams {
+		miner.RegisterAlgorithm(name, func() miner.Algorithm { return &chukwaAlgorithm{} })
+	}
+}
+
+// chukwaAlgorithm is the miner.Algorithm of the Chukwa algorithms. It keeps
+// the memory of its hasher, which lives on the Go heap
+type chukwaAlgorithm struct {
+	hasher *Hasher
+}
+
+// VariantOf returns the algorithm of job, since each has its own parameters
+func (a *chukwaAlgorithm) VariantOf(job *miner.AlgorithmJob) string {
+	return job.Algorithm
+}
+
+// Init creates the hasher for the parameters of the algorithm of job
+func (a *chukwaAlgorithm) Init(job *miner.AlgorithmJob) error {
+	params, ok := chukwaParams[job.Algorithm]
+	if !ok {
+		return fmt.Errorf("Algorithm '%v' is not a Chukwa algorithm", job.Algorithm)
+	}
+	if a.hasher == nil || a.hasher.Params() != params {
+		a.hasher = NewHasher(params)
+	}
+	return nil
+}
+
+func (a *chukwaAlgorithm) Hash(blob []byte) ([]byte, error) {
+	return a.hasher.HashChukwa(blob), nil
+}
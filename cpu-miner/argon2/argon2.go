@@ -0,0 +1,278 @@
+// Package argon2 implements Argon2id (RFC 9106) in pure Go along with the
+// parameters of the Chukwa proof of work that TurtleCoin builds on it
+package argon2
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	version      = 0x13
+	typeID       = 2
+	blockLength  = 128
+	syncPoints   = 4
+	addressCount = blockLength
+)
+
+// block is a 1KiB Argon2 memory block
+type block [blockLength]uint64
+
+// Params are the cost parameters of an Argon2id hash
+type Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the amount of memory in KiB
+	Memory uint32
+	// Lanes is the degree of parallelism
+	Lanes uint32
+	// KeyLen is the length of the tag in bytes
+	KeyLen uint32
+}
+
+// Hasher computes Argon2id hashes with a fixed set of parameters. It keeps
+// its memory between hashes so a mining thread allocates it only once. A
+// Hasher must not be used from more than one goroutine at a time
+type Hasher struct {
+	params        Params
+	memory        []block
+	laneLength    uint32
+	segmentLength uint32
+}
+
+// NewHasher allocates a Hasher for params
+func NewHasher(params Params) *Hasher {
+	if params.Lanes == 0 {
+		params.Lanes = 1
+	}
+	memory := params.Memory
+	if memory < 2*syncPoints*params.Lanes {
+		memory = 2 * syncPoints * params.Lanes
+	}
+	segmentLength := memory / (params.Lanes * syncPoints)
+	laneLength := segmentLength * syncPoints
+	return &Hasher{
+		params,
+		make([]block, laneLength*params.Lanes),
+		laneLength,
+		segmentLength,
+	}
+}
+
+// Params returns the parameters of the hasher
+func (h *Hasher) Params() Params {
+	return h.params
+}
+
+// Hash returns the Argon2id tag of password. secret and data are the
+// optional key and associated data and may be nil
+func (h *Hasher) Hash(password, salt, secret, data []byte) []byte {
+	h0 := h.initialHash(password, salt, secret, data)
+	h.initBlocks(h0)
+	for pass := uint32(0); pass < h.params.Time; pass++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			for lane := uint32(0); lane < h.params.Lanes; lane++ {
+				h.fillSegment(pass, slice, lane)
+			}
+		}
+	}
+	return h.finalize()
+}
+
+func (h *Hasher) initialHash(password, salt, secret, data []byte) []byte {
+	var params [24]byte
+	binary.LittleEndian.PutUint32(params[0:], h.params.Lanes)
+	binary.LittleEndian.PutUint32(params[4:], h.params.KeyLen)
+	binary.LittleEndian.PutUint32(params[8:], h.params.Memory)
+	binary.LittleEndian.PutUint32(params[12:], h.params.Time)
+	binary.LittleEndian.PutUint32(params[16:], version)
+	binary.LittleEndian.PutUint32(params[20:], typeID)
+
+	d := newBlake2b(64)
+	d.Write(params[:])
+	var length [4]byte
+	for _, p := range [][]byte{password, salt, secret, data} {
+		binary.LittleEndian.PutUint32(length[:], uint32(len(p)))
+		d.Write(length[:])
+		d.Write(p)
+	}
+	return d.Sum(nil)
+}
+
+func (h *Hasher) initBlocks(h0 []byte) {
+	var buf [blockLength * 8]byte
+	var index, lane [4]byte
+	for l := uint32(0); l < h.params.Lanes; l++ {
+		binary.LittleEndian.PutUint32(lane[:], l)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(index[:], i)
+			blake2bLong(buf[:], h0, index[:], lane[:])
+			b := &h.memory[l*h.laneLength+i]
+			for j := range b {
+				b[j] = binary.LittleEndian.Uint64(buf[8*j:])
+			}
+		}
+	}
+}
+
+func (h *Hasher) finalize() []byte {
+	var final block
+	for l := uint32(0); l < h.params.Lanes; l++ {
+		b := &h.memory[l*h.laneLength+h.laneLength-1]
+		for i := range final {
+			final[i] ^= b[i]
+		}
+	}
+	var buf [blockLength * 8]byte
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(buf[8*i:], v)
+	}
+	out := make([]byte, h.params.KeyLen)
+	blake2bLong(out, buf[:])
+	return out
+}
+
+func (h *Hasher) fillSegment(pass, slice, lane uint32) {
+	// Argon2id uses data-independent addressing for the first half of the
+	// first pass
+	independent := pass == 0 && slice < syncPoints/2
+
+	var address, input, zero block
+	if independent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(len(h.memory))
+		input[4] = uint64(h.params.Time)
+		input[5] = typeID
+	}
+	nextAddresses := func() {
+		input[6]++
+		processBlock(&address, &zero, &input, false)
+		processBlock(&address, &zero, &address, false)
+	}
+
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		start = 2
+		if independent {
+			nextAddresses()
+		}
+	}
+
+	offset := lane*h.laneLength + slice*h.segmentLength + start
+	for index := start; index < h.segmentLength; index, offset = index+1, offset+1 {
+		prev := offset - 1
+		if offset%h.laneLength == 0 {
+			prev = offset + h.laneLength - 1
+		}
+
+		var random uint64
+		if independent {
+			if index%addressCount == 0 {
+				nextAddresses()
+			}
+			random = address[index%addressCount]
+		} else {
+			random = h.memory[prev][0]
+		}
+
+		refLane := uint32(random>>32) % h.params.Lanes
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+		refIndex := h.indexAlpha(pass, slice, index, uint32(random), refLane == lane)
+		ref := &h.memory[refLane*h.laneLength+refIndex]
+		processBlock(&h.memory[offset], &h.memory[prev], ref, pass > 0)
+	}
+}
+
+// indexAlpha maps a pseudo-random value to the index of the reference block
+// within its lane
+func (h *Hasher) indexAlpha(pass, slice, index, random uint32, sameLane bool) uint32 {
+	var area uint32
+	switch {
+	case pass == 0 && slice == 0:
+		area = index - 1
+	case pass == 0 && sameLane:
+		area = slice*h.segmentLength + index - 1
+	case pass == 0:
+		area = slice * h.segmentLength
+		if index == 0 {
+			area--
+		}
+	case sameLane:
+		area = h.laneLength - h.segmentLength + index - 1
+	default:
+		area = h.laneLength - h.segmentLength
+		if index == 0 {
+			area--
+		}
+	}
+
+	x := uint64(random) * uint64(random) >> 32
+	relative := uint64(area) - 1 - (uint64(area) * x >> 32)
+
+	start := uint32(0)
+	if pass != 0 && slice != syncPoints-1 {
+		start = (slice + 1) * h.segmentLength
+	}
+	return uint32((uint64(start) + relative) % uint64(h.laneLength))
+}
+
+// processBlock sets out to the compression G(prev, ref), XORed with the old
+// contents of out when xor is set as Argon2 v1.3 does after the first pass
+func processBlock(out, prev, ref *block, xor bool) {
+	var r, tmp block
+	for i := range r {
+		r[i] = prev[i] ^ ref[i]
+	}
+	tmp = r
+	if xor {
+		for i := range tmp {
+			tmp[i] ^= out[i]
+		}
+	}
+	for i := 0; i < 8; i++ {
+		q := 16 * i
+		blamkaRound(
+			&r[q], &r[q+1], &r[q+2], &r[q+3], &r[q+4], &r[q+5], &r[q+6], &r[q+7],
+			&r[q+8], &r[q+9], &r[q+10], &r[q+11], &r[q+12], &r[q+13], &r[q+14], &r[q+15],
+		)
+	}
+	for i := 0; i < 8; i++ {
+		q := 2 * i
+		blamkaRound(
+			&r[q], &r[q+1], &r[q+16], &r[q+17], &r[q+32], &r[q+33], &r[q+48], &r[q+49],
+			&r[q+64], &r[q+65], &r[q+80], &r[q+81], &r[q+96], &r[q+97], &r[q+112], &r[q+113],
+		)
+	}
+	for i := range out {
+		out[i] = tmp[i] ^ r[i]
+	}
+}
+
+func blamkaRound(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	blamkaG(v0, v4, v8, v12)
+	blamkaG(v1, v5, v9, v13)
+	blamkaG(v2, v6, v10, v14)
+	blamkaG(v3, v7, v11, v15)
+	blamkaG(v0, v5, v10, v15)
+	blamkaG(v1, v6, v11, v12)
+	blamkaG(v2, v7, v8, v13)
+	blamkaG(v3, v4, v9, v14)
+}
+
+func blamkaG(a, b, c, d *uint64) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+	*a = fBlaMka(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -32)
+	*c = fBlaMka(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -24)
+	*a = fBlaMka(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -16)
+	*c = fBlaMka(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -63)
+}
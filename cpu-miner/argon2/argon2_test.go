@@ -0,0 +1,32 @@
+package argon2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgon2idRFC9106(t *testing.T) {
+	require := require.New(t)
+
+	h := NewHasher(Params{3, 32, 4, 32})
+	tag := h.Hash(
+		bytes.Repeat([]byte{0x01}, 32),
+		bytes.Repeat([]byte{0x02}, 16),
+		bytes.Repeat([]byte{0x03}, 8),
+		bytes.Repeat([]byte{0x04}, 12),
+	)
+	require.Equal("0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659", hex.EncodeToString(tag))
+}
+
+func TestHasherReuse(t *testing.T) {
+	require := require.New(t)
+
+	h := NewHasher(Chukwa)
+	a := h.HashChukwa([]byte("first blob of at least sixteen bytes"))
+	b := h.HashChukwa([]byte("second blob of at least sixteen bytes"))
+	require.NotEqual(a, b)
+	require.Equal(a, NewHasher(Chukwa).HashChukwa([]byte("first blob of at least sixteen bytes")))
+}
@@ -0,0 +1,24 @@
+package argon2
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlake2b(t *testing.T) {
+	require := require.New(t)
+
+	hash := func(input []byte, outLen int) string {
+		d := newBlake2b(outLen)
+		d.Write(input)
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	require.Equal("ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923", hash([]byte("abc"), 64))
+	require.Equal("0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8", hash(nil, 32))
+	// Inputs that end on a block boundary
+	require.Equal("fc6c71f688f43ea7d60817478808f3cac753e61571865c95adbc2d9122c943a76b92c2cb1047ef3fe7bf6e436ec1d0a99a9e5b216780bf7fed9d7ca91d3a8f3b", hash([]byte(strings.Repeat("a", 128)), 64))
+	require.Equal("c9c4a2f8df7d9546fad021510f72ee0ae1b15058", hash([]byte(strings.Repeat("a", 300)), 20))
+}
@@ -0,0 +1,21 @@
+package argon2
+
+var (
+	// Chukwa is the original TurtleCoin proof of work (argon2/chukwa)
+	Chukwa = Params{3, 512, 1, 32}
+	// ChukwaV2 is the heavier revision TurtleCoin forked to (argon2/chukwav2)
+	ChukwaV2 = Params{4, 1024, 1, 32}
+)
+
+// ChukwaSaltSize is the number of leading bytes of the blob used as salt
+const ChukwaSaltSize = 16
+
+// HashChukwa hashes a blob with Chukwa-style parameters: the whole blob is
+// the password and its first ChukwaSaltSize bytes are the salt
+func (h *Hasher) HashChukwa(blob []byte) []byte {
+	salt := blob
+	if len(salt) > ChukwaSaltSize {
+		salt = salt[:ChukwaSaltSize]
+	}
+	return h.Hash(blob, salt, nil, nil)
+}
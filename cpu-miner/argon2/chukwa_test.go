@@ -0,0 +1,37 @@
+package argon2
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChukwa(t *testing.T) {
+	require := require.New(t)
+
+	input, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+
+	require.Equal("c158a105ae75c7561cfd029083a47a87653d51f914128e21c1971d8b10c49034", hex.EncodeToString(NewHasher(Chukwa).HashChukwa(input)))
+	require.Equal("77cf6958b3536e1f9f0d1ea165f22811ca7bc487ea9f52030b5050c17fcdd8f5", hex.EncodeToString(NewHasher(ChukwaV2).HashChukwa(input)))
+}
+
+func TestChukwaAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	input, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+
+	h := miner.NewAlgorithmHasher()
+	hash, err := h.Hash(miner.NewAlgorithmJob("chukwa", ""), input)
+	require.Nil(err)
+	require.Equal("c158a105ae75c7561cfd029083a47a87653d51f914128e21c1971d8b10c49034", hex.EncodeToString(hash))
+	hash, err = h.Hash(miner.NewAlgorithmJob("chukwav2", ""), input)
+	require.Nil(err)
+	require.Equal("77cf6958b3536e1f9f0d1ea165f22811ca7bc487ea9f52030b5050c17fcdd8f5", hex.EncodeToString(hash))
+
+	a := &chukwaAlgorithm{}
+	require.NotNil(a.Init(&miner.AlgorithmJob{Algorithm: "cn/0"}))
+}
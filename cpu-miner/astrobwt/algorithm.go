@@ -0,0 +1,31 @@
+package astrobwt
+
+import (
+	"github.com/gurupras/go-cryptonight-miner/miner"
+)
+
+func init() {
+	miner.RegisterAlgorithm("astrobwt", func() miner.Algorithm { return &algorithm{} })
+}
+
+// algorithm is the miner.Algorithm of AstroBWT. Its hasher is allocated by
+// the first Init
+type algorithm struct {
+	hasher *Hasher
+}
+
+// VariantOf returns the algorithm of job, since AstroBWT has no variants
+func (a *algorithm) VariantOf(job *miner.AlgorithmJob) string {
+	return job.Algorithm
+}
+
+func (a *algorithm) Init(job *miner.AlgorithmJob) error {
+	if a.hasher == nil {
+		a.hasher = NewHasher()
+	}
+	return nil
+}
+
+func (a *algorithm) Hash(blob []byte) ([]byte, error) {
+	return a.hasher.Hash(blob), nil
+}
@@ -0,0 +1,141 @@
+// Package astrobwt implements the AstroBWT proof of work of Dero in pure Go.
+// A hash runs two Burrows-Wheeler transforms over Salsa20 key streams that
+// are keyed by SHA3-256 hashes, the second of up to 1.2MB
+package astrobwt
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// Stage1Size is the length of the key stream of the first stage
+	Stage1Size = 147253
+	// MaxStage2Size is the length of the longest key stream of the second
+	// stage
+	MaxStage2Size = Stage1Size + 0xfffff
+
+	// Each index is packed into the lowest indexBits of a uint64, below the
+	// leading bytes of its suffix
+	indexBits = 21
+	indexMask = 1<<indexBits - 1
+
+	// The indices are counting sorted by the leading 2*countingSortBits
+	// bits of their suffixes
+	countingSortBits = 10
+	countingSortSize = 1 << countingSortBits
+
+	// The text of a stage is followed by a zero byte that is part of the
+	// transform, and by zeros that suffixes are compared against past its
+	// end
+	padding = 16
+)
+
+// Hasher computes AstroBWT hashes. It keeps the buffers of the largest
+// second stage, about 20MB, between hashes so a mining thread allocates them
+// only once. A Hasher must not be used from more than one goroutine at a time
+type Hasher struct {
+	// text holds a zero byte followed by the key stream of the current stage
+	// and its padding
+	text       []byte
+	indices    []uint64
+	tmpIndices []uint64
+	result     []byte
+}
+
+// NewHasher allocates a Hasher
+func NewHasher() *Hasher {
+	return &Hasher{
+		make([]byte, 1+MaxStage2Size+padding),
+		make([]uint64, MaxStage2Size+1),
+		make([]uint64, MaxStage2Size+1),
+		make([]byte, MaxStage2Size+1),
+	}
+}
+
+// Hash returns the AstroBWT hash of input
+func (h *Hasher) Hash(input []byte) []byte {
+	key := sha3Sum256(input)
+	key = h.stage(&key, Stage1Size)
+	stage2Size := Stage1Size + int(binary.LittleEndian.Uint32(key[:])&0xfffff)
+	key = h.stage(&key, stage2Size)
+	return key[:]
+}
+
+// stage transforms size bytes of the key stream of key and returns the
+// SHA3-256 hash of the transform
+func (h *Hasher) stage(key *[32]byte, size int) [32]byte {
+	text := h.text[:1+size+padding]
+	for i := range text {
+		text[i] = 0
+	}
+	salsa20KeyStream(text[1:1+size], key)
+
+	// The transform covers the key stream and the zero byte after it. Each
+	// suffix is preceded by the byte before it, which is zero for the first
+	v := text[1:]
+	n := size + 1
+	indices := h.indices[:n]
+	sortIndices(v, indices, h.tmpIndices[:n])
+	result := h.result[:n]
+	for i, index := range indices {
+		result[i] = text[index&indexMask]
+	}
+	return sha3Sum256(result)
+}
+
+// prefix returns the leading 8 bytes of the suffix of v at i as a big endian
+// number
+func prefix(v []byte, i int) uint64 {
+	return binary.BigEndian.Uint64(v[i:])
+}
+
+// sortIndices sorts the suffixes of the first len(indices) bytes of v, which
+// must be followed by at least 13 zero bytes. The suffixes are counting
+// sorted by their leading 20 bits and then insertion sorted by their leading
+// 13 bytes, which tells apart all the suffixes of a random text. Suffixes
+// that agree on those stay in the order of their positions
+func sortIndices(v []byte, indices, tmpIndices []uint64) {
+	n := len(indices)
+	var counters [2][countingSortSize]int
+	for i := 0; i < n; i++ {
+		k := prefix(v, i)
+		counters[0][(k>>(64-2*countingSortBits))&(countingSortSize-1)]++
+		counters[1][k>>(64-countingSortBits)]++
+	}
+	for i := range counters {
+		previous := counters[i][0] - 1
+		counters[i][0] = previous
+		for j := 1; j < countingSortSize; j++ {
+			previous += counters[i][j]
+			counters[i][j] = previous
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		k := prefix(v, i)
+		bucket := (k >> (64 - 2*countingSortBits)) & (countingSortSize - 1)
+		tmpIndices[counters[0][bucket]] = (k &^ indexMask) | uint64(i)
+		counters[0][bucket]--
+	}
+	for i := n - 1; i >= 0; i-- {
+		data := tmpIndices[i]
+		bucket := data >> (64 - countingSortBits)
+		indices[counters[1][bucket]] = data
+		counters[1][bucket]--
+	}
+
+	smaller := func(a, b uint64) bool {
+		if a>>indexBits != b>>indexBits {
+			return a>>indexBits < b>>indexBits
+		}
+		return prefix(v, int(a&indexMask)+5) < prefix(v, int(b&indexMask)+5)
+	}
+	for i := 1; i < n; i++ {
+		t := indices[i]
+		j := i
+		for j > 0 && smaller(t, indices[j-1]) {
+			indices[j] = indices[j-1]
+			j--
+		}
+		indices[j] = t
+	}
+}
@@ -0,0 +1,100 @@
+package astrobwt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSHA3(t *testing.T) {
+	require := require.New(t)
+
+	hash := func(input []byte) string {
+		sum := sha3Sum256(input)
+		return hex.EncodeToString(sum[:])
+	}
+	require.Equal("a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a", hash(nil))
+	require.Equal("3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532", hash([]byte("abc")))
+	// Inputs that end on a block boundary
+	require.Equal("3fc5559f14db8e453a0a3091edbd2bc25e11528d81c66fa570a4efdcc2695ee1", hash([]byte(strings.Repeat("a", 136))))
+	require.Equal("8a5720b2ca0cae7b89ad399c5daab22c29f5c72bcf30ab81e807d9bda95b4580", hash([]byte(strings.Repeat("a", 300))))
+}
+
+func TestSalsa20(t *testing.T) {
+	require := require.New(t)
+
+	// The example of the Salsa20 specification, with k0 = 1..16,
+	// k1 = 201..216 and a nonce and block counter of 101..116
+	var input [16]uint32
+	input[0], input[5], input[10], input[15] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	word := func(start int) uint32 {
+		return uint32(start) | uint32(start+1)<<8 | uint32(start+2)<<16 | uint32(start+3)<<24
+	}
+	for i := 0; i < 4; i++ {
+		input[1+i] = word(1 + 4*i)
+		input[6+i] = word(101 + 4*i)
+		input[11+i] = word(201 + 4*i)
+	}
+	var block [64]byte
+	salsa20Block(&block, &input)
+	require.Equal([]byte{
+		69, 37, 68, 39, 41, 15, 107, 193, 255, 139, 122, 6, 170, 233, 217, 98,
+		89, 144, 182, 106, 21, 51, 200, 65, 239, 49, 222, 34, 215, 114, 40, 126,
+		104, 197, 7, 225, 197, 153, 31, 2, 102, 78, 76, 176, 84, 245, 246, 184,
+		177, 160, 133, 130, 6, 72, 149, 119, 192, 195, 132, 236, 234, 103, 246, 74,
+	}, block[:])
+
+	// The key stream continues with the next block
+	var key [32]byte
+	stream := make([]byte, 100)
+	salsa20KeyStream(stream, &key)
+	input = [16]uint32{0x61707865, 0, 0, 0, 0, 0x3320646e, 0, 0, 1, 0, 0x79622d32, 0, 0, 0, 0, 0x6b206574}
+	salsa20Block(&block, &input)
+	require.Equal(block[:36], stream[64:])
+}
+
+func TestSortIndices(t *testing.T) {
+	require := require.New(t)
+
+	rng := rand.New(rand.NewSource(1))
+	text := make([]byte, 5000+padding)
+	rng.Read(text[:5000])
+	n := 5001
+	indices := make([]uint64, n)
+	sortIndices(text, indices, make([]uint64, n))
+
+	// The suffixes of a random text differ within their first 13 bytes, so
+	// the result is the suffix array
+	expected := make([]int, n)
+	for i := range expected {
+		expected[i] = i
+	}
+	sort.Slice(expected, func(a, b int) bool {
+		return bytes.Compare(text[expected[a]:], text[expected[b]:]) < 0
+	})
+	for i, index := range indices {
+		require.Equal(expected[i], int(index&indexMask))
+	}
+}
+
+func TestHash(t *testing.T) {
+	require := require.New(t)
+
+	input, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	h := NewHasher()
+	hash := h.Hash(input)
+	require.Equal("7e8844f2d6b7a43498fe6d226527689023da8a52f9fc4ec69e5aaaa63edce1c1", hex.EncodeToString(hash))
+	// The buffers are reused
+	require.Equal(hash, h.Hash(input))
+
+	hash, err = miner.NewAlgorithmHasher().Hash(miner.NewAlgorithmJob("astrobwt/dero", ""), input)
+	require.Nil(err)
+	require.Equal("7e8844f2d6b7a43498fe6d226527689023da8a52f9fc4ec69e5aaaa63edce1c1", hex.EncodeToString(hash))
+}
@@ -0,0 +1,58 @@
+package astrobwt
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// salsa20KeyStream fills out with the Salsa20/20 key stream of key, with a
+// nonce and initial block counter of zero
+func salsa20KeyStream(out []byte, key *[32]byte) {
+	var input [16]uint32
+	// "expand 32-byte k"
+	input[0] = 0x61707865
+	input[5] = 0x3320646e
+	input[10] = 0x79622d32
+	input[15] = 0x6b206574
+	for i := 0; i < 4; i++ {
+		input[1+i] = binary.LittleEndian.Uint32(key[4*i:])
+		input[11+i] = binary.LittleEndian.Uint32(key[16+4*i:])
+	}
+
+	var block [64]byte
+	var counter uint64
+	for len(out) > 0 {
+		input[8] = uint32(counter)
+		input[9] = uint32(counter >> 32)
+		salsa20Block(&block, &input)
+		n := copy(out, block[:])
+		out = out[n:]
+		counter++
+	}
+}
+
+// salsa20Block computes the 64-byte block of the Salsa20/20 core for input
+func salsa20Block(out *[64]byte, input *[16]uint32) {
+	x := *input
+	quarter := func(a, b, c, d int) {
+		x[b] ^= bits.RotateLeft32(x[a]+x[d], 7)
+		x[c] ^= bits.RotateLeft32(x[b]+x[a], 9)
+		x[d] ^= bits.RotateLeft32(x[c]+x[b], 13)
+		x[a] ^= bits.RotateLeft32(x[d]+x[c], 18)
+	}
+	for i := 0; i < 20; i += 2 {
+		// Columns
+		quarter(0, 4, 8, 12)
+		quarter(5, 9, 13, 1)
+		quarter(10, 14, 2, 6)
+		quarter(15, 3, 7, 11)
+		// Rows
+		quarter(0, 1, 2, 3)
+		quarter(5, 6, 7, 4)
+		quarter(10, 11, 8, 9)
+		quarter(15, 12, 13, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+input[i])
+	}
+}
@@ -0,0 +1,198 @@
+package cpuminer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+	"unsafe"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	log "github.com/sirupsen/logrus"
+)
+
+// SweepPlateau is how close to the best hashrate, as a fraction, a thread
+// count has to be for it to be recommended. Extra threads that add less than
+// this are not worth the power and heat
+var SweepPlateau = 0.02
+
+// SweepResult is the aggregate hashrate measured with a number of threads
+type SweepResult struct {
+	Threads  int     `json:"threads"`
+	HashRate float64 `json:"hashrate"`
+	// Hashrate of each of the threads
+	PerThread []float64 `json:"per_thread"`
+}
+
+// BenchmarkSweep measures the aggregate hashrate with 1 to maxThreads
+// threads, hashing generated work for duration at each step
+func BenchmarkSweep(maxThreads int, duration time.Duration) ([]SweepResult, error) {
+	mem, err := xmrig_crypto.SetupHugePages(uint32(maxThreads), xmrig_crypto.Memory)
+	if err != nil {
+		return nil, err
+	}
+	contexts := make([]unsafe.Pointer, maxThreads)
+	for i := range contexts {
+		if contexts[i], err = xmrig_crypto.SetupCryptonightContext(mem, uint32(i), xmrig_crypto.Memory); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]SweepResult, 0, maxThreads)
+	for threads := 1; threads <= maxThreads; threads++ {
+		perThread := benchmarkThreads(contexts[:threads], duration)
+		hashRate := 0.0
+		for _, rate := range perThread {
+			hashRate += rate
+		}
+		log.Infof("benchmark: %d threads: %.1f H/s", threads, hashRate)
+		results = append(results, SweepResult{threads, hashRate, perThread})
+	}
+	return results, nil
+}
+
+// benchmarkThreads hashes generated work on one thread per context for
+// duration and returns the hashrate of each thread
+func benchmarkThreads(contexts []unsafe.Pointer, duration time.Duration) []float64 {
+	hashes := make([]uint64, len(contexts))
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i, ctx := range contexts {
+		wg.Add(1)
+		go func(i int, ctx unsafe.Pointer) {
+			defer wg.Done()
+			work := xmrig_crypto.NewWorkGenerator(int64(i), 1).Next()
+			nonce := work.Nonce()
+			count := uint64(0)
+			for {
+				select {
+				case <-stop:
+					atomic.StoreUint64(&hashes[i], count)
+					return
+				default:
+				}
+				nonce++
+				work.SetNonce(nonce)
+				xmrig_crypto.CryptonightHash(work, ctx)
+				count++
+			}
+		}(i, ctx)
+	}
+	start := time.Now()
+	time.Sleep(duration)
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(start).Seconds()
+	rates := make([]float64, len(hashes))
+	for i := range hashes {
+		rates[i] = float64(hashes[i]) / elapsed
+	}
+	return rates
+}
+
+// RecommendThreads returns the smallest thread count whose hashrate is
+// within SweepPlateau of the best one
+func RecommendThreads(results []SweepResult) int {
+	best := 0.0
+	for _, r := range results {
+		if r.HashRate > best {
+			best = r.HashRate
+		}
+	}
+	for _, r := range results {
+		if r.HashRate >= best*(1-SweepPlateau) {
+			return r.Threads
+		}
+	}
+	return 0
+}
+
+// WriteSweepTable writes results as a table of thread count vs hashrate,
+// followed by the recommended thread count
+func WriteSweepTable(w io.Writer, results []SweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Threads\tH/s\tH/s per thread\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%.1f\t%.1f\t\n", r.Threads, r.HashRate, r.HashRate/float64(r.Threads))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Recommended threads: %d\n", RecommendThreads(results))
+}
+
+// BenchmarkReport is the machine readable result of a benchmark sweep, for
+// scripts and CI jobs that compare runs
+type BenchmarkReport struct {
+	Version   string `json:"version"`
+	Algorithm string `json:"algo"`
+	CPU       string `json:"cpu"`
+	// Thread count and hashrates of the run with the most threads
+	Threads   int           `json:"threads"`
+	HashRate  float64       `json:"hashrate"`
+	PerThread []float64     `json:"per_thread"`
+	Sweep     []SweepResult `json:"sweep"`
+}
+
+// NewBenchmarkReport returns the report of a sweep of algo on cpu
+func NewBenchmarkReport(results []SweepResult, algo, cpu string) *BenchmarkReport {
+	report := &BenchmarkReport{
+		Version:   miner.Version,
+		Algorithm: algo,
+		CPU:       cpu,
+		Sweep:     results,
+	}
+	if len(results) > 0 {
+		last := results[len(results)-1]
+		report.Threads = last.Threads
+		report.HashRate = last.HashRate
+		report.PerThread = last.PerThread
+	}
+	return report
+}
+
+// WriteBenchmarkReport writes report as JSON
+func WriteBenchmarkReport(w io.Writer, report *BenchmarkReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// ReadBenchmarkReport reads a report written by WriteBenchmarkReport
+func ReadBenchmarkReport(r io.Reader) (*BenchmarkReport, error) {
+	report := &BenchmarkReport{}
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		return nil, fmt.Errorf("Invalid benchmark report: %v", err)
+	}
+	return report, nil
+}
+
+// CompareBenchmarks returns an error listing every thread count whose
+// hashrate in current is more than threshold, as a fraction, below the one
+// in baseline. Thread counts that only one of the reports has are skipped
+func CompareBenchmarks(baseline, current *BenchmarkReport, threshold float64) error {
+	if baseline.Algorithm != current.Algorithm {
+		return fmt.Errorf("Cannot compare a benchmark of %v with one of %v", current.Algorithm, baseline.Algorithm)
+	}
+	base := make(map[int]float64, len(baseline.Sweep))
+	for _, r := range baseline.Sweep {
+		base[r.Threads] = r.HashRate
+	}
+	var regressions []string
+	for _, r := range current.Sweep {
+		rate, ok := base[r.Threads]
+		if !ok || rate <= 0 {
+			continue
+		}
+		if change := r.HashRate/rate - 1; change < -threshold {
+			regressions = append(regressions, fmt.Sprintf("%d threads: %.1f H/s vs %.1f H/s (%.1f%%)", r.Threads, r.HashRate, rate, change*100))
+		}
+	}
+	if len(regressions) != 0 {
+		return fmt.Errorf("Hashrate regressed by more than %.1f%%: %v", threshold*100, strings.Join(regressions, ", "))
+	}
+	return nil
+}
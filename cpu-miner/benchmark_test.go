@@ -0,0 +1,80 @@
+package cpuminer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecommendThreads(t *testing.T) {
+	require := require.New(t)
+
+	// Plateaus at 4 threads and regresses after
+	results := []SweepResult{{1, 100, nil}, {2, 195, nil}, {3, 280, nil}, {4, 340, nil}, {5, 355, nil}, {6, 340, nil}}
+	require.Equal(5, RecommendThreads(results))
+
+	results[3].HashRate = 352
+	require.Equal(4, RecommendThreads(results))
+
+	require.Equal(0, RecommendThreads(nil))
+}
+
+func TestWriteSweepTable(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	WriteSweepTable(&buf, []SweepResult{{1, 100, nil}, {2, 190, nil}})
+	require.Contains(buf.String(), "Threads")
+	require.Contains(buf.String(), "190.0")
+	require.Contains(buf.String(), "Recommended threads: 2")
+}
+
+func TestBenchmarkSweep(t *testing.T) {
+	require := require.New(t)
+
+	results, err := BenchmarkSweep(2, 500*time.Millisecond)
+	require.Nil(err)
+	require.Equal(2, len(results))
+	for i, r := range results {
+		require.Equal(i+1, r.Threads)
+		require.True(r.HashRate > 0)
+		require.Equal(r.Threads, len(r.PerThread))
+	}
+}
+
+func TestBenchmarkReport(t *testing.T) {
+	require := require.New(t)
+
+	results := []SweepResult{{1, 100, []float64{100}}, {2, 190, []float64{96, 94}}}
+	report := NewBenchmarkReport(results, "cn/1", "Test CPU")
+	require.Equal(2, report.Threads)
+	require.Equal(190.0, report.HashRate)
+
+	var buf bytes.Buffer
+	require.Nil(WriteBenchmarkReport(&buf, report))
+	require.Contains(buf.String(), `"per_thread"`)
+	read, err := ReadBenchmarkReport(&buf)
+	require.Nil(err)
+	require.Equal(report, read)
+
+	_, err = ReadBenchmarkReport(bytes.NewBufferString("not json"))
+	require.NotNil(err)
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	require := require.New(t)
+
+	baseline := NewBenchmarkReport([]SweepResult{{1, 100, nil}, {2, 200, nil}}, "cn/1", "")
+	current := NewBenchmarkReport([]SweepResult{{1, 97, nil}, {2, 185, nil}, {3, 250, nil}}, "cn/1", "")
+	require.Nil(CompareBenchmarks(baseline, current, 0.1))
+
+	err := CompareBenchmarks(baseline, current, 0.05)
+	require.NotNil(err)
+	require.Contains(err.Error(), "2 threads")
+	require.NotContains(err.Error(), "1 threads")
+
+	current.Algorithm = "cn/0"
+	require.NotNil(CompareBenchmarks(baseline, current, 0.1))
+}
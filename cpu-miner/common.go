@@ -4,28 +4,46 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	"github.com/gurupras/go-cryptonight-miner/miner"
 	stratum "github.com/gurupras/go-stratum-client"
 )
 
 var (
+	// TotalMiners is the number of CPU miners, which share the scratchpad
+	// memory
 	TotalMiners uint32 = 0
-	minerId     uint32 = 0
 )
 
 type CPUMiner struct {
-	*stratum.StratumContext
+	miner.WorkProvider
 	*miner.Miner
 	CryptonightContext unsafe.Pointer
 }
 
-func New(sc *stratum.StratumContext) *CPUMiner {
+func New(provider miner.WorkProvider) *CPUMiner {
 	miner := &CPUMiner{
-		sc,
-		miner.New(minerId),
+		provider,
+		miner.New(miner.NextMinerID()),
 		nil,
 	}
-	atomic.AddUint32(&minerId, 1)
 	atomic.AddUint32(&TotalMiners, 1)
 	return miner
 }
+
+// submitShare submits a hash that meets the target of work to the pool,
+// unless it was already submitted
+func (m *CPUMiner) submitShare(work *xmrig_crypto.XMRigWork, hashBytes []byte) error {
+	if !miner.ShouldSubmit(m.Id(), work.Work, hashBytes) {
+		return nil
+	}
+	hashHex, err := stratum.BinToHex(hashBytes)
+	if err != nil {
+		return err
+	}
+	if miner.IsDuplicateShare(m.Id(), work.JobID, work.Nonce()) {
+		return nil
+	}
+	miner.RecordShare(m.Id(), hashBytes, work.Target)
+	return m.WorkProvider.SubmitWork(work.Work, hashHex)
+}
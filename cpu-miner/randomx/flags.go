@@ -0,0 +1,53 @@
+package randomx
+
+import "fmt"
+
+// Flags select the implementation of RandomX, as in randomx_flags of
+// librandomx
+type Flags int
+
+const (
+	FlagDefault     Flags = 0
+	FlagLargePages  Flags = 1
+	FlagHardAES     Flags = 2
+	FlagFullMem     Flags = 4
+	FlagJIT         Flags = 8
+	FlagSecure      Flags = 16
+	FlagArgon2SSSE3 Flags = 32
+	FlagArgon2AVX2  Flags = 64
+)
+
+const (
+	// HashSize is the size of a RandomX hash in bytes
+	HashSize = 32
+	// CacheSize is the size of the cache that the dataset is built from
+	CacheSize = 256 * 1024 * 1024
+	// DatasetSize is the size of the dataset that full memory mode hashes
+	// against
+	DatasetSize = 2080 * 1024 * 1024
+	// ScratchpadSize is the size of the scratchpad of each virtual machine
+	ScratchpadSize = 2 * 1024 * 1024
+)
+
+// ErrNotCompiled is returned by everything that needs librandomx in builds
+// without it
+var ErrNotCompiled = fmt.Errorf("RandomX support was not compiled in, rebuild with -tags randomx and librandomx installed")
+
+// String returns the names of the flags that are set
+func (f Flags) String() string {
+	names := []string{"large-pages", "hard-aes", "full-mem", "jit", "secure", "argon2-ssse3", "argon2-avx2"}
+	ret := ""
+	for i, name := range names {
+		if f&(1<<uint(i)) == 0 {
+			continue
+		}
+		if len(ret) != 0 {
+			ret += ","
+		}
+		ret += name
+	}
+	if len(ret) == 0 {
+		return "default"
+	}
+	return ret
+}
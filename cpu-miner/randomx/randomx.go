@@ -0,0 +1,153 @@
+//go:build randomx && cgo
+// +build randomx,cgo
+
+package randomx
+
+/*
+#cgo LDFLAGS: -lrandomx -lstdc++ -lm
+#include <stdlib.h>
+#include <randomx.h>
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// Available is true if RandomX support was compiled in
+const Available = true
+
+// RecommendedFlags returns the flags that librandomx recommends for this
+// CPU: the JIT compiler, hardware AES and the fastest Argon2 implementation
+// that it supports
+func RecommendedFlags() Flags {
+	return Flags(C.randomx_get_flags())
+}
+
+// Cache is the 256MB RandomX cache of a seed hash, which light mode hashes
+// against and the dataset is built from
+type Cache struct {
+	ptr *C.randomx_cache
+}
+
+// NewCache allocates a cache. It has to be initialized with a seed hash
+// before it is used
+func NewCache(flags Flags) (*Cache, error) {
+	ptr := C.randomx_alloc_cache(C.randomx_flags(flags))
+	if ptr == nil {
+		return nil, fmt.Errorf("Failed to allocate the RandomX cache with flags %v", flags)
+	}
+	return &Cache{ptr}, nil
+}
+
+// Init initializes the cache with seed
+func (c *Cache) Init(seed []byte) {
+	key := C.CBytes(seed)
+	defer C.free(key)
+	C.randomx_init_cache(c.ptr, key, C.size_t(len(seed)))
+}
+
+// Close releases the memory of the cache
+func (c *Cache) Close() {
+	if c.ptr != nil {
+		C.randomx_release_cache(c.ptr)
+		c.ptr = nil
+	}
+}
+
+// Dataset is the 2080MB RandomX dataset that full memory mode hashes against
+type Dataset struct {
+	ptr *C.randomx_dataset
+}
+
+// NewDataset allocates a dataset. It has to be built from a cache before it
+// is used
+func NewDataset(flags Flags) (*Dataset, error) {
+	ptr := C.randomx_alloc_dataset(C.randomx_flags(flags))
+	if ptr == nil {
+		return nil, fmt.Errorf("Failed to allocate the RandomX dataset with flags %v", flags)
+	}
+	return &Dataset{ptr}, nil
+}
+
+// Init builds the dataset from cache, splitting the items across threads
+func (d *Dataset) Init(cache *Cache, threads int) {
+	items := uint64(C.randomx_dataset_item_count())
+	if threads < 1 {
+		threads = 1
+	}
+	wg := sync.WaitGroup{}
+	start := uint64(0)
+	for i := 0; i < threads; i++ {
+		count := items / uint64(threads)
+		if i == threads-1 {
+			count = items - start
+		}
+		wg.Add(1)
+		go func(start, count uint64) {
+			defer wg.Done()
+			C.randomx_init_dataset(d.ptr, cache.ptr, C.ulong(start), C.ulong(count))
+		}(start, count)
+		start += count
+	}
+	wg.Wait()
+}
+
+// Close releases the memory of the dataset
+func (d *Dataset) Close() {
+	if d.ptr != nil {
+		C.randomx_release_dataset(d.ptr)
+		d.ptr = nil
+	}
+}
+
+// VM is a RandomX virtual machine. Each mining thread needs its own, since a
+// VM can't be used from more than one goroutine at a time
+type VM struct {
+	ptr    *C.randomx_vm
+	output []byte
+}
+
+// NewVM creates a virtual machine that hashes against dataset if flags has
+// FlagFullMem and against cache otherwise
+func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
+	var cachePtr *C.randomx_cache
+	var datasetPtr *C.randomx_dataset
+	if cache != nil {
+		cachePtr = cache.ptr
+	}
+	if dataset != nil {
+		datasetPtr = dataset.ptr
+	}
+	ptr := C.randomx_create_vm(C.randomx_flags(flags), cachePtr, datasetPtr)
+	if ptr == nil {
+		return nil, fmt.Errorf("Failed to create a RandomX VM with flags %v", flags)
+	}
+	return &VM{ptr, make([]byte, HashSize)}, nil
+}
+
+// SetCache points a light mode VM at cache after it was reinitialized
+func (vm *VM) SetCache(cache *Cache) {
+	C.randomx_vm_set_cache(vm.ptr, cache.ptr)
+}
+
+// SetDataset points a full memory mode VM at dataset after it was rebuilt
+func (vm *VM) SetDataset(dataset *Dataset) {
+	C.randomx_vm_set_dataset(vm.ptr, dataset.ptr)
+}
+
+// Hash returns the RandomX hash of input. The returned slice is reused by
+// the next call
+func (vm *VM) Hash(input []byte) []byte {
+	C.randomx_calculate_hash(vm.ptr, unsafe.Pointer(&input[0]), C.size_t(len(input)), unsafe.Pointer(&vm.output[0]))
+	return vm.output
+}
+
+// Close releases the virtual machine
+func (vm *VM) Close() {
+	if vm.ptr != nil {
+		C.randomx_destroy_vm(vm.ptr)
+		vm.ptr = nil
+	}
+}
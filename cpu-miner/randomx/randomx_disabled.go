@@ -0,0 +1,66 @@
+//go:build !randomx || !cgo
+// +build !randomx !cgo
+
+package randomx
+
+// This file provides the API of randomx.go for builds without librandomx,
+// so that the miners build everywhere and fail with an explanation when
+// RandomX is selected
+
+// Available is true if RandomX support was compiled in
+const Available = false
+
+// RecommendedFlags returns the flags that librandomx recommends for this CPU
+func RecommendedFlags() Flags {
+	return FlagDefault
+}
+
+// Cache is the 256MB RandomX cache of a seed hash
+type Cache struct{}
+
+// NewCache fails without librandomx
+func NewCache(flags Flags) (*Cache, error) {
+	return nil, ErrNotCompiled
+}
+
+// Init initializes the cache with seed
+func (c *Cache) Init(seed []byte) {}
+
+// Close releases the memory of the cache
+func (c *Cache) Close() {}
+
+// Dataset is the 2080MB RandomX dataset that full memory mode hashes against
+type Dataset struct{}
+
+// NewDataset fails without librandomx
+func NewDataset(flags Flags) (*Dataset, error) {
+	return nil, ErrNotCompiled
+}
+
+// Init builds the dataset from cache, splitting the items across threads
+func (d *Dataset) Init(cache *Cache, threads int) {}
+
+// Close releases the memory of the dataset
+func (d *Dataset) Close() {}
+
+// VM is a RandomX virtual machine
+type VM struct{}
+
+// NewVM fails without librandomx
+func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
+	return nil, ErrNotCompiled
+}
+
+// SetCache points a light mode VM at cache after it was reinitialized
+func (vm *VM) SetCache(cache *Cache) {}
+
+// SetDataset points a full memory mode VM at dataset after it was rebuilt
+func (vm *VM) SetDataset(dataset *Dataset) {}
+
+// Hash returns the RandomX hash of input
+func (vm *VM) Hash(input []byte) []byte {
+	return nil
+}
+
+// Close releases the virtual machine
+func (vm *VM) Close() {}
@@ -0,0 +1,37 @@
+package randomx
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagsString(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("default", FlagDefault.String())
+	require.Equal("hard-aes,full-mem,jit", (FlagJIT | FlagHardAES | FlagFullMem).String())
+}
+
+func TestHash(t *testing.T) {
+	require := require.New(t)
+
+	if !Available {
+		_, err := NewCache(FlagDefault)
+		require.NotNil(err)
+		t.Skip("RandomX support was not compiled in")
+	}
+
+	// Test vector of librandomx, hashed in light mode against the cache
+	flags := RecommendedFlags()
+	cache, err := NewCache(flags)
+	require.Nil(err)
+	defer cache.Close()
+	cache.Init([]byte("test key 000"))
+	vm, err := NewVM(flags, cache, nil)
+	require.Nil(err)
+	defer vm.Close()
+	hash := vm.Hash([]byte("This is a test"))
+	require.Equal("639183aae1bf4c9a35884cb46b09cad9175f04efd7684e7262a0ac1c2f0b4e3f", hex.EncodeToString(hash))
+}
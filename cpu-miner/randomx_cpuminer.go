@@ -0,0 +1,294 @@
+package cpuminer
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/randomx"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// randomXAlgorithms are the algorithms that the RandomX miner hashes, as
+// named by miner.NormalizeAlgorithm
+var randomXAlgorithms = map[string]bool{
+	"rx/0": true,
+}
+
+// IsRandomX returns true if algo is hashed by the RandomX miner rather than
+// the cryptonight one
+func IsRandomX(algo string) bool {
+	return randomXAlgorithms[miner.NormalizeAlgorithm(algo)]
+}
+
+// rxDataset is the RandomX cache and dataset shared by all the RandomX
+// miners. They are rebuilt whenever a job with another seed hash arrives,
+// which happens every 2048 blocks. The dataset is only allocated once a
+// miner in full mode needs it
+var rxDataset = struct {
+	sync.Mutex
+	seed    []byte
+	cache   *randomx.Cache
+	dataset *randomx.Dataset
+	// Flags that the dataset was allocated with
+	datasetFlags randomx.Flags
+	// epoch is incremented every time the cache is initialized with another
+	// seed, so that the miners know to point their VMs at it again.
+	// datasetEpoch is the epoch that the dataset was last built for
+	epoch        int
+	datasetEpoch int
+}{}
+
+// allocRandomX allocates a cache or dataset with flags, in huge pages if
+// possible. It returns the flags that the allocation succeeded with
+func allocRandomX(name string, flags randomx.Flags, alloc func(randomx.Flags) error) (randomx.Flags, error) {
+	err := alloc(flags | randomx.FlagLargePages)
+	if err == nil {
+		return flags | randomx.FlagLargePages, nil
+	}
+	log.Warnf("Huge pages unavailable for the RandomX %v, falling back to normal pages: %v", name, err)
+	return flags, alloc(flags)
+}
+
+// buildRandomXDataset makes sure that the cache was initialized with seed
+// and, if full is set, that the dataset was built from it. The first miner
+// to see a new seed initializes the cache and builds the dataset with all
+// the cores, and the others wait for it. Call with rxDataset locked
+func buildRandomXDataset(seed []byte, full bool) error {
+	flags := randomx.RecommendedFlags()
+	if rxDataset.cache == nil {
+		_, err := allocRandomX("cache", flags, func(flags randomx.Flags) (err error) {
+			rxDataset.cache, err = randomx.NewCache(flags)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if full && rxDataset.dataset == nil {
+		var err error
+		rxDataset.datasetFlags, err = allocRandomX("dataset", flags|randomx.FlagFullMem, func(flags randomx.Flags) (err error) {
+			rxDataset.dataset, err = randomx.NewDataset(flags)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if rxDataset.epoch == 0 || !bytes.Equal(rxDataset.seed, seed) {
+		log.Infof("Initializing the RandomX cache for seed %x", seed)
+		rxDataset.cache.Init(seed)
+		rxDataset.seed = append([]byte(nil), seed...)
+		rxDataset.epoch++
+	}
+	if rxDataset.dataset != nil && rxDataset.datasetEpoch != rxDataset.epoch {
+		log.Infof("Building the RandomX dataset with flags %v", rxDataset.datasetFlags)
+		start := time.Now()
+		rxDataset.dataset.Init(rxDataset.cache, runtime.NumCPU())
+		rxDataset.datasetEpoch = rxDataset.epoch
+		log.Infof("Built the RandomX dataset in %v", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// RandomXCPUMiner hashes RandomX jobs with a VM per thread, against the
+// shared dataset in full mode or the shared cache in light mode
+type RandomXCPUMiner struct {
+	*CPUMiner
+	vm *randomx.VM
+	// Epoch of the cache or dataset that vm points at
+	epoch int
+	light bool
+}
+
+func NewRandomXCPUMiner(provider miner.WorkProvider) miner.Interface {
+	miner := New(provider)
+	return &RandomXCPUMiner{
+		miner,
+		nil,
+		0,
+		false,
+	}
+}
+
+// SetAlgorithm sets the algorithm this miner runs, which has to be RandomX
+func (m *RandomXCPUMiner) SetAlgorithm(algo string) error {
+	if !IsRandomX(algo) {
+		return fmt.Errorf("Algorithm '%v' is not implemented by the RandomX miner", miner.NormalizeAlgorithm(algo))
+	}
+	return m.Miner.SetAlgorithm(algo)
+}
+
+// SetLight makes this miner hash in light mode, against the cache instead of
+// the dataset. It has to be called before the miner is started
+func (m *RandomXCPUMiner) SetLight(light bool) {
+	m.light = light
+}
+
+// useSeed points the VM of this miner at the cache or dataset of seed,
+// creating the VM on first use
+func (m *RandomXCPUMiner) useSeed(seed []byte) error {
+	rxDataset.Lock()
+	defer rxDataset.Unlock()
+	if err := buildRandomXDataset(seed, !m.light); err != nil {
+		return err
+	}
+	if m.vm != nil && m.epoch == rxDataset.epoch {
+		return nil
+	}
+	switch {
+	case m.vm == nil && m.light:
+		vm, err := randomx.NewVM(randomx.RecommendedFlags(), rxDataset.cache, nil)
+		if err != nil {
+			return err
+		}
+		m.vm = vm
+	case m.vm == nil:
+		vm, err := randomx.NewVM(randomx.RecommendedFlags()|randomx.FlagFullMem, nil, rxDataset.dataset)
+		if err != nil {
+			return err
+		}
+		m.vm = vm
+	case m.light:
+		m.vm.SetCache(rxDataset.cache)
+	default:
+		m.vm.SetDataset(rxDataset.dataset)
+	}
+	m.epoch = rxDataset.epoch
+	return nil
+}
+
+func (m *RandomXCPUMiner) Run() error {
+	if !randomx.Available {
+		return fmt.Errorf("miner-%d: Can't mine %v: %v", m.Id(), m.Algorithm(), randomx.ErrNotCompiled)
+	}
+	if m.light {
+		log.Infof("miner-%d: Hashing %v in light mode", m.Id(), m.Algorithm())
+	}
+	nonceRange := miner.RigNonceShard.Partition(m.Id(), miner.MinerCount())
+	nonces := miner.NonceCounter{}
+	workLock := sync.Mutex{}
+	work := xmrig_crypto.NewXMRigWork()
+	work.Nicehash = miner.RigNicehash
+	var newWork *stratum.Work
+
+	workChan := make(chan *stratum.Work, 0)
+
+	initialWg := sync.WaitGroup{}
+	initialWg.Add(1)
+	gotFirstJob := false
+
+	m.WorkProvider.RegisterWorkListener(workChan)
+	go func() {
+		for work := range workChan {
+			workLock.Lock()
+			newWork = work
+			m.LogNewWork(m.WorkProvider, newWork)
+			if !gotFirstJob {
+				gotFirstJob = true
+				initialWg.Done()
+			}
+			workLock.Unlock()
+		}
+	}()
+
+	// Job that can't be hashed, so that it is only logged once
+	var rejected *stratum.Work
+
+	// Returns true if new work was consumed
+	consumeWork := func() (bool, error) {
+		workLock.Lock()
+		if !miner.IsNewJob(work.Work, newWork) || newWork == rejected {
+			workLock.Unlock()
+			return false, nil
+		}
+		if err := xmrig_crypto.ValidateBlob(newWork.Data, newWork.Size); err != nil {
+			log.Errorf("miner-%d: Skipping job %v: %v", m.Id(), newWork.JobID, err)
+			rejected = newWork
+			workLock.Unlock()
+			return false, nil
+		}
+		seed, ok := miner.JobSeed(newWork.JobID)
+		if !ok {
+			log.Errorf("miner-%d: Skipping job %v: It has no seed hash, which %v needs", m.Id(), newWork.JobID, m.Algorithm())
+			rejected = newWork
+			workLock.Unlock()
+			return false, nil
+		}
+		stratum.WorkCopy(work.Work, newWork)
+		workLock.Unlock()
+		// Building the dataset takes a while, during which new jobs are
+		// still received
+		if err := m.useSeed(seed); err != nil {
+			return false, err
+		}
+		nonces.Reset(nonceRange)
+		return true, nil
+	}
+
+	initialWg.Wait()
+	if _, err := consumeWork(); err != nil {
+		return err
+	}
+	for m.vm == nil {
+		if algorithmFamily(m.Algorithm()) != familyRandomX {
+			return errAlgorithmSwitched
+		}
+		// Wait for a job with a seed hash
+		time.Sleep(100 * time.Millisecond)
+		if _, err := consumeWork(); err != nil {
+			return err
+		}
+	}
+	defer m.vm.Close()
+
+	for {
+		select {
+		case <-m.Restarting():
+			// SetAlgorithm restarts the miner when the algorithm changes
+			if algorithmFamily(m.Algorithm()) != familyRandomX {
+				return errAlgorithmSwitched
+			}
+			// The VM and dataset don't need to be set up again
+			log.Infof("miner-%d: Restarting", m.Id())
+		default:
+		}
+
+		nonce, ok := nonces.Next()
+		if !ok {
+			log.Warnf("miner-%d: Exhausted nonces for job %v, waiting for new job", m.Id(), work.JobID)
+			for {
+				consumed, err := consumeWork()
+				if err != nil {
+					return err
+				}
+				if consumed {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			continue
+		}
+		work.SetNonce(nonce)
+		hashBytes := m.vm.Hash(work.Data[:work.Size])
+		// RandomX hashes take milliseconds, so each one is reported
+		m.InformHashrate(1)
+
+		if miner.MeetsTarget(work.JobID, work.Target, hashBytes) {
+			// The VM reuses the hash buffer
+			m.SubmitWork(work, append([]byte(nil), hashBytes...))
+		}
+		if _, err := consumeWork(); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *RandomXCPUMiner) SubmitWork(work *xmrig_crypto.XMRigWork, hashBytes []byte) error {
+	return m.submitShare(work, hashBytes)
+}
@@ -0,0 +1,42 @@
+package cpuminer
+
+import (
+	"testing"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/randomx"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMiner(t *testing.T) {
+	require := require.New(t)
+
+	provider := &countingProvider{}
+	m, ok := NewMiner(provider, "randomx", true).(*RandomXCPUMiner)
+	require.True(ok)
+	require.True(m.light)
+	_, ok = NewMiner(provider, "cn/2", true).(*XMRigCPUMiner)
+	require.True(ok)
+
+	// Neither miner can be switched to the algorithms of the other
+	require.NotNil(NewRandomXCPUMiner(provider).SetAlgorithm("cn/0"))
+	require.NotNil(NewXMRigCPUMiner(provider).SetAlgorithm("rx/0"))
+
+	require.Equal(xmrig_crypto.HugePagesSize(4, xmrig_crypto.Memory), HugePagesSize(4, 0, "cn/0"))
+	require.Equal(randomx.CacheSize+randomx.DatasetSize+4*randomx.ScratchpadSize, HugePagesSize(4, 3, "rx/0"))
+	// Light mode needs no dataset
+	require.Equal(randomx.CacheSize+4*randomx.ScratchpadSize, HugePagesSize(4, 4, "rx/0"))
+}
+
+func TestRandomXMinerNotCompiled(t *testing.T) {
+	require := require.New(t)
+
+	if randomx.Available {
+		t.Skip("RandomX support was compiled in")
+	}
+	m := NewRandomXCPUMiner(&countingProvider{})
+	require.Nil(m.SetAlgorithm("rx/0"))
+	err := m.Run()
+	require.NotNil(err)
+	require.Contains(err.Error(), "randomx")
+}
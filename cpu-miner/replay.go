@@ -0,0 +1,75 @@
+package cpuminer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unsafe"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// nonceOffset is the offset of the nonce within a hashing blob
+const nonceOffset = 39
+
+// VerifyCapture hashes every share submission found in captured stratum
+// traffic using the job it was submitted for, and logs whether the hash
+// matches the submitted result. It returns the number of matching and
+// mismatching shares
+func VerifyCapture(r io.Reader) (matched int, mismatched int, err error) {
+	mem, err := xmrig_crypto.SetupHugePages(1, xmrig_crypto.Memory)
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx, err := xmrig_crypto.SetupCryptonightContext(mem, 0, xmrig_crypto.Memory)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	jobs := make(map[string]*stratum.Work)
+	onJob := func(work *stratum.Work) {
+		jobs[work.JobID] = work
+	}
+	onSubmit := func(submit *miner.CapturedSubmit) {
+		hash, err := hashCapturedSubmit(jobs[submit.JobID], submit, ctx)
+		if err != nil {
+			log.Errorf("replay: job %v nonce %v: %v", submit.JobID, submit.Nonce, err)
+			mismatched++
+			return
+		}
+		if strings.EqualFold(hash, submit.Result) {
+			log.Infof("replay: job %v nonce %v: OK", submit.JobID, submit.Nonce)
+			matched++
+		} else {
+			log.Errorf("replay: job %v nonce %v: result %v does not match hash %v", submit.JobID, submit.Nonce, submit.Result, hash)
+			mismatched++
+		}
+	}
+	err = miner.ReadCapture(r, onJob, onSubmit)
+	return matched, mismatched, err
+}
+
+func hashCapturedSubmit(job *stratum.Work, submit *miner.CapturedSubmit, ctx unsafe.Pointer) (string, error) {
+	if job == nil {
+		return "", fmt.Errorf("Unknown job")
+	}
+	nonce, err := hex.DecodeString(submit.Nonce)
+	if err != nil || len(nonce) != 4 {
+		return "", fmt.Errorf("Invalid nonce")
+	}
+	work := xmrig_crypto.NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(job.Data))
+	copy(work.Data, job.Data)
+	work.Size = job.Size
+	work.Target = job.Target
+	work.JobID = job.JobID
+	copy(work.Data[nonceOffset:nonceOffset+4], nonce)
+	work.UpdateCData()
+
+	hashBytes, _ := xmrig_crypto.CryptonightHash(work, ctx)
+	return hex.EncodeToString(hashBytes), nil
+}
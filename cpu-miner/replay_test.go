@@ -0,0 +1,33 @@
+package cpuminer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCapture(t *testing.T) {
+	require := require.New(t)
+
+	// Same job as TestWorkGeneratorHash
+	work := xmrig_crypto.NewWorkGenerator(0, 1).Next()
+	blob := hex.EncodeToString(work.Data[:work.Size])
+	expected := "b7395156971bfa27dc804585c225ba19ce08d7ef07ba025204a4ecb07abcff1b"
+
+	capture := strings.Join([]string{
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"job","params":{"blob":"%s","job_id":"1","target":"ffffffff"}}`, blob),
+		fmt.Sprintf(`{"id":2,"method":"submit","params":{"id":"abc","job_id":"1","nonce":"00000000","result":"%s"}}`, expected),
+		fmt.Sprintf(`{"id":3,"method":"submit","params":{"id":"abc","job_id":"1","nonce":"01000000","result":"%s"}}`, expected),
+		fmt.Sprintf(`{"id":4,"method":"submit","params":{"id":"abc","job_id":"2","nonce":"00000000","result":"%s"}}`, expected),
+	}, "\n")
+
+	matched, mismatched, err := VerifyCapture(strings.NewReader(capture))
+	require.Nil(err)
+	require.Equal(1, matched)
+	// Wrong nonce and unknown job
+	require.Equal(2, mismatched)
+}
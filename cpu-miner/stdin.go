@@ -0,0 +1,178 @@
+package cpuminer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// Solution is a nonce that meets the target of a job, and the resulting hash
+type Solution struct {
+	Nonce uint32
+	Hash  []byte
+}
+
+// String formats the solution the way it is submitted to a pool: the nonce
+// as 4 little-endian bytes followed by the hash, both in hex
+func (s *Solution) String() string {
+	nonce := make([]byte, 4)
+	binary.LittleEndian.PutUint32(nonce, s.Nonce)
+	return fmt.Sprintf("%s %s", hex.EncodeToString(nonce), hex.EncodeToString(s.Hash))
+}
+
+// Solver searches for nonces that meet a target using one cryptonight
+// context per thread
+type Solver struct {
+	contexts []unsafe.Pointer
+}
+
+// NewSolver returns a Solver that hashes on the given number of threads
+func NewSolver(threads int) (*Solver, error) {
+	if threads < 1 {
+		threads = 1
+	}
+	mem, err := xmrig_crypto.SetupHugePages(uint32(threads), xmrig_crypto.Memory)
+	if err != nil {
+		return nil, err
+	}
+	s := &Solver{make([]unsafe.Pointer, threads)}
+	for i := range s.contexts {
+		if s.contexts[i], err = xmrig_crypto.SetupCryptonightContext(mem, uint32(i), xmrig_crypto.Memory); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Solve returns the first nonce found for blob that meets target. The nonce
+// space is split between the threads, so the nonce found is not necessarily
+// the smallest. nil is returned if no nonce is found within timeout. A
+// timeout of 0 means no timeout
+func (s *Solver) Solve(blob []byte, target *miner.Target, timeout time.Duration) *Solution {
+	job := xmrig_crypto.NewXMRigWork()
+	job.Data = make(stratum.WorkData, len(blob)+128)
+	copy(job.Data, blob)
+	job.Size = len(blob)
+	job.UpdateCData()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	stop := make(chan struct{})
+	solutions := make(chan *Solution, len(s.contexts))
+	wg := sync.WaitGroup{}
+	for i, ctx := range s.contexts {
+		wg.Add(1)
+		go func(index int, ctx unsafe.Pointer) {
+			defer wg.Done()
+			work := job.Clone()
+			nonces := miner.NonceCounter{}
+			nonces.Reset(miner.PartitionNonceSpace(uint32(index), uint32(len(s.contexts))))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				nonce, ok := nonces.Next()
+				if !ok {
+					return
+				}
+				work.SetNonce(nonce)
+				hash, _ := xmrig_crypto.CryptonightHash(work, ctx)
+				if target.Meets(hash) {
+					solutions <- &Solution{nonce, append([]byte(nil), hash...)}
+					return
+				}
+			}
+		}(i, ctx)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	select {
+	case solution := <-solutions:
+		return solution
+	case <-done:
+		// Every thread exhausted its nonces, but one may have found a
+		// solution right before
+		select {
+		case solution := <-solutions:
+			return solution
+		default:
+			return nil
+		}
+	case <-deadline:
+		return nil
+	}
+}
+
+// SolveJobs reads jobs from r, one per line as "<blob> <target>" in hex, and
+// writes one line to w for each of them: the solution found, "timeout" if
+// none was found within timeout, or "invalid" if the job could not be parsed.
+// Targets are accepted in any of the forms pools send them
+func (s *Solver) SolveJobs(r io.Reader, w io.Writer, timeout time.Duration) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		blob, target, err := parseStdinJob(line)
+		var result string
+		if err != nil {
+			log.Errorf("stdin: %v", err)
+			result = "invalid"
+		} else if solution := s.Solve(blob, target, timeout); solution != nil {
+			result = solution.String()
+		} else {
+			log.Warnf("stdin: No nonce found within %v", timeout)
+			result = "timeout"
+		}
+		if _, err := fmt.Fprintln(w, result); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseStdinJob(line string) ([]byte, *miner.Target, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("Expected '<blob> <target>', got '%v'", line)
+	}
+	blob, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid blob: %v", err)
+	}
+	if len(blob) < nonceOffset+4 {
+		return nil, nil, fmt.Errorf("Blob is too short: %d bytes", len(blob))
+	}
+	target, err := miner.ParseTarget(fields[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return blob, target, nil
+}
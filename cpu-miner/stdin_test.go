@@ -0,0 +1,40 @@
+package cpuminer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSolveJobs(t *testing.T) {
+	require := require.New(t)
+
+	// A single thread makes the nonce found deterministic
+	solver, err := NewSolver(1)
+	require.Nil(err)
+
+	work := xmrig_crypto.NewWorkGenerator(0, 1).Next()
+	blob := hex.EncodeToString(work.Data[:work.Size])
+	input := strings.Join([]string{
+		// Difficulty 1, the first nonce tried by the first thread is a solution
+		fmt.Sprintf("%s ffffffff", blob),
+		"zz ffffffff",
+		// Unsolvable within the timeout
+		fmt.Sprintf("%s 0000000000000000000000000000000000000000000000000000000000000001", blob),
+	}, "\n")
+
+	var out bytes.Buffer
+	require.Nil(solver.SolveJobs(strings.NewReader(input), &out, time.Second))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Equal(3, len(lines))
+	// Same hash as TestVerifyCapture
+	require.Equal("00000000 b7395156971bfa27dc804585c225ba19ce08d7ef07ba025204a4ecb07abcff1b", lines[0])
+	require.Equal("invalid", lines[1])
+	require.Equal("timeout", lines[2])
+}
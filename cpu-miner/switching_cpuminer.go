@@ -0,0 +1,165 @@
+package cpuminer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/randomx"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// Families of algorithms that are hashed by the same kind of miner
+const (
+	familyCryptonight = iota
+	familyRandomX
+	// familyAlgorithm are the algorithms registered with
+	// miner.RegisterAlgorithm that have no miner of their own
+	familyAlgorithm
+)
+
+// errAlgorithmSwitched is returned by the run loop of a miner when its
+// algorithm was switched to the family of another miner
+var errAlgorithmSwitched = fmt.Errorf("Algorithm switched to another miner")
+
+// algorithmFamily returns the family of the miner that hashes algo
+func algorithmFamily(algo string) int {
+	if IsRandomX(algo) {
+		return familyRandomX
+	}
+	if _, ok := xmrig_crypto.AlgorithmVariant(miner.NormalizeAlgorithm(algo)); !ok && miner.IsAlgorithmRegistered(algo) {
+		return familyAlgorithm
+	}
+	return familyCryptonight
+}
+
+// CanHash returns true if the CPU miners implement algo
+func CanHash(algo string) bool {
+	switch algorithmFamily(algo) {
+	case familyRandomX:
+		return randomx.Available
+	case familyAlgorithm:
+		return true
+	}
+	_, ok := xmrig_crypto.AlgorithmVariant(miner.NormalizeAlgorithm(algo))
+	return ok
+}
+
+// newFamilyMiner returns the miner that hashes the family of algo with cpu.
+// light selects the light mode of RandomX and is ignored for other
+// algorithms
+func newFamilyMiner(cpu *CPUMiner, algo string, light bool) miner.Interface {
+	switch algorithmFamily(algo) {
+	case familyRandomX:
+		return &RandomXCPUMiner{cpu, nil, 0, light}
+	case familyAlgorithm:
+		return &AlgorithmCPUMiner{cpu, nil}
+	}
+	return &XMRigCPUMiner{cpu, 0}
+}
+
+// workForwarder is the work provider of the miners that a SwitchingCPUMiner
+// runs one after another. It listens to the pool once and forwards jobs to
+// the listener of the running miner only. The listener of the previous miner
+// is closed, which ends the goroutine that received its jobs
+type workForwarder struct {
+	miner.WorkProvider
+	sync.Mutex
+	listener chan<- *stratum.Work
+	// last is the latest job, which a newly started miner begins with
+	last *stratum.Work
+}
+
+func newWorkForwarder(provider miner.WorkProvider) *workForwarder {
+	return &workForwarder{
+		provider,
+		sync.Mutex{},
+		nil,
+		nil,
+	}
+}
+
+// RegisterWorkListener makes workChan the only listener that jobs are
+// forwarded to, and sends it the latest job
+func (f *workForwarder) RegisterWorkListener(workChan chan<- *stratum.Work) {
+	f.Lock()
+	if f.listener != nil {
+		close(f.listener)
+	}
+	f.listener = workChan
+	f.Unlock()
+	// The miner starts receiving from workChan after registering it
+	go f.forward(workChan)
+}
+
+// forward sends the latest job to listener, unless another listener was
+// registered since
+func (f *workForwarder) forward(listener chan<- *stratum.Work) {
+	f.Lock()
+	defer f.Unlock()
+	if listener == nil || listener != f.listener || f.last == nil {
+		return
+	}
+	listener <- f.last
+}
+
+// run forwards the jobs received on workChan. This function is expected to
+// be run in a goroutine
+func (f *workForwarder) run(workChan <-chan *stratum.Work) {
+	for work := range workChan {
+		f.Lock()
+		f.last = work
+		listener := f.listener
+		f.Unlock()
+		f.forward(listener)
+	}
+}
+
+// SwitchingCPUMiner hashes every algorithm that the CPU miners implement. It
+// runs the miner of the family of its algorithm, and when the pool switches
+// to an algorithm of another family, e.g. from cryptonight to RandomX, the
+// running miner tears down its context and returns, and the miner of the new
+// family is started in its place. The RandomX dataset is kept when switching
+// away from it, so switching back doesn't allocate it again
+type SwitchingCPUMiner struct {
+	*CPUMiner
+	forwarder *workForwarder
+	light     bool
+}
+
+// NewSwitchingCPUMiner returns a SwitchingCPUMiner. light selects the light
+// mode of RandomX
+func NewSwitchingCPUMiner(provider miner.WorkProvider, light bool) miner.Interface {
+	forwarder := newWorkForwarder(provider)
+	return &SwitchingCPUMiner{
+		New(forwarder),
+		forwarder,
+		light,
+	}
+}
+
+// SetAlgorithm sets the algorithm this miner runs. A running miner of
+// another family returns from its run loop the next time around it
+func (m *SwitchingCPUMiner) SetAlgorithm(algo string) error {
+	if !CanHash(algo) {
+		return fmt.Errorf("Algorithm '%v' is not implemented by the CPU miners", miner.NormalizeAlgorithm(algo))
+	}
+	return m.Miner.SetAlgorithm(algo)
+}
+
+func (m *SwitchingCPUMiner) Run() error {
+	workChan := make(chan *stratum.Work, 0)
+	m.forwarder.WorkProvider.RegisterWorkListener(workChan)
+	go m.forwarder.run(workChan)
+
+	for {
+		algo := m.Algorithm()
+		err := newFamilyMiner(m.CPUMiner, algo, m.light).Run()
+		if err != errAlgorithmSwitched {
+			return err
+		}
+		log.Infof("miner-%d: Switching from %v to %v, starting its miner", m.Id(), algo, m.Algorithm())
+	}
+}
@@ -0,0 +1,106 @@
+package cpuminer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/randomx"
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+// jobProvider sends job to every listener that registers
+type jobProvider struct {
+	countingProvider
+	job *stratum.Work
+}
+
+func (p *jobProvider) RegisterWorkListener(workChan chan<- *stratum.Work) {
+	go func() {
+		workChan <- p.job
+	}()
+}
+
+func TestCanHash(t *testing.T) {
+	require := require.New(t)
+
+	require.True(CanHash("cryptonight_v8"))
+	require.True(CanHash("cn/gpu"))
+	require.True(CanHash("chukwa"))
+	require.Equal(randomx.Available, CanHash("randomx"))
+	require.False(CanHash("dogecoin"))
+
+	provider := &countingProvider{}
+	m := NewSwitchingCPUMiner(provider, false)
+	require.Nil(m.SetAlgorithm("cn/2"))
+	require.Nil(m.SetAlgorithm("argon2/chukwav2"))
+	require.Equal("argon2/chukwav2", m.Algorithm())
+	require.NotNil(m.SetAlgorithm("dogecoin"))
+}
+
+func TestNewFamilyMiner(t *testing.T) {
+	require := require.New(t)
+
+	cpu := New(&countingProvider{})
+	_, ok := newFamilyMiner(cpu, "cn-pico/trtl", true).(*XMRigCPUMiner)
+	require.True(ok)
+	_, ok = newFamilyMiner(cpu, "chukwa", true).(*AlgorithmCPUMiner)
+	require.True(ok)
+	m, ok := newFamilyMiner(cpu, "rx/0", true).(*RandomXCPUMiner)
+	require.True(ok)
+	require.True(m.light)
+	// The miners share the state of cpu
+	require.Equal(cpu.Id(), m.Id())
+}
+
+func TestWorkForwarder(t *testing.T) {
+	require := require.New(t)
+
+	forwarder := newWorkForwarder(&countingProvider{})
+	jobs := make(chan *stratum.Work)
+	go forwarder.run(jobs)
+
+	first := make(chan *stratum.Work)
+	forwarder.RegisterWorkListener(first)
+	job := stratum.NewWork()
+	job.JobID = "1"
+	jobs <- job
+	require.Equal("1", (<-first).JobID)
+
+	// A new listener gets the latest job, and the previous one is closed
+	second := make(chan *stratum.Work)
+	forwarder.RegisterWorkListener(second)
+	require.Equal("1", (<-second).JobID)
+	_, ok := <-first
+	require.False(ok)
+
+	job = stratum.NewWork()
+	job.JobID = "2"
+	jobs <- job
+	require.Equal("2", (<-second).JobID)
+	close(jobs)
+}
+
+func TestMinerReturnsWhenSwitched(t *testing.T) {
+	require := require.New(t)
+
+	provider := &jobProvider{job: xmrig_crypto.NewWorkGenerator(360, 1).Next().Work}
+	cpu := New(provider)
+	require.Nil(cpu.Miner.SetAlgorithm("chukwa"))
+	m := newFamilyMiner(cpu, "chukwa", false)
+
+	done := make(chan error)
+	go func() {
+		done <- m.Run()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// The algorithm miner can't hash cn/0, so it makes way for the one that can
+	require.Nil(cpu.Miner.SetAlgorithm("cn/0"))
+	select {
+	case err := <-done:
+		require.Equal(errAlgorithmSwitched, err)
+	case <-time.After(5 * time.Second):
+		require.Fail("Miner didn't return after switching algorithms")
+	}
+}
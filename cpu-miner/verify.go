@@ -0,0 +1,73 @@
+package cpuminer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
+)
+
+// Verification is the result of checking a share with VerifyShare
+type Verification struct {
+	Hash       []byte
+	Difficulty uint64
+	Match      bool
+}
+
+// String formats the verification as the computed hash, its difficulty and
+// whether it matches the expected hash
+func (v *Verification) String() string {
+	result := "MISMATCH"
+	if v.Match {
+		result = "OK"
+	}
+	return fmt.Sprintf("hash: %v diff: %d %v", hex.EncodeToString(v.Hash), v.Difficulty, result)
+}
+
+// VerifyShare hashes blob with nonce using algo and compares the hash with
+// expected, so that a share the pool rejected can be checked independently.
+// The nonce is the hex of its 4 bytes as they are submitted to the pool, and
+// expected is the hash in hex as submitted with the share. height is the
+// block height of the job, which is only used by cn/r. The algorithms that
+// are registered with miner.RegisterAlgorithm can be verified, which RandomX
+// isn't
+func VerifyShare(algo string, blob string, nonce string, expected string, height uint64) (*Verification, error) {
+	algo = miner.NormalizeAlgorithm(algo)
+	if !miner.IsAlgorithmSupported(algo) || !miner.IsAlgorithmRegistered(algo) {
+		return nil, fmt.Errorf("Unsupported algorithm '%v'", algo)
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(blob))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid blob: %v", err)
+	}
+	if err := xmrig_crypto.ValidateBlob(data, len(data)); err != nil {
+		return nil, fmt.Errorf("Invalid blob: %v", err)
+	}
+	nonceBytes, err := hex.DecodeString(strings.TrimSpace(nonce))
+	if err != nil || len(nonceBytes) != 4 {
+		return nil, fmt.Errorf("Invalid nonce '%v', expected 4 bytes in hex", nonce)
+	}
+	expectedHash, err := hex.DecodeString(strings.TrimSpace(expected))
+	if err != nil || len(expectedHash) != 32 {
+		return nil, fmt.Errorf("Invalid hash '%v', expected 32 bytes in hex", expected)
+	}
+
+	copy(data[nonceOffset:nonceOffset+4], nonceBytes)
+	job := &miner.AlgorithmJob{
+		Algorithm: algo,
+		Height:    height,
+	}
+	hash, err := miner.NewAlgorithmHasher().Hash(job, data)
+	if err != nil {
+		return nil, err
+	}
+	hash = append([]byte(nil), hash...)
+	return &Verification{
+		hash,
+		miner.ShareDifficulty(hash),
+		bytes.Equal(hash, expectedHash),
+	}, nil
+}
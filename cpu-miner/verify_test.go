@@ -0,0 +1,44 @@
+package cpuminer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// verifyBlob is the hashing blob of a monero block
+const verifyBlob = "0707f7a4f0d605b303260816ba3f10902e1a145ac5fad3aa3af6ea44c11869dc4f853f002b2eea0000000077b206a02ca5b1d4ce6bbfdf0acac38bded34d2dcdeef95cd20cefc12f61d56109"
+
+func TestVerifyShare(t *testing.T) {
+	require := require.New(t)
+
+	hash := "5e7c9366ad01c0f52b4407b631da33eae8e620b244c49a2c645f4b3d9c991f5e"
+	v, err := VerifyShare("cryptonight", verifyBlob, "78563412", hash, 0)
+	require.Nil(err)
+	require.True(v.Match)
+	require.Equal(hash, v.String()[len("hash: "):len("hash: ")+64])
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF/0x5e1f999c3d4b5f64), v.Difficulty)
+
+	// The nonce as a big-endian number gives a different hash
+	v, err = VerifyShare("cn/0", verifyBlob, "12345678", hash, 0)
+	require.Nil(err)
+	require.False(v.Match)
+	require.Contains(v.String(), "MISMATCH")
+
+	// Chukwa is hashed with Argon2id rather than a cryptonight context
+	v, err = VerifyShare("chukwa", verifyBlob, "78563412", "eec61e56bcf5543434f9e5b98b641efa3cb69e37c2c15a61bcdee3f850911188", 0)
+	require.Nil(err)
+	require.True(v.Match)
+
+	// RandomX isn't a registered algorithm
+	_, err = VerifyShare("rx/0", verifyBlob, "78563412", hash, 0)
+	require.NotNil(err)
+	_, err = VerifyShare("cn/fast", verifyBlob, "78563412", hash, 0)
+	require.NotNil(err)
+	_, err = VerifyShare("cn/0", verifyBlob[:60], "78563412", hash, 0)
+	require.NotNil(err)
+	_, err = VerifyShare("cn/0", verifyBlob, "785634", hash, 0)
+	require.NotNil(err)
+	_, err = VerifyShare("cn/0", verifyBlob, "78563412", hash[:62], 0)
+	require.NotNil(err)
+}
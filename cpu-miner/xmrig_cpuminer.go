@@ -1,10 +1,12 @@
 package cpuminer
 
 import (
-	"strings"
+	"fmt"
 	"sync"
+	"time"
 	"unsafe"
 
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/randomx"
 	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	"github.com/gurupras/go-cryptonight-miner/miner"
 	stratum "github.com/gurupras/go-stratum-client"
@@ -12,33 +14,117 @@ import (
 )
 
 var globalMemoryLock sync.Mutex
-var globalMemory unsafe.Pointer
+
+// globalMemory holds the scratchpads of all the miners by their size, since
+// miners that switch algorithms can need larger ones
+var globalMemory = make(map[int]unsafe.Pointer)
 
 type XMRigCPUMiner struct {
 	*CPUMiner
+	// Size of the scratchpad of CryptonightContext
+	scratchpad int
+}
+
+// SetupMemory allocates the scratchpads that all the miners that were
+// created need for algo. Miners do this when they start or switch to an
+// algorithm with another scratchpad size, if it wasn't done already. The
+// RandomX VMs allocate their own scratchpads and the other registered
+// algorithms use the Go heap
+func SetupMemory(algo string) error {
+	if algorithmFamily(algo) != familyCryptonight {
+		return nil
+	}
+	_, err := setupMemory(scratchpadSize(algo))
+	return err
+}
+
+// HugePagesSize returns the memory in bytes that totalMiners mining algo
+// use, which should be reserved as huge pages. lightMiners of them hash
+// RandomX in light mode, which needs no dataset if all of them do. The
+// other registered algorithms, like Chukwa and AstroBWT, need no huge pages
+func HugePagesSize(totalMiners uint32, lightMiners uint32, algo string) int {
+	if algorithmFamily(algo) == familyAlgorithm {
+		return 0
+	}
+	if IsRandomX(algo) {
+		size := randomx.CacheSize + int(totalMiners)*randomx.ScratchpadSize
+		if lightMiners < totalMiners {
+			size += randomx.DatasetSize
+		}
+		return size
+	}
+	return xmrig_crypto.HugePagesSize(totalMiners, scratchpadSize(algo))
 }
 
-func NewXMRigCPUMiner(sc *stratum.StratumContext) miner.Interface {
-	miner := New(sc)
+// NewMiner creates the CPU miner that hashes algo. light selects the light
+// mode of RandomX and is ignored for other algorithms
+func NewMiner(provider miner.WorkProvider, algo string, light bool) miner.Interface {
+	return newFamilyMiner(New(provider), algo, light)
+}
+
+// scratchpadSize returns the size of the scratchpad that hashing algo needs
+func scratchpadSize(algo string) int {
+	variant, _ := xmrig_crypto.AlgorithmVariant(miner.NormalizeAlgorithm(algo))
+	return xmrig_crypto.ScratchpadSize(variant)
+}
+
+func setupMemory(scratchpad int) (unsafe.Pointer, error) {
+	globalMemoryLock.Lock()
+	defer globalMemoryLock.Unlock()
+	if mem, ok := globalMemory[scratchpad]; ok {
+		return mem, nil
+	}
+	mem, err := xmrig_crypto.SetupHugePages(TotalMiners, scratchpad)
+	if err != nil {
+		return nil, err
+	}
+	globalMemory[scratchpad] = mem
+	return mem, nil
+}
+
+func NewXMRigCPUMiner(provider miner.WorkProvider) miner.Interface {
+	miner := New(provider)
 	return &XMRigCPUMiner{
 		miner,
+		0,
 	}
 }
 
+// SetAlgorithm sets the algorithm this miner runs, which has to be a variant
+// of cryptonight
+func (m *XMRigCPUMiner) SetAlgorithm(algo string) error {
+	if algorithmFamily(algo) != familyCryptonight {
+		return fmt.Errorf("Algorithm '%v' is not implemented by the cryptonight miner", miner.NormalizeAlgorithm(algo))
+	}
+	return m.Miner.SetAlgorithm(algo)
+}
+
+// setupContext points CryptonightContext at this miner's scratchpad of
+// scratchpad bytes
+func (m *XMRigCPUMiner) setupContext(scratchpad int) error {
+	mem, err := setupMemory(scratchpad)
+	if err != nil {
+		return fmt.Errorf("Failed to allocate hugepages: %v", err)
+	}
+	if m.CryptonightContext, err = xmrig_crypto.SetupCryptonightContext(mem, m.Id(), scratchpad); err != nil {
+		return err
+	}
+	m.scratchpad = scratchpad
+	return nil
+}
+
 func (m *XMRigCPUMiner) Run() error {
-	defaultNonce := 0xffffffff / int(TotalMiners) * (int(m.Id()))
+	nonceRange := miner.RigNonceShard.Partition(m.Id(), miner.MinerCount())
+	nonces := miner.NonceCounter{}
 	workLock := sync.Mutex{}
 	work := xmrig_crypto.NewXMRigWork()
+	work.Nicehash = miner.RigNicehash
 	var newWork *stratum.Work
 	var err error
 
-	globalMemoryLock.Lock()
-	if globalMemory == nil {
-		if globalMemory, err = xmrig_crypto.SetupHugePages(TotalMiners); err != nil {
-			log.Fatalf("Failed to allocate hugepages: %v", err)
-		}
+	if err := SetupMemory(m.Algorithm()); err != nil {
+		log.Fatalf("Failed to allocate hugepages: %v", err)
 	}
-	globalMemoryLock.Unlock()
 
 	workChan := make(chan *stratum.Work, 0)
 
@@ -46,12 +132,12 @@ func (m *XMRigCPUMiner) Run() error {
 	initialWg.Add(1)
 	gotFirstJob := false
 
-	m.StratumContext.RegisterWorkListener(workChan)
+	m.WorkProvider.RegisterWorkListener(workChan)
 	go func() {
 		for work := range workChan {
 			workLock.Lock()
 			newWork = work
-			m.LogNewWork(m.StratumContext, newWork)
+			m.LogNewWork(m.WorkProvider, newWork)
 			if !gotFirstJob {
 				gotFirstJob = true
 				initialWg.Done()
@@ -62,23 +148,38 @@ func (m *XMRigCPUMiner) Run() error {
 		}
 	}()
 
-	if m.CryptonightContext, err = xmrig_crypto.SetupCryptonightContext(globalMemory, m.Id()); err != nil {
+	if err = m.setupContext(scratchpadSize(m.Algorithm())); err != nil {
 		return err
 	}
 
-	noncePtr := work.NoncePtr
+	// Job whose blob failed validation, so that it is only logged once
+	var rejected *stratum.Work
 
-	consumeWork := func() {
+	// Returns true if new work was consumed
+	consumeWork := func() bool {
 		workLock.Lock()
 		defer workLock.Unlock()
-		if newWork == nil || strings.Compare(newWork.JobID, work.JobID) == 0 {
-			return
+		if !miner.IsNewJob(work.Work, newWork) || newWork == rejected {
+			return false
+		}
+		if err := xmrig_crypto.ValidateBlob(newWork.Data, newWork.Size); err != nil {
+			// Keep hashing the previous job rather than submitting
+			// shares that the pool would reject as invalid
+			log.Errorf("miner-%d: Skipping job %v: %v", m.Id(), newWork.JobID, err)
+			rejected = newWork
+			return false
 		}
 		//log.Debugf("Thread-%d: Got new work - %s", m.id, newWork.JobID)
 		//log.Debugf("Thread-%d: blob: %v", stratum.BinToStr(newWork.Data))
 		stratum.WorkCopy(work.Work, newWork)
+		height, ok := miner.JobHeight(newWork.JobID)
+		if variant, _ := xmrig_crypto.AlgorithmVariant(m.Algorithm()); variant == xmrig_crypto.VariantR && !ok {
+			log.Warnf("miner-%d: Job %v has no block height, which %v needs, shares will be rejected", m.Id(), newWork.JobID, m.Algorithm())
+		}
+		work.Height = height
 		work.UpdateCData()
-		*noncePtr = uint32(defaultNonce)
+		nonces.Reset(nonceRange)
+		return true
 	}
 
 	var (
@@ -89,8 +190,48 @@ func (m *XMRigCPUMiner) Run() error {
 	log.Debugf("Got first job")
 	consumeWork()
 
+	// The algorithm is read on every hash, so it is only looked up again
+	// when SetAlgorithm restarts the miner
+	variant, _ := xmrig_crypto.AlgorithmVariant(m.Algorithm())
 	for {
-		*noncePtr++
+		select {
+		case <-m.Restarting():
+			// Hashes done so far are reported once, and counting starts over
+			// with the new context
+			if hashesDone > 0 {
+				m.InformHashrate(hashesDone)
+				hashesDone = 0
+			}
+			algo := m.Algorithm()
+			if algorithmFamily(algo) != familyCryptonight {
+				return errAlgorithmSwitched
+			}
+			variant, _ = xmrig_crypto.AlgorithmVariant(algo)
+			log.Infof("miner-%d: Restarting", m.Id())
+			if err = m.setupContext(m.scratchpad); err != nil {
+				return err
+			}
+		default:
+		}
+
+		nonce, ok := nonces.Next()
+		if !ok {
+			// We've run out of nonces for this job. Reusing nonces would only
+			// produce duplicate shares, so idle until we get a new job
+			log.Warnf("miner-%d: Exhausted nonces for job %v, waiting for new job", m.Id(), work.JobID)
+			for !consumeWork() {
+				time.Sleep(100 * time.Millisecond)
+			}
+			continue
+		}
+		work.SetNonce(nonce)
+		work.Variant = variant
+		if scratchpad := xmrig_crypto.ScratchpadSize(work.Variant); scratchpad != m.scratchpad {
+			// The algorithm was switched to one with another scratchpad size
+			if err = m.setupContext(scratchpad); err != nil {
+				return err
+			}
+		}
 		hashesDone++
 
 		if hashesDone&0xFF != 0 {
@@ -98,7 +239,7 @@ func (m *XMRigCPUMiner) Run() error {
 			hashesDone = 0
 		}
 
-		if hashBytes, found := xmrig_crypto.CryptonightHash(work, m.CryptonightContext); found {
+		if hashBytes, found := xmrig_crypto.CryptonightHash(work, m.CryptonightContext); found && miner.MeetsTarget(work.JobID, work.Target, hashBytes) {
 			m.SubmitWork(work, hashBytes)
 		}
 		consumeWork()
@@ -107,9 +248,5 @@ func (m *XMRigCPUMiner) Run() error {
 }
 
 func (m *XMRigCPUMiner) SubmitWork(work *xmrig_crypto.XMRigWork, hashBytes []byte) error {
-	hashHex, err := stratum.BinToHex(hashBytes)
-	if err != nil {
-		return err
-	}
-	return m.StratumContext.SubmitWork(work.Work, hashHex)
+	return m.submitShare(work, hashBytes)
 }
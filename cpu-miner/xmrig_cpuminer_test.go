@@ -6,6 +6,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	stratum "github.com/gurupras/go-stratum-client"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
@@ -16,6 +17,22 @@ func TestWithExternalPool(t *testing.T) {
 	testCPUMiner(t, 4, NewXMRigCPUMiner)
 }
 
+func TestSetupMemory(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(xmrig_crypto.Memory, scratchpadSize("cryptonight"))
+	require.Equal(xmrig_crypto.Memory, scratchpadSize("cn/r"))
+	require.Equal(xmrig_crypto.MemoryHeavy, scratchpadSize("cryptonight-heavy"))
+
+	// The scratchpads of each size are only allocated once
+	mem, err := setupMemory(xmrig_crypto.MemoryHeavy)
+	require.Nil(err)
+	require.NotNil(mem)
+	again, err := setupMemory(xmrig_crypto.MemoryHeavy)
+	require.Nil(err)
+	require.Equal(mem, again)
+}
+
 func TestXMRigSolver(t *testing.T) {
 	log.Warnf("This test may take a while depending on hashing rate")
 	require := require.New(t)
@@ -54,3 +71,35 @@ func TestXMRigSolver(t *testing.T) {
 
 	wg.Wait()
 }
+
+// countingProvider is a WorkProvider that counts submitted shares
+type countingProvider struct {
+	submits int
+}
+
+func (p *countingProvider) RegisterWorkListener(chan<- *stratum.Work) {
+}
+
+func (p *countingProvider) SubmitWork(work *stratum.Work, hash string) error {
+	p.submits++
+	return nil
+}
+
+func TestXMRigSubmitDuplicate(t *testing.T) {
+	require := require.New(t)
+
+	provider := &countingProvider{}
+	m := NewXMRigCPUMiner(provider).(*XMRigCPUMiner)
+	work := xmrig_crypto.NewWorkGenerator(360, 1).Next()
+	hash := make([]byte, 32)
+
+	require.Nil(m.SubmitWork(work, hash))
+	require.Equal(1, provider.submits)
+	// The same job and nonce again is dropped
+	require.Nil(m.SubmitWork(work, hash))
+	require.Equal(1, provider.submits)
+
+	*work.NoncePtr = 1
+	require.Nil(m.SubmitWork(work, hash))
+	require.Equal(2, provider.submits)
+}
@@ -0,0 +1,66 @@
+package xmrig_crypto
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+func init() {
+	for name := range algorithmVariants {
+		miner.RegisterAlgorithm(name, func() miner.Algorithm { return &algorithm{} })
+	}
+}
+
+// algorithm is the miner.Algorithm of the variants of cryptonight. Its
+// scratchpad is allocated by the first Init and is large enough for every
+// variant. Miners that hash cryptonight on the CPU use the scratchpads that
+// SetupHugePages allocated for all threads instead
+type algorithm struct {
+	ctx  unsafe.Pointer
+	work *XMRigWork
+}
+
+// VariantOf returns the algorithm of job, and for cn/r also the block height
+// that its random math is generated from
+func (a *algorithm) VariantOf(job *miner.AlgorithmJob) string {
+	if variant, _ := AlgorithmVariant(job.Algorithm); variant == VariantR {
+		return fmt.Sprintf("%v@%d", job.Algorithm, job.Height)
+	}
+	return job.Algorithm
+}
+
+func (a *algorithm) Init(job *miner.AlgorithmJob) error {
+	variant, ok := AlgorithmVariant(job.Algorithm)
+	if !ok {
+		return fmt.Errorf("Algorithm '%v' is not a variant of cryptonight", job.Algorithm)
+	}
+	if a.ctx == nil {
+		mem, err := SetupHugePages(1, MemoryHeavy)
+		if err != nil {
+			return err
+		}
+		if a.ctx, err = SetupCryptonightContext(mem, 0, MemoryHeavy); err != nil {
+			return err
+		}
+		a.work = NewXMRigWork()
+		a.work.Data = make(stratum.WorkData, maxWorkSize+128)
+		a.work.UpdateCData()
+	}
+	a.work.Variant = variant
+	a.work.Height = job.Height
+	return nil
+}
+
+func (a *algorithm) Hash(blob []byte) ([]byte, error) {
+	if len(blob) > maxWorkSize {
+		return nil, fmt.Errorf("Blob size %d is larger than %d", len(blob), maxWorkSize)
+	}
+	copy(a.work.Data, blob)
+	a.work.Size = len(blob)
+	a.work.UpdateCData()
+	hash, _ := CryptonightHash(a.work, a.ctx)
+	return hash, nil
+}
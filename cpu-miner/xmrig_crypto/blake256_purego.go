@@ -0,0 +1,116 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+var blake256Sigma = [14][16]uint8{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+}
+
+var blake256Constants = [16]uint32{
+	0x243F6A88, 0x85A308D3, 0x13198A2E, 0x03707344,
+	0xA4093822, 0x299F31D0, 0x082EFA98, 0xEC4E6C89,
+	0x452821E6, 0x38D01377, 0xBE5466CF, 0x34E90C6C,
+	0xC0AC29B7, 0xC97C50DD, 0x3F84D5B5, 0xB5470917,
+}
+
+// blake256Compress compresses a 64-byte block into h. t is the number of
+// message bits up to and including this block, or 0 for a block holding
+// only padding
+func blake256Compress(h *[8]uint32, block []byte, t uint64) {
+	var m [16]uint32
+	for i := range m {
+		m[i] = binary.BigEndian.Uint32(block[4*i:])
+	}
+	var v [16]uint32
+	copy(v[:8], h[:])
+	copy(v[8:], blake256Constants[:8])
+	v[12] ^= uint32(t)
+	v[13] ^= uint32(t)
+	v[14] ^= uint32(t >> 32)
+	v[15] ^= uint32(t >> 32)
+
+	g := func(s *[16]uint8, a, b, c, d, e int) {
+		v[a] += (m[s[e]] ^ blake256Constants[s[e+1]]) + v[b]
+		v[d] = bits.RotateLeft32(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -12)
+		v[a] += (m[s[e+1]] ^ blake256Constants[s[e]]) + v[b]
+		v[d] = bits.RotateLeft32(v[d]^v[a], -8)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft32(v[b]^v[c], -7)
+	}
+	for i := range blake256Sigma {
+		s := &blake256Sigma[i]
+		g(s, 0, 4, 8, 12, 0)
+		g(s, 1, 5, 9, 13, 2)
+		g(s, 2, 6, 10, 14, 4)
+		g(s, 3, 7, 11, 15, 6)
+		g(s, 0, 5, 10, 15, 8)
+		g(s, 1, 6, 11, 12, 10)
+		g(s, 2, 7, 8, 13, 12)
+		g(s, 3, 4, 9, 14, 14)
+	}
+	for i := range v {
+		h[i%8] ^= v[i]
+	}
+}
+
+// blake256 returns the BLAKE-256 hash of data
+func blake256(data []byte) []byte {
+	h := [8]uint32{
+		0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+		0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+	}
+	bitLen := uint64(len(data)) * 8
+	t := uint64(0)
+	for ; len(data) >= 64; data = data[64:] {
+		t += 512
+		blake256Compress(&h, data, t)
+	}
+
+	// Padding: a 1 bit, zeros, a 1 bit and the 64-bit message length
+	var pad [128]byte
+	n := copy(pad[:], data)
+	pad[n] = 0x80
+	size := 64
+	if n > 55 {
+		size = 128
+	}
+	pad[size-9] |= 0x01
+	binary.BigEndian.PutUint64(pad[size-8:], bitLen)
+	if n == 0 {
+		t = 0
+	} else {
+		t += uint64(n) * 8
+	}
+	blake256Compress(&h, pad[:64], t)
+	if size == 128 {
+		// The second padding block holds no message bits
+		blake256Compress(&h, pad[64:], 0)
+	}
+
+	out := make([]byte, 32)
+	for i, v := range h {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /*
  * The blake256_* and blake224_* functions are largely copied from
  * blake256_light.c and blake224_light.c from the BLAKE website:
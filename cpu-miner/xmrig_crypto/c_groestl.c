@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /* hash.c     April 2012
  * Groestl ANSI C code optimised for 32-bit machines
  * Author: Thomas Krinninger
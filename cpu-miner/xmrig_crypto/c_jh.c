@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /*This program gives the 64-bit optimized bitslice implementation of JH using ANSI C
 
    --------------------------------
@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /***********************************************************************
 **
 ** Implementation of the Skein hash function.
@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 package xmrig_crypto
 
 /*
@@ -6,39 +9,17 @@ package xmrig_crypto
 #include "helpers.h"
 #include "cryptonight.h"
 #include "hash.h"
+#include "c_blake256.h"
 */
 import "C"
 import (
 	"fmt"
+	"runtime"
 	"unsafe"
 
-	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
 )
 
-type XMRigWork struct {
-	*stratum.Work
-	Cdata *XMRigCData
-}
-
-func NewXMRigWork() *XMRigWork {
-	return &XMRigWork{
-		stratum.NewWork(),
-		nil,
-	}
-}
-
-func (work *XMRigWork) Clone() *XMRigWork {
-	scWork := stratum.NewWork()
-	stratum.WorkCopy(scWork, work.Work)
-
-	ret := &XMRigWork{
-		scWork,
-		nil,
-	}
-	ret.UpdateCData()
-	return ret
-}
-
 type XMRigCData struct {
 	Input        unsafe.Pointer
 	Target       unsafe.Pointer
@@ -62,19 +43,49 @@ func (work *XMRigWork) UpdateCData() {
 	}
 }
 
-func SetupHugePages(totalMiners uint32) (unsafe.Pointer, error) {
+// SetupHugePages allocates scratchpads of scratchpad bytes for totalMiners
+// threads, see ScratchpadSize
+func SetupHugePages(totalMiners uint32, scratchpad int) (unsafe.Pointer, error) {
 	totalMinersCint := C.int(int(totalMiners))
-	ptr := C.xmrig_setup_hugepages(totalMinersCint)
+	ptr := C.xmrig_setup_hugepages(totalMinersCint, C.int(scratchpad))
 	if ptr != nil {
+		if !HugePagesEnabled() {
+			log.Warnf("Huge pages unavailable, falling back to normal pages: %v", hugePagesUnavailableReason())
+		}
 		return ptr, nil
 	} else {
 		return nil, fmt.Errorf("Failed to set up hugepages")
 	}
 }
 
-func SetupCryptonightContext(memPtr unsafe.Pointer, threadId uint32) (unsafe.Pointer, error) {
+// HugePagesSize returns the number of bytes that SetupHugePages allocates
+// for totalMiners threads with scratchpads of scratchpad bytes
+func HugePagesSize(totalMiners uint32, scratchpad int) int {
+	return scratchpad * (int(totalMiners) + 1)
+}
+
+// HugePagesEnabled returns true if the memory allocated by SetupHugePages is
+// backed by huge (large) pages
+func HugePagesEnabled() bool {
+	return C.xmrig_hugepages_enabled() != 0
+}
+
+func hugePagesUnavailableReason() string {
+	if runtime.GOOS == "windows" {
+		if C.xmrig_lock_pages_privilege() == 0 {
+			return "SeLockMemoryPrivilege is not held by this process. If it was just granted, log off and back on for it to take effect"
+		}
+		return "VirtualAlloc(MEM_LARGE_PAGES) failed, memory may be too fragmented"
+	}
+	return "failed to map huge pages, check that they have been reserved"
+}
+
+// SetupCryptonightContext returns the context of thread threadId within the
+// memory allocated by SetupHugePages, which must have been called with the
+// same scratchpad size
+func SetupCryptonightContext(memPtr unsafe.Pointer, threadId uint32, scratchpad int) (unsafe.Pointer, error) {
 	threadIdCint := C.int(int(threadId))
-	ptr := C.xmrig_thread_persistent_ctx(memPtr, threadIdCint)
+	ptr := C.xmrig_thread_persistent_ctx(memPtr, threadIdCint, C.int(scratchpad))
 	if ptr != nil {
 		return ptr, nil
 	} else {
@@ -91,6 +102,9 @@ func SetupSimpleCryptonightContext() (unsafe.Pointer, error) {
 	}
 }
 
+// CryptonightHash hashes work and returns true if the most significant 64
+// bits of the hash are within the work target. Shares that pass should be
+// checked against the full target with miner.MeetsTarget before submitting
 func CryptonightHash(work *XMRigWork, ctx unsafe.Pointer) ([]byte, bool) {
 	target := work.Work.Target
 	targetPtr := unsafe.Pointer(&target)
@@ -103,10 +117,21 @@ func CryptonightHash(work *XMRigWork, ctx unsafe.Pointer) ([]byte, bool) {
 	// log.Debugf("cdata.hashbytesptr=%X", work.Cdata.HashBytesPtr)
 	// log.Debugf("ctx=%X", ctx)
 
-	found := C.xmrig_cryptonight_hash_wrapper(work.Cdata.Input, work.Cdata.Size, work.Cdata.HashBytesPtr, targetPtr, ctx)
+	var code *C.struct_V4_Instruction
+	if work.Variant == VariantR {
+		code = (*C.struct_V4_Instruction)(unsafe.Pointer(&RandomMath(work.Height)[0]))
+	}
+	found := C.xmrig_cryptonight_hash_wrapper(work.Cdata.Input, work.Cdata.Size, work.Cdata.HashBytesPtr, targetPtr, ctx, C.int(work.Variant), code)
 	return work.Cdata.HashBytes, found == 1
 }
 
+// blake256 returns the blake-256 hash of data
+func blake256(data []byte) []byte {
+	ret := make([]byte, 32)
+	C.blake256_hash((*C.uint8_t)(unsafe.Pointer(&ret[0])), (*C.uint8_t)(unsafe.Pointer(&data[0])), C.uint64_t(len(data)))
+	return ret
+}
+
 func SelfTest() error {
 	ret := C.xmrig_self_test()
 	if ret != 0 {
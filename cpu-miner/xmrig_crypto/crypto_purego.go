@@ -0,0 +1,131 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// This file provides the API of crypto.go on top of a pure Go cryptonight
+// implementation, for platforms and builds without cgo. It is much slower
+// than the native code and meant for portability and tests
+
+type XMRigCData struct {
+	Input        unsafe.Pointer
+	Target       unsafe.Pointer
+	Size         int
+	HashBytes    []byte
+	HashBytesPtr unsafe.Pointer
+}
+
+func (work *XMRigWork) UpdateCData() {
+	if work.Cdata == nil {
+		work.Cdata = &XMRigCData{
+			unsafe.Pointer(&work.Data[0]),
+			nil,
+			work.Size,
+			make([]byte, 32),
+			nil,
+		}
+		work.Cdata.HashBytesPtr = unsafe.Pointer(&work.Cdata.HashBytes[0])
+	} else {
+		work.Cdata.Size = work.Size
+	}
+}
+
+// contextPool stands in for the memory that the native code allocates for
+// the scratchpads of all threads
+type contextPool struct {
+	sync.Mutex
+	contexts   []*cryptonightContext
+	scratchpad int
+}
+
+// SetupHugePages allocates scratchpads of scratchpad bytes for totalMiners
+// threads, see ScratchpadSize
+func SetupHugePages(totalMiners uint32, scratchpad int) (unsafe.Pointer, error) {
+	log.Warnf("Using the pure Go cryptonight implementation, hashing will be slow")
+	pool := &contextPool{
+		contexts:   make([]*cryptonightContext, totalMiners),
+		scratchpad: scratchpad,
+	}
+	return unsafe.Pointer(pool), nil
+}
+
+// HugePagesSize returns the number of bytes of huge pages that
+// SetupHugePages allocates for totalMiners threads. The pure Go
+// implementation doesn't use huge pages
+func HugePagesSize(totalMiners uint32, scratchpad int) int {
+	return 0
+}
+
+// HugePagesEnabled returns true if the memory allocated by SetupHugePages is
+// backed by huge (large) pages. It never is with the pure Go implementation
+func HugePagesEnabled() bool {
+	return false
+}
+
+// SetupCryptonightContext returns the context of thread threadId within the
+// memory allocated by SetupHugePages, which must have been called with the
+// same scratchpad size
+func SetupCryptonightContext(memPtr unsafe.Pointer, threadId uint32, scratchpad int) (unsafe.Pointer, error) {
+	pool := (*contextPool)(memPtr)
+	if pool == nil || int(threadId) >= len(pool.contexts) || scratchpad > pool.scratchpad {
+		return nil, fmt.Errorf("Failed to get cryptonight context for thread: %d", threadId)
+	}
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.contexts[threadId] == nil {
+		pool.contexts[threadId] = newCryptonightContext(pool.scratchpad)
+	}
+	return unsafe.Pointer(pool.contexts[threadId]), nil
+}
+
+func SetupSimpleCryptonightContext() (unsafe.Pointer, error) {
+	return unsafe.Pointer(newCryptonightContext(Memory)), nil
+}
+
+// CryptonightHash hashes work and returns true if the most significant 64
+// bits of the hash are within the work target. Shares that pass should be
+// checked against the full target with miner.MeetsTarget before submitting
+func CryptonightHash(work *XMRigWork, ctx unsafe.Pointer) ([]byte, bool) {
+	var code []V4Instruction
+	if work.Variant == VariantR {
+		code = RandomMath(work.Height)
+	}
+	(*cryptonightContext)(ctx).hash(work.Data[:work.Size], work.Cdata.HashBytes, work.Variant, code)
+	res := binary.LittleEndian.Uint64(work.Cdata.HashBytes[24:])
+	return work.Cdata.HashBytes, res <= work.Work.Target
+}
+
+// selfTestInput and selfTestOutput are the same test vector that the native
+// self test uses
+var (
+	selfTestInput = []byte{
+		0x01, 0x00, 0xFB, 0x8E, 0x8A, 0xC8, 0x05, 0x89, 0x93, 0x23, 0x37, 0x1B, 0xB7, 0x90, 0xDB, 0x19,
+		0x21, 0x8A, 0xFD, 0x8D, 0xB8, 0xE3, 0x75, 0x5D, 0x8B, 0x90, 0xF3, 0x9B, 0x3D, 0x55, 0x06, 0xA9,
+		0xAB, 0xCE, 0x4F, 0xA9, 0x12, 0x24, 0x45, 0x00, 0x00, 0x00, 0x00, 0xEE, 0x81, 0x46, 0xD4, 0x9F,
+		0xA9, 0x3E, 0xE7, 0x24, 0xDE, 0xB5, 0x7D, 0x12, 0xCB, 0xC6, 0xC6, 0xF3, 0xB9, 0x24, 0xD9, 0x46,
+		0x12, 0x7C, 0x7A, 0x97, 0x41, 0x8F, 0x93, 0x48, 0x82, 0x8F, 0x0F, 0x02,
+	}
+	selfTestOutput = []byte{
+		0x1B, 0x60, 0x6A, 0x3F, 0x4A, 0x07, 0xD6, 0x48, 0x9A, 0x1B, 0xCD, 0x07, 0x69, 0x7B, 0xD1, 0x66,
+		0x96, 0xB6, 0x1C, 0x8A, 0xE9, 0x82, 0xF6, 0x1A, 0x90, 0x16, 0x0F, 0x4E, 0x52, 0x82, 0x8A, 0x7F,
+	}
+)
+
+func SelfTest() error {
+	output := make([]byte, 32)
+	newCryptonightContext(Memory).hash(selfTestInput, output, VariantOriginal, nil)
+	if !bytes.Equal(output, selfTestOutput) {
+		return fmt.Errorf("Failed self test")
+	}
+	return nil
+}
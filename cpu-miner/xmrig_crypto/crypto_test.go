@@ -1,8 +1,11 @@
 package xmrig_crypto
 
 import (
+	"encoding/hex"
 	"testing"
 
+	"github.com/gurupras/go-cryptonight-miner/miner"
+	stratum "github.com/gurupras/go-stratum-client"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,3 +23,291 @@ func TestSetupSimpleCryptonightContext(t *testing.T) {
 	require.Nil(err)
 	require.NotNil(ptr)
 }
+
+func TestWorkGeneratorIsDeterministic(t *testing.T) {
+	require := require.New(t)
+
+	g1 := NewWorkGenerator(42, 1000)
+	g2 := NewWorkGenerator(42, 1000)
+	g3 := NewWorkGenerator(43, 1000)
+	for i := 0; i < 10; i++ {
+		w1 := g1.Next()
+		w2 := g2.Next()
+		w3 := g3.Next()
+		require.Equal(w1.JobID, w2.JobID)
+		require.Equal([]byte(w1.Data[:w1.Size]), []byte(w2.Data[:w2.Size]))
+		require.NotEqual([]byte(w1.Data[:w1.Size]), []byte(w3.Data[:w3.Size]))
+		require.Equal(uint32(0), *w1.NoncePtr)
+	}
+}
+
+func TestWorkGeneratorHash(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+
+	work := NewWorkGenerator(0, 1).Next()
+	hashBytes, found := CryptonightHash(work, ctx)
+	require.True(found)
+	require.Equal("b7395156971bfa27dc804585c225ba19ce08d7ef07ba025204a4ecb07abcff1b", hex.EncodeToString(hashBytes))
+}
+
+func TestCryptonightHashVariant2(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+
+	// Test vectors of monero's cryptonight v2
+	vectors := map[string]string{
+		"5468697320697320612074657374205468697320697320612074657374205468697320697320612074657374":             "353fdc068fd47b03c04b9431e005e00b68c2168a3cc7335c8b9b308156591a4f",
+		"4c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e73656374657475722061646970697363696e67": "72f134fc50880c330fe65a2cb7896d59b2e708a0221c6a9da3f69b3a702d8682",
+	}
+	for input, expected := range vectors {
+		data, err := hex.DecodeString(input)
+		require.Nil(err)
+		work := NewXMRigWork()
+		work.Data = make(stratum.WorkData, len(data)+128)
+		copy(work.Data, data)
+		work.Size = len(data)
+		work.Variant = Variant2
+		work.UpdateCData()
+
+		hashBytes, _ := CryptonightHash(work, ctx)
+		require.Equal(expected, hex.EncodeToString(hashBytes), "input %v", input)
+	}
+}
+
+func TestCryptonightHashVariantR(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+
+	// Test vectors of monero's cryptonight-r
+	vectors := []struct {
+		input    string
+		height   uint64
+		expected string
+	}{
+		{"5468697320697320612074657374205468697320697320612074657374205468697320697320612074657374", 1806260, "f759588ad57e758467295443a9bd71490abff8e9dad1b95b6bf2f5d0d78387bc"},
+		{"4c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e73656374657475722061646970697363696e67", 1806261, "5bb833deca2bdd7252a9ccd7b4ce0b6a4854515794b56c207262f7a5b9bdb566"},
+	}
+	for _, v := range vectors {
+		data, err := hex.DecodeString(v.input)
+		require.Nil(err)
+		work := NewXMRigWork()
+		work.Data = make(stratum.WorkData, len(data)+128)
+		copy(work.Data, data)
+		work.Size = len(data)
+		work.Variant = VariantR
+		work.Height = v.height
+		work.UpdateCData()
+
+		hashBytes, _ := CryptonightHash(work, ctx)
+		require.Equal(v.expected, hex.EncodeToString(hashBytes), "height %v", v.height)
+	}
+}
+
+func TestCryptonightHashHeavy(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, MemoryHeavy)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, MemoryHeavy)
+	require.Nil(err)
+
+	// Test vector of xmrig's cryptonight-heavy
+	data, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	work := NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(data)+128)
+	copy(work.Data, data)
+	work.Size = len(data)
+	work.Variant = VariantHeavy
+	work.UpdateCData()
+
+	hashBytes, _ := CryptonightHash(work, ctx)
+	require.Equal("9983f21bdf2010a8d707bb2f14d78664bbe1187f55014b39e5f3d69328e48fc2", hex.EncodeToString(hashBytes))
+}
+
+func TestCryptonightHashLite(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, MemoryLite)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, MemoryLite)
+	require.Nil(err)
+
+	// Test vector of xmrig's cryptonight-lite
+	data, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	work := NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(data)+128)
+	copy(work.Data, data)
+	work.Size = len(data)
+	work.Variant = VariantLite
+	work.UpdateCData()
+
+	hashBytes, _ := CryptonightHash(work, ctx)
+	require.Equal("3695b4b53bb00358b0ad38dc160feb9e004eece09b83a72ef6ba9864d3510c88", hex.EncodeToString(hashBytes))
+}
+
+func TestCryptonightHashPico(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, MemoryPico)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, MemoryPico)
+	require.Nil(err)
+
+	// Test vector of xmrig's cryptonight-pico
+	data, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	work := NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(data)+128)
+	copy(work.Data, data)
+	work.Size = len(data)
+	work.Variant = VariantPico
+	work.UpdateCData()
+
+	hashBytes, _ := CryptonightHash(work, ctx)
+	require.Equal("08f421d7833117300eda66e98f4a2569093df300500173944efc401e9a4a17af", hex.EncodeToString(hashBytes))
+}
+
+func TestCryptonightHashHalf(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+
+	// Test vector of xmrig's cryptonight-half
+	data, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	work := NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(data)+128)
+	copy(work.Data, data)
+	work.Size = len(data)
+	work.Variant = VariantHalf
+	work.UpdateCData()
+
+	hashBytes, _ := CryptonightHash(work, ctx)
+	require.Equal("5d4fbc356097ea6440b0888edeb635ddc84a0e397c868456895c3f29be7312a7", hex.EncodeToString(hashBytes))
+}
+
+func TestCryptonightHashGPU(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+
+	// Test vector of xmrig's cryptonight-gpu
+	data, err := hex.DecodeString("0305a0dbd6bf05cf16e503f3a66f78007cbf34144332ecbfc22ed95c8700383b309ace1923a0964b00000008ba939a62724c0d7581fce5761e9d8a0e6a1c3f924fdd8493d1115649c05eb601")
+	require.Nil(err)
+	work := NewXMRigWork()
+	work.Data = make(stratum.WorkData, len(data)+128)
+	copy(work.Data, data)
+	work.Size = len(data)
+	work.Variant = VariantGPU
+	work.UpdateCData()
+
+	hashBytes, _ := CryptonightHash(work, ctx)
+	require.Equal("e55cb23e51649a59b127b96b515f2bf7bfea199741a0216cf838ded06eff82df", hex.EncodeToString(hashBytes))
+}
+
+func TestAlgorithmVariant(t *testing.T) {
+	require := require.New(t)
+
+	variant, ok := AlgorithmVariant("cn/0")
+	require.True(ok)
+	require.Equal(VariantOriginal, variant)
+	variant, ok = AlgorithmVariant("cn/2")
+	require.True(ok)
+	require.Equal(Variant2, variant)
+	variant, ok = AlgorithmVariant("cn/r")
+	require.True(ok)
+	require.Equal(VariantR, variant)
+	variant, ok = AlgorithmVariant("cn-heavy/0")
+	require.True(ok)
+	require.Equal(VariantHeavy, variant)
+	variant, ok = AlgorithmVariant("cn-lite/0")
+	require.True(ok)
+	require.Equal(VariantLite, variant)
+	variant, ok = AlgorithmVariant("cn-pico/trtl")
+	require.True(ok)
+	require.Equal(VariantPico, variant)
+	variant, ok = AlgorithmVariant("cn/half")
+	require.True(ok)
+	require.Equal(VariantHalf, variant)
+	variant, ok = AlgorithmVariant("cn/gpu")
+	require.True(ok)
+	require.Equal(VariantGPU, variant)
+	_, ok = AlgorithmVariant("cn/fast")
+	require.False(ok)
+
+	algo, ok := VariantAlgorithm(VariantPico)
+	require.True(ok)
+	require.Equal("cn-pico/trtl", algo)
+	_, ok = VariantAlgorithm(-1)
+	require.False(ok)
+
+	require.Equal(Memory, ScratchpadSize(VariantR))
+	require.Equal(MemoryHeavy, ScratchpadSize(VariantHeavy))
+	require.Equal(MemoryLite, ScratchpadSize(VariantLite))
+	require.Equal(MemoryPico, ScratchpadSize(VariantPico))
+	require.Equal(Memory, ScratchpadSize(VariantHalf))
+	require.Equal(Memory, ScratchpadSize(VariantGPU))
+}
+
+func BenchmarkCryptonightHash(b *testing.B) {
+	mem, err := SetupHugePages(1, Memory)
+	if err != nil {
+		b.Fatalf("Failed to set up hugepages: %v", err)
+	}
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	if err != nil {
+		b.Fatalf("Failed to set up cryptonight context: %v", err)
+	}
+
+	work := NewWorkGenerator(0, 1).Next()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		*work.NoncePtr++
+		CryptonightHash(work, ctx)
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	for name := range algorithmVariants {
+		require.True(miner.IsAlgorithmRegistered(name))
+	}
+
+	// The random math of cn/r follows the height of the job
+	h := miner.NewAlgorithmHasher()
+	data, err := hex.DecodeString("5468697320697320612074657374205468697320697320612074657374205468697320697320612074657374")
+	require.Nil(err)
+	hash, err := h.Hash(&miner.AlgorithmJob{Algorithm: "cn/r", Height: 1806260}, data)
+	require.Nil(err)
+	require.Equal("f759588ad57e758467295443a9bd71490abff8e9dad1b95b6bf2f5d0d78387bc", hex.EncodeToString(hash))
+	data, err = hex.DecodeString("4c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e73656374657475722061646970697363696e67")
+	require.Nil(err)
+	hash, err = h.Hash(&miner.AlgorithmJob{Algorithm: "cn/r", Height: 1806261}, data)
+	require.Nil(err)
+	require.Equal("5bb833deca2bdd7252a9ccd7b4ce0b6a4854515794b56c207262f7a5b9bdb566", hex.EncodeToString(hash))
+
+	_, err = h.Hash(&miner.AlgorithmJob{Algorithm: "cn/r", Height: 1806261}, make([]byte, maxWorkSize+1))
+	require.NotNil(err)
+}
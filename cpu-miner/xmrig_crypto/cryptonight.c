@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /* XMRig
  * Copyright 2010      Jeff Garzik <jgarzik@pobox.com>
  * Copyright 2012-2014 pooler      <pooler@litecoinpool.org>
@@ -34,55 +37,55 @@
 
 #include <stdio.h>
 
-static void cryptonight_av1_aesni(const void *input, size_t size, const void *output, struct cryptonight_ctx *ctx) {
+static void cryptonight_av1_aesni(const void *input, size_t size, const void *output, struct cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
 #   if !defined(XMRIG_ARMv7)
-    arch_cryptonight_hash(input, size, output, ctx);
+    arch_cryptonight_hash(input, size, output, ctx, variant, code);
 #   endif
 }
 
 
-static void cryptonight_av2_aesni_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
+static void cryptonight_av2_aesni_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
 #   if !defined(XMRIG_ARMv7)
-    arch_cryptonight_double_hash(input, size, output, ctx);
+    arch_cryptonight_double_hash(input, size, output, ctx, variant, code);
 #   endif
 }
 
 
-static void cryptonight_av3_softaes(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
-    arch_cryptonight_hash(input, size, output, ctx);
+static void cryptonight_av3_softaes(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
+    arch_cryptonight_hash(input, size, output, ctx, variant, code);
 }
 
 
-static void cryptonight_av4_softaes_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
-    arch_cryptonight_double_hash(input, size, output, ctx);
+static void cryptonight_av4_softaes_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
+    arch_cryptonight_double_hash(input, size, output, ctx, variant, code);
 }
 
 
 #ifndef XMRIG_NO_AEON
-static void cryptonight_lite_av1_aesni(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
+static void cryptonight_lite_av1_aesni(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
     #   if !defined(XMRIG_ARMv7)
-    arch_cryptonight_hash(input, size, output, ctx);
+    arch_cryptonight_hash(input, size, output, ctx, variant, code);
 #endif
 }
 
 
-static void cryptonight_lite_av2_aesni_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
+static void cryptonight_lite_av2_aesni_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
 #   if !defined(XMRIG_ARMv7)
-    arch_cryptonight_double_hash(input, size, output, ctx);
+    arch_cryptonight_double_hash(input, size, output, ctx, variant, code);
 #   endif
 }
 
 
-static void cryptonight_lite_av3_softaes(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
-    arch_cryptonight_hash(input, size, output, ctx);
+static void cryptonight_lite_av3_softaes(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
+    arch_cryptonight_hash(input, size, output, ctx, variant, code);
 }
 
 
-static void cryptonight_lite_av4_softaes_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) {
-    arch_cryptonight_double_hash(input, size, output, ctx);
+static void cryptonight_lite_av4_softaes_double(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) {
+    arch_cryptonight_double_hash(input, size, output, ctx, variant, code);
 }
 
-void (*cryptonight_variations[8])(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) = {
+void (*cryptonight_variations[8])(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) = {
             cryptonight_av1_aesni,
             cryptonight_av2_aesni_double,
             cryptonight_av3_softaes,
@@ -93,7 +96,7 @@ void (*cryptonight_variations[8])(const void *input, size_t size, const void *ou
             cryptonight_lite_av4_softaes_double
         };
 #else
-void (*cryptonight_variations[4])(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) = {
+void (*cryptonight_variations[4])(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) = {
             cryptonight_av1_aesni,
             cryptonight_av2_aesni_double,
             cryptonight_av3_softaes,
@@ -101,23 +104,24 @@ void (*cryptonight_variations[4])(const void *input, size_t size, const void *ou
         };
 #endif
 
-void (*cryptonight_hash_ctx)(const void *input, size_t size, const void *output, cryptonight_ctx *ctx) = cryptonight_av1_aesni;
+void (*cryptonight_hash_ctx)(const void *input, size_t size, const void *output, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code) = cryptonight_av1_aesni;
 
-bool xmrig_cryptonight_hash(const void *input, int size, const void *output, const void *target, cryptonight_ctx *ctx)
+bool xmrig_cryptonight_hash(const void *input, int size, const void *output, const void *target, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code)
 {
-    cryptonight_hash_ctx(input, size, output, ctx);
+    cryptonight_hash_ctx(input, size, output, ctx, variant, code);
 
-    // TODO: Check this
+    // Only the most significant 64 bits are compared here. This lets through
+    // every hash that can meet the target, the exact check is done in Go
     uint64_t res = (*(uint64_t *)(output + 24));
     uint64_t tgt = (*(uint64_t *) target);
     // printf("res=%llX tgt=%llX\n", res, tgt);
-    return res < tgt;
+    return res <= tgt;
 }
 
 
-void xmrig_cryptonight_hash_void(const void *input, size_t size, const void *output, const void *target, cryptonight_ctx *ctx)
+void xmrig_cryptonight_hash_void(const void *input, size_t size, const void *output, const void *target, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code)
 {
-    cryptonight_hash_ctx(input, size, output, ctx);
+    cryptonight_hash_ctx(input, size, output, ctx, variant, code);
 }
 
 
@@ -138,7 +142,7 @@ int xmrig_self_test() {
     struct cryptonight_ctx *ctx = (struct cryptonight_ctx*) _mm_malloc(sizeof(struct cryptonight_ctx), 16);
     ctx->memory = (uint8_t *) _mm_malloc(MEMORY * 2, 16);
 
-    cryptonight_hash_ctx(test_input, 76, output, ctx);
+    cryptonight_hash_ctx(test_input, 76, output, ctx, 0, NULL);
 
     _mm_free(ctx->memory);
     _mm_free(ctx);
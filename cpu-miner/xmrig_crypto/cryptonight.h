@@ -35,6 +35,17 @@
 
 #define MEMORY      2097152 /* 2 MiB */
 #define MEMORY_LITE 1048576 /* 1 MiB */
+#define MEMORY_HEAVY 4194304 /* 4 MiB */
+#define MEMORY_PICO 262144 /* 256 KiB */
+
+/* The variants of cryptonight-heavy, cryptonight-lite, cryptonight-pico,
+ * cryptonight-half and cryptonight-gpu, VariantHeavy, VariantLite,
+ * VariantPico, VariantHalf and VariantGPU in Go */
+#define VARIANT_HEAVY 5
+#define VARIANT_LITE  6
+#define VARIANT_PICO  7
+#define VARIANT_HALF  8
+#define VARIANT_GPU   9
 
 
 struct cryptonight_ctx {
@@ -44,8 +55,29 @@ struct cryptonight_ctx {
 };
 typedef struct cryptonight_ctx cryptonight_ctx;
 
-bool xmrig_cryptonight_hash(const void *input, int size, const void *output, const  void *target, cryptonight_ctx *ctx);
-void xmrig_cryptonight_hash_void(const void *input, size_t size, const void *output, const  void *target, cryptonight_ctx *ctx);
+
+/* Opcodes of the random math of cryptonight-r */
+enum V4_InstructionList {
+    V4_MUL,
+    V4_ADD,
+    V4_SUB,
+    V4_ROR,
+    V4_ROL,
+    V4_XOR,
+    V4_RET
+};
+
+/* An instruction of the random math of cryptonight-r, generated in Go by
+ * GenerateRandomMath */
+struct V4_Instruction {
+    uint8_t opcode;
+    uint8_t dst_index;
+    uint8_t src_index;
+    uint32_t C;
+};
+
+bool xmrig_cryptonight_hash(const void *input, int size, const void *output, const  void *target, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code);
+void xmrig_cryptonight_hash_void(const void *input, size_t size, const void *output, const  void *target, cryptonight_ctx *ctx, int variant, const struct V4_Instruction *code);
 int xmrig_self_test(void);
 
 #endif /* __CRYPTONIGHT_H__ */
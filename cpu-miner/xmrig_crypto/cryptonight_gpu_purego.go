@@ -0,0 +1,250 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// gpuIterations is the number of iterations of the main loop of
+	// cryptonight-gpu
+	gpuIterations = 0xC000
+	// gpuMask addresses the 64-byte lines of the scratchpad of
+	// cryptonight-gpu
+	gpuMask = 0x1FFFC0
+)
+
+// f32x4 is a vector of 4 floats, the way the native code holds them in SSE
+// registers. The results of multiplications are converted to float32
+// explicitly so that they are rounded and never fused with additions
+type f32x4 [4]float32
+
+func (a f32x4) add(b f32x4) (r f32x4) {
+	for i := range r {
+		r[i] = float32(a[i] + b[i])
+	}
+	return r
+}
+
+func (a f32x4) sub(b f32x4) (r f32x4) {
+	for i := range r {
+		r[i] = float32(a[i] - b[i])
+	}
+	return r
+}
+
+func (a f32x4) mul(b f32x4) (r f32x4) {
+	for i := range r {
+		r[i] = float32(a[i] * b[i])
+	}
+	return r
+}
+
+func (a f32x4) div(b f32x4) (r f32x4) {
+	for i := range r {
+		r[i] = float32(a[i] / b[i])
+	}
+	return r
+}
+
+// bits sets the bits of or in each float and clears those not in and
+func (a f32x4) bits(and, or uint32) (r f32x4) {
+	for i := range r {
+		r[i] = math.Float32frombits(math.Float32bits(a[i])&and | or)
+	}
+	return r
+}
+
+// truncate converts the floats to integers rounding towards zero, which
+// gives 0x80000000 for values out of range like cvttps2dq does
+func (a f32x4) truncate() (r [4]uint32) {
+	for i := range r {
+		if f := a[i]; f >= -2147483648.0 && f < 2147483648.0 {
+			r[i] = uint32(int32(f))
+		} else {
+			r[i] = 0x80000000
+		}
+	}
+	return r
+}
+
+func splat(f float32) f32x4 {
+	return f32x4{f, f, f, f}
+}
+
+// gpuExplodeScratchpad fills the scratchpad with keccak of the state, with
+// the index of each 512 byte block mixed into the first word
+func (ctx *cryptonightContext) gpuExplodeScratchpad(size int) {
+	var st, hash [25]uint64
+	for i := range st {
+		st[i] = binary.LittleEndian.Uint64(ctx.state[8*i:])
+	}
+	out := ctx.memory
+	for i := 0; i < size/512; i++ {
+		hash = st
+		hash[0] ^= uint64(i)
+		for _, n := range []int{160, 176, 176} {
+			keccakf(&hash)
+			for j := 0; j < n/8; j++ {
+				binary.LittleEndian.PutUint64(out[8*j:], hash[j])
+			}
+			out = out[n:]
+		}
+	}
+}
+
+func gpuSubRound(n0, n1, n2, n3, rndC f32x4, n, d, c *f32x4) {
+	n1 = n1.add(*c)
+	nn := n0.mul(*c)
+	nn = n1.mul(nn.mul(nn))
+	nn = nn.bits(0xFEFFFFFF, 0x00800000)
+	*n = n.add(nn)
+
+	n3 = n3.sub(*c)
+	dd := n2.mul(*c)
+	dd = n3.mul(dd.mul(dd))
+	dd = dd.bits(0xFEFFFFFF, 0x00800000)
+	*d = d.add(dd)
+
+	// Constant feedback
+	*c = c.add(rndC)
+	*c = c.add(splat(0.734375))
+	r := nn.add(dd).bits(0x807FFFFF, 0x40000000)
+	*c = c.add(r)
+}
+
+func gpuRoundCompute(n0, n1, n2, n3, rndC f32x4, c, r *f32x4) {
+	var n, d f32x4
+	gpuSubRound(n0, n1, n2, n3, rndC, &n, &d, c)
+	gpuSubRound(n1, n2, n3, n0, rndC, &n, &d, c)
+	gpuSubRound(n2, n3, n0, n1, rndC, &n, &d, c)
+	gpuSubRound(n3, n0, n1, n2, rndC, &n, &d, c)
+	gpuSubRound(n3, n2, n1, n0, rndC, &n, &d, c)
+	gpuSubRound(n2, n1, n0, n3, rndC, &n, &d, c)
+	gpuSubRound(n1, n0, n3, n2, rndC, &n, &d, c)
+	gpuSubRound(n0, n3, n2, n1, rndC, &n, &d, c)
+
+	// abs(d) >= 2.0 rules out divisions by zero and overflows
+	d = d.bits(0xFF7FFFFF, 0x40000000)
+	*r = r.add(n.div(d))
+}
+
+// gpuSingleCompute runs 4 rounds starting from cnt and xors the result,
+// rotated by rot bytes, into out. Even rotations start a new sum and odd ones
+// add to it
+func gpuSingleCompute(n0, n1, n2, n3 f32x4, cnt float32, rndC f32x4, sum *f32x4, out *[16]byte, rot int) {
+	c := splat(cnt)
+	var r f32x4
+	for i := 0; i < 4; i++ {
+		gpuRoundCompute(n0, n1, n2, n3, rndC, &c, &r)
+	}
+
+	// A quick fmod, setting the exponent to 2
+	r = r.bits(0x807FFFFF, 0x40000000)
+	if rot%2 != 0 {
+		*sum = sum.add(r)
+	} else {
+		*sum = r
+	}
+
+	var x [16]byte
+	for i, v := range r.mul(splat(536870880.0)).truncate() {
+		binary.LittleEndian.PutUint32(x[4*i:], v)
+	}
+	for i := range out {
+		out[i] ^= x[(i+rot)%16]
+	}
+}
+
+// gpuInner is the main loop of cryptonight-gpu. It runs float math on the
+// four 16-byte chunks of a 64-byte line of the scratchpad, as 32-bit integers
+// converted to floats, and xors the results into them
+func (ctx *cryptonightContext) gpuInner() {
+	// The inputs of each chunk in the order of gpuSingleCompute, and the
+	// counters they start from
+	var order = [4][4][4]int{
+		{{0, 1, 2, 3}, {0, 2, 3, 1}, {0, 3, 1, 2}, {0, 3, 2, 1}},
+		{{1, 0, 2, 3}, {1, 2, 3, 0}, {1, 3, 0, 2}, {1, 3, 2, 0}},
+		{{2, 1, 0, 3}, {2, 0, 3, 1}, {2, 3, 1, 0}, {2, 3, 0, 1}},
+		{{3, 1, 2, 0}, {3, 2, 0, 1}, {3, 0, 1, 2}, {3, 0, 2, 1}},
+	}
+	var counts = [4][4]float32{
+		{1.3437500, 1.2812500, 1.3593750, 1.3671875},
+		{1.4296875, 1.3984375, 1.3828125, 1.3046875},
+		{1.4140625, 1.2734375, 1.2578125, 1.2890625},
+		{1.3203125, 1.3515625, 1.3359375, 1.4609375},
+	}
+
+	l := ctx.memory
+	offset := (binary.LittleEndian.Uint32(ctx.state[:]) >> 8) & gpuMask
+	var sum0 f32x4
+	for i := 0; i < gpuIterations; i++ {
+		var n [4]f32x4
+		for j := range n {
+			for k := range n[j] {
+				n[j][k] = float32(int32(binary.LittleEndian.Uint32(l[offset+uint32(16*j+4*k):])))
+			}
+		}
+		rc := sum0
+
+		var sums [4]f32x4
+		var out2 [16]byte
+		for j := range order {
+			var out [16]byte
+			var suma, sumb f32x4
+			for k, o := range order[j] {
+				sum := &suma
+				if k >= 2 {
+					sum = &sumb
+				}
+				gpuSingleCompute(n[o[0]], n[o[1]], n[o[2]], n[o[3]], counts[j][k], rc, sum, &out, k)
+			}
+			sums[j] = suma.add(sumb)
+			p := l[offset+uint32(16*j):]
+			for k := range out {
+				p[k] ^= out[k]
+				out2[k] ^= out[k]
+			}
+		}
+
+		sum0 = sums[0].add(sums[1]).add(sums[2].add(sums[3]))
+		// abs(sum0), which is below 64
+		sum0 = sum0.bits(0x7FFFFFFF, 0)
+
+		var x [4]uint32
+		for k, v := range sum0.mul(splat(16777216.0)).truncate() {
+			x[k] = v ^ binary.LittleEndian.Uint32(out2[4*k:])
+		}
+		x = [4]uint32{x[0] ^ x[3], x[1] ^ x[2], x[2] ^ x[1], x[3] ^ x[0]}
+		x = [4]uint32{x[0] ^ x[1], x[1] ^ x[0], x[2] ^ x[3], x[3] ^ x[2]}
+
+		// sum0 is fed into the next iteration between 0 and 1
+		sum0 = sum0.div(splat(64.0))
+		offset = x[0] & gpuMask
+	}
+}
+
+// gpuHash computes the cryptonight-gpu hash of input into output. It keeps
+// the AES of the implode of cryptonight-heavy but fills the scratchpad with
+// keccak and replaces the main loop with float math. Its hash is the state
+// after keccak, without the extra hashes
+func (ctx *cryptonightContext) gpuHash(input []byte, output []byte) {
+	st := keccak1600(input)
+	for i, w := range st {
+		binary.LittleEndian.PutUint64(ctx.state[8*i:], w)
+	}
+	ctx.gpuExplodeScratchpad(Memory)
+	ctx.gpuInner()
+	ctx.implodeScratchpad(Memory, true)
+	for i := range st {
+		st[i] = binary.LittleEndian.Uint64(ctx.state[8*i:])
+	}
+	keccakf(&st)
+	for i, w := range st {
+		binary.LittleEndian.PutUint64(ctx.state[8*i:], w)
+	}
+	copy(output, ctx.state[:32])
+}
@@ -0,0 +1,289 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+const (
+	// cryptonightIterations is the number of iterations of the main loop
+	cryptonightIterations = 0x80000
+	// halfIterations is the number of iterations of cryptonight-heavy,
+	// cryptonight-lite and cryptonight-half
+	halfIterations = 0x40000
+	// picoIterations is the number of iterations of cryptonight-pico
+	picoIterations = 0x10000
+)
+
+// extraHashes are the final hashes, selected by the low 2 bits of the state
+var extraHashes = [4]func([]byte) []byte{blake256, groestl256, jh256, skein512256}
+
+// cryptonightContext holds the state and scratchpad of one hashing thread
+type cryptonightContext struct {
+	state  [200]byte
+	memory []byte
+}
+
+// newCryptonightContext returns a context with a scratchpad of scratchpad
+// bytes
+func newCryptonightContext(scratchpad int) *cryptonightContext {
+	return &cryptonightContext{
+		memory: make([]byte, scratchpad),
+	}
+}
+
+// mixAndPropagate xors each of the blocks of text with the next one, which
+// cryptonight-heavy does after every pass of AES rounds
+func mixAndPropagate(text *[8]aesBlock) {
+	first := text[0]
+	for i := 0; i < 7; i++ {
+		for j := range text[i] {
+			text[i][j] ^= text[i+1][j]
+		}
+	}
+	for j := range text[7] {
+		text[7][j] ^= first[j]
+	}
+}
+
+// heavyRounds runs the 16 extra passes of AES rounds and mixing that
+// cryptonight-heavy adds before exploding and after imploding the scratchpad
+func heavyRounds(text *[8]aesBlock, keys *[10]aesBlock) {
+	for r := 0; r < 16; r++ {
+		for i := range text {
+			for k := range keys {
+				text[i] = aesRound(text[i], &keys[k])
+			}
+		}
+		mixAndPropagate(text)
+	}
+}
+
+// explodeScratchpad fills the first size bytes of the scratchpad by
+// repeatedly encrypting bytes 64 to 192 of the state with a key taken from
+// its first 32 bytes
+func (ctx *cryptonightContext) explodeScratchpad(size int, heavy bool) {
+	keys := aesExpandKey(ctx.state[:32])
+	var text [8]aesBlock
+	for i := range text {
+		text[i] = loadAESBlock(ctx.state[64+16*i:])
+	}
+	if heavy {
+		heavyRounds(&text, &keys)
+	}
+	for offset := 0; offset < size; offset += 128 {
+		for i := range text {
+			for k := range keys {
+				text[i] = aesRound(text[i], &keys[k])
+			}
+			text[i].store(ctx.memory[offset+16*i:])
+		}
+	}
+}
+
+// implodeScratchpad folds the first size bytes of the scratchpad back into
+// bytes 64 to 192 of the state with a key taken from bytes 32 to 64.
+// Cryptonight-heavy folds it in twice
+func (ctx *cryptonightContext) implodeScratchpad(size int, heavy bool) {
+	keys := aesExpandKey(ctx.state[32:64])
+	var text [8]aesBlock
+	for i := range text {
+		text[i] = loadAESBlock(ctx.state[64+16*i:])
+	}
+	passes := 1
+	if heavy {
+		passes = 2
+	}
+	for pass := 0; pass < passes; pass++ {
+		for offset := 0; offset < size; offset += 128 {
+			for i := range text {
+				m := loadAESBlock(ctx.memory[offset+16*i:])
+				for j := range m {
+					text[i][j] ^= m[j]
+				}
+				for k := range keys {
+					text[i] = aesRound(text[i], &keys[k])
+				}
+			}
+			if heavy {
+				mixAndPropagate(&text)
+			}
+		}
+	}
+	if heavy {
+		heavyRounds(&text, &keys)
+	}
+	for i := range text {
+		text[i].store(ctx.state[64+16*i:])
+	}
+}
+
+// variant2Sqrt returns floor(2 * sqrt(2^64 + input) - 2^33), the square
+// root step of the integer math of variant 2. The floating point estimate
+// is off by at most one, which the fixup corrects
+func variant2Sqrt(input uint64) uint64 {
+	r := uint64(math.Sqrt(float64(input)+18446744073709551616.0)*2.0 - 8589934592.0)
+	s := r >> 1
+	b := r & 1
+	r2 := s*(s+b) + r<<32
+	if r2+b > input {
+		r--
+	}
+	if r2+1<<32 < input-s {
+		r++
+	}
+	return r
+}
+
+// variant2Shuffle adds a, b and b1 to the three 16-byte chunks of the 64-byte
+// line of l at offset other than the one at offset, rotating them. It returns
+// the xor of the chunks before they were shuffled, which cryptonight-r mixes
+// into c
+func variant2Shuffle(l []byte, offset uint64, al, ah, bl, bh, b1l, b1h uint64) (uint64, uint64) {
+	chunk1 := l[offset^0x10:]
+	chunk2 := l[offset^0x20:]
+	chunk3 := l[offset^0x30:]
+	c1l, c1h := binary.LittleEndian.Uint64(chunk1), binary.LittleEndian.Uint64(chunk1[8:])
+	c2l, c2h := binary.LittleEndian.Uint64(chunk2), binary.LittleEndian.Uint64(chunk2[8:])
+	c3l, c3h := binary.LittleEndian.Uint64(chunk3), binary.LittleEndian.Uint64(chunk3[8:])
+	binary.LittleEndian.PutUint64(chunk1, c3l+b1l)
+	binary.LittleEndian.PutUint64(chunk1[8:], c3h+b1h)
+	binary.LittleEndian.PutUint64(chunk2, c1l+bl)
+	binary.LittleEndian.PutUint64(chunk2[8:], c1h+bh)
+	binary.LittleEndian.PutUint64(chunk3, c2l+al)
+	binary.LittleEndian.PutUint64(chunk3[8:], c2h+ah)
+	return c1l ^ c2l ^ c3l, c1h ^ c2h ^ c3h
+}
+
+// hash computes the cryptonight hash of input into output with the given
+// variant, 0 for the original algorithm, 2 for cryptonight v2, 4 for
+// cryptonight-r, which runs the random math program code, 5 for
+// cryptonight-heavy, 6 for cryptonight-lite, 7 for cryptonight-pico, 8 for
+// cryptonight-half or 9 for cryptonight-gpu
+func (ctx *cryptonightContext) hash(input []byte, output []byte, variant int, code []V4Instruction) {
+	if variant == VariantGPU {
+		ctx.gpuHash(input, output)
+		return
+	}
+	heavy := variant == VariantHeavy
+	size := ScratchpadSize(variant)
+	mask := uint64(size - 16)
+	iterations := cryptonightIterations
+	switch variant {
+	case VariantHeavy, VariantLite:
+		iterations = halfIterations
+	case VariantHalf:
+		iterations = halfIterations
+		variant = Variant2
+	case VariantPico:
+		// The main loop of cryptonight-pico only addresses the first half of
+		// its scratchpad and is otherwise the one of cn/2
+		iterations = picoIterations
+		mask = uint64(size/2 - 16)
+		variant = Variant2
+	}
+
+	st := keccak1600(input)
+	for i, w := range st {
+		binary.LittleEndian.PutUint64(ctx.state[8*i:], w)
+	}
+	ctx.explodeScratchpad(size, heavy)
+
+	h := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(ctx.state[8*i:])
+	}
+	l := ctx.memory
+	al, ah := h(0)^h(4), h(1)^h(5)
+	bl, bh := h(2)^h(6), h(3)^h(7)
+	// Variant 2 keeps a second b and the results of its integer math
+	b1l, b1h := h(8)^h(10), h(9)^h(11)
+	division, sqrt := h(12), h(13)
+	// The registers of the random math of cryptonight-r
+	r := [9]uint32{uint32(h(12)), uint32(h(12) >> 32), uint32(h(13)), uint32(h(13) >> 32)}
+	idx := al
+	for i := 0; i < iterations; i++ {
+		offset := idx & mask
+		p := l[offset:]
+		key := aesBlock{uint32(al), uint32(al >> 32), uint32(ah), uint32(ah >> 32)}
+		c := aesRound(loadAESBlock(p), &key)
+		cl := uint64(c[0]) | uint64(c[1])<<32
+		ch := uint64(c[2]) | uint64(c[3])<<32
+		// a as it was before this iteration
+		al0, ah0 := al, ah
+		if variant == Variant2 || variant == VariantR {
+			xl, xh := variant2Shuffle(l, offset, al, ah, bl, bh, b1l, b1h)
+			if variant == 4 {
+				cl ^= xl
+				ch ^= xh
+			}
+		}
+		binary.LittleEndian.PutUint64(p, bl^cl)
+		binary.LittleEndian.PutUint64(p[8:], bh^ch)
+		idx = cl
+
+		offset = idx & mask
+		p = l[offset:]
+		dl := binary.LittleEndian.Uint64(p)
+		dh := binary.LittleEndian.Uint64(p[8:])
+		if variant == 2 {
+			dl ^= division ^ sqrt<<32
+			divisor := uint32(cl+uint64(uint32(sqrt<<1))) | 0x80000001
+			division = uint64(uint32(ch/uint64(divisor))) + (ch%uint64(divisor))<<32
+			sqrt = variant2Sqrt(cl + division)
+		} else if variant == 4 {
+			dl ^= uint64(r[0]+r[1]) | uint64(r[2]+r[3])<<32
+			r[4], r[5] = uint32(al), uint32(ah)
+			r[6], r[7], r[8] = uint32(bl), uint32(b1l), uint32(b1h)
+			ExecuteRandomMath(code, &r)
+			al ^= uint64(r[2]) | uint64(r[3])<<32
+			ah ^= uint64(r[0]) | uint64(r[1])<<32
+		}
+		hi, lo := bits.Mul64(idx, dl)
+		if variant == 2 {
+			chunk1 := l[offset^0x10:]
+			chunk2 := l[offset^0x20:]
+			binary.LittleEndian.PutUint64(chunk1, binary.LittleEndian.Uint64(chunk1)^hi)
+			binary.LittleEndian.PutUint64(chunk1[8:], binary.LittleEndian.Uint64(chunk1[8:])^lo)
+			hi ^= binary.LittleEndian.Uint64(chunk2)
+			lo ^= binary.LittleEndian.Uint64(chunk2[8:])
+			variant2Shuffle(l, offset, al, ah, bl, bh, b1l, b1h)
+		} else if variant == 4 {
+			xl, xh := variant2Shuffle(l, offset, al0, ah0, bl, bh, b1l, b1h)
+			cl ^= xl
+			ch ^= xh
+		}
+		al += hi
+		ah += lo
+		binary.LittleEndian.PutUint64(p, al)
+		binary.LittleEndian.PutUint64(p[8:], ah)
+		ah ^= dh
+		al ^= dl
+		idx = al
+		if heavy {
+			// The first 8 bytes of the next line are divided by the
+			// next 4 and the quotient is mixed into them and the index
+			p = l[idx&mask:]
+			n := int64(binary.LittleEndian.Uint64(p))
+			d := int32(binary.LittleEndian.Uint32(p[8:]))
+			q := n / int64(d|5)
+			binary.LittleEndian.PutUint64(p, uint64(n^q))
+			idx = uint64(int64(d) ^ q)
+		}
+		b1l, b1h = bl, bh
+		bl, bh = cl, ch
+	}
+
+	ctx.implodeScratchpad(size, heavy)
+	for i := range st {
+		st[i] = h(i)
+	}
+	keccakf(&st)
+	for i, w := range st {
+		binary.LittleEndian.PutUint64(ctx.state[8*i:], w)
+	}
+	copy(output, extraHashes[ctx.state[0]&3](ctx.state[:]))
+}
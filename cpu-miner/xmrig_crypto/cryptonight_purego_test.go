@@ -0,0 +1,52 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtraHashes(t *testing.T) {
+	require := require.New(t)
+
+	// Hashes of the empty message
+	require.Equal("716f6e863f744b9ac22c97ec7b76ea5f5908bc5b2f67c61510bfc4751384ea7a", hex.EncodeToString(blake256(nil)))
+	require.Equal("1a52d11d550039be16107f9c58db9ebcc417f16f736adb2502567119f0083467", hex.EncodeToString(groestl256(nil)))
+	require.Equal("46e64619c18bb0a92a5e87185a47eef83ca747b8fcc8e1412921357e326df434", hex.EncodeToString(jh256(nil)))
+	require.Equal("39ccc4554a8b31853b9de7a1fe638a24cce6b35a55f2431009e18780335d2621", hex.EncodeToString(skein512256(nil)))
+}
+
+func TestCryptonightVectors(t *testing.T) {
+	require := require.New(t)
+
+	vectors := map[string]string{
+		"":               "eb14e8a833fac6fe9a43b57b336789c46ffe93f2868452240720607b14387e11",
+		"This is a test": "a084f01d1437a09c6985401b60d43554ae105802c5f5d8a9b3253649c0be6605",
+	}
+	ctx := newCryptonightContext(Memory)
+	output := make([]byte, 32)
+	for input, expected := range vectors {
+		ctx.hash([]byte(input), output, VariantOriginal, nil)
+		require.Equal(expected, hex.EncodeToString(output), "input %q", input)
+	}
+}
+
+func TestVariant2Sqrt(t *testing.T) {
+	require := require.New(t)
+
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	two33 := new(big.Int).Lsh(big.NewInt(1), 33)
+	inputs := []uint64{0, 1, 2, 3, 1 << 32, 1<<32 - 1, 0x123456789abcdef0, 1<<63 - 1, 1 << 63, ^uint64(0) - 1, ^uint64(0)}
+	for _, input := range inputs {
+		// floor(2 * sqrt(2^64 + input) - 2^33) is floor(sqrt(4 * (2^64 + input))) - 2^33
+		n := new(big.Int).Add(two64, new(big.Int).SetUint64(input))
+		expected := new(big.Int).Sqrt(n.Lsh(n, 2))
+		expected.Sub(expected, two33)
+		require.Equal(expected.Uint64(), variant2Sqrt(input), "input %x", input)
+	}
+}
@@ -1,11 +1,53 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 #include "cryptonight_x86.h"
 #include "soft_aes.h"
 
-size_t ITERATIONS = 0x80000;
-size_t MEM = MEMORY;
-size_t MASK = 0x1FFFF0;
 bool SOFT_AES = false;
 
+// Cryptonight-heavy doubles the scratchpad and cryptonight-lite halves it.
+// Both halve the iterations of the main loop, as does cryptonight-half.
+// Cryptonight-pico has an eighth of the scratchpad and of the iterations
+static inline size_t variant_memory(int variant)
+{
+    switch (variant) {
+    case VARIANT_HEAVY:
+        return MEMORY_HEAVY;
+    case VARIANT_LITE:
+        return MEMORY_LITE;
+    case VARIANT_PICO:
+        return MEMORY_PICO;
+    default:
+        return MEMORY;
+    }
+}
+
+static inline size_t variant_iterations(int variant)
+{
+    switch (variant) {
+    case VARIANT_HEAVY:
+    case VARIANT_LITE:
+    case VARIANT_HALF:
+        return 0x40000;
+    case VARIANT_PICO:
+        return 0x10000;
+    default:
+        return 0x80000;
+    }
+}
+
+// The main loop of cryptonight-pico only addresses the first half of its
+// scratchpad
+static inline size_t variant_mask(int variant)
+{
+    return (variant == VARIANT_PICO ? MEMORY_PICO / 2 : variant_memory(variant)) - 16;
+}
+
+// The main loop of cryptonight-gpu reads 64-byte lines
+#define CN_GPU_ITERATIONS 0xC000
+#define CN_GPU_MASK       0x1FFFC0
+
 static inline void do_blake_hash(const void* input, size_t len, char* output) {
     blake256_hash((uint8_t *) output, (uint8_t *) input, len);
 }
@@ -169,7 +211,38 @@ static inline void aes_round(__m128i key, __m128i* x0, __m128i* x1, __m128i* x2,
     }
 }
 
-static inline void cn_explode_scratchpad(const __m128i *input, __m128i *output)
+// Cryptonight-heavy mixes the 8 blocks into each other after each pass of
+// AES rounds while exploding and imploding the scratchpad
+static inline void mix_and_propagate(__m128i *x0, __m128i *x1, __m128i *x2, __m128i *x3, __m128i *x4, __m128i *x5, __m128i *x6, __m128i *x7)
+{
+    const __m128i tmp0 = *x0;
+    *x0 = _mm_xor_si128(*x0, *x1);
+    *x1 = _mm_xor_si128(*x1, *x2);
+    *x2 = _mm_xor_si128(*x2, *x3);
+    *x3 = _mm_xor_si128(*x3, *x4);
+    *x4 = _mm_xor_si128(*x4, *x5);
+    *x5 = _mm_xor_si128(*x5, *x6);
+    *x6 = _mm_xor_si128(*x6, *x7);
+    *x7 = _mm_xor_si128(*x7, tmp0);
+}
+
+
+static inline void aes_rounds(__m128i k0, __m128i k1, __m128i k2, __m128i k3, __m128i k4, __m128i k5, __m128i k6, __m128i k7, __m128i k8, __m128i k9, __m128i *x0, __m128i *x1, __m128i *x2, __m128i *x3, __m128i *x4, __m128i *x5, __m128i *x6, __m128i *x7)
+{
+    aes_round(k0, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k1, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k2, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k3, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k4, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k5, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k6, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k7, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k8, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+    aes_round(k9, x0, x1, x2, x3, x4, x5, x6, x7, SOFT_AES);
+}
+
+
+static inline void cn_explode_scratchpad(const __m128i *input, __m128i *output, size_t mem, bool heavy)
 {
     __m128i xin0, xin1, xin2, xin3, xin4, xin5, xin6, xin7;
     __m128i k0, k1, k2, k3, k4, k5, k6, k7, k8, k9;
@@ -185,7 +258,14 @@ static inline void cn_explode_scratchpad(const __m128i *input, __m128i *output)
     xin6 = _mm_load_si128(input + 10);
     xin7 = _mm_load_si128(input + 11);
 
-    for (size_t i = 0; i < MEM / sizeof(__m128i); i += 8) {
+    if (heavy) {
+        for (size_t i = 0; i < 16; i++) {
+            aes_rounds(k0, k1, k2, k3, k4, k5, k6, k7, k8, k9, &xin0, &xin1, &xin2, &xin3, &xin4, &xin5, &xin6, &xin7);
+            mix_and_propagate(&xin0, &xin1, &xin2, &xin3, &xin4, &xin5, &xin6, &xin7);
+        }
+    }
+
+    for (size_t i = 0; i < mem / sizeof(__m128i); i += 8) {
         aes_round(k0, &xin0, &xin1, &xin2, &xin3, &xin4, &xin5, &xin6, &xin7, SOFT_AES);
         aes_round(k1, &xin0, &xin1, &xin2, &xin3, &xin4, &xin5, &xin6, &xin7, SOFT_AES);
         aes_round(k2, &xin0, &xin1, &xin2, &xin3, &xin4, &xin5, &xin6, &xin7, SOFT_AES);
@@ -208,7 +288,7 @@ static inline void cn_explode_scratchpad(const __m128i *input, __m128i *output)
     }
 }
 
-static inline void cn_implode_scratchpad(const __m128i *input, __m128i *output)
+static inline void cn_implode_scratchpad(const __m128i *input, __m128i *output, size_t mem, bool heavy)
 {
     __m128i xout0, xout1, xout2, xout3, xout4, xout5, xout6, xout7;
     __m128i k0, k1, k2, k3, k4, k5, k6, k7, k8, k9;
@@ -224,27 +304,32 @@ static inline void cn_implode_scratchpad(const __m128i *input, __m128i *output)
     xout6 = _mm_load_si128(output + 10);
     xout7 = _mm_load_si128(output + 11);
 
-    for (size_t i = 0; i < MEM / sizeof(__m128i); i += 8)
-    {
-        xout0 = _mm_xor_si128(_mm_load_si128(input + i + 0), xout0);
-        xout1 = _mm_xor_si128(_mm_load_si128(input + i + 1), xout1);
-        xout2 = _mm_xor_si128(_mm_load_si128(input + i + 2), xout2);
-        xout3 = _mm_xor_si128(_mm_load_si128(input + i + 3), xout3);
-        xout4 = _mm_xor_si128(_mm_load_si128(input + i + 4), xout4);
-        xout5 = _mm_xor_si128(_mm_load_si128(input + i + 5), xout5);
-        xout6 = _mm_xor_si128(_mm_load_si128(input + i + 6), xout6);
-        xout7 = _mm_xor_si128(_mm_load_si128(input + i + 7), xout7);
-
-        aes_round(k0, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k1, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k2, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k3, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k4, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k5, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k6, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k7, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k8, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
-        aes_round(k9, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7, SOFT_AES);
+    // Cryptonight-heavy makes a second pass over the scratchpad and 16 more
+    // rounds without it
+    for (int pass = 0; pass < (heavy ? 2 : 1); pass++) {
+        for (size_t i = 0; i < mem / sizeof(__m128i); i += 8) {
+            xout0 = _mm_xor_si128(_mm_load_si128(input + i + 0), xout0);
+            xout1 = _mm_xor_si128(_mm_load_si128(input + i + 1), xout1);
+            xout2 = _mm_xor_si128(_mm_load_si128(input + i + 2), xout2);
+            xout3 = _mm_xor_si128(_mm_load_si128(input + i + 3), xout3);
+            xout4 = _mm_xor_si128(_mm_load_si128(input + i + 4), xout4);
+            xout5 = _mm_xor_si128(_mm_load_si128(input + i + 5), xout5);
+            xout6 = _mm_xor_si128(_mm_load_si128(input + i + 6), xout6);
+            xout7 = _mm_xor_si128(_mm_load_si128(input + i + 7), xout7);
+
+            aes_rounds(k0, k1, k2, k3, k4, k5, k6, k7, k8, k9, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7);
+
+            if (heavy) {
+                mix_and_propagate(&xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7);
+            }
+        }
+    }
+
+    if (heavy) {
+        for (size_t i = 0; i < 16; i++) {
+            aes_rounds(k0, k1, k2, k3, k4, k5, k6, k7, k8, k9, &xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7);
+            mix_and_propagate(&xout0, &xout1, &xout2, &xout3, &xout4, &xout5, &xout6, &xout7);
+        }
     }
 
     _mm_store_si128(output + 4, xout0);
@@ -257,11 +342,356 @@ static inline void cn_implode_scratchpad(const __m128i *input, __m128i *output)
     _mm_store_si128(output + 11, xout7);
 }
 
-inline void arch_cryptonight_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx)
+// Cryptonight v2 adds a, b and the b before it to the other three 16-byte
+// chunks of the 64-byte line that was accessed, rotating them. The xor of the
+// chunks before they were shuffled is returned for cryptonight-r
+static inline __m128i variant2_shuffle(const uint8_t *l, uint64_t offset, __m128i a, __m128i b, __m128i b1)
+{
+    const __m128i chunk1 = _mm_load_si128((__m128i *) &l[offset ^ 0x10]);
+    const __m128i chunk2 = _mm_load_si128((__m128i *) &l[offset ^ 0x20]);
+    const __m128i chunk3 = _mm_load_si128((__m128i *) &l[offset ^ 0x30]);
+    _mm_store_si128((__m128i *) &l[offset ^ 0x10], _mm_add_epi64(chunk3, b1));
+    _mm_store_si128((__m128i *) &l[offset ^ 0x20], _mm_add_epi64(chunk1, b));
+    _mm_store_si128((__m128i *) &l[offset ^ 0x30], _mm_add_epi64(chunk2, a));
+    return _mm_xor_si128(_mm_xor_si128(chunk1, chunk2), chunk3);
+}
+
+
+// After the multiplication, the product is also mixed with the chunks
+// before they are shuffled
+static inline void variant2_shuffle_mul(const uint8_t *l, uint64_t offset, __m128i a, __m128i b, __m128i b1, uint64_t *hi, uint64_t *lo)
+{
+    uint64_t *chunk1 = (uint64_t *) &l[offset ^ 0x10];
+    const uint64_t *chunk2 = (const uint64_t *) &l[offset ^ 0x20];
+    chunk1[0] ^= *hi;
+    chunk1[1] ^= *lo;
+    *hi ^= chunk2[0];
+    *lo ^= chunk2[1];
+    variant2_shuffle(l, offset, a, b, b1);
+}
+
+
+// variant2_sqrt returns floor(2 * sqrt(2^64 + input) - 2^33). The square root
+// of the double is off by at most one, which the fixup corrects
+static inline uint64_t variant2_sqrt(uint64_t input)
+{
+    const __m128i exp_double_bias = _mm_set_epi64x(0, 1023ULL << 52);
+    __m128d x = _mm_castsi128_pd(_mm_add_epi64(_mm_set_epi64x(0, input >> 12), exp_double_bias));
+    x = _mm_sqrt_sd(_mm_setzero_pd(), x);
+    uint64_t r = ((uint64_t) EXTRACT64(_mm_sub_epi64(_mm_castpd_si128(x), exp_double_bias))) >> 19;
+
+    const uint64_t s = r >> 1;
+    const uint64_t b = r & 1;
+    const uint64_t r2 = s * (s + b) + (r << 32);
+    r += ((r2 + b > input) ? -1 : 0) + ((r2 + (1ULL << 32) < input - s) ? 1 : 0);
+    return r;
+}
+
+
+// The integer math of cryptonight v2 mixes a division and a square root of
+// the AES output into the 64-bit multiplicand cl
+static inline void variant2_integer_math(uint64_t *cl, __m128i cx, uint64_t *division_result, uint64_t *sqrt_result)
+{
+    const uint64_t cx_lo = EXTRACT64(cx);
+    const uint64_t cx_hi = EXTRACT64(_mm_srli_si128(cx, 8));
+    *cl ^= *division_result ^ (*sqrt_result << 32);
+    const uint32_t divisor = (uint32_t) (cx_lo + (uint32_t) (*sqrt_result << 1)) | 0x80000001UL;
+    *division_result = (uint32_t) (cx_hi / divisor) + ((cx_hi % divisor) << 32);
+    *sqrt_result = variant2_sqrt(cx_lo + *division_result);
+}
+
+
+// Cryptonight-r mixes the random math program of the block height into the
+// multiplicand cl and into a. The registers r0-r3 carry over between
+// iterations and r4-r8 are loaded from a, b and the b before it
+static inline void variant4_random_math(const struct V4_Instruction *code, uint32_t *r, uint64_t *al, uint64_t *ah, uint64_t *cl, __m128i b, __m128i b1)
+{
+    *cl ^= (r[0] + r[1]) | ((uint64_t) (r[2] + r[3]) << 32);
+    r[4] = (uint32_t) *al;
+    r[5] = (uint32_t) *ah;
+    r[6] = (uint32_t) _mm_cvtsi128_si32(b);
+    r[7] = (uint32_t) _mm_cvtsi128_si32(b1);
+    r[8] = (uint32_t) _mm_cvtsi128_si32(_mm_srli_si128(b1, 8));
+
+    for (const struct V4_Instruction *op = code; op->opcode != V4_RET; op++) {
+        const uint32_t src = r[op->src_index];
+        uint32_t *dst = &r[op->dst_index];
+        switch (op->opcode) {
+        case V4_MUL:
+            *dst *= src;
+            break;
+        case V4_ADD:
+            *dst += src + op->C;
+            break;
+        case V4_SUB:
+            *dst -= src;
+            break;
+        case V4_ROR:
+            *dst = (*dst >> (src & 31)) | (*dst << ((32 - (src & 31)) & 31));
+            break;
+        case V4_ROL:
+            *dst = (*dst << (src & 31)) | (*dst >> ((32 - (src & 31)) & 31));
+            break;
+        case V4_XOR:
+            *dst ^= src;
+            break;
+        }
+    }
+
+    *al ^= r[2] | ((uint64_t) r[3] << 32);
+    *ah ^= r[0] | ((uint64_t) r[1] << 32);
+}
+
+
+// Cryptonight-heavy divides the first 8 bytes of the line that the next
+// iteration reads by the next 4 bytes, and mixes the quotient into them and
+// into the index
+static inline uint64_t heavy_division(const uint8_t *l, uint64_t offset)
+{
+    const int64_t n = ((int64_t *) &l[offset])[0];
+    const int32_t d = ((int32_t *) &l[offset])[2];
+    const int64_t q = n / (d | 0x5);
+
+    ((int64_t *) &l[offset])[0] = n ^ q;
+    return d ^ q;
+}
+
+
+// The float math of cryptonight-gpu has to be rounded exactly as written, so
+// the fast math of -Ofast is turned off for it. Fused multiply-adds and
+// reordered additions give other hashes
+#pragma GCC push_options
+#pragma GCC optimize ("no-fast-math", "fp-contract=off")
+
+// Cryptonight-gpu fills the scratchpad with keccak of the state, with the
+// index of each 512 byte block mixed into the first word
+static inline void cn_gpu_explode_scratchpad(const uint64_t *input, uint8_t *output, size_t mem)
+{
+    uint64_t hash[25];
+
+    for (uint64_t i = 0; i < mem / 512; i++) {
+        memcpy(hash, input, sizeof(hash));
+        hash[0] ^= i;
+
+        keccakf(hash, 24);
+        memcpy(output, hash, 160);
+        output += 160;
+
+        keccakf(hash, 24);
+        memcpy(output, hash, 176);
+        output += 176;
+
+        keccakf(hash, 24);
+        memcpy(output, hash, 176);
+        output += 176;
+    }
+}
+
+
+// Sets the lowest bit of the exponent and clears the one above it, which
+// keeps the compiler from fusing the multiplications with the additions
+static inline __m128 cn_gpu_fma_break(__m128 x)
 {
+    x = _mm_and_ps(_mm_castsi128_ps(_mm_set1_epi32((int) 0xFEFFFFFF)), x);
+    return _mm_or_ps(_mm_castsi128_ps(_mm_set1_epi32(0x00800000)), x);
+}
+
+
+// Sets the exponent of x to that of 2.0, which maps it into [2, 4)
+static inline __m128 cn_gpu_exp2(__m128 x, int sign_mask)
+{
+    x = _mm_and_ps(_mm_castsi128_ps(_mm_set1_epi32(sign_mask)), x);
+    return _mm_or_ps(_mm_castsi128_ps(_mm_set1_epi32(0x40000000)), x);
+}
+
+
+static inline void cn_gpu_sub_round(__m128 n0, __m128 n1, __m128 n2, __m128 n3, __m128 rnd_c, __m128 *n, __m128 *d, __m128 *c)
+{
+    n1 = _mm_add_ps(n1, *c);
+    __m128 nn = _mm_mul_ps(n0, *c);
+    nn = _mm_mul_ps(n1, _mm_mul_ps(nn, nn));
+    nn = cn_gpu_fma_break(nn);
+    *n = _mm_add_ps(*n, nn);
+
+    n3 = _mm_sub_ps(n3, *c);
+    __m128 dd = _mm_mul_ps(n2, *c);
+    dd = _mm_mul_ps(n3, _mm_mul_ps(dd, dd));
+    dd = cn_gpu_fma_break(dd);
+    *d = _mm_add_ps(*d, dd);
+
+    // Constant feedback
+    *c = _mm_add_ps(*c, rnd_c);
+    *c = _mm_add_ps(*c, _mm_set1_ps(0.734375f));
+    __m128 r = _mm_add_ps(nn, dd);
+    r = cn_gpu_exp2(r, (int) 0x807FFFFF);
+    *c = _mm_add_ps(*c, r);
+}
+
+
+static inline void cn_gpu_round_compute(__m128 n0, __m128 n1, __m128 n2, __m128 n3, __m128 rnd_c, __m128 *c, __m128 *r)
+{
+    __m128 n = _mm_setzero_ps();
+    __m128 d = _mm_setzero_ps();
+
+    cn_gpu_sub_round(n0, n1, n2, n3, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n1, n2, n3, n0, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n2, n3, n0, n1, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n3, n0, n1, n2, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n3, n2, n1, n0, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n2, n1, n0, n3, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n1, n0, n3, n2, rnd_c, &n, &d, c);
+    cn_gpu_sub_round(n0, n3, n2, n1, rnd_c, &n, &d, c);
+
+    // abs(d) >= 2.0 rules out divisions by zero and overflows
+    d = cn_gpu_exp2(d, (int) 0xFF7FFFFF);
+    *r = _mm_add_ps(*r, _mm_div_ps(n, d));
+}
+
+
+// cn_gpu_single_compute runs 4 rounds starting from cnt and mixes the result,
+// rotated by rot bytes, into out. Even rotations start a new sum and odd ones
+// add to it
+static inline void cn_gpu_single_compute(__m128 n0, __m128 n1, __m128 n2, __m128 n3, float cnt, __m128 rnd_c, __m128 *sum, __m128i *out, int rot)
+{
+    __m128 c = _mm_set1_ps(cnt);
+    __m128 r = _mm_setzero_ps();
+
+    cn_gpu_round_compute(n0, n1, n2, n3, rnd_c, &c, &r);
+    cn_gpu_round_compute(n0, n1, n2, n3, rnd_c, &c, &r);
+    cn_gpu_round_compute(n0, n1, n2, n3, rnd_c, &c, &r);
+    cn_gpu_round_compute(n0, n1, n2, n3, rnd_c, &c, &r);
+
+    // A quick fmod, setting the exponent to 2
+    r = cn_gpu_exp2(r, (int) 0x807FFFFF);
+    *sum = rot % 2 != 0 ? _mm_add_ps(*sum, r) : r;
+
+    r = _mm_mul_ps(r, _mm_set1_ps(536870880.0f));
+    __m128i x = _mm_cvttps_epi32(r);
+    switch (rot) {
+    case 1:
+        x = _mm_or_si128(_mm_slli_si128(x, 15), _mm_srli_si128(x, 1));
+        break;
+    case 2:
+        x = _mm_or_si128(_mm_slli_si128(x, 14), _mm_srli_si128(x, 2));
+        break;
+    case 3:
+        x = _mm_or_si128(_mm_slli_si128(x, 13), _mm_srli_si128(x, 3));
+        break;
+    }
+    *out = _mm_xor_si128(*out, x);
+}
+
+
+// The main loop of cryptonight-gpu runs float math on the four 16-byte
+// chunks of a 64-byte line of the scratchpad, as 32-bit integers converted to
+// floats, and xors the results into them
+static inline void cn_gpu_inner(const uint8_t *state, uint8_t *memory)
+{
+    uint32_t s = ((const uint32_t *) state)[0] >> 8;
+    __m128i *idx = (__m128i *) &memory[s & CN_GPU_MASK];
+    __m128 sum0 = _mm_setzero_ps();
+
+    for (size_t i = 0; i < CN_GPU_ITERATIONS; i++) {
+        __m128i v[4];
+        __m128 n[4];
+        __m128 suma, sumb, sum[4];
+        __m128i out, out2;
+
+        for (int j = 0; j < 4; j++) {
+            v[j] = _mm_load_si128(idx + j);
+            n[j] = _mm_cvtepi32_ps(v[j]);
+        }
+        const __m128 rc = sum0;
+
+        out = _mm_setzero_si128();
+        cn_gpu_single_compute(n[0], n[1], n[2], n[3], 1.3437500f, rc, &suma, &out, 0);
+        cn_gpu_single_compute(n[0], n[2], n[3], n[1], 1.2812500f, rc, &suma, &out, 1);
+        cn_gpu_single_compute(n[0], n[3], n[1], n[2], 1.3593750f, rc, &sumb, &out, 2);
+        cn_gpu_single_compute(n[0], n[3], n[2], n[1], 1.3671875f, rc, &sumb, &out, 3);
+        sum[0] = _mm_add_ps(suma, sumb);
+        _mm_store_si128(idx + 0, _mm_xor_si128(v[0], out));
+        out2 = out;
+
+        out = _mm_setzero_si128();
+        cn_gpu_single_compute(n[1], n[0], n[2], n[3], 1.4296875f, rc, &suma, &out, 0);
+        cn_gpu_single_compute(n[1], n[2], n[3], n[0], 1.3984375f, rc, &suma, &out, 1);
+        cn_gpu_single_compute(n[1], n[3], n[0], n[2], 1.3828125f, rc, &sumb, &out, 2);
+        cn_gpu_single_compute(n[1], n[3], n[2], n[0], 1.3046875f, rc, &sumb, &out, 3);
+        sum[1] = _mm_add_ps(suma, sumb);
+        _mm_store_si128(idx + 1, _mm_xor_si128(v[1], out));
+        out2 = _mm_xor_si128(out2, out);
+
+        out = _mm_setzero_si128();
+        cn_gpu_single_compute(n[2], n[1], n[0], n[3], 1.4140625f, rc, &suma, &out, 0);
+        cn_gpu_single_compute(n[2], n[0], n[3], n[1], 1.2734375f, rc, &suma, &out, 1);
+        cn_gpu_single_compute(n[2], n[3], n[1], n[0], 1.2578125f, rc, &sumb, &out, 2);
+        cn_gpu_single_compute(n[2], n[3], n[0], n[1], 1.2890625f, rc, &sumb, &out, 3);
+        sum[2] = _mm_add_ps(suma, sumb);
+        _mm_store_si128(idx + 2, _mm_xor_si128(v[2], out));
+        out2 = _mm_xor_si128(out2, out);
+
+        out = _mm_setzero_si128();
+        cn_gpu_single_compute(n[3], n[1], n[2], n[0], 1.3203125f, rc, &suma, &out, 0);
+        cn_gpu_single_compute(n[3], n[2], n[0], n[1], 1.3515625f, rc, &suma, &out, 1);
+        cn_gpu_single_compute(n[3], n[0], n[1], n[2], 1.3359375f, rc, &sumb, &out, 2);
+        cn_gpu_single_compute(n[3], n[0], n[2], n[1], 1.4609375f, rc, &sumb, &out, 3);
+        sum[3] = _mm_add_ps(suma, sumb);
+        _mm_store_si128(idx + 3, _mm_xor_si128(v[3], out));
+        out2 = _mm_xor_si128(out2, out);
+
+        sum0 = _mm_add_ps(_mm_add_ps(sum[0], sum[1]), _mm_add_ps(sum[2], sum[3]));
+        // abs(sum0), which is below 64
+        sum0 = _mm_and_ps(_mm_castsi128_ps(_mm_set1_epi32(0x7FFFFFFF)), sum0);
+
+        __m128i x = _mm_cvttps_epi32(_mm_mul_ps(sum0, _mm_set1_ps(16777216.0f)));
+        x = _mm_xor_si128(x, out2);
+        x = _mm_xor_si128(x, _mm_shuffle_epi32(x, _MM_SHUFFLE(0, 1, 2, 3)));
+        x = _mm_xor_si128(x, _mm_shuffle_epi32(x, _MM_SHUFFLE(0, 1, 0, 1)));
+
+        // sum0 is fed into the next iteration between 0 and 1
+        sum0 = _mm_div_ps(sum0, _mm_set1_ps(64.0f));
+        idx = (__m128i *) &memory[(uint32_t) _mm_cvtsi128_si32(x) & CN_GPU_MASK];
+    }
+}
+
+
+// Cryptonight-gpu keeps the AES of the implode of cryptonight-heavy but
+// fills the scratchpad with keccak and replaces the main loop with float
+// math. Its hash is the state after keccak, without the extra hashes
+static inline void cn_gpu_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx)
+{
+    keccak((const uint8_t *) input, (int) size, ctx->state0, 200);
+
+    cn_gpu_explode_scratchpad((uint64_t *) ctx->state0, ctx->memory, MEMORY);
+    cn_gpu_inner(ctx->state0, ctx->memory);
+    cn_implode_scratchpad((__m128i *) ctx->memory, (__m128i *) ctx->state0, MEMORY, true);
+
+    keccakf((uint64_t *) ctx->state0, 24);
+    memcpy((void *) output, ctx->state0, 32);
+}
+
+#pragma GCC pop_options
+
+
+inline void arch_cryptonight_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx, int variant, const struct V4_Instruction *code)
+{
+    if (variant == VARIANT_GPU) {
+        cn_gpu_hash(input, size, output, ctx);
+        return;
+    }
+
+    const size_t mem = variant_memory(variant);
+    const size_t mask = variant_mask(variant);
+    const size_t iterations = variant_iterations(variant);
+    const bool heavy = variant == VARIANT_HEAVY;
+    // Cryptonight-pico and cryptonight-half run the main loop of cryptonight v2
+    if (variant == VARIANT_PICO || variant == VARIANT_HALF) {
+        variant = 2;
+    }
+
     keccak((uint8_t *) input, (int) size, ctx->state0, 200);
 
-    cn_explode_scratchpad((__m128i*) ctx->state0, (__m128i*) ctx->memory);
+    cn_explode_scratchpad((__m128i*) ctx->state0, (__m128i*) ctx->memory, mem, heavy);
 
     const uint8_t* l0 = ctx->memory;
     uint64_t* h0 = (uint64_t*) ctx->state0;
@@ -272,56 +702,102 @@ inline void arch_cryptonight_hash(const void *__restrict__ input, size_t size, c
 
     uint64_t idx0 = h0[0] ^ h0[4];
 
-    for (size_t i = 0; i < ITERATIONS; i++) {
+    __m128i bx1 = _mm_set_epi64x(h0[9] ^ h0[11], h0[8] ^ h0[10]);
+    uint64_t division_result = h0[12];
+    uint64_t sqrt_result = h0[13];
+    uint32_t r0[9] = { (uint32_t) h0[12], (uint32_t) (h0[12] >> 32), (uint32_t) h0[13], (uint32_t) (h0[13] >> 32) };
+
+    for (size_t i = 0; i < iterations; i++) {
         __m128i cx;
-        cx = _mm_load_si128((__m128i *) &l0[idx0 & MASK]);
+        const __m128i ax0 = _mm_set_epi64x(ah0, al0);
+        cx = _mm_load_si128((__m128i *) &l0[idx0 & mask]);
 
         if (SOFT_AES) {
-            cx = soft_aesenc(cx, _mm_set_epi64x(ah0, al0));
+            cx = soft_aesenc(cx, ax0);
         }
         else {
-            cx = _mm_aesenc_si128(cx, _mm_set_epi64x(ah0, al0));
+            cx = _mm_aesenc_si128(cx, ax0);
         }
 
-        _mm_store_si128((__m128i *) &l0[idx0 & MASK], _mm_xor_si128(bx0, cx));
+        if (variant == 2) {
+            variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx1);
+        } else if (variant == 4) {
+            cx = _mm_xor_si128(cx, variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx1));
+        }
+        _mm_store_si128((__m128i *) &l0[idx0 & mask], _mm_xor_si128(bx0, cx));
         idx0 = EXTRACT64(cx);
-        bx0 = cx;
 
         uint64_t hi, lo, cl, ch;
-        cl = ((uint64_t*) &l0[idx0 & MASK])[0];
-        ch = ((uint64_t*) &l0[idx0 & MASK])[1];
+        cl = ((uint64_t*) &l0[idx0 & mask])[0];
+        ch = ((uint64_t*) &l0[idx0 & mask])[1];
+        if (variant == 2) {
+            variant2_integer_math(&cl, cx, &division_result, &sqrt_result);
+        } else if (variant == 4) {
+            variant4_random_math(code, r0, &al0, &ah0, &cl, bx0, bx1);
+        }
         lo = __umul128(idx0, cl, &hi);
+        if (variant == 2) {
+            variant2_shuffle_mul(l0, idx0 & mask, ax0, bx0, bx1, &hi, &lo);
+        } else if (variant == 4) {
+            cx = _mm_xor_si128(cx, variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx1));
+        }
 
         al0 += hi;
         ah0 += lo;
 
-        ((uint64_t*)&l0[idx0 & MASK])[0] = al0;
-        ((uint64_t*)&l0[idx0 & MASK])[1] = ah0;
+        ((uint64_t*)&l0[idx0 & mask])[0] = al0;
+        ((uint64_t*)&l0[idx0 & mask])[1] = ah0;
 
         ah0 ^= ch;
         al0 ^= cl;
         idx0 = al0;
+
+        if (heavy) {
+            idx0 = heavy_division(l0, idx0 & mask);
+        }
+        bx1 = bx0;
+        bx0 = cx;
     }
 
-    cn_implode_scratchpad((__m128i*) ctx->memory, (__m128i*) ctx->state0);
+    cn_implode_scratchpad((__m128i*) ctx->memory, (__m128i*) ctx->state0, mem, heavy);
 
     keccakf(h0, 24);
     extra_hashes[ctx->state0[0] & 3](ctx->state0, 200, (char*) output);
 }
 
 
-inline void arch_cryptonight_double_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, struct cryptonight_ctx *__restrict__ ctx)
+inline void arch_cryptonight_double_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, struct cryptonight_ctx *__restrict__ ctx, int variant, const struct V4_Instruction *code)
 {
+    if (variant == VARIANT_GPU) {
+        // The float math doesn't interleave, the two hashes are done one
+        // after the other in the two halves of the memory
+        uint8_t *memory = ctx->memory;
+        cn_gpu_hash(input, size, output, ctx);
+        ctx->memory += MEMORY;
+        cn_gpu_hash((const uint8_t *) input + size, size, (uint8_t *) output + 32, ctx);
+        ctx->memory = memory;
+        return;
+    }
+
+    const size_t mem = variant_memory(variant);
+    const size_t mask = variant_mask(variant);
+    const size_t iterations = variant_iterations(variant);
+    const bool heavy = variant == VARIANT_HEAVY;
+    // Cryptonight-pico and cryptonight-half run the main loop of cryptonight v2
+    if (variant == VARIANT_PICO || variant == VARIANT_HALF) {
+        variant = 2;
+    }
+
     keccak((const uint8_t *) input,        (int) size, ctx->state0, 200);
     keccak((const uint8_t *) input + size, (int) size, ctx->state1, 200);
 
     const uint8_t* l0 = ctx->memory;
-    const uint8_t* l1 = ctx->memory + MEM;
+    const uint8_t* l1 = ctx->memory + mem;
     uint64_t* h0 = (uint64_t*) ctx->state0;
     uint64_t* h1 = (uint64_t*) ctx->state1;
 
-    cn_explode_scratchpad((__m128i*) h0, (__m128i*) l0);
-    cn_explode_scratchpad((__m128i*) h1, (__m128i*) l1);
+    cn_explode_scratchpad((__m128i*) h0, (__m128i*) l0, mem, heavy);
+    cn_explode_scratchpad((__m128i*) h1, (__m128i*) l1, mem, heavy);
 
     uint64_t al0 = h0[0] ^ h0[4];
     uint64_t al1 = h1[0] ^ h1[4];
@@ -334,60 +810,108 @@ inline void arch_cryptonight_double_hash(const void *__restrict__ input, size_t
     uint64_t idx0 = h0[0] ^ h0[4];
     uint64_t idx1 = h1[0] ^ h1[4];
 
-    for (size_t i = 0; i < ITERATIONS; i++) {
-        __m128i cx0 = _mm_load_si128((__m128i *) &l0[idx0 & MASK]);
-        __m128i cx1 = _mm_load_si128((__m128i *) &l1[idx1 & MASK]);
+    __m128i bx01 = _mm_set_epi64x(h0[9] ^ h0[11], h0[8] ^ h0[10]);
+    __m128i bx11 = _mm_set_epi64x(h1[9] ^ h1[11], h1[8] ^ h1[10]);
+    uint64_t division_result0 = h0[12];
+    uint64_t division_result1 = h1[12];
+    uint64_t sqrt_result0 = h0[13];
+    uint64_t sqrt_result1 = h1[13];
+    uint32_t r0[9] = { (uint32_t) h0[12], (uint32_t) (h0[12] >> 32), (uint32_t) h0[13], (uint32_t) (h0[13] >> 32) };
+    uint32_t r1[9] = { (uint32_t) h1[12], (uint32_t) (h1[12] >> 32), (uint32_t) h1[13], (uint32_t) (h1[13] >> 32) };
+
+    for (size_t i = 0; i < iterations; i++) {
+        const __m128i ax0 = _mm_set_epi64x(ah0, al0);
+        const __m128i ax1 = _mm_set_epi64x(ah1, al1);
+        __m128i cx0 = _mm_load_si128((__m128i *) &l0[idx0 & mask]);
+        __m128i cx1 = _mm_load_si128((__m128i *) &l1[idx1 & mask]);
 
         if (SOFT_AES) {
-            cx0 = soft_aesenc(cx0, _mm_set_epi64x(ah0, al0));
-            cx1 = soft_aesenc(cx1, _mm_set_epi64x(ah1, al1));
+            cx0 = soft_aesenc(cx0, ax0);
+            cx1 = soft_aesenc(cx1, ax1);
         }
         else {
-            cx0 = _mm_aesenc_si128(cx0, _mm_set_epi64x(ah0, al0));
-            cx1 = _mm_aesenc_si128(cx1, _mm_set_epi64x(ah1, al1));
+            cx0 = _mm_aesenc_si128(cx0, ax0);
+            cx1 = _mm_aesenc_si128(cx1, ax1);
         }
 
-        _mm_store_si128((__m128i *) &l0[idx0 & MASK], _mm_xor_si128(bx0, cx0));
-        _mm_store_si128((__m128i *) &l1[idx1 & MASK], _mm_xor_si128(bx1, cx1));
+        if (variant == 2) {
+            variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx01);
+            variant2_shuffle(l1, idx1 & mask, ax1, bx1, bx11);
+        } else if (variant == 4) {
+            cx0 = _mm_xor_si128(cx0, variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx01));
+            cx1 = _mm_xor_si128(cx1, variant2_shuffle(l1, idx1 & mask, ax1, bx1, bx11));
+        }
+        _mm_store_si128((__m128i *) &l0[idx0 & mask], _mm_xor_si128(bx0, cx0));
+        _mm_store_si128((__m128i *) &l1[idx1 & mask], _mm_xor_si128(bx1, cx1));
 
         idx0 = EXTRACT64(cx0);
         idx1 = EXTRACT64(cx1);
 
-        bx0 = cx0;
-        bx1 = cx1;
-
         uint64_t hi, lo, cl, ch;
-        cl = ((uint64_t*) &l0[idx0 & MASK])[0];
-        ch = ((uint64_t*) &l0[idx0 & MASK])[1];
+        cl = ((uint64_t*) &l0[idx0 & mask])[0];
+        ch = ((uint64_t*) &l0[idx0 & mask])[1];
+        if (variant == 2) {
+            variant2_integer_math(&cl, cx0, &division_result0, &sqrt_result0);
+        } else if (variant == 4) {
+            variant4_random_math(code, r0, &al0, &ah0, &cl, bx0, bx01);
+        }
         lo = __umul128(idx0, cl, &hi);
+        if (variant == 2) {
+            variant2_shuffle_mul(l0, idx0 & mask, ax0, bx0, bx01, &hi, &lo);
+        } else if (variant == 4) {
+            cx0 = _mm_xor_si128(cx0, variant2_shuffle(l0, idx0 & mask, ax0, bx0, bx01));
+        }
 
         al0 += hi;
         ah0 += lo;
 
-        ((uint64_t*) &l0[idx0 & MASK])[0] = al0;
-        ((uint64_t*) &l0[idx0 & MASK])[1] = ah0;
+        ((uint64_t*) &l0[idx0 & mask])[0] = al0;
+        ((uint64_t*) &l0[idx0 & mask])[1] = ah0;
 
         ah0 ^= ch;
         al0 ^= cl;
         idx0 = al0;
 
-        cl = ((uint64_t*) &l1[idx1 & MASK])[0];
-        ch = ((uint64_t*) &l1[idx1 & MASK])[1];
+        if (heavy) {
+            idx0 = heavy_division(l0, idx0 & mask);
+        }
+
+        cl = ((uint64_t*) &l1[idx1 & mask])[0];
+        ch = ((uint64_t*) &l1[idx1 & mask])[1];
+        if (variant == 2) {
+            variant2_integer_math(&cl, cx1, &division_result1, &sqrt_result1);
+        } else if (variant == 4) {
+            variant4_random_math(code, r1, &al1, &ah1, &cl, bx1, bx11);
+        }
         lo = __umul128(idx1, cl, &hi);
+        if (variant == 2) {
+            variant2_shuffle_mul(l1, idx1 & mask, ax1, bx1, bx11, &hi, &lo);
+        } else if (variant == 4) {
+            cx1 = _mm_xor_si128(cx1, variant2_shuffle(l1, idx1 & mask, ax1, bx1, bx11));
+        }
 
         al1 += hi;
         ah1 += lo;
 
-        ((uint64_t*) &l1[idx1 & MASK])[0] = al1;
-        ((uint64_t*) &l1[idx1 & MASK])[1] = ah1;
+        ((uint64_t*) &l1[idx1 & mask])[0] = al1;
+        ((uint64_t*) &l1[idx1 & mask])[1] = ah1;
 
         ah1 ^= ch;
         al1 ^= cl;
         idx1 = al1;
+
+        if (heavy) {
+            idx1 = heavy_division(l1, idx1 & mask);
+        }
+
+        bx01 = bx0;
+        bx11 = bx1;
+        bx0 = cx0;
+        bx1 = cx1;
     }
 
-    cn_implode_scratchpad((__m128i*) l0, (__m128i*) h0);
-    cn_implode_scratchpad((__m128i*) l1, (__m128i*) h1);
+    cn_implode_scratchpad((__m128i*) l0, (__m128i*) h0, mem, heavy);
+    cn_implode_scratchpad((__m128i*) l1, (__m128i*) h1, mem, heavy);
 
     keccakf(h0, 24);
     keccakf(h1, 24);
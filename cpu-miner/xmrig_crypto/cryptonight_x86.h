@@ -46,6 +46,6 @@ extern size_t MEM;
 extern size_t MASK;
 extern bool SOFT_AES;
 
-void arch_cryptonight_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx);
-void arch_cryptonight_double_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx);
+void arch_cryptonight_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx, int variant, const struct V4_Instruction *code);
+void arch_cryptonight_double_hash(const void *__restrict__ input, size_t size, const void *__restrict__ output, cryptonight_ctx *__restrict__ ctx, int variant, const struct V4_Instruction *code);
 #endif /* __CRYPTONIGHT_X86_H__ */
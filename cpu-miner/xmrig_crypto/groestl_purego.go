@@ -0,0 +1,125 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// groestlBlockSize is the block and state size of Groestl-256 in bytes
+	groestlBlockSize = 64
+	groestlRounds    = 10
+)
+
+var (
+	// groestlShiftP and groestlShiftQ are how far each row is shifted left
+	// in the P and Q permutations
+	groestlShiftP = [8]int{0, 1, 2, 3, 4, 5, 6, 7}
+	groestlShiftQ = [8]int{1, 3, 5, 7, 0, 2, 4, 6}
+	// groestlMix is the first row of the circulant MixBytes matrix
+	groestlMix = [8]byte{2, 2, 3, 4, 5, 3, 5, 7}
+)
+
+// gfMul multiplies a by a small constant b in GF(2^8) with the AES
+// polynomial
+func gfMul(a, b byte) byte {
+	var r byte
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		a = gfDouble(a)
+	}
+	return r
+}
+
+// groestlPermute applies the P or Q permutation to the state x, in which
+// byte i is row i%8 of column i/8
+func groestlPermute(x *[groestlBlockSize]byte, q bool) {
+	shift := &groestlShiftP
+	if q {
+		shift = &groestlShiftQ
+	}
+	var y [groestlBlockSize]byte
+	for r := 0; r < groestlRounds; r++ {
+		// AddRoundConstant
+		for c := 0; c < 8; c++ {
+			if q {
+				for i := 0; i < 7; i++ {
+					x[8*c+i] ^= 0xff
+				}
+				x[8*c+7] ^= 0xff ^ byte(c<<4) ^ byte(r)
+			} else {
+				x[8*c] ^= byte(c<<4) ^ byte(r)
+			}
+		}
+		// SubBytes and ShiftBytes
+		for c := 0; c < 8; c++ {
+			for i := 0; i < 8; i++ {
+				y[8*c+i] = aesSbox[x[8*((c+shift[i])%8)+i]]
+			}
+		}
+		// MixBytes
+		for c := 0; c < 8; c++ {
+			for i := 0; i < 8; i++ {
+				var b byte
+				for j := 0; j < 8; j++ {
+					b ^= gfMul(y[8*c+j], groestlMix[(j-i+8)%8])
+				}
+				x[8*c+i] = b
+			}
+		}
+	}
+}
+
+// groestlCompress compresses block into h: h = P(h ^ m) ^ Q(m) ^ h
+func groestlCompress(h *[groestlBlockSize]byte, block []byte) {
+	var p, q [groestlBlockSize]byte
+	copy(q[:], block)
+	for i := range p {
+		p[i] = h[i] ^ block[i]
+	}
+	groestlPermute(&p, false)
+	groestlPermute(&q, true)
+	for i := range h {
+		h[i] ^= p[i] ^ q[i]
+	}
+}
+
+// groestl256 returns the Groestl-256 hash of data
+func groestl256(data []byte) []byte {
+	var h [groestlBlockSize]byte
+	// The initial value encodes the output size in bits
+	binary.BigEndian.PutUint16(h[groestlBlockSize-2:], 256)
+
+	blocks := uint64(0)
+	for ; len(data) >= groestlBlockSize; data = data[groestlBlockSize:] {
+		groestlCompress(&h, data)
+		blocks++
+	}
+
+	// Padding: a 1 bit, zeros and the 64-bit number of blocks
+	var pad [2 * groestlBlockSize]byte
+	n := copy(pad[:], data)
+	pad[n] = 0x80
+	size := groestlBlockSize
+	if n >= groestlBlockSize-8 {
+		size = 2 * groestlBlockSize
+	}
+	blocks += uint64(size / groestlBlockSize)
+	binary.BigEndian.PutUint64(pad[size-8:], blocks)
+	for i := 0; i < size; i += groestlBlockSize {
+		groestlCompress(&h, pad[i:i+groestlBlockSize])
+	}
+
+	// Output transformation: truncate P(h) ^ h
+	p := h
+	groestlPermute(&p, false)
+	out := make([]byte, 32)
+	for i := range out {
+		out[i] = p[32+i] ^ h[32+i]
+	}
+	return out
+}
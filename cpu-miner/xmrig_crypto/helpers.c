@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 #include "helpers.h"
 
 #include <stdio.h>
@@ -20,16 +23,25 @@ static int USING_HUGEPAGES = 1;
 static int size = 0;
 #ifndef _WIN32
 static int LOCKED = 0;
+#else
+static int LOCK_PAGES_PRIVILEGE = 0;
 #endif
-void *xmrig_setup_hugepages(int nthreads) {
-	void *ret;
-	size = MEMORY * (nthreads * 1 + 1);
+void *xmrig_setup_hugepages(int nthreads, int memory) {
+	void *ret = NULL;
+	size = memory * (nthreads * 1 + 1);
 #if defined _WIN32
-	TrySetLockPagesPrivilege();
-	ret = VirtualAlloc(NULL, size, MEM_COMMIT | MEM_RESERVE | MEM_LARGE_PAGES,
-	                   PAGE_READWRITE);
+	// Large pages can only be allocated while holding SeLockMemoryPrivilege
+	LOCK_PAGES_PRIVILEGE = TrySetLockPagesPrivilege();
+	if (LOCK_PAGES_PRIVILEGE) {
+		// The allocation size must be a multiple of the large page size
+		SIZE_T large_page = GetLargePageMinimum();
+		if (large_page > 0) {
+			size = ((size + large_page - 1) / large_page) * large_page;
+		}
+		ret = VirtualAlloc(NULL, size, MEM_COMMIT | MEM_RESERVE | MEM_LARGE_PAGES,
+		                   PAGE_READWRITE);
+	}
 	if (!ret) {
-		printf("Failed to call VirtualAlloc()\n");
 		USING_HUGEPAGES = 0;
 		ret = _mm_malloc(size, 16);
 	}
@@ -80,12 +92,24 @@ void release_hugepages(void *ptr) {
 	}
 }
 
-void *xmrig_thread_persistent_ctx(void *memptr, int thread_id) {
+int xmrig_hugepages_enabled() {
+	return USING_HUGEPAGES;
+}
+
+int xmrig_lock_pages_privilege() {
+#ifdef _WIN32
+	return LOCK_PAGES_PRIVILEGE;
+#else
+	return 0;
+#endif
+}
+
+void *xmrig_thread_persistent_ctx(void *memptr, int thread_id, int memory) {
 	uint8_t *mem = (uint8_t *)memptr;
 	struct cryptonight_ctx *persistent_ctx;
 	persistent_ctx =
-		(void *)&mem[MEMORY - sizeof(struct cryptonight_ctx) * (thread_id + 1)];
-	persistent_ctx->memory = (void *)&mem[MEMORY * (thread_id * 1 + 1)];
+		(void *)&mem[memory - sizeof(struct cryptonight_ctx) * (thread_id + 1)];
+	persistent_ctx->memory = (void *)&mem[memory * (thread_id * 1 + 1)];
 	return persistent_ctx;
 }
 
@@ -95,13 +119,13 @@ void *xmrig_simple_cryptonight_context() {
 
 int xmrig_cryptonight_hash_wrapper(const void *input, int size,
                                    const void *output, const void *target,
-                                   void *ctx) {
+                                   void *ctx, int variant, const struct V4_Instruction *code) {
 	return xmrig_cryptonight_hash(input, size, output, target,
-	                              (struct cryptonight_ctx *)ctx);
+	                              (struct cryptonight_ctx *)ctx, variant, code);
 }
 void xmrig_cryptonight_hash_void_wrapper(const void *input, int size,
                                          const void *output, const void *target,
-                                         void *ctx) {
+                                         void *ctx, int variant, const struct V4_Instruction *code) {
 	xmrig_cryptonight_hash_void(input, size, output, target,
-	                            (struct cryptonight_ctx *)ctx);
+	                            (struct cryptonight_ctx *)ctx, variant, code);
 }
@@ -2,9 +2,11 @@
 #define __HELPERS_H_
 #include "cryptonight.h"
 
-void *xmrig_setup_hugepages(int nthreads);
-void *xmrig_thread_persistent_ctx(void *mem, int thread_id);
-int xmrig_cryptonight_hash_wrapper(const void *input, int size, const void *output, const  void *target, void *ctx);
-void xmrig_cryptonight_hash_void_wrapper(const void *input, int size, const void *output, const  void *target, void *ctx);
+void *xmrig_setup_hugepages(int nthreads, int memory);
+int xmrig_hugepages_enabled();
+int xmrig_lock_pages_privilege();
+void *xmrig_thread_persistent_ctx(void *mem, int thread_id, int memory);
+int xmrig_cryptonight_hash_wrapper(const void *input, int size, const void *output, const  void *target, void *ctx, int variant, const struct V4_Instruction *code);
+void xmrig_cryptonight_hash_void_wrapper(const void *input, int size, const void *output, const  void *target, void *ctx, int variant, const struct V4_Instruction *code);
 void *xmrig_simple_cryptonight_context();
 #endif
@@ -0,0 +1,93 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	// keccakRate is the number of bytes absorbed per permutation when
+	// keccak1600 produces the full 200-byte state
+	keccakRate = 136
+)
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a,
+	0x8000000080008000, 0x000000000000808b, 0x0000000080000001,
+	0x8000000080008081, 0x8000000000008009, 0x000000000000008a,
+	0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089,
+	0x8000000000008003, 0x8000000000008002, 0x8000000000000080,
+	0x000000000000800a, 0x800000008000000a, 0x8000000080008081,
+	0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRotations and keccakLanes drive the combined rho and pi steps:
+// lane keccakLanes[i] receives the previous lane rotated by keccakRotations[i]
+var (
+	keccakRotations = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakLanes     = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// keccakf applies the 24-round Keccak-f[1600] permutation to st
+func keccakf(st *[25]uint64) {
+	var bc [5]uint64
+	for round := 0; round < 24; round++ {
+		// Theta
+		for i := 0; i < 5; i++ {
+			bc[i] = st[i] ^ st[i+5] ^ st[i+10] ^ st[i+15] ^ st[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := bc[(i+4)%5] ^ bits.RotateLeft64(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				st[j+i] ^= t
+			}
+		}
+
+		// Rho and pi
+		t := st[1]
+		for i := 0; i < 24; i++ {
+			j := keccakLanes[i]
+			t, st[j] = st[j], bits.RotateLeft64(t, keccakRotations[i])
+		}
+
+		// Chi
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = st[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				st[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+
+		// Iota
+		st[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// keccak1600 absorbs in and returns the whole Keccak state, the way
+// cryptonight starts off
+func keccak1600(in []byte) [25]uint64 {
+	var st [25]uint64
+	for ; len(in) >= keccakRate; in = in[keccakRate:] {
+		for i := 0; i < keccakRate/8; i++ {
+			st[i] ^= binary.LittleEndian.Uint64(in[8*i:])
+		}
+		keccakf(&st)
+	}
+
+	// Last block and padding
+	var temp [keccakRate]byte
+	copy(temp[:], in)
+	temp[len(in)] = 1
+	temp[keccakRate-1] |= 0x80
+	for i := 0; i < keccakRate/8; i++ {
+		st[i] ^= binary.LittleEndian.Uint64(temp[8*i:])
+	}
+	keccakf(&st)
+	return st
+}
@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 /* XMRig
  * Copyright 2010      Jeff Garzik <jgarzik@pobox.com>
  * Copyright 2012-2014 pooler      <pooler@litecoinpool.org>
@@ -36,7 +39,7 @@
 #endif
 
 #include "cryptonight.h"
-#include "Mem.h"
+#include "mem_win.h"
 
 #include <stdio.h>
 
@@ -1,5 +1,7 @@
 #ifndef __MEM_WIN_H_
 #define __MEM_WIN_H_
 
+#include <stdbool.h>
+
 bool TrySetLockPagesPrivilege(void);
 #endif
@@ -0,0 +1,282 @@
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Opcodes of the random math of cryptonight-r
+const (
+	V4Mul = iota
+	V4Add
+	V4Sub
+	V4Ror
+	V4Rol
+	V4Xor
+	V4Ret
+)
+
+const (
+	// v4TotalLatency is the minimal latency of the generated code, 15
+	// multiplications
+	v4TotalLatency = 15 * 3
+	// V4MinInstructions and V4MaxInstructions bound the number of
+	// instructions generated, not counting the final RET
+	V4MinInstructions = 60
+	V4MaxInstructions = 70
+	// ALUs of the abstract CPU that the code is generated for. Only one of
+	// them can multiply
+	v4ALUCountMul = 1
+	v4ALUCount    = 3
+)
+
+var (
+	// Latencies of MUL, ADD, SUB, ROR, ROL and XOR on a CPU and on an ASIC
+	v4OpLatency     = [V4Ret]int{3, 2, 1, 2, 2, 1}
+	v4ASICOpLatency = [V4Ret]int{3, 1, 1, 1, 1, 1}
+	v4OpALUs        = [V4Ret]int{v4ALUCountMul, v4ALUCount, v4ALUCount, v4ALUCount, v4ALUCount, v4ALUCount}
+)
+
+// V4Instruction is an instruction of the random math of cryptonight-r. It
+// has the layout of struct V4_Instruction in cryptonight.h so that programs
+// can be handed to C as they are
+type V4Instruction struct {
+	Opcode uint8
+	Dst    uint8
+	Src    uint8
+	C      uint32
+}
+
+// randomMathData supplies the bytes that a program is generated from,
+// rehashing them with blake-256 when they run out
+type randomMathData struct {
+	data  []byte
+	index int
+}
+
+func (d *randomMathData) check(needed int) {
+	if d.index+needed > len(d.data) {
+		d.data = blake256(d.data)
+		d.index = 0
+	}
+}
+
+func (d *randomMathData) byte() byte {
+	d.check(1)
+	b := d.data[d.index]
+	d.index++
+	return b
+}
+
+func (d *randomMathData) uint32() uint32 {
+	d.check(4)
+	v := binary.LittleEndian.Uint32(d.data[d.index:])
+	d.index += 4
+	return v
+}
+
+// GenerateRandomMath generates the random math program of cryptonight-r for
+// a block height. The program ends with a RET instruction. This follows
+// v4_random_math_init of monero's variant4_random_math.h exactly, since every
+// miner of a block has to run the same program
+func GenerateRandomMath(height uint64) []V4Instruction {
+	data := &randomMathData{make([]byte, 32), 32}
+	binary.LittleEndian.PutUint64(data.data, height)
+	data.data[20] = 0xda // change seed
+
+	code := make([]V4Instruction, 0, V4MaxInstructions+1)
+	isRotation := [V4Ret]bool{V4Ror: true, V4Rol: true}
+	// There is a small chance that R8 isn't used, in which case the code
+	// is generated again from where the data left off
+	for r8Used := false; ; {
+		var (
+			latency     [9]int
+			asicLatency [9]int
+			// The previous instruction and the source value of R0-R3.
+			// R4-R8 are constant and treated as having the same value
+			instData    = [9]uint32{0, 1, 2, 3, 0xFFFFFF, 0xFFFFFF, 0xFFFFFF, 0xFFFFFF, 0xFFFFFF}
+			aluBusy     [v4TotalLatency + 1][v4ALUCount]bool
+			rotated     [4]bool
+			rotateCount int
+			numRetries  int
+		)
+		code = code[:0]
+		r8Used = false
+
+		for iterations := 0; (latency[0] < v4TotalLatency || latency[1] < v4TotalLatency || latency[2] < v4TotalLatency || latency[3] < v4TotalLatency) && numRetries < 64; {
+			// Fail-safe to guarantee termination
+			iterations++
+			if iterations > 256 {
+				break
+			}
+
+			c := data.byte()
+			// MUL is 0-2, ADD 3, SUB 4, ROR/ROL 5 and XOR 6-7
+			opcode := c & 7
+			switch {
+			case opcode == 5:
+				if int8(data.byte()) >= 0 {
+					opcode = V4Ror
+				} else {
+					opcode = V4Rol
+				}
+			case opcode >= 6:
+				opcode = V4Xor
+			case opcode <= 2:
+				opcode = V4Mul
+			default:
+				opcode -= 2
+			}
+			dst := (c >> 3) & 3
+			src := (c >> 5) & 7
+			a, b := int(dst), int(src)
+
+			// ADD, SUB and XOR of a register with itself use R8 instead
+			if (opcode == V4Add || opcode == V4Sub || opcode == V4Xor) && a == b {
+				b = 8
+				src = 8
+			}
+			// Rotating the same register twice is a single rotation
+			if isRotation[opcode] && rotated[a] {
+				continue
+			}
+			// Repeating an instruction other than MUL with the same source
+			// value can be optimized into a single one
+			if opcode != V4Mul && instData[a]&0xFFFF00 == uint32(opcode)<<8+(instData[b]&255)<<16 {
+				continue
+			}
+
+			// Find the ALU that is available first for this instruction
+			nextLatency := latency[a]
+			if latency[b] > nextLatency {
+				nextLatency = latency[b]
+			}
+			alu := -1
+			for ; nextLatency < v4TotalLatency; nextLatency++ {
+				for i := v4OpALUs[opcode] - 1; i >= 0; i-- {
+					if aluBusy[nextLatency][i] {
+						continue
+					}
+					// ADD takes two cycles of the ALU
+					if opcode == V4Add && aluBusy[nextLatency+1][i] {
+						continue
+					}
+					// A rotation can only start after the previous one
+					if isRotation[opcode] && nextLatency < rotateCount*v4OpLatency[opcode] {
+						continue
+					}
+					alu = i
+					break
+				}
+				if alu >= 0 {
+					break
+				}
+			}
+
+			// Don't leave a register unchanged for more than 7 cycles
+			if nextLatency > latency[a]+7 {
+				continue
+			}
+
+			nextLatency += v4OpLatency[opcode]
+			if nextLatency > v4TotalLatency {
+				numRetries++
+				continue
+			}
+			if isRotation[opcode] {
+				rotateCount++
+			}
+			aluBusy[nextLatency-v4OpLatency[opcode]][alu] = true
+			latency[a] = nextLatency
+			// An ASIC runs as many independent instructions at once as
+			// possible, so only the dependencies count
+			if asicLatency[b] > asicLatency[a] {
+				asicLatency[a] = asicLatency[b]
+			}
+			asicLatency[a] += v4ASICOpLatency[opcode]
+			rotated[a] = isRotation[opcode]
+			instData[a] = uint32(len(code)) + uint32(opcode)<<8 + (instData[b]&255)<<16
+
+			instruction := V4Instruction{opcode, dst, src, 0}
+			if src == 8 {
+				r8Used = true
+			}
+			if opcode == V4Add {
+				aluBusy[nextLatency-v4OpLatency[opcode]+1][alu] = true
+				instruction.C = data.uint32()
+			}
+			code = append(code, instruction)
+			if len(code) >= V4MinInstructions {
+				break
+			}
+		}
+
+		// An ASIC can run more of the code in parallel, so MUL and ROR are
+		// added until at least one register has the latency on an ASIC too
+		generated := len(code)
+		for len(code) < V4MaxInstructions && asicLatency[0] < v4TotalLatency && asicLatency[1] < v4TotalLatency && asicLatency[2] < v4TotalLatency && asicLatency[3] < v4TotalLatency {
+			min, max := 0, 0
+			for i := 1; i < 4; i++ {
+				if asicLatency[i] < asicLatency[min] {
+					min = i
+				}
+				if asicLatency[i] > asicLatency[max] {
+					max = i
+				}
+			}
+			opcode := [3]uint8{V4Ror, V4Mul, V4Mul}[(len(code)-generated)%3]
+			latency[min] = latency[max] + v4OpLatency[opcode]
+			asicLatency[min] = asicLatency[max] + v4ASICOpLatency[opcode]
+			code = append(code, V4Instruction{opcode, uint8(min), uint8(max), 0})
+		}
+
+		if r8Used && len(code) >= V4MinInstructions && len(code) <= V4MaxInstructions {
+			break
+		}
+	}
+	return append(code, V4Instruction{V4Ret, 0, 0, 0})
+}
+
+// ExecuteRandomMath runs a random math program on the registers r
+func ExecuteRandomMath(code []V4Instruction, r *[9]uint32) {
+	for _, op := range code {
+		src := r[op.Src]
+		dst := &r[op.Dst]
+		switch op.Opcode {
+		case V4Mul:
+			*dst *= src
+		case V4Add:
+			*dst += src + op.C
+		case V4Sub:
+			*dst -= src
+		case V4Ror:
+			*dst = *dst>>(src%32) | *dst<<((32-src%32)%32)
+		case V4Rol:
+			*dst = *dst<<(src%32) | *dst>>((32-src%32)%32)
+		case V4Xor:
+			*dst ^= src
+		case V4Ret:
+			return
+		}
+	}
+}
+
+// randomMathCache keeps the program of the most recent height, which every
+// hash of a block runs
+var randomMathCache = struct {
+	sync.Mutex
+	height uint64
+	code   []V4Instruction
+}{}
+
+// RandomMath returns the random math program of a block height, generating
+// it only when the height changes
+func RandomMath(height uint64) []V4Instruction {
+	randomMathCache.Lock()
+	defer randomMathCache.Unlock()
+	if randomMathCache.code == nil || randomMathCache.height != height {
+		randomMathCache.code = GenerateRandomMath(height)
+		randomMathCache.height = height
+	}
+	return randomMathCache.code
+}
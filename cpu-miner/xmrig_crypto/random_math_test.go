@@ -0,0 +1,52 @@
+package xmrig_crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRandomMath(t *testing.T) {
+	require := require.New(t)
+
+	for height := uint64(1806260); height < 1806360; height++ {
+		code := GenerateRandomMath(height)
+		require.True(len(code) >= V4MinInstructions+1, "height %v", height)
+		require.True(len(code) <= V4MaxInstructions+1, "height %v", height)
+		require.Equal(uint8(V4Ret), code[len(code)-1].Opcode)
+
+		r8Used := false
+		for _, op := range code[:len(code)-1] {
+			require.True(op.Opcode < V4Ret)
+			require.True(op.Dst < 4)
+			require.True(op.Src < 9)
+			if op.Src == 8 {
+				r8Used = true
+			}
+		}
+		require.True(r8Used, "height %v", height)
+		require.Equal(code, GenerateRandomMath(height))
+	}
+	require.NotEqual(GenerateRandomMath(1806260), GenerateRandomMath(1806261))
+	require.Equal(GenerateRandomMath(1806260), RandomMath(1806260))
+}
+
+func TestExecuteRandomMath(t *testing.T) {
+	require := require.New(t)
+
+	r := [9]uint32{3, 0x80000001, 0xF0, 10, 4, 1, 0, 0, 0}
+	ExecuteRandomMath([]V4Instruction{
+		{V4Mul, 0, 4, 0},
+		{V4Add, 3, 0, 5},
+		{V4Ror, 1, 5, 0},
+		{V4Rol, 2, 4, 0},
+		{V4Sub, 0, 5, 0},
+		{V4Xor, 3, 4, 0},
+		{V4Ret, 0, 0, 0},
+		{V4Mul, 0, 0, 0},
+	}, &r)
+	require.Equal(uint32(11), r[0])
+	require.Equal(uint32(0xC0000000), r[1])
+	require.Equal(uint32(0xF00), r[2])
+	require.Equal(uint32((10+12+5)^4), r[3])
+}
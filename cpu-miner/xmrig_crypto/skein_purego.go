@@ -0,0 +1,113 @@
+//go:build purego || !cgo
+// +build purego !cgo
+
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	skeinBlockSize = 64
+	skeinKSParity  = 0x1BD11BDAA9FC1A22
+
+	skeinFlagFirst = uint64(1) << 62
+	skeinFlagFinal = uint64(1) << 63
+	skeinTypeMsg   = uint64(48) << 56
+	skeinTypeOut   = uint64(63) << 56
+)
+
+// skein512IV256 is the chaining value of Skein-512-256 after the config block
+var skein512IV256 = [8]uint64{
+	0xCCD044A12FDB3E13, 0xE83590301A79A9EB, 0x55AEA0614F816E6F, 0x2A2767A4AE9B94DB,
+	0xEC06025E74DD7683, 0xE7A436CDC4746251, 0xC36FBAF9393AD185, 0x3EEDBA1833EDFC13,
+}
+
+// skeinRotations are the Threefish-512 rotation constants for each of the
+// 8 rounds that repeat
+var skeinRotations = [8][4]int{
+	{46, 36, 19, 37}, {33, 27, 14, 42}, {17, 49, 36, 39}, {44, 9, 54, 56},
+	{39, 30, 34, 24}, {13, 50, 10, 17}, {25, 29, 39, 43}, {8, 35, 56, 22},
+}
+
+// skeinPairs are the words mixed together in each of the 4 rounds between
+// key injections, which takes care of the word permutation
+var skeinPairs = [4][8]int{
+	{0, 1, 2, 3, 4, 5, 6, 7},
+	{2, 1, 4, 7, 6, 5, 0, 3},
+	{4, 1, 6, 3, 0, 5, 2, 7},
+	{6, 1, 0, 7, 2, 5, 4, 3},
+}
+
+// skeinProcessBlock runs one UBI block through Threefish-512 keyed with h,
+// with position being the number of bytes processed so far including this
+// block
+func skeinProcessBlock(h *[8]uint64, block []byte, position, flags uint64) {
+	var ks [9]uint64
+	ks[8] = skeinKSParity
+	for i := 0; i < 8; i++ {
+		ks[i] = h[i]
+		ks[8] ^= h[i]
+	}
+	ts := [3]uint64{position, flags}
+	ts[2] = ts[0] ^ ts[1]
+
+	var w, x [8]uint64
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint64(block[8*i:])
+	}
+	inject := func(s int) {
+		for i := range x {
+			x[i] += ks[(s+i)%9]
+		}
+		x[5] += ts[s%3]
+		x[6] += ts[(s+1)%3]
+		x[7] += uint64(s)
+	}
+
+	x = w
+	inject(0)
+	for r := 0; r < 72; r++ {
+		p := &skeinPairs[r%4]
+		rot := &skeinRotations[r%8]
+		for j := 0; j < 4; j++ {
+			a, b := p[2*j], p[2*j+1]
+			x[a] += x[b]
+			x[b] = bits.RotateLeft64(x[b], rot[j]) ^ x[a]
+		}
+		if r%4 == 3 {
+			inject(r/4 + 1)
+		}
+	}
+	for i := range h {
+		h[i] = x[i] ^ w[i]
+	}
+}
+
+// skein512256 returns the Skein-512-256 hash of data
+func skein512256(data []byte) []byte {
+	h := skein512IV256
+	flags := skeinFlagFirst | skeinTypeMsg
+	position := uint64(0)
+	// The last block is processed separately, with the final flag set, even
+	// if it is a full block
+	for ; len(data) > skeinBlockSize; data = data[skeinBlockSize:] {
+		position += skeinBlockSize
+		skeinProcessBlock(&h, data, position, flags)
+		flags &^= skeinFlagFirst
+	}
+	var block [skeinBlockSize]byte
+	copy(block[:], data)
+	position += uint64(len(data))
+	skeinProcessBlock(&h, block[:], position, flags|skeinFlagFinal)
+
+	// Output transform with a zero counter
+	var counter [skeinBlockSize]byte
+	skeinProcessBlock(&h, counter[:], 8, skeinFlagFirst|skeinFlagFinal|skeinTypeOut)
+	out := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(out[8*i:], h[i])
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package xmrig_crypto
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+const (
+	// VariantOriginal is the original cryptonight, cn/0
+	VariantOriginal = 0
+	// Variant2 is cryptonight v2, cn/2, which monero uses since its v8 fork
+	Variant2 = 2
+	// VariantR is cryptonight-r, cn/r, whose random math changes with the
+	// block height
+	VariantR = 4
+	// VariantHeavy is cryptonight-heavy, cn-heavy/0, which sumokoin and
+	// haven use. It has twice the scratchpad and half the iterations of
+	// cn/0
+	VariantHeavy = 5
+	// VariantLite is cryptonight-lite, cn-lite/0, which aeon uses. It has
+	// half the scratchpad and half the iterations of cn/0
+	VariantLite = 6
+	// VariantPico is cryptonight-pico, cn-pico/trtl, which turtlecoin uses.
+	// It runs the main loop of cn/2 with an eighth of the scratchpad and of
+	// the iterations of cn/0
+	VariantPico = 7
+	// VariantHalf is cryptonight-half, cn/half, which masari and stellite
+	// use. It is cn/2 with half the iterations
+	VariantHalf = 8
+	// VariantGPU is cryptonight-gpu, cn/gpu, which ryo uses. It replaces the
+	// main loop with float math meant for GPUs and has no extra hashes
+	VariantGPU = 9
+)
+
+const (
+	// Memory is the size of the scratchpad of cryptonight
+	Memory = 2 * 1024 * 1024
+	// MemoryHeavy is the size of the scratchpad of cryptonight-heavy, the
+	// largest of all variants
+	MemoryHeavy = 4 * 1024 * 1024
+	// MemoryLite is the size of the scratchpad of cryptonight-lite
+	MemoryLite = 1 * 1024 * 1024
+	// MemoryPico is the size of the scratchpad of cryptonight-pico
+	MemoryPico = 256 * 1024
+)
+
+// algorithmVariants maps the algorithms that can be hashed onto their
+// variant of cryptonight
+var algorithmVariants = map[string]int{
+	"cn/0":         VariantOriginal,
+	"cn/2":         Variant2,
+	"cn/r":         VariantR,
+	"cn/half":      VariantHalf,
+	"cn/gpu":       VariantGPU,
+	"cn-heavy/0":   VariantHeavy,
+	"cn-lite/0":    VariantLite,
+	"cn-pico/trtl": VariantPico,
+}
+
+// AlgorithmVariant returns the variant of cryptonight of algo, which is
+// named the way miner.NormalizeAlgorithm names it. ok is false if the
+// algorithm isn't implemented
+func AlgorithmVariant(algo string) (variant int, ok bool) {
+	variant, ok = algorithmVariants[algo]
+	return variant, ok
+}
+
+// VariantAlgorithm returns the name of the algorithm of variant, the inverse
+// of AlgorithmVariant. ok is false if variant isn't implemented
+func VariantAlgorithm(variant int) (algo string, ok bool) {
+	for algo, v := range algorithmVariants {
+		if v == variant {
+			return algo, true
+		}
+	}
+	return "", false
+}
+
+// ScratchpadSize returns the size in bytes of the scratchpad that hashing
+// with variant needs
+func ScratchpadSize(variant int) int {
+	switch variant {
+	case VariantHeavy:
+		return MemoryHeavy
+	case VariantLite:
+		return MemoryLite
+	case VariantPico:
+		return MemoryPico
+	default:
+		return Memory
+	}
+}
+
+type XMRigWork struct {
+	*stratum.Work
+	Cdata *XMRigCData
+	// Variant of cryptonight that the work is hashed with
+	Variant int
+	// Height of the block that the work belongs to, which selects the
+	// random math of cryptonight-r
+	Height uint64
+	// Nicehash is true if the pool reserved the most significant nonce
+	// byte, which SetNonce then leaves as the job has it
+	Nicehash bool
+}
+
+func NewXMRigWork() *XMRigWork {
+	return &XMRigWork{
+		stratum.NewWork(),
+		nil,
+		VariantOriginal,
+		0,
+		false,
+	}
+}
+
+func (work *XMRigWork) Clone() *XMRigWork {
+	scWork := stratum.NewWork()
+	stratum.WorkCopy(scWork, work.Work)
+
+	ret := &XMRigWork{
+		scWork,
+		nil,
+		work.Variant,
+		work.Height,
+		work.Nicehash,
+	}
+	ret.UpdateCData()
+	return ret
+}
+
+// SetNonce writes nonce into the blob of work. Every cryptonight variant
+// has the nonce at NonceOffset as a little-endian 32-bit number, and pools
+// decode the nonce of a share from the hex of those bytes, so it is written
+// in that byte order whatever the byte order of the machine. With nicehash
+// the most significant byte of the job is kept
+func (work *XMRigWork) SetNonce(nonce uint32) {
+	if work.Nicehash {
+		nonce = NicehashNonce(nonce, work.Data)
+	}
+	binary.LittleEndian.PutUint32(work.Data[NonceOffset:NonceOffset+4], nonce)
+}
+
+// NicehashNonce returns nonce with its most significant byte replaced by
+// the one that a nicehash-style pool reserved in blob
+func NicehashNonce(nonce uint32, blob []byte) uint32 {
+	return nonce&0xFFFFFF | uint32(blob[NonceOffset+3])<<24
+}
+
+// Nonce returns the nonce in the blob of work
+func (work *XMRigWork) Nonce() uint32 {
+	return binary.LittleEndian.Uint32(work.Data[NonceOffset : NonceOffset+4])
+}
+
+// Validate checks the blob of work with ValidateBlob
+func (work *XMRigWork) Validate() error {
+	return ValidateBlob(work.Data, work.Size)
+}
+
+// ValidateBlob checks that the first size bytes of data look like a hashing
+// blob, so that a truncated or corrupted job isn't hashed and doesn't
+// produce a stream of invalid shares. The blob has to fit in data and in
+// the buffers of the miners, and has to start with a block header whose
+// nonce is at NonceOffset: the major and minor versions and the timestamp
+// as varints, followed by the hash of the previous block
+func ValidateBlob(data []byte, size int) error {
+	if size < DefaultWorkSize || size > maxWorkSize {
+		return fmt.Errorf("Blob size %d is not between %d and %d", size, DefaultWorkSize, maxWorkSize)
+	}
+	if len(data) < size {
+		return fmt.Errorf("Blob is truncated to %d of %d bytes", len(data), size)
+	}
+	offset := 0
+	for _, field := range []string{"major version", "minor version", "timestamp"} {
+		n, ok := varintLength(data[offset:NonceOffset])
+		if !ok {
+			return fmt.Errorf("Invalid %v in block header", field)
+		}
+		offset += n
+	}
+	if offset+32 != NonceOffset {
+		return fmt.Errorf("Nonce of block header is at offset %d instead of %d", offset+32, NonceOffset)
+	}
+	return nil
+}
+
+// varintLength returns the number of bytes of the varint at the start of b.
+// ok is false if b ends before the varint does
+func varintLength(b []byte) (n int, ok bool) {
+	for i, c := range b {
+		if c&0x80 == 0 {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package xmrig_crypto
+
+import (
+	"fmt"
+	"math/rand"
+	"unsafe"
+
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+const (
+	// DefaultWorkSize is the size of a typical monero hashing blob
+	DefaultWorkSize = 76
+	// NonceOffset is the offset of the 32-bit nonce within the hashing blob
+	NonceOffset = 39
+	// maxWorkSize is the size of the buffer backing generated work.
+	// The GPU miner pads the blob up to 88 bytes
+	maxWorkSize = 128
+)
+
+// WorkGenerator generates a deterministic sequence of XMRigWork from a seed.
+// Two generators created with the same seed and parameters produce exactly
+// the same sequence of work on every machine, which makes it suitable for
+// benchmarks and regression tests.
+type WorkGenerator struct {
+	Seed   int64
+	Size   int
+	Target uint64
+	rand   *rand.Rand
+	count  uint64
+}
+
+// NewWorkGenerator returns a WorkGenerator producing DefaultWorkSize blobs
+// with a target equivalent to the given difficulty
+func NewWorkGenerator(seed int64, difficulty uint64) *WorkGenerator {
+	if difficulty == 0 {
+		difficulty = 1
+	}
+	return &WorkGenerator{
+		Seed:   seed,
+		Size:   DefaultWorkSize,
+		Target: 0xFFFFFFFFFFFFFFFF / difficulty,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Next returns the next XMRigWork in the sequence
+func (g *WorkGenerator) Next() *XMRigWork {
+	work := NewXMRigWork()
+	data := make(stratum.WorkData, maxWorkSize)
+	g.rand.Read(data[:g.Size])
+	// Every job starts off with a zero nonce
+	for i := NonceOffset; i < NonceOffset+4; i++ {
+		data[i] = 0
+	}
+	work.Data = data
+	work.Size = g.Size
+	work.Target = g.Target
+	work.JobID = fmt.Sprintf("%d-%d", g.Seed, g.count)
+	work.NoncePtr = (*uint32)(unsafe.Pointer(&work.Data[NonceOffset]))
+	work.UpdateCData()
+	g.count++
+	return work
+}
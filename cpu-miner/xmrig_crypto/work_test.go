@@ -0,0 +1,96 @@
+package xmrig_crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testBlob is the hashing blob of a monero block, with a nonce of 0
+const testBlob = "0707f7a4f0d605b303260816ba3f10902e1a145ac5fad3aa3af6ea44c11869dc4f853f002b2eea0000000077b206a02ca5b1d4ce6bbfdf0acac38bded34d2dcdeef95cd20cefc12f61d56109"
+
+func TestValidateBlob(t *testing.T) {
+	require := require.New(t)
+
+	blob, err := hex.DecodeString(testBlob)
+	require.Nil(err)
+	work := NewXMRigWork()
+	copy(work.Data, blob)
+	work.Size = len(blob)
+	require.Nil(work.Validate())
+
+	// Truncated and oversized blobs
+	require.NotNil(ValidateBlob(blob, len(blob)-1))
+	require.NotNil(ValidateBlob(blob, maxWorkSize+1))
+	require.NotNil(ValidateBlob(blob[:50], len(blob)))
+
+	// A blob of zeros has a header that is too short
+	require.NotNil(ValidateBlob(make([]byte, len(blob)), len(blob)))
+
+	// A timestamp that doesn't end before the nonce
+	bad := append([]byte(nil), blob...)
+	for i := 2; i < NonceOffset; i++ {
+		bad[i] = 0xff
+	}
+	require.NotNil(ValidateBlob(bad, len(bad)))
+}
+
+func TestSetNonce(t *testing.T) {
+	require := require.New(t)
+
+	mem, err := SetupHugePages(1, Memory)
+	require.Nil(err)
+	ctx, err := SetupCryptonightContext(mem, 0, Memory)
+	require.Nil(err)
+	blob, err := hex.DecodeString(testBlob)
+	require.Nil(err)
+
+	vectors := []struct {
+		nonce uint32
+		// Nonce as submitted to the pool
+		hex  string
+		hash string
+	}{
+		{0, "00000000", "e239fb8ac08b56f30e657e0ac78efcc60c0e7c11141a22c508ad2c6cf345be5f"},
+		{0x12345678, "78563412", "5e7c9366ad01c0f52b4407b631da33eae8e620b244c49a2c645f4b3d9c991f5e"},
+		{0xdeadbeef, "efbeadde", "a37d3a060570d0aa751b15141e21d14f46fda8f84f31bf9ce96dd5ea50fbdda6"},
+	}
+	for _, v := range vectors {
+		work := NewXMRigWork()
+		copy(work.Data, blob)
+		work.Size = len(blob)
+		work.Target = 0xFFFFFFFFFFFFFFFF
+		work.UpdateCData()
+		work.SetNonce(v.nonce)
+		require.Equal(v.nonce, work.Nonce())
+		require.Equal(v.hex, hex.EncodeToString(work.Data[NonceOffset:NonceOffset+4]))
+		// The rest of the blob is left alone
+		require.Equal(blob[:NonceOffset], []byte(work.Data[:NonceOffset]))
+		require.Equal(blob[NonceOffset+4:], []byte(work.Data[NonceOffset+4:work.Size]))
+
+		hash, found := CryptonightHash(work, ctx)
+		require.True(found)
+		require.Equal(v.hash, hex.EncodeToString(hash))
+	}
+}
+
+func TestSetNonceNicehash(t *testing.T) {
+	require := require.New(t)
+
+	blob, err := hex.DecodeString(testBlob)
+	require.Nil(err)
+	work := NewXMRigWork()
+	copy(work.Data, blob)
+	work.Size = len(blob)
+	work.Nicehash = true
+	// The pool reserved byte 42 for this rig
+	work.Data[NonceOffset+3] = 42
+
+	work.SetNonce(0x123456)
+	require.Equal(uint32(42)<<24|0x123456, work.Nonce())
+	work.SetNonce(0xdeadbeef)
+	require.Equal(uint32(42)<<24|0xadbeef, work.Nonce())
+	require.Equal(byte(42), work.Clone().Data[NonceOffset+3])
+	require.True(work.Clone().Nicehash)
+}
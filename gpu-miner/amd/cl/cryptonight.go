@@ -411,6 +411,148 @@ void AESExpandKey256(uint *keybuf)
 
 #define IDX(x)	(x)
 
+#ifndef VARIANT
+#define VARIANT 0
+#endif
+
+// Cryptonight-pico and cryptonight-half run the main loop of cryptonight v2
+// with a smaller scratchpad or fewer iterations, which MEMORY, MASK and
+// ITERATIONS already account for
+#if VARIANT == 7 || VARIANT == 8
+#undef VARIANT
+#define VARIANT 2
+#endif
+
+#ifndef MEMORY
+#define MEMORY (ITERATIONS << 2)
+#endif
+
+#if VARIANT == 5 || VARIANT == 9
+// Cryptonight-heavy xors the text of each of the 8 threads of a hash with
+// that of the next one, as does the implode of cryptonight-gpu. Every thread of the work group has to reach the
+// barriers, so threads past Threads run this too and their results are
+// ignored
+inline uint4 mix_and_propagate(__local uint4 xin[8][WORKSIZE], const uint4 text)
+{
+	barrier(CLK_LOCAL_MEM_FENCE);
+	xin[get_local_id(1)][get_local_id(0)] = text;
+	barrier(CLK_LOCAL_MEM_FENCE);
+	return text ^ xin[(get_local_id(1) + 1) % 8][get_local_id(0)];
+}
+#endif
+
+#if VARIANT == 2 || VARIANT == 4
+// Adds a, b and b1 to the other three 16-byte chunks of the 64-byte line of
+// chunk idx, rotating them. Returns the xor of the chunks before they were
+// shuffled, which cryptonight-r mixes into c
+inline ulong2 variant2_shuffle(__global uint4 *Scratchpad, const ulong idx, const ulong2 a, const ulong2 b, const ulong2 b1)
+{
+	const ulong2 chunk1 = as_ulong2(Scratchpad[IDX(idx ^ 1)]);
+	const ulong2 chunk2 = as_ulong2(Scratchpad[IDX(idx ^ 2)]);
+	const ulong2 chunk3 = as_ulong2(Scratchpad[IDX(idx ^ 3)]);
+	Scratchpad[IDX(idx ^ 1)] = as_uint4(chunk3 + b1);
+	Scratchpad[IDX(idx ^ 2)] = as_uint4(chunk1 + b);
+	Scratchpad[IDX(idx ^ 3)] = as_uint4(chunk2 + a);
+	return chunk1 ^ chunk2 ^ chunk3;
+}
+#endif
+
+#if VARIANT == 2
+#pragma OPENCL EXTENSION cl_khr_fp64 : enable
+
+// Returns floor(2 * sqrt(2^64 + input) - 2^33). The square root of the double
+// is off by at most one, which the fixup corrects
+inline ulong variant2_sqrt(const ulong input)
+{
+	ulong r = convert_ulong(sqrt(convert_double(input) + 18446744073709551616.0) * 2.0 - 8589934592.0);
+	const ulong s = r >> 1;
+	const ulong b = r & 1;
+	const ulong r2 = s * (s + b) + (r << 32);
+	if (r2 + b > input)
+		--r;
+	if (r2 + (1UL << 32) < input - s)
+		++r;
+	return r;
+}
+#endif
+
+#if VARIANT == 9
+// The float math of cryptonight-gpu has to be rounded exactly like the CPU
+// rounds it, so no multiplication may be fused with an addition. The host
+// also builds it with correctly rounded divisions
+#pragma OPENCL FP_CONTRACT OFF
+
+// Sets the lowest bit of the exponent and clears the one above it
+inline float4 cn_gpu_fma_break(const float4 x)
+{
+	return as_float4((as_uint4(x) & 0xFEFFFFFFU) | 0x00800000U);
+}
+
+// Sets the exponent of x to that of 2.0, with the sign kept or cleared by
+// mask
+inline float4 cn_gpu_exp2(const float4 x, const uint mask)
+{
+	return as_float4((as_uint4(x) & mask) | 0x40000000U);
+}
+
+inline void cn_gpu_sub_round(const float4 n0, float4 n1, const float4 n2, float4 n3, const float4 rnd_c, float4 *n, float4 *d, float4 *c)
+{
+	n1 = n1 + *c;
+	float4 nn = n0 * *c;
+	nn = n1 * (nn * nn);
+	nn = cn_gpu_fma_break(nn);
+	*n = *n + nn;
+
+	n3 = n3 - *c;
+	float4 dd = n2 * *c;
+	dd = n3 * (dd * dd);
+	dd = cn_gpu_fma_break(dd);
+	*d = *d + dd;
+
+	// Constant feedback
+	*c = *c + rnd_c;
+	*c = *c + (float4)(0.734375f);
+	*c = *c + cn_gpu_exp2(nn + dd, 0x807FFFFFU);
+}
+
+inline void cn_gpu_round_compute(const float4 n0, const float4 n1, const float4 n2, const float4 n3, const float4 rnd_c, float4 *c, float4 *r)
+{
+	float4 n = (float4)(0.0f);
+	float4 d = (float4)(0.0f);
+
+	cn_gpu_sub_round(n0, n1, n2, n3, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n1, n2, n3, n0, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n2, n3, n0, n1, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n3, n0, n1, n2, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n3, n2, n1, n0, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n2, n1, n0, n3, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n1, n0, n3, n2, rnd_c, &n, &d, c);
+	cn_gpu_sub_round(n0, n3, n2, n1, rnd_c, &n, &d, c);
+
+	// abs(d) >= 2.0 rules out divisions by zero and overflows
+	*r = *r + n / cn_gpu_exp2(d, 0xFF7FFFFFU);
+}
+
+// Runs 4 rounds starting from cnt and xors the result, rotated by rot bytes,
+// into out. Even rotations start a new sum and odd ones add to it
+inline void cn_gpu_single_compute(const float4 n0, const float4 n1, const float4 n2, const float4 n3, const float cnt, const float4 rnd_c, float4 *sum, uint4 *out, const uint rot)
+{
+	float4 c = (float4)(cnt);
+	float4 r = (float4)(0.0f);
+
+	for(int i = 0; i < 4; ++i)
+		cn_gpu_round_compute(n0, n1, n2, n3, rnd_c, &c, &r);
+
+	// A quick fmod, setting the exponent to 2
+	r = cn_gpu_exp2(r, 0x807FFFFFU);
+	*sum = (rot & 1) ? *sum + r : r;
+
+	const uchar16 x = as_uchar16(convert_int4_rtz(r * (float4)(536870880.0f)));
+	const uchar16 bytes = (uchar16)(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15);
+	*out ^= as_uint4(shuffle(x, (bytes + (uchar16)((uchar)rot)) & (uchar16)(15)));
+}
+#endif
+
 __attribute__((reqd_work_group_size(WORKSIZE, 8, 1)))
 __kernel void cn0(__global ulong *input, __global uint4 *Scratchpad, __global ulong *states, ulong Threads)
 {
@@ -438,7 +580,7 @@ __kernel void cn0(__global ulong *input, __global uint4 *Scratchpad, __global ul
 	if(gIdx < Threads)
 	{
 		states += 25 * gIdx;
-		Scratchpad += gIdx * (ITERATIONS >> 2);
+		Scratchpad += gIdx * (MEMORY >> 4);
 
 		((ulong8 *)State)[0] = vload8(0, input);
 		State[8] = input[8];
@@ -476,11 +618,46 @@ __kernel void cn0(__global ulong *input, __global uint4 *Scratchpad, __global ul
 
 	mem_fence(CLK_LOCAL_MEM_FENCE);
 
+#if VARIANT == 5
+	__local uint4 xin[8][WORKSIZE];
+
+	for(int i = 0; i < 16; ++i)
+	{
+		#pragma unroll
+		for(int j = 0; j < 10; ++j)
+			text = AES_Round(AES0, AES1, AES2, AES3, text, ((uint4 *)ExpandedKey1)[j]);
+
+		text = mix_and_propagate(xin, text);
+	}
+#endif
+
+#if VARIANT == 9
+	// Cryptonight-gpu fills each 512 byte block of the scratchpad with
+	// keccak of the state, with the index of the block mixed into it. The 8
+	// threads of a hash take every 8th block
+	if(gIdx < Threads)
+	{
+		__global ulong *out = (__global ulong *)Scratchpad;
+		for(int i = get_local_id(1); i < (MEMORY >> 9); i += 8)
+		{
+			ulong hash[25];
+			for(int j = 0; j < 25; ++j) hash[j] = State[j];
+			hash[0] ^= i;
+
+			keccakf1600_2(hash);
+			for(int j = 0; j < 20; ++j) out[(i << 6) + j] = hash[j];
+			keccakf1600_2(hash);
+			for(int j = 0; j < 22; ++j) out[(i << 6) + 20 + j] = hash[j];
+			keccakf1600_2(hash);
+			for(int j = 0; j < 22; ++j) out[(i << 6) + 42 + j] = hash[j];
+		}
+	}
+#else
 	// do not use early return here
 	if(gIdx < Threads)
 	{
 		#pragma unroll 2
-		for(int i = 0; i < (ITERATIONS >> 5); ++i)
+		for(int i = 0; i < (MEMORY >> 7); ++i)
 		{
 			#pragma unroll
 			for(int j = 0; j < 10; ++j)
@@ -489,9 +666,93 @@ __kernel void cn0(__global ulong *input, __global uint4 *Scratchpad, __global ul
 			Scratchpad[IDX((i << 3) + get_local_id(1))] = text;
 		}
 	}
+#endif
 	mem_fence(CLK_GLOBAL_MEM_FENCE);
 }
 
+#if VARIANT == 9
+// The main loop of cryptonight-gpu runs float math on the four 16-byte
+// chunks of a 64-byte line of the scratchpad, as 32-bit integers converted to
+// floats, and xors the results into them. Each thread runs the loop of one
+// hash, exactly as the CPU does
+__attribute__((reqd_work_group_size(WORKSIZE, 1, 1)))
+__kernel void cn1(__global uint4 *Scratchpad, __global ulong *states, ulong Threads)
+{
+	const ulong gIdx = get_global_id(0) - get_global_offset(0);
+
+	// do not use early return here
+	if(gIdx < Threads)
+	{
+		states += 25 * gIdx;
+		Scratchpad += gIdx * (MEMORY >> 4);
+
+		uint idx = ((((__global uint *)states)[0] >> 8) & MASK) >> 4;
+		float4 sum0 = (float4)(0.0f);
+
+		for(int i = 0; i < ITERATIONS; ++i)
+		{
+			uint4 v[4];
+			float4 n[4];
+			for(int j = 0; j < 4; ++j)
+			{
+				v[j] = Scratchpad[IDX(idx + j)];
+				n[j] = convert_float4_rte(as_int4(v[j]));
+			}
+			const float4 rc = sum0;
+			float4 suma, sumb, sum[4];
+			uint4 out, out2;
+
+			out = (uint4)(0U);
+			cn_gpu_single_compute(n[0], n[1], n[2], n[3], 1.3437500f, rc, &suma, &out, 0);
+			cn_gpu_single_compute(n[0], n[2], n[3], n[1], 1.2812500f, rc, &suma, &out, 1);
+			cn_gpu_single_compute(n[0], n[3], n[1], n[2], 1.3593750f, rc, &sumb, &out, 2);
+			cn_gpu_single_compute(n[0], n[3], n[2], n[1], 1.3671875f, rc, &sumb, &out, 3);
+			sum[0] = suma + sumb;
+			Scratchpad[IDX(idx)] = v[0] ^ out;
+			out2 = out;
+
+			out = (uint4)(0U);
+			cn_gpu_single_compute(n[1], n[0], n[2], n[3], 1.4296875f, rc, &suma, &out, 0);
+			cn_gpu_single_compute(n[1], n[2], n[3], n[0], 1.3984375f, rc, &suma, &out, 1);
+			cn_gpu_single_compute(n[1], n[3], n[0], n[2], 1.3828125f, rc, &sumb, &out, 2);
+			cn_gpu_single_compute(n[1], n[3], n[2], n[0], 1.3046875f, rc, &sumb, &out, 3);
+			sum[1] = suma + sumb;
+			Scratchpad[IDX(idx + 1)] = v[1] ^ out;
+			out2 ^= out;
+
+			out = (uint4)(0U);
+			cn_gpu_single_compute(n[2], n[1], n[0], n[3], 1.4140625f, rc, &suma, &out, 0);
+			cn_gpu_single_compute(n[2], n[0], n[3], n[1], 1.2734375f, rc, &suma, &out, 1);
+			cn_gpu_single_compute(n[2], n[3], n[1], n[0], 1.2578125f, rc, &sumb, &out, 2);
+			cn_gpu_single_compute(n[2], n[3], n[0], n[1], 1.2890625f, rc, &sumb, &out, 3);
+			sum[2] = suma + sumb;
+			Scratchpad[IDX(idx + 2)] = v[2] ^ out;
+			out2 ^= out;
+
+			out = (uint4)(0U);
+			cn_gpu_single_compute(n[3], n[1], n[2], n[0], 1.3203125f, rc, &suma, &out, 0);
+			cn_gpu_single_compute(n[3], n[2], n[0], n[1], 1.3515625f, rc, &suma, &out, 1);
+			cn_gpu_single_compute(n[3], n[0], n[1], n[2], 1.3359375f, rc, &sumb, &out, 2);
+			cn_gpu_single_compute(n[3], n[0], n[2], n[1], 1.4609375f, rc, &sumb, &out, 3);
+			sum[3] = suma + sumb;
+			Scratchpad[IDX(idx + 3)] = v[3] ^ out;
+			out2 ^= out;
+
+			// abs(sum0), which is below 64
+			sum0 = fabs((sum[0] + sum[1]) + (sum[2] + sum[3]));
+
+			uint4 x = as_uint4(convert_int4_rtz(sum0 * (float4)(16777216.0f))) ^ out2;
+			x ^= x.wzyx;
+			x ^= x.yxyx;
+
+			// sum0 is fed into the next iteration between 0 and 1
+			sum0 = sum0 / (float4)(64.0f);
+			idx = (x.s0 & MASK) >> 4;
+		}
+	}
+	mem_fence(CLK_GLOBAL_MEM_FENCE);
+}
+#else
 __attribute__((reqd_work_group_size(WORKSIZE, 1, 1)))
 __kernel void cn1(__global uint4 *Scratchpad, __global ulong *states, ulong Threads)
 {
@@ -512,12 +773,24 @@ __kernel void cn1(__global uint4 *Scratchpad, __global ulong *states, ulong Thre
 	barrier(CLK_LOCAL_MEM_FENCE);
 
 	uint4 b_x;
+	// Offset of the next read, which cryptonight-heavy makes differ from a
+	ulong idx0;
+#if VARIANT == 2 || VARIANT == 4
+	ulong2 b_x1;
+#endif
+#if VARIANT == 2
+	ulong division_result, sqrt_result;
+#elif VARIANT == 4
+	// The registers of the random math, variant4_random_math is generated
+	// for the block height
+	uint r[9];
+#endif
 
 	// do not use early return here
 	if(gIdx < Threads)
 	{
 		states += 25 * gIdx;
-		Scratchpad += gIdx * (ITERATIONS >> 2);
+		Scratchpad += gIdx * (MEMORY >> 4);
 
 		a[0] = states[0] ^ states[4];
 		b[0] = states[2] ^ states[6];
@@ -525,6 +798,19 @@ __kernel void cn1(__global uint4 *Scratchpad, __global ulong *states, ulong Thre
 		b[1] = states[3] ^ states[7];
 
 		b_x = ((uint4 *)b)[0];
+		idx0 = a[0];
+#if VARIANT == 2 || VARIANT == 4
+		b_x1 = (ulong2)(states[8] ^ states[10], states[9] ^ states[11]);
+#endif
+#if VARIANT == 2
+		division_result = states[12];
+		sqrt_result = states[13];
+#elif VARIANT == 4
+		r[0] = (uint)states[12];
+		r[1] = (uint)(states[12] >> 32);
+		r[2] = (uint)states[13];
+		r[3] = (uint)(states[13] >> 32);
+#endif
 	}
 
 	mem_fence(CLK_LOCAL_MEM_FENCE);
@@ -537,27 +823,91 @@ __kernel void cn1(__global uint4 *Scratchpad, __global ulong *states, ulong Thre
 		{
 			ulong c[2];
 
-			((uint4 *)c)[0] = Scratchpad[IDX((a[0] & MASK) >> 4)];
+			((uint4 *)c)[0] = Scratchpad[IDX((idx0 & MASK) >> 4)];
 			((uint4 *)c)[0] = AES_Round(AES0, AES1, AES2, AES3, ((uint4 *)c)[0], ((uint4 *)a)[0]);
 			//b_x ^= ((uint4 *)c)[0];
 
-			Scratchpad[IDX((a[0] & MASK) >> 4)] = b_x ^ ((uint4 *)c)[0];
+#if VARIANT == 2 || VARIANT == 4
+			const ulong2 a_x = (ulong2)(a[0], a[1]);
+#endif
+#if VARIANT == 2
+			variant2_shuffle(Scratchpad, (idx0 & MASK) >> 4, a_x, as_ulong2(b_x), b_x1);
+#elif VARIANT == 4
+			((uint4 *)c)[0] ^= as_uint4(variant2_shuffle(Scratchpad, (idx0 & MASK) >> 4, a_x, as_ulong2(b_x), b_x1));
+#endif
+			Scratchpad[IDX((idx0 & MASK) >> 4)] = b_x ^ ((uint4 *)c)[0];
 
 			uint4 tmp;
 			tmp = Scratchpad[IDX((c[0] & MASK) >> 4)];
 
+#if VARIANT == 2
+			ulong2 t = as_ulong2(tmp);
+			t.s0 ^= division_result ^ (sqrt_result << 32);
+			const uint divisor = ((uint)c[0] + (uint)(sqrt_result << 1)) | 0x80000001U;
+			division_result = (uint)(c[1] / divisor) + ((c[1] % divisor) << 32);
+			sqrt_result = variant2_sqrt(c[0] + division_result);
+			tmp = as_uint4(t);
+
+			ulong2 product = (ulong2)(mul_hi(c[0], t.s0), c[0] * t.s0);
+			ulong2 chunk1 = as_ulong2(Scratchpad[IDX(((c[0] & MASK) >> 4) ^ 1)]);
+			const ulong2 chunk2 = as_ulong2(Scratchpad[IDX(((c[0] & MASK) >> 4) ^ 2)]);
+			Scratchpad[IDX(((c[0] & MASK) >> 4) ^ 1)] = as_uint4(chunk1 ^ product);
+			product ^= chunk2;
+			variant2_shuffle(Scratchpad, (c[0] & MASK) >> 4, a_x, as_ulong2(b_x), b_x1);
+
+			a[0] += product.s0;
+			a[1] += product.s1;
+#else
+#if VARIANT == 4
+			ulong2 t = as_ulong2(tmp);
+			t.s0 ^= (r[0] + r[1]) | ((ulong)(r[2] + r[3]) << 32);
+			r[4] = (uint)a[0];
+			r[5] = (uint)a[1];
+			r[6] = b_x.s0;
+			r[7] = (uint)b_x1.s0;
+			r[8] = (uint)b_x1.s1;
+			variant4_random_math(r);
+			a[0] ^= r[2] | ((ulong)r[3] << 32);
+			a[1] ^= r[0] | ((ulong)r[1] << 32);
+			tmp = as_uint4(t);
+#endif
 			a[1] += c[0] * as_ulong2(tmp).s0;
 			a[0] += mul_hi(c[0], as_ulong2(tmp).s0);
+#endif
 
 			Scratchpad[IDX((c[0] & MASK) >> 4)] = ((uint4 *)a)[0];
 
 			((uint4 *)a)[0] ^= tmp;
+			idx0 = a[0];
 
+#if VARIANT == 5
+			// Cryptonight-heavy divides the first 8 bytes of the line
+			// that the next iteration reads by the next 4, and mixes the
+			// quotient into them and into the offset
+			{
+				__global long *line = (__global long *)(Scratchpad + IDX((idx0 & MASK) >> 4));
+				const long n = line[0];
+				const int d = ((__global int *)line)[2];
+				const long q = n / (d | 0x5);
+				line[0] = n ^ q;
+				idx0 = d ^ q;
+			}
+#endif
+
+#if VARIANT == 4
+			// c is no longer needed as an index, so it can be mixed with
+			// the chunks now
+			((uint4 *)c)[0] ^= as_uint4(variant2_shuffle(Scratchpad, (c[0] & MASK) >> 4, a_x, as_ulong2(b_x), b_x1));
+#endif
+#if VARIANT == 2 || VARIANT == 4
+			b_x1 = as_ulong2(b_x);
+#endif
 			b_x = ((uint4 *)c)[0];
 		}
 	}
 	mem_fence(CLK_GLOBAL_MEM_FENCE);
 }
+#endif
 
 __attribute__((reqd_work_group_size(WORKSIZE, 8, 1)))
 __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global uint *Branch0, __global uint *Branch1, __global uint *Branch2, __global uint *Branch3, ulong Threads)
@@ -586,7 +936,7 @@ __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global u
 	if(gIdx < Threads)
 	{
 		states += 25 * gIdx;
-		Scratchpad += gIdx * (ITERATIONS >> 2);
+		Scratchpad += gIdx * (MEMORY >> 4);
 
 		#if defined(__Tahiti__) || defined(__Pitcairn__)
 
@@ -605,11 +955,43 @@ __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global u
 
 	barrier(CLK_LOCAL_MEM_FENCE);
 
+#if VARIANT == 5 || VARIANT == 9
+	__local uint4 xin[8][WORKSIZE];
+
+	// Cryptonight-heavy and cryptonight-gpu fold the scratchpad in twice and runs 16 more
+	// rounds, mixing the text after each
+	for(int pass = 0; pass < 2; ++pass)
+	{
+		for(int i = 0; i < (MEMORY >> 7); ++i)
+		{
+			if(gIdx < Threads)
+				text ^= Scratchpad[IDX((i << 3) + get_local_id(1))];
+
+			#pragma unroll
+			for(int j = 0; j < 10; ++j)
+				text = AES_Round(AES0, AES1, AES2, AES3, text, ((uint4 *)ExpandedKey2)[j]);
+
+			text = mix_and_propagate(xin, text);
+		}
+	}
+
+	for(int i = 0; i < 16; ++i)
+	{
+		#pragma unroll
+		for(int j = 0; j < 10; ++j)
+			text = AES_Round(AES0, AES1, AES2, AES3, text, ((uint4 *)ExpandedKey2)[j]);
+
+		text = mix_and_propagate(xin, text);
+	}
+
+	if(gIdx < Threads)
+		vstore2(as_ulong2(text), get_local_id(1) + 4, states);
+#else
 	// do not use early return here
 	if(gIdx < Threads)
 	{
 		#pragma unroll 2
-		for(int i = 0; i < (ITERATIONS >> 5); ++i)
+		for(int i = 0; i < (MEMORY >> 7); ++i)
 		{
 			text ^= Scratchpad[IDX((i << 3) + get_local_id(1))];
 
@@ -620,6 +1002,7 @@ __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global u
 
 		vstore2(as_ulong2(text), get_local_id(1) + 4, states);
 	}
+#endif
 
 	barrier(CLK_GLOBAL_MEM_FENCE);
 
@@ -634,6 +1017,11 @@ __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global u
 
 			for(int i = 0; i < 25; ++i) states[i] = State[i];
 
+#if VARIANT == 9
+			// Cryptonight-gpu has no extra hashes, its hashes are all
+			// checked by the kernel of branch 0
+			Branch0[atomic_inc(Branch0 + Threads)] = get_global_id(0) - get_global_offset(0);
+#else
 			switch(State[0] & 3)
 			{
 				case 0:
@@ -649,6 +1037,7 @@ __kernel void cn2(__global uint4 *Scratchpad, __global ulong *states, __global u
 					Branch3[atomic_inc(Branch3 + Threads)] = get_global_id(0) - get_global_offset(0);
 					break;
 			}
+#endif
 		}
 	}
 	mem_fence(CLK_GLOBAL_MEM_FENCE);
@@ -804,6 +1193,16 @@ __kernel void Blake(__global ulong *states, __global uint *BranchBuf, __global u
 	{
 		states += 25 * BranchBuf[idx];
 
+#if VARIANT == 9
+		// The hash of cryptonight-gpu is the first 32 bytes of the state,
+		// which cn2 queues on this branch
+		if(states[3] <= Target)
+		{
+			ulong outIdx = atomic_inc(output + 0xFF);
+			if(outIdx < 0xFF)
+				output[outIdx] = BranchBuf[idx] + get_global_offset(0);
+		}
+#else
 		unsigned int m[16];
 		unsigned int v[16];
 		uint h[8];
@@ -867,6 +1266,7 @@ __kernel void Blake(__global ulong *states, __global uint *BranchBuf, __global u
 			if(outIdx < 0xFF)
 				output[outIdx] = BranchBuf[idx] + get_global_offset(0);
 		}
+#endif
 	}
 }
 
@@ -1,5 +1,7 @@
 package amdgpu
 
+import "github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+
 const (
 	AEON_MEMORY = uint64(1048576)
 	AEON_MASK   = 0xFFFF0
@@ -8,4 +10,40 @@ const (
 	MONERO_MEMORY = uint64(2097152)
 	MONERO_MASK   = 0x1FFFF0
 	MONERO_ITER   = 0x80000
+	HALF_ITER     = 0x40000
+
+	HEAVY_MEMORY = uint64(4194304)
+	HEAVY_MASK   = 0x3FFFF0
+	HEAVY_ITER   = 0x40000
+
+	// The main loop of cryptonight-pico only addresses the first half of
+	// its scratchpad
+	PICO_MEMORY = uint64(262144)
+	PICO_MASK   = 0x1FFF0
+	PICO_ITER   = 0x10000
+
+	// The main loop of cryptonight-gpu reads 64-byte lines of the
+	// scratchpad of cn/0
+	GPU_MASK = 0x1FFFC0
+	GPU_ITER = 0xC000
 )
+
+// VariantMemory returns the scratchpad size of each thread, the mask of
+// offsets into it and the iterations of the main loop that the kernels are
+// built with for variant
+func VariantMemory(variant int) (memory uint64, mask int, iterations int) {
+	switch variant {
+	case xmrig_crypto.VariantHeavy:
+		return HEAVY_MEMORY, HEAVY_MASK, HEAVY_ITER
+	case xmrig_crypto.VariantLite:
+		return AEON_MEMORY, AEON_MASK, AEON_ITER
+	case xmrig_crypto.VariantPico:
+		return PICO_MEMORY, PICO_MASK, PICO_ITER
+	case xmrig_crypto.VariantHalf:
+		return MONERO_MEMORY, MONERO_MASK, HALF_ITER
+	case xmrig_crypto.VariantGPU:
+		return MONERO_MEMORY, GPU_MASK, GPU_ITER
+	default:
+		return MONERO_MEMORY, MONERO_MASK, MONERO_ITER
+	}
+}
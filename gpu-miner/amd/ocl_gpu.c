@@ -1,5 +1,6 @@
 #include "ocl_gpu.h"
 #include <stdio.h>
+#include <string.h>
 #include <assert.h>
 
 #define OCL_ERR_SUCCESS (0)
@@ -19,7 +20,6 @@ static inline void port_sleep(size_t sec)
 }
 #else
 #include <unistd.h>
-#include <string.h>
 static inline void port_sleep(size_t sec)
 {
     sleep(sec);
@@ -322,9 +322,31 @@ size_t InitOpenCLGpu(int index, void *opencl_ctx_ptr, void *ctx_ptr, const char*
         int hasIterations;
 
 
-        hashMemSize   = MONERO_MEMORY;
-        threadMemMask = MONERO_MASK;
-        hasIterations = MONERO_ITER;
+        if (ctx->Variant == VARIANT_HEAVY) {
+                hashMemSize   = HEAVY_MEMORY;
+                threadMemMask = HEAVY_MASK;
+                hasIterations = HEAVY_ITER;
+        } else if (ctx->Variant == VARIANT_LITE) {
+                hashMemSize   = AEON_MEMORY;
+                threadMemMask = AEON_MASK;
+                hasIterations = AEON_ITER;
+        } else if (ctx->Variant == VARIANT_PICO) {
+                hashMemSize   = PICO_MEMORY;
+                threadMemMask = PICO_MASK;
+                hasIterations = PICO_ITER;
+        } else if (ctx->Variant == VARIANT_HALF) {
+                hashMemSize   = MONERO_MEMORY;
+                threadMemMask = MONERO_MASK;
+                hasIterations = HALF_ITER;
+        } else if (ctx->Variant == VARIANT_GPU) {
+                hashMemSize   = MONERO_MEMORY;
+                threadMemMask = GPU_MASK;
+                hasIterations = GPU_ITER;
+        } else {
+                hashMemSize   = MONERO_MEMORY;
+                threadMemMask = MONERO_MASK;
+                hasIterations = MONERO_ITER;
+        }
 
         size_t g_thd = ctx->RawIntensity;
         ctx->ExtraBuffers[0] = clCreateBuffer(opencl_ctx, CL_MEM_READ_WRITE, hashMemSize * g_thd, NULL, &ret);
@@ -381,7 +403,12 @@ size_t InitOpenCLGpu(int index, void *opencl_ctx_ptr, void *ctx_ptr, const char*
         }
 
         char options[256];
-        snprintf(options, sizeof(options), "-DITERATIONS=%d -DMASK=%d -DWORKSIZE=%lu", hasIterations, threadMemMask, ctx->WorkSize);
+        snprintf(options, sizeof(options), "-DITERATIONS=%d -DMASK=%d -DMEMORY=%lu -DWORKSIZE=%lu -DVARIANT=%d", hasIterations, threadMemMask, hashMemSize, ctx->WorkSize, ctx->Variant);
+        // The float math of cryptonight-gpu needs divisions rounded like
+        // the CPU rounds them
+        if (ctx->Variant == VARIANT_GPU) {
+                strncat(options, " -cl-fp32-correctly-rounded-divide-sqrt", sizeof(options) - strlen(options) - 1);
+        }
         ret = clBuildProgram(ctx->Program, 1, &ctx->DeviceID, options, NULL, NULL);
         if (ret != CL_SUCCESS) {
                 size_t len;
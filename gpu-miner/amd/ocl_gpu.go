@@ -16,6 +16,7 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	amdgpu_cl "github.com/gurupras/go-cryptonight-miner/gpu-miner/amd/cl"
 	"github.com/gurupras/go-cryptonight-miner/gpu-miner/gpucontext"
 	"github.com/gurupras/minerconfig/pcie"
@@ -25,6 +26,11 @@ import (
 
 var (
 	UseC bool = false
+
+	// OpenCL context and program source used by GoInitOpenCL. These are kept
+	// around so that a single GPU can be reinitialized later on.
+	clContext cl.CL_context
+	clCode    [1][]byte
 )
 
 const (
@@ -72,6 +78,17 @@ func getDeviceMaxComputeUnits(id cl.CL_device_id) cl.CL_uint {
 	return info.(cl.CL_uint)
 }
 
+// DeviceMemory returns the global memory of the device of ctx in bytes, or
+// 0 if it can't be queried
+func DeviceMemory(ctx *gpucontext.GPUContext) uint64 {
+	var info interface{}
+	if ret := cl.CLGetDeviceInfo(ctx.DeviceID, cl.CL_DEVICE_GLOBAL_MEM_SIZE, cl.CL_size_t(unsafe.Sizeof(cl.CL_ulong(0))), &info, nil); ret != cl.CL_SUCCESS {
+		return 0
+	}
+	mem, _ := info.(cl.CL_ulong)
+	return uint64(mem)
+}
+
 func getNumPlatforms() cl.CL_uint {
 	var (
 		count cl.CL_uint = 0
@@ -213,6 +230,16 @@ func GoInitOpenCLGPU(index int, clCtx cl.CL_context, ctx *gpucontext.GPUContext,
 	ctx.Name = string(deviceNameBytes)
 	ctx.ComputeUnits = getDeviceMaxComputeUnits(ctx.DeviceID)
 
+	maxWorkSize := clSizeToInt(maxWorkSizeIntf)
+	workSize, err := gpucontext.ClampWorkSize(ctx.WorkSize, maxWorkSize)
+	if err != nil {
+		return fmt.Errorf("GPU #%d %s: %v", ctx.DeviceIndex, ctx.Name, err)
+	}
+	if workSize != ctx.WorkSize {
+		log.Warnf("GPU #%d %s: worksize %d exceeds the device maximum of %d, using %d", ctx.DeviceIndex, ctx.Name, ctx.WorkSize, maxWorkSize, workSize)
+		ctx.WorkSize = workSize
+	}
+
 	log.Infof("#%d, GPU #%d %s, intensity: %d (%d/%v), cu: %d", index, ctx.DeviceIndex, ctx.Name, ctx.RawIntensity, ctx.WorkSize, maxWorkSizeIntf, ctx.ComputeUnits)
 
 	var commandQueueProperties cl.CL_command_queue_properties
@@ -229,10 +256,14 @@ func GoInitOpenCLGPU(index int, clCtx cl.CL_context, ctx *gpucontext.GPUContext,
 		return fmt.Errorf("Error when calling clCreateBuffer: %v", err_to_str(ret))
 	}
 
-	//TODO: handle AEON?
-	hashMemSize := MONERO_MEMORY
-	threadMemMask := MONERO_MASK
-	hasIterations := MONERO_ITER
+	hashMemSize, threadMemMask, hasIterations := VariantMemory(ctx.Variant)
+
+	// Fewer threads fit in the memory of the device with the larger
+	// scratchpads of cryptonight-heavy
+	if max := ctx.MaxIntensity(int(hashMemSize)); ctx.FreeMemory > 0 && max > 0 && ctx.RawIntensity > max {
+		log.Warnf("GPU #%d %s: intensity %d doesn't fit in device memory with %d byte scratchpads, using %d", ctx.DeviceIndex, ctx.Name, ctx.RawIntensity, hashMemSize, max)
+		ctx.RawIntensity = max
+	}
 
 	g_thd := ctx.RawIntensity
 	ctx.ExtraBuffers[0] = cl.CLCreateBuffer(clCtx, cl.CL_MEM_READ_WRITE, cl.CL_size_t(int(hashMemSize)*g_thd), nil, &ret)
@@ -274,12 +305,46 @@ func GoInitOpenCLGPU(index int, clCtx cl.CL_context, ctx *gpucontext.GPUContext,
 		return fmt.Errorf("Error when calling clCreateBuffer for output buffer: %v", err_to_str(ret))
 	}
 
+	bufferSets := ctx.BufferSets
+	if bufferSets < 1 {
+		bufferSets = 1
+	}
+	ctx.OutputBuffers = []cl.CL_mem{ctx.OutputBuffer}
+	for i := 1; i < bufferSets; i++ {
+		buf := cl.CLCreateBuffer(clCtx, cl.CL_MEM_READ_WRITE, cl.CL_size_t(int(unsafe.Sizeof(ret))*0x100), nil, &ret)
+		if ret != cl.CL_SUCCESS {
+			return fmt.Errorf("Error when calling clCreateBuffer for output buffer %d: %v", i, err_to_str(ret))
+		}
+		ctx.OutputBuffers = append(ctx.OutputBuffers, buf)
+	}
+	ctx.ReadEvents = make([]cl.CL_event, bufferSets)
+	if bufferSets > 1 {
+		log.Infof("GPU #%d %s: Pipelining kernel launches over %d buffer sets", ctx.DeviceIndex, ctx.Name, bufferSets)
+	}
+
+	if ctx.PinnedResults {
+		if err := createPinnedResultsBuffer(clCtx, ctx); err != nil {
+			log.Warnf("GPU #%d %s: Failed to allocate pinned memory for results, falling back to regular reads: %v", ctx.DeviceIndex, ctx.Name, err)
+		} else {
+			log.Infof("GPU #%d %s: Reading results through pinned host memory", ctx.DeviceIndex, ctx.Name)
+		}
+	}
+
+	if ctx.Variant == xmrig_crypto.VariantR {
+		log.Infof("GPU #%d %s: Building kernels for the random math of height %d", ctx.DeviceIndex, ctx.Name, ctx.Height)
+		code = [][]byte{append([]byte(RandomMathSource(ctx.Height)), code[0]...)}
+	}
 	ctx.Program = cl.CLCreateProgramWithSource(clCtx, 1, code, []cl.CL_size_t{cl.CL_size_t(len(code[0]))}, &ret)
 	if ret != cl.CL_SUCCESS {
 		return fmt.Errorf("Error when calling clCreateProgramWithSource: %v", err_to_str(ret))
 	}
 
-	options := fmt.Sprintf("-DITERATIONS=%d -DMASK=%d -DWORKSIZE=%d", hasIterations, threadMemMask, ctx.WorkSize)
+	options := fmt.Sprintf("-DITERATIONS=%d -DMASK=%d -DMEMORY=%d -DWORKSIZE=%d -DVARIANT=%d", hasIterations, threadMemMask, hashMemSize, ctx.WorkSize, ctx.Variant)
+	if ctx.Variant == xmrig_crypto.VariantGPU {
+		// The float math of cryptonight-gpu needs divisions rounded like
+		// the CPU rounds them
+		options += " -cl-fp32-correctly-rounded-divide-sqrt"
+	}
 	if ret = cl.CLBuildProgram(ctx.Program, 1, []cl.CL_device_id{ctx.DeviceID}, []byte(options), nil, nil); ret != cl.CL_SUCCESS {
 		log.Errorf("Error when calling clBuildProgram: %v", err_to_str(ret))
 
@@ -316,11 +381,81 @@ func GoInitOpenCLGPU(index int, clCtx cl.CL_context, ctx *gpucontext.GPUContext,
 		if ret != cl.CL_SUCCESS {
 			return fmt.Errorf("Error when calling clCreateKernel for kernel %s: %v", kernelNames[i], err_to_str(ret))
 		}
+
+		// Kernels may support smaller work-groups than the device as a whole
+		var kernelWorkSizeIntf interface{}
+		if ret = cl.CLGetKernelWorkGroupInfo(ctx.Kernels[i], ctx.DeviceID, cl.CL_KERNEL_WORK_GROUP_SIZE, cl.CL_size_t(unsafe.Sizeof(index)), &kernelWorkSizeIntf, nil); ret != cl.CL_SUCCESS {
+			return fmt.Errorf("Error when querying max worksize of kernel %s: %v", kernelNames[i], err_to_str(ret))
+		}
+		if kernelWorkSize := clSizeToInt(kernelWorkSizeIntf); kernelWorkSize > 0 && ctx.WorkSize > kernelWorkSize {
+			return fmt.Errorf("GPU #%d %s: worksize %d exceeds the maximum of %d supported by kernel %s, set worksize to at most %d", ctx.DeviceIndex, ctx.Name, ctx.WorkSize, kernelWorkSize, kernelNames[i], kernelWorkSize)
+		}
 	}
 	ctx.Nonce = 0
 	return nil
 }
 
+// createPinnedResultsBuffer allocates a page-locked host buffer for reading
+// results back from the GPU and keeps it mapped for the lifetime of ctx
+func createPinnedResultsBuffer(clCtx cl.CL_context, ctx *gpucontext.GPUContext) error {
+	var ret cl.CL_int
+	// One block of results for every buffer set
+	size := clIntSize() * 0x100 * cl.CL_size_t(len(ctx.OutputBuffers))
+	buf := cl.CLCreateBuffer(clCtx, cl.CL_MEM_READ_WRITE|cl.CL_MEM_ALLOC_HOST_PTR, size, nil, &ret)
+	if ret != cl.CL_SUCCESS {
+		return fmt.Errorf("Error when calling clCreateBuffer for pinned results buffer: %v", err_to_str(ret))
+	}
+	ptr := cl.CLEnqueueMapBuffer(ctx.CommandQueues, buf, cl.CL_TRUE, cl.CL_MAP_READ|cl.CL_MAP_WRITE, 0, size, 0, nil, nil, &ret)
+	if ret != cl.CL_SUCCESS {
+		cl.CLReleaseMemObject(buf)
+		return fmt.Errorf("Error when calling clEnqueueMapBuffer for pinned results buffer: %v", err_to_str(ret))
+	}
+	ctx.ResultsBuffer = buf
+	ctx.ResultsPtr = ptr
+	return nil
+}
+
+// CheckDevices returns an error, with guidance on fixing it, if the OpenCL
+// platform platformIndex doesn't exist or has no GPU devices. OpenCL runtimes
+// without GPUs, e.g. a CPU-only runtime or one whose GPU driver failed to load,
+// report no devices rather than failing
+func CheckDevices(platformIndex int) error {
+	numPlatforms := getNumPlatforms()
+	if numPlatforms == 0 {
+		return fmt.Errorf("Did not find any OpenCL platforms, check that the GPU drivers and their OpenCL runtime are installed")
+	}
+	if platformIndex < 0 || int(numPlatforms) <= platformIndex {
+		return fmt.Errorf("Selected OpenCL platform index %d doesn't exist, there are %d platforms", platformIndex, numPlatforms)
+	}
+
+	platforms := make([]cl.CL_platform_id, numPlatforms)
+	cl.CLGetPlatformIDs(numPlatforms, platforms, nil)
+
+	var numDevices cl.CL_uint
+	ret := cl.CLGetDeviceIDs(platforms[platformIndex], cl.CL_DEVICE_TYPE_GPU, 0, nil, &numDevices)
+	if ret != cl.CL_SUCCESS && ret != cl.CL_DEVICE_NOT_FOUND {
+		return fmt.Errorf("Error when calling clGetDeviceIDs for number of devices: %v", err_to_str(ret))
+	}
+	if ret == cl.CL_DEVICE_NOT_FOUND || numDevices == 0 {
+		return noDevicesError(platforms, platformIndex)
+	}
+	return nil
+}
+
+// noDevicesError returns the error for a platform without GPU devices. It
+// lists the platforms so that the one with the GPUs can be selected
+func noDevicesError(platforms []cl.CL_platform_id, platformIndex int) error {
+	names := make([]string, 0, len(platforms))
+	for i := range platforms {
+		var vendor interface{}
+		if cl.CLGetPlatformInfo(platforms[i], cl.CL_PLATFORM_VENDOR, 256, &vendor, nil) != cl.CL_SUCCESS {
+			vendor = "unknown"
+		}
+		names = append(names, fmt.Sprintf("#%d: %v", i, vendor))
+	}
+	return fmt.Errorf("No compatible GPU devices on OpenCL platform #%d. Check that the GPU drivers are installed and loaded, or set opencl-platform to the platform of the GPUs (%v)", platformIndex, strings.Join(names, ", "))
+}
+
 func getAMDPlatformIndex() int {
 	numPlatforms := getNumPlatforms()
 	if numPlatforms == 0 {
@@ -367,6 +502,9 @@ func getCode() string {
 	return code
 }
 func InitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformIndex int) error {
+	if numGPUs == 0 || len(gpuContexts) < numGPUs {
+		return fmt.Errorf("No GPU threads to initialize, %d contexts for %d GPUs", len(gpuContexts), numGPUs)
+	}
 	if UseC {
 		return CInitOpenCL(gpuContexts, numGPUs, platformIndex)
 	} else {
@@ -375,6 +513,18 @@ func InitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformIndex
 }
 
 func CInitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformIndex int) error {
+	// The C code only reports failures as a return code, so check for the
+	// devices first to give a useful error
+	if err := CheckDevices(platformIndex); err != nil {
+		return err
+	}
+	// The kernels of cn/r are rebuilt for every block height, which
+	// requires reinitializing the GPU
+	for _, ctx := range gpuContexts[:numGPUs] {
+		if ctx.Variant == xmrig_crypto.VariantR {
+			return fmt.Errorf("cn/r is not supported when initializing OpenCL with C")
+		}
+	}
 	cContexts := make([]uint64, len(gpuContexts))
 
 	code := getCode()
@@ -421,7 +571,11 @@ func GoInitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformInd
 	cl.CLGetPlatformIDs(numPlatforms, platformIdList, nil)
 
 	var numDevices cl.CL_uint
-	if ret := cl.CLGetDeviceIDs(platformIdList[platformIndex], cl.CL_DEVICE_TYPE_GPU, 0, nil, &numDevices); ret != cl.CL_SUCCESS {
+	ret := cl.CLGetDeviceIDs(platformIdList[platformIndex], cl.CL_DEVICE_TYPE_GPU, 0, nil, &numDevices)
+	if ret == cl.CL_DEVICE_NOT_FOUND || (ret == cl.CL_SUCCESS && numDevices == 0) {
+		return noDevicesError(platformIdList, platformIndex)
+	}
+	if ret != cl.CL_SUCCESS {
 		return fmt.Errorf("Error when calling clGetDeviceIDs for number of devices: %v", err_to_str(ret))
 	}
 
@@ -444,7 +598,6 @@ func GoInitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformInd
 		tempDeviceList[i] = deviceIdList[gpuContexts[i].DeviceIndex]
 	}
 
-	var ret cl.CL_int
 	clCtx := cl.CLCreateContext(nil, cl.CL_uint(numGPUs), tempDeviceList, nil, nil, &ret)
 	if ret != cl.CL_SUCCESS {
 		return fmt.Errorf("Error when calling clCreateContext: %v", err_to_str(ret))
@@ -454,6 +607,9 @@ func GoInitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformInd
 
 	var codeBytes [1][]byte
 	codeBytes[0] = []byte(code)
+
+	clContext = clCtx
+	clCode = codeBytes
 	//wg := sync.WaitGroup{}
 	//failed := false
 	for i := 0; i < numGPUs; i++ {
@@ -474,6 +630,73 @@ func GoInitOpenCL(gpuContexts []*gpucontext.GPUContext, numGPUs int, platformInd
 	return nil
 }
 
+// ReleaseOpenCLGPU releases all the OpenCL objects that were created for ctx
+// by GoInitOpenCLGPU
+func ReleaseOpenCLGPU(ctx *gpucontext.GPUContext) {
+	for i := 0; i < len(ctx.Kernels); i++ {
+		if ctx.Kernels[i] != nil {
+			cl.CLReleaseKernel(ctx.Kernels[i])
+			ctx.Kernels[i] = nil
+		}
+	}
+	if ctx.Program != nil {
+		cl.CLReleaseProgram(ctx.Program)
+		ctx.Program = nil
+	}
+	for i := 0; i < len(ctx.ExtraBuffers); i++ {
+		if ctx.ExtraBuffers[i] != nil {
+			cl.CLReleaseMemObject(ctx.ExtraBuffers[i])
+			ctx.ExtraBuffers[i] = nil
+		}
+	}
+	if ctx.InputBuffer != nil {
+		cl.CLReleaseMemObject(ctx.InputBuffer)
+		ctx.InputBuffer = nil
+	}
+	if ctx.OutputBuffer != nil {
+		cl.CLReleaseMemObject(ctx.OutputBuffer)
+		ctx.OutputBuffer = nil
+	}
+	// The first output buffer is OutputBuffer
+	for i := 1; i < len(ctx.OutputBuffers); i++ {
+		cl.CLReleaseMemObject(ctx.OutputBuffers[i])
+	}
+	ctx.OutputBuffers = nil
+	for _, event := range ctx.ReadEvents {
+		if event != nil {
+			cl.CLReleaseEvent(event)
+		}
+	}
+	ctx.ReadEvents = nil
+	if ctx.ResultsBuffer != nil {
+		if ctx.ResultsPtr != nil && ctx.CommandQueues != nil {
+			cl.CLEnqueueUnmapMemObject(ctx.CommandQueues, ctx.ResultsBuffer, ctx.ResultsPtr, 0, nil, nil)
+		}
+		cl.CLReleaseMemObject(ctx.ResultsBuffer)
+		ctx.ResultsBuffer = nil
+		ctx.ResultsPtr = nil
+	}
+	if ctx.CommandQueues != nil {
+		cl.CLFinish(ctx.CommandQueues)
+		cl.CLReleaseCommandQueue(ctx.CommandQueues)
+		ctx.CommandQueues = nil
+	}
+}
+
+// ReinitOpenCLGPU tears down and re-creates the OpenCL objects of a single GPU
+// using the context that was set up by InitOpenCL. The caller is expected to
+// call SetWork again before running any more work on ctx.
+func ReinitOpenCLGPU(ctx *gpucontext.GPUContext) error {
+	if UseC {
+		return fmt.Errorf("Reinitializing a GPU is not supported with C OpenCL functions")
+	}
+	if clContext == nil {
+		return fmt.Errorf("OpenCL has not been initialized")
+	}
+	ReleaseOpenCLGPU(ctx)
+	return GoInitOpenCLGPU(ctx.DeviceIndex, clContext, ctx, clCode[:])
+}
+
 func SetWork(ctx *gpucontext.GPUContext, input []byte, workSize int, target uint64) error {
 	if UseC {
 		return CSetWork(ctx, input, workSize, target)
@@ -577,6 +800,24 @@ func GoSetWork(ctx *gpucontext.GPUContext, input []byte, workSize int, target ui
 	return nil
 }
 
+// clSizeToInt converts a size_t returned by an OpenCL info query to an int.
+// It returns 0 if the value has an unexpected type
+func clSizeToInt(v interface{}) int {
+	switch n := v.(type) {
+	case cl.CL_size_t:
+		return int(n)
+	case cl.CL_uint:
+		return int(n)
+	case cl.CL_ulong:
+		return int(n)
+	case int:
+		return n
+	case uint64:
+		return int(n)
+	}
+	return 0
+}
+
 func clSizeWrap(v uintptr) cl.CL_size_t {
 	return cl.CL_size_t(v)
 }
@@ -618,18 +859,100 @@ func CRunWork(ctx *gpucontext.GPUContext, hashResults []cl.CL_int) error {
 	return nil
 }
 
+// EnqueueWork launches the kernels for the next ctx.Threads nonces and
+// enqueues a non-blocking read of their results into hashResults, using the
+// output buffer of the given buffer set. WaitWork must be called before the
+// results are used. With C OpenCL functions the work is run synchronously
+func EnqueueWork(ctx *gpucontext.GPUContext, set int, hashResults []cl.CL_int) error {
+	if UseC {
+		return CRunWork(ctx, hashResults)
+	}
+	return goEnqueueWork(ctx, set, hashResults)
+}
+
+// WaitWork waits for the results of the work enqueued on the given buffer
+// set to be read into hashResults
+func WaitWork(ctx *gpucontext.GPUContext, set int, hashResults []cl.CL_int) error {
+	if UseC {
+		return nil
+	}
+	event := ctx.ReadEvents[set]
+	if event == nil {
+		return fmt.Errorf("No work was enqueued on buffer set %d", set)
+	}
+	ret := waitForEvent(ctx, event)
+	cl.CLReleaseEvent(event)
+	ctx.ReadEvents[set] = nil
+	if ret != cl.CL_SUCCESS {
+		return fmt.Errorf("Error when waiting for results: %v", err_to_str(ret))
+	}
+	if ctx.ResultsPtr != nil {
+		copy(hashResults, (*[0x100]cl.CL_int)(pinnedResults(ctx, set))[:])
+	}
+	return nil
+}
+
+// waitForEvent waits for the command that event belongs to to complete. With
+// a poll interval set, the status of the command is checked every interval
+// instead of blocking in clWaitForEvents, which keeps a CPU core busy with
+// some drivers
+func waitForEvent(ctx *gpucontext.GPUContext, event cl.CL_event) cl.CL_int {
+	if ctx.PollInterval <= 0 {
+		return cl.CLWaitForEvents(1, []cl.CL_event{event})
+	}
+	// Make sure the commands are submitted, or we would wait forever
+	cl.CLFlush(ctx.CommandQueues)
+	for {
+		var statusIface interface{}
+		if ret := cl.CLGetEventInfo(event, cl.CL_EVENT_COMMAND_EXECUTION_STATUS, cl.CL_size_t(unsafe.Sizeof(cl.CL_int(0))), &statusIface, nil); ret != cl.CL_SUCCESS {
+			return ret
+		}
+		status, ok := statusIface.(cl.CL_int)
+		if !ok {
+			return cl.CLWaitForEvents(1, []cl.CL_event{event})
+		}
+		if status == cl.CL_COMPLETE {
+			return cl.CL_SUCCESS
+		}
+		if status < 0 {
+			// The command was terminated with this error
+			return status
+		}
+		time.Sleep(ctx.PollInterval)
+	}
+}
+
+// pinnedResults returns the pinned host memory that the results of a buffer
+// set are read into
+func pinnedResults(ctx *gpucontext.GPUContext, set int) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(ctx.ResultsPtr) + uintptr(set)*uintptr(clIntSize())*0x100)
+}
+
 func GoRunWork(ctx *gpucontext.GPUContext, hashResults []cl.CL_int) error {
+	if err := goEnqueueWork(ctx, 0, hashResults); err != nil {
+		return err
+	}
+	return WaitWork(ctx, 0, hashResults)
+}
+
+func goEnqueueWork(ctx *gpucontext.GPUContext, set int, hashResults []cl.CL_int) error {
 	var (
 		ret  cl.CL_int
 		zero cl.CL_uint = 0
 	)
 	branchNonces := make([]cl.CL_size_t, 4)
 
+	// The buffers are sized for RawIntensity threads and so the branch
+	// counters always live at that offset, even if we launch fewer threads
 	gIntensity := ctx.RawIntensity
+	launchSize := ctx.Threads
+	if launchSize <= 0 || launchSize > gIntensity {
+		launchSize = ctx.LaunchSize()
+	}
 	workSize := ctx.WorkSize
 
 	// Round up to next multiple of workSize
-	g_thd := ((gIntensity + workSize - 1) / workSize) * workSize
+	g_thd := ((launchSize + workSize - 1) / workSize) * workSize
 
 	// number of global threads must be a multiple of the work group size (workSize)
 	if g_thd%workSize != 0 {
@@ -642,7 +965,8 @@ func GoRunWork(ctx *gpucontext.GPUContext, hashResults []cl.CL_int) error {
 		}
 	}
 
-	if ret = cl.CLEnqueueWriteBuffer(ctx.CommandQueues, ctx.OutputBuffer, cl.CL_FALSE, clIntSize()*0xFF, clIntSize(), unsafe.Pointer(&zero), 0, nil, nil); ret != cl.CL_SUCCESS {
+	outputBuffer := ctx.OutputBuffers[set]
+	if ret = cl.CLEnqueueWriteBuffer(ctx.CommandQueues, outputBuffer, cl.CL_FALSE, clIntSize()*0xFF, clIntSize(), unsafe.Pointer(&zero), 0, nil, nil); ret != cl.CL_SUCCESS {
 		return fmt.Errorf("Error when calling clEnqueueWriteBuffer to fetch results", err_to_str(ret))
 	}
 
@@ -679,14 +1003,25 @@ func GoRunWork(ctx *gpucontext.GPUContext, hashResults []cl.CL_int) error {
 		return fmt.Errorf("Error when calling clEnqueueReadBuffer to fetch results: %v", err_to_str(ret))
 	}
 
-	if ret = cl.CLEnqueueReadBuffer(ctx.CommandQueues, ctx.ExtraBuffers[5], cl.CL_FALSE, clIntSize()*cl.CL_size_t(gIntensity), clIntSize(), unsafe.Pointer(&branchNonces[3]), 0, nil, nil); ret != cl.CL_SUCCESS {
+	var branchEvent cl.CL_event
+	if ret = cl.CLEnqueueReadBuffer(ctx.CommandQueues, ctx.ExtraBuffers[5], cl.CL_FALSE, clIntSize()*cl.CL_size_t(gIntensity), clIntSize(), unsafe.Pointer(&branchNonces[3]), 0, nil, &branchEvent); ret != cl.CL_SUCCESS {
 		return fmt.Errorf("Error when calling clEnqueueReadBuffer to fetch results: %v", err_to_str(ret))
 	}
 
-	cl.CLFinish(ctx.CommandQueues)
+	// The queue is in order, so this waits for the kernels as well
+	ret = waitForEvent(ctx, branchEvent)
+	cl.CLReleaseEvent(branchEvent)
+	if ret != cl.CL_SUCCESS {
+		return fmt.Errorf("Error when waiting for branch counters: %v", err_to_str(ret))
+	}
 
 	for i := 0; i < 4; i++ {
 		if branchNonces[0] != 0 {
+			// Output
+			if ret = cl.CLSetKernelArg(ctx.Kernels[i+3], 2, clMemSize(), unsafe.Pointer(&outputBuffer)); ret != cl.CL_SUCCESS {
+				return fmt.Errorf(setKernelArgError, err_to_str(ret), i+3, 2)
+			}
+
 			// Threads
 			if ret = cl.CLSetKernelArg(ctx.Kernels[i+3], 4, clLongSize(), unsafe.Pointer(&branchNonces[i])); ret != cl.CL_SUCCESS {
 				return fmt.Errorf(setKernelArgError, err_to_str(ret), i+3, 4)
@@ -706,18 +1041,19 @@ func GoRunWork(ctx *gpucontext.GPUContext, hashResults []cl.CL_int) error {
 		}
 	}
 
-	if ret = cl.CLEnqueueReadBuffer(ctx.CommandQueues, ctx.OutputBuffer, cl.CL_TRUE, 0, clIntSize()*0x100, unsafe.Pointer(&hashResults[0]), 0, nil, nil); ret != cl.CL_SUCCESS {
-		return fmt.Errorf("Error when calling clEnqueueReadBuffer to fetch results: %v", err_to_str(ret))
+	resultsPtr := unsafe.Pointer(&hashResults[0])
+	if ctx.ResultsPtr != nil {
+		// Reading into pinned memory avoids a staging copy in the driver
+		resultsPtr = pinnedResults(ctx, set)
 	}
-
-	cl.CLFinish(ctx.CommandQueues)
-	numHashValues := hashResults[0xFF]
-	// Avoid out of memory read, we only have storage for 0xFF reads
-	if numHashValues > 0xFF {
-		numHashValues = 0xFF
+	var event cl.CL_event
+	if ret = cl.CLEnqueueReadBuffer(ctx.CommandQueues, outputBuffer, cl.CL_FALSE, 0, clIntSize()*0x100, resultsPtr, 0, nil, &event); ret != cl.CL_SUCCESS {
+		return fmt.Errorf("Error when calling clEnqueueReadBuffer to fetch results: %v", err_to_str(ret))
 	}
+	ctx.ReadEvents[set] = event
+	cl.CLFlush(ctx.CommandQueues)
 
-	ctx.Nonce += uint32(gIntensity)
+	ctx.Nonce += uint32(launchSize)
 	return nil
 }
 
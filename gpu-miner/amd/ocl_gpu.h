@@ -8,9 +8,33 @@
 #include "CL/cl_ext.h"
 #endif
 
+#define AEON_MEMORY   1048576
+#define AEON_MASK     0xFFFF0
+#define AEON_ITER     0x40000
+
 #define MONERO_MEMORY 2097152
 #define MONERO_MASK   0x1FFFF0
 #define MONERO_ITER   0x80000
+#define HALF_ITER     0x40000
+
+#define HEAVY_MEMORY  4194304
+#define HEAVY_MASK    0x3FFFF0
+#define HEAVY_ITER    0x40000
+
+#define PICO_MEMORY   262144
+#define PICO_MASK     0x1FFF0
+#define PICO_ITER     0x10000
+
+#define GPU_MASK      0x1FFFC0
+#define GPU_ITER      0xC000
+/* The variants of cryptonight-heavy, cryptonight-lite, cryptonight-pico,
+ * cryptonight-half and cryptonight-gpu, xmrig_crypto.VariantHeavy,
+ * VariantLite, VariantPico, VariantHalf and VariantGPU */
+#define VARIANT_HEAVY 5
+#define VARIANT_LITE  6
+#define VARIANT_PICO  7
+#define VARIANT_HALF  8
+#define VARIANT_GPU   9
 
 enum LOG_TYPE {
   TYPE_DEBUG = 0,
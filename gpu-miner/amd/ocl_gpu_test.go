@@ -3,6 +3,7 @@ package amdgpu
 import (
 	"testing"
 
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
 	"github.com/gurupras/go-cryptonight-miner/gpu-miner/gpucontext"
 	"github.com/stretchr/testify/require"
 )
@@ -62,3 +63,47 @@ func TestPrintPlatforms(t *testing.T) {
 	t.Skip("Too primitive")
 	printPlatforms()
 }
+
+func TestRandomMathSource(t *testing.T) {
+	require := require.New(t)
+
+	source := RandomMathSource(1806260)
+	require.Contains(source, "inline void variant4_random_math(uint *r)")
+	require.Contains(source, "// Random math of height 1806260")
+	require.NotEqual(source, RandomMathSource(1806261))
+}
+
+func TestVariantMemory(t *testing.T) {
+	require := require.New(t)
+
+	memory, mask, iterations := VariantMemory(xmrig_crypto.VariantR)
+	require.Equal(MONERO_MEMORY, memory)
+	require.Equal(MONERO_MASK, mask)
+	require.Equal(MONERO_ITER, iterations)
+
+	memory, mask, iterations = VariantMemory(xmrig_crypto.VariantHeavy)
+	require.Equal(uint64(xmrig_crypto.MemoryHeavy), memory)
+	require.Equal(int(memory)-16, mask)
+	require.Equal(HEAVY_ITER, iterations)
+
+	memory, mask, iterations = VariantMemory(xmrig_crypto.VariantLite)
+	require.Equal(uint64(xmrig_crypto.MemoryLite), memory)
+	require.Equal(int(memory)-16, mask)
+	require.Equal(AEON_ITER, iterations)
+
+	memory, mask, iterations = VariantMemory(xmrig_crypto.VariantPico)
+	require.Equal(uint64(xmrig_crypto.MemoryPico), memory)
+	require.Equal(int(memory)/2-16, mask)
+	require.Equal(PICO_ITER, iterations)
+
+	memory, mask, iterations = VariantMemory(xmrig_crypto.VariantHalf)
+	require.Equal(MONERO_MEMORY, memory)
+	require.Equal(MONERO_MASK, mask)
+	require.Equal(MONERO_ITER/2, iterations)
+
+	// The main loop of cryptonight-gpu reads 64-byte lines
+	memory, mask, iterations = VariantMemory(xmrig_crypto.VariantGPU)
+	require.Equal(MONERO_MEMORY, memory)
+	require.Equal(int(memory)-64, mask)
+	require.Equal(GPU_ITER, iterations)
+}
@@ -0,0 +1,38 @@
+package amdgpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+)
+
+// RandomMathSource returns the OpenCL source of variant4_random_math, the
+// random math of cryptonight-r for a block height. The program is compiled
+// into the kernels, so they have to be rebuilt for every height
+func RandomMathSource(height uint64) string {
+	code := xmrig_crypto.RandomMath(height)
+	lines := make([]string, 0, len(code)+4)
+	lines = append(lines, fmt.Sprintf("// Random math of height %d", height))
+	lines = append(lines, "inline void variant4_random_math(uint *r)", "{")
+	for _, op := range code {
+		dst := fmt.Sprintf("r[%d]", op.Dst)
+		src := fmt.Sprintf("r[%d]", op.Src)
+		switch op.Opcode {
+		case xmrig_crypto.V4Mul:
+			lines = append(lines, fmt.Sprintf("\t%s *= %s;", dst, src))
+		case xmrig_crypto.V4Add:
+			lines = append(lines, fmt.Sprintf("\t%s += %s + 0x%08xU;", dst, src, op.C))
+		case xmrig_crypto.V4Sub:
+			lines = append(lines, fmt.Sprintf("\t%s -= %s;", dst, src))
+		case xmrig_crypto.V4Ror:
+			lines = append(lines, fmt.Sprintf("\t%s = rotate(%s, 32U - (%s & 31U));", dst, dst, src))
+		case xmrig_crypto.V4Rol:
+			lines = append(lines, fmt.Sprintf("\t%s = rotate(%s, %s & 31U);", dst, dst, src))
+		case xmrig_crypto.V4Xor:
+			lines = append(lines, fmt.Sprintf("\t%s ^= %s;", dst, src))
+		}
+	}
+	lines = append(lines, "}", "")
+	return strings.Join(lines, "\n")
+}
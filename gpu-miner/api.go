@@ -0,0 +1,73 @@
+package gpuminer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gurupras/go-cryptonight-miner/miner"
+)
+
+// GPUStatus describes the settings of a GPU thread
+type GPUStatus struct {
+	Miner        uint32 `json:"miner"`
+	Device       int    `json:"device"`
+	Name         string `json:"name"`
+	Intensity    int    `json:"intensity"`
+	MaxIntensity int    `json:"max_intensity"`
+	WorkSize     int    `json:"worksize"`
+	// Results waiting to be checked on the CPU
+	PendingResults int `json:"pending_results"`
+}
+
+// Status returns the settings of this GPU thread
+func (m *GPUMiner) Status() GPUStatus {
+	return GPUStatus{
+		m.Id(),
+		m.Context.DeviceIndex,
+		m.Context.Name,
+		m.Intensity,
+		m.Context.MaxIntensity(m.scratchpad()),
+		m.WorkSize,
+		m.PendingResults(),
+	}
+}
+
+// intensityRequest is the body of a POST /intensity request
+type intensityRequest struct {
+	Miner     uint32 `json:"miner"`
+	Intensity int    `json:"intensity"`
+}
+
+// RegisterAPI adds the GPU endpoints to api:
+//
+//	GET  /gpus       the GPUStatus of every GPU thread
+//	POST /intensity  change the intensity of a GPU thread, given as
+//	                 {"miner": 0, "intensity": 1024}
+func RegisterAPI(api *miner.APIServer, miners []*GPUMiner) {
+	api.Handle("/gpus", http.MethodGet, func(r *http.Request) (interface{}, error) {
+		statuses := make([]GPUStatus, 0, len(miners))
+		for _, m := range miners {
+			statuses = append(statuses, m.Status())
+		}
+		return statuses, nil
+	})
+	api.Handle("/intensity", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		var request intensityRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return nil, fmt.Errorf("Invalid request: %v", err)
+		}
+		for _, m := range miners {
+			if m.Id() != request.Miner {
+				continue
+			}
+			if err := m.SetIntensity(request.Intensity); err != nil {
+				return nil, err
+			}
+			status := m.Status()
+			status.Intensity = request.Intensity
+			return status, nil
+		}
+		return nil, fmt.Errorf("No GPU miner %d", request.Miner)
+	})
+}
@@ -6,6 +6,8 @@ package gpucontext
 import "C"
 
 import (
+	"fmt"
+	"time"
 	"unsafe"
 
 	"github.com/rainliu/gocl/cl"
@@ -26,7 +28,99 @@ type GPUContext struct {
 	ComputeUnits  cl.CL_uint
 	Name          string
 	Nonce         uint32
-	cStruct       *C.struct_gpu_context
+	// BatchSize limits the number of threads launched per kernel run.
+	// 0 launches RawIntensity threads at once
+	BatchSize int
+	// Threads is the number of threads launched by the next kernel run.
+	// 0 launches LaunchSize() threads
+	Threads int
+	// PinnedResults reads results back through page-locked host memory.
+	// ResultsBuffer and ResultsPtr are the pinned buffer and its mapping
+	PinnedResults bool
+	ResultsBuffer cl.CL_mem `cl_mem`
+	ResultsPtr    unsafe.Pointer
+	// BufferSets is the number of output buffers that kernel launches
+	// alternate between, so that a launch can be enqueued before the
+	// results of the previous one are processed. OutputBuffers[0] is
+	// OutputBuffer and ReadEvents signal when results have been read back
+	BufferSets    int
+	OutputBuffers []cl.CL_mem `cl_mem`
+	ReadEvents    []cl.CL_event
+	// PollInterval makes waits for the GPU sleep this long between checks
+	// of the command status instead of blocking in clWaitForEvents, which
+	// some drivers implement as a busy-wait. 0 blocks
+	PollInterval time.Duration
+	// Variant of cryptonight that the kernels are built for. It takes
+	// effect when OpenCL is initialized for the GPU
+	Variant int
+	// Height is the block height whose random math the kernels are built
+	// for with cryptonight-r
+	Height  uint64
+	cStruct *C.struct_gpu_context
+}
+
+// LaunchSize returns the number of nonces processed by a single kernel run
+func (ctx *GPUContext) LaunchSize() int {
+	if ctx.BatchSize > 0 && ctx.BatchSize < ctx.RawIntensity {
+		return ctx.BatchSize
+	}
+	return ctx.RawIntensity
+}
+
+const (
+	// threadStateSize is the memory used by each GPU thread besides its
+	// scratchpad: the hash state and the branch buffers
+	threadStateSize = 100 + 4*4
+	// reservedMemory is left free on the device for the driver and display
+	reservedMemory = 128 * 1024 * 1024
+)
+
+// MaxIntensity returns the largest intensity, rounded down to a multiple of
+// the worksize, whose buffers fit in the memory of the device when each
+// thread needs a scratchpad of the given size
+func (ctx *GPUContext) MaxIntensity(scratchpad int) int {
+	free := int64(ctx.FreeMemory) - reservedMemory
+	if free <= 0 {
+		return 0
+	}
+	max := int(free / int64(scratchpad+threadStateSize))
+	if ctx.WorkSize > 0 {
+		max -= max % ctx.WorkSize
+	}
+	return max
+}
+
+// ValidateIntensity returns an error if intensity is not a positive multiple
+// of the worksize or doesn't fit in the memory of the device
+func (ctx *GPUContext) ValidateIntensity(intensity int, scratchpad int) error {
+	if intensity <= 0 {
+		return fmt.Errorf("Invalid intensity %d", intensity)
+	}
+	if ctx.WorkSize > 0 && intensity%ctx.WorkSize != 0 {
+		return fmt.Errorf("Intensity %d is not a multiple of the worksize %d", intensity, ctx.WorkSize)
+	}
+	if max := ctx.MaxIntensity(scratchpad); intensity > max {
+		return fmt.Errorf("Intensity %d exceeds the maximum of %d for GPU #%d", intensity, max, ctx.DeviceIndex)
+	}
+	return nil
+}
+
+// ClampWorkSize checks workSize against the maximum work-group size of a
+// device or kernel. A worksize that is too large is rounded down to the
+// largest power of two the device supports. A maxWorkSize of 0 means that
+// the limit is unknown
+func ClampWorkSize(workSize, maxWorkSize int) (int, error) {
+	if workSize <= 0 {
+		return 0, fmt.Errorf("Invalid worksize %d, must be between 1 and %d", workSize, maxWorkSize)
+	}
+	if maxWorkSize <= 0 || workSize <= maxWorkSize {
+		return workSize, nil
+	}
+	ret := 1
+	for ret*2 <= maxWorkSize {
+		ret *= 2
+	}
+	return ret, nil
 }
 
 func (ctx *GPUContext) AsCStruct() *C.struct_gpu_context {
@@ -49,6 +143,7 @@ func (ctx *GPUContext) AsCStruct() *C.struct_gpu_context {
 		ret.FreeMemory = *(*C.cl_ulong)(unsafe.Pointer(&ctx.FreeMemory))
 		ret.ComputeUnits = *(*C.cl_uint)(unsafe.Pointer(&ctx.ComputeUnits))
 		ret.Name = C.CString(ctx.Name)
+		ret.Variant = C.int(ctx.Variant)
 		ctx.cStruct = ret
 	}
 	// Nonce may change
@@ -22,6 +22,7 @@ struct gpu_context {
   cl_uint ComputeUnits;
   char *Name;
   unsigned int Nonce;
+  int Variant;
 };
 
 #endif
@@ -3,6 +3,7 @@ package gpucontext
 import (
 	"testing"
 
+	"github.com/rainliu/gocl/cl"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,3 +17,51 @@ func TestAsCStruct(t *testing.T) {
 	err := testCContext(ctx)
 	require.Nil(err)
 }
+
+func TestClampWorkSize(t *testing.T) {
+	require := require.New(t)
+
+	workSize, err := ClampWorkSize(8, 256)
+	require.Nil(err)
+	require.Equal(8, workSize)
+
+	workSize, err = ClampWorkSize(256, 256)
+	require.Nil(err)
+	require.Equal(256, workSize)
+
+	workSize, err = ClampWorkSize(512, 256)
+	require.Nil(err)
+	require.Equal(256, workSize)
+
+	// Not every device reports a power of two
+	workSize, err = ClampWorkSize(256, 192)
+	require.Nil(err)
+	require.Equal(128, workSize)
+
+	// Unknown limit
+	workSize, err = ClampWorkSize(1024, 0)
+	require.Nil(err)
+	require.Equal(1024, workSize)
+
+	_, err = ClampWorkSize(0, 256)
+	require.NotNil(err)
+	require.Contains(err.Error(), "256")
+}
+
+func TestValidateIntensity(t *testing.T) {
+	require := require.New(t)
+
+	scratchpad := 2 * 1024 * 1024
+	ctx := New(0, 1024, 8)
+	ctx.FreeMemory = cl.CL_ulong(reservedMemory + 1000*(scratchpad+threadStateSize))
+	require.Equal(1000, ctx.MaxIntensity(scratchpad))
+
+	require.Nil(ctx.ValidateIntensity(1000, scratchpad))
+	require.Nil(ctx.ValidateIntensity(8, scratchpad))
+	require.NotNil(ctx.ValidateIntensity(1008, scratchpad))
+	require.NotNil(ctx.ValidateIntensity(996, scratchpad))
+	require.NotNil(ctx.ValidateIntensity(0, scratchpad))
+
+	ctx.FreeMemory = 1024
+	require.Equal(0, ctx.MaxIntensity(scratchpad))
+}
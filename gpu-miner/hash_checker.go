@@ -1,42 +1,184 @@
 package gpuminer
 
 import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/gurupras/go-cryptonight-miner/cpu-miner/xmrig_crypto"
+	"github.com/gurupras/go-cryptonight-miner/miner"
 	stratum "github.com/gurupras/go-stratum-client"
 	log "github.com/sirupsen/logrus"
 )
 
 type HashResult struct {
 	id uint32
-	*stratum.StratumContext
+	miner.WorkSubmitter
 	*xmrig_crypto.XMRigWork
+	miner *GPUMiner
+}
+
+// ComputeErrorStats tracks the compute errors reported for a single GPU
+type ComputeErrorStats struct {
+	Consecutive uint32
+	Total       uint64
+	Recoveries  uint32
 }
 
 var (
 	HashCheckChan chan *HashResult = make(chan *HashResult, 256)
+
+	// ComputeErrorLimit is the number of consecutive compute errors after
+	// which a GPU is recovered. A value of 0 disables recovery.
+	ComputeErrorLimit = 0
+
+	computeErrorsLock sync.Mutex
+	computeErrors     = make(map[uint32]*ComputeErrorStats)
+
+	// MaxPendingResults is the number of results waiting to be checked
+	// above which GPUs stop launching kernels until the hash checker has
+	// caught up. A value of 0 or less disables throttling
+	MaxPendingResults = 0
+
+	// pendingResults is the number of results submitted by the GPUs that
+	// have not been checked yet
+	pendingResults int32
+
+	// throttlePollInterval is how often a throttled GPU checks whether the
+	// hash checker has caught up
+	throttlePollInterval = 10 * time.Millisecond
 )
 
-func RunHashChecker() {
-	globalMem, err := xmrig_crypto.SetupHugePages(1)
-	if err != nil {
-		log.Fatalf("Failed to initialize hugepages: %v", err)
+func init() {
+	miner.OnStatsReset(func() {
+		computeErrorsLock.Lock()
+		defer computeErrorsLock.Unlock()
+		computeErrors = make(map[uint32]*ComputeErrorStats)
+	})
+}
+
+// ComputeErrors returns a snapshot of the compute error stats of all GPUs
+// that have submitted results so far, keyed by miner id
+func ComputeErrors() map[uint32]ComputeErrorStats {
+	computeErrorsLock.Lock()
+	defer computeErrorsLock.Unlock()
+	ret := make(map[uint32]ComputeErrorStats, len(computeErrors))
+	for id, stats := range computeErrors {
+		ret[id] = *stats
 	}
-	ctx, err := xmrig_crypto.SetupCryptonightContext(globalMem, 0)
-	if err != nil {
-		log.Fatalf("Failed to intialize context: %v", err)
+	return ret
+}
+
+func getComputeErrorStats(id uint32) *ComputeErrorStats {
+	stats, ok := computeErrors[id]
+	if !ok {
+		stats = &ComputeErrorStats{}
+		computeErrors[id] = stats
 	}
+	return stats
+}
+
+// recordComputeResult updates the compute error stats of the GPU with the
+// given id and returns true if the GPU needs to be recovered
+func recordComputeResult(id uint32, computeError bool) bool {
+	computeErrorsLock.Lock()
+	defer computeErrorsLock.Unlock()
+	stats := getComputeErrorStats(id)
+	if !computeError {
+		stats.Consecutive = 0
+		return false
+	}
+	stats.Consecutive++
+	stats.Total++
+	if ComputeErrorLimit > 0 && stats.Consecutive >= uint32(ComputeErrorLimit) {
+		stats.Consecutive = 0
+		stats.Recoveries++
+		return true
+	}
+	return false
+}
 
+// PendingResults returns the number of results submitted by the GPUs that
+// are waiting to be checked
+func PendingResults() int {
+	return int(atomic.LoadInt32(&pendingResults))
+}
+
+// waitForHashChecker blocks while more than MaxPendingResults results are
+// waiting to be checked. It returns true if it had to wait
+func waitForHashChecker() bool {
+	if MaxPendingResults <= 0 {
+		return false
+	}
+	waited := false
+	for PendingResults() >= MaxPendingResults {
+		waited = true
+		time.Sleep(throttlePollInterval)
+	}
+	return waited
+}
+
+// RunHashChecker hashes every result reported by the GPUs on the CPU before
+// submitting it. Results are hashed with the algorithms registered with
+// miner.RegisterAlgorithm
+func RunHashChecker() {
+	hasher := miner.NewAlgorithmHasher()
 	for hr := range HashCheckChan {
-		if hashBytes, foundHash := xmrig_crypto.CryptonightHash(hr.XMRigWork, ctx); foundHash {
-			hashHex, err := stratum.BinToHex(hashBytes)
-			if err != nil {
-				log.Errorf("RunHashChecker: Failed to convert hash bytes to hex: %v", err)
-				continue
-			}
-			log.Debugf("Submitting id=%d job=%v result=%v", hr.id, hr.XMRigWork.Work.JobID, hashHex)
-			hr.SubmitWork(hr.XMRigWork.Work, hashHex)
-		} else {
-			log.Errorf("GPU #%d COMPUTE ERROR", hr.id)
+		checkHashResult(hr, hasher)
+		atomic.AddInt32(&pendingResults, -1)
+		if hr.miner != nil {
+			atomic.AddInt32(&hr.miner.pendingResults, -1)
+		}
+	}
+}
+
+// checkHashResult hashes a result on the CPU and submits it if it is a share.
+// The work carries the variant that the kernels of the GPU were built for,
+// so results are verified with the algorithm they were found with
+func checkHashResult(hr *HashResult, hasher *miner.AlgorithmHasher) {
+	algo, ok := xmrig_crypto.VariantAlgorithm(hr.XMRigWork.Variant)
+	if !ok {
+		log.Errorf("GPU #%d: Result for job %v has unknown variant %d", hr.id, hr.XMRigWork.JobID, hr.XMRigWork.Variant)
+		return
+	}
+	job := &miner.AlgorithmJob{
+		Algorithm: algo,
+		Height:    hr.XMRigWork.Height,
+	}
+	hashBytes, err := hasher.Hash(job, hr.XMRigWork.Data[:hr.XMRigWork.Size])
+	if err != nil {
+		log.Errorf("GPU #%d: Failed to hash result for job %v: %v", hr.id, hr.XMRigWork.JobID, err)
+		return
+	}
+	// The kernels only report nonces whose hash has its most significant 64
+	// bits within the target, anything else is a compute error
+	if binary.LittleEndian.Uint64(hashBytes[24:]) <= hr.XMRigWork.Target {
+		recordComputeResult(hr.id, false)
+		if !miner.MeetsTarget(hr.XMRigWork.JobID, hr.XMRigWork.Target, hashBytes) {
+			// The kernels only compare the most significant 64 bits
+			log.Debugf("GPU #%d: Result for job %v is just above target, not submitting", hr.id, hr.XMRigWork.JobID)
+			return
+		}
+		if !miner.ShouldSubmit(hr.id, hr.XMRigWork.Work, hashBytes) {
+			return
+		}
+		hashHex, err := stratum.BinToHex(hashBytes)
+		if err != nil {
+			log.Errorf("RunHashChecker: Failed to convert hash bytes to hex: %v", err)
+			return
+		}
+		log.Debugf("Submitting id=%d job=%v result=%v", hr.id, hr.XMRigWork.Work.JobID, hashHex)
+		if miner.IsDuplicateShare(hr.id, hr.XMRigWork.JobID, hr.XMRigWork.Nonce()) {
+			return
+		}
+		miner.RecordShare(hr.id, hashBytes, hr.XMRigWork.Target)
+		hr.SubmitWork(hr.XMRigWork.Work, hashHex)
+	} else {
+		log.Errorf("GPU #%d COMPUTE ERROR", hr.id)
+		if recordComputeResult(hr.id, true) && hr.miner != nil {
+			log.Warnf("GPU #%d: %d consecutive compute errors, recovering", hr.id, ComputeErrorLimit)
+			hr.miner.requestRecovery()
 		}
 	}
 }
@@ -3,8 +3,8 @@ package gpuminer
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,32 +20,63 @@ import (
 )
 
 var (
+	// TotalMiners is the number of GPU miners
 	TotalMiners uint32 = 0
-	minerId     uint32 = 0
+
+	// ComputeErrorIntensityStep is the amount by which a GPU's intensity is
+	// reduced every time it is recovered from compute errors
+	ComputeErrorIntensityStep = 0
 )
 
 type GPUMiner struct {
-	*stratum.StratumContext
+	miner.WorkProvider
 	*miner.Miner
 	Context   *gpucontext.GPUContext
 	Index     int
 	Intensity int
 	WorkSize  int
 	debug     bool
+	recover   chan struct{}
+	warmup    Warmup
+	// Settings from an algo-perf profile that are applied on the next
+	// reinitialization. 0 keeps the current setting
+	pendingIntensity int32
+	pendingBatchSize int32
+	// pendingVariant is one more than the variant that the kernels are
+	// built for on the next reinitialization, so that 0 keeps the current
+	// variant. The variant is switched from the event goroutine while the
+	// run loop uses the context
+	pendingVariant int32
+	// Results submitted by this GPU that have not been checked yet
+	pendingResults int32
+	// running is set once the run loop started
+	running int32
+	// lastHashed is the algorithm that the kernels were built for when the
+	// pool switched to one that they don't implement, during which the GPU
+	// idles
+	lastHashed atomic.Value // string
 }
 
-func NewGPUMiner(sc *stratum.StratumContext, index, intensity, worksize int) *GPUMiner {
+func NewGPUMiner(provider miner.WorkProvider, index, intensity, worksize int) *GPUMiner {
 	miner := &GPUMiner{
-		sc,
-		miner.New(minerId),
+		provider,
+		miner.New(miner.NextMinerID()),
 		gpucontext.New(index, intensity, worksize),
 		index,
 		intensity,
 		worksize,
 		false,
+		make(chan struct{}, 1),
+		Warmup{},
+		0,
+		0,
+		0,
+		0,
+		0,
+		atomic.Value{},
 	}
+	miner.lastHashed.Store("")
 	atomic.AddUint32(&TotalMiners, 1)
-	atomic.AddUint32(&minerId, 1)
 	return miner
 }
 
@@ -53,6 +84,239 @@ func (m *GPUMiner) SetDebug(val bool) {
 	m.debug = val
 }
 
+// SetBatchSize splits every kernel run into launches of at most batchSize
+// threads so that new jobs are picked up sooner. batchSize is rounded up to a
+// multiple of the worksize. A value of 0 launches the full intensity at once
+func (m *GPUMiner) SetBatchSize(batchSize int) {
+	if batchSize > 0 {
+		if amdgpu.UseC {
+			log.Warnf("miner-%d: Batch size is not supported when initializing OpenCL with C, ignoring", m.Id())
+			return
+		}
+		if m.WorkSize > 0 {
+			batchSize = ((batchSize + m.WorkSize - 1) / m.WorkSize) * m.WorkSize
+		}
+	}
+	m.Context.BatchSize = batchSize
+}
+
+// CanHash returns true if the GPU kernels implement algo
+func CanHash(algo string) bool {
+	_, ok := xmrig_crypto.AlgorithmVariant(miner.NormalizeAlgorithm(algo))
+	return ok
+}
+
+// SetAlgorithm sets the algorithm this GPU runs and the variant of
+// cryptonight that its kernels are built for. A running GPU switches
+// variants when it is reinitialized, which ApplyAlgoProfile requests. It
+// idles while its algorithm isn't implemented by the kernels, which only a
+// running GPU can be switched to
+func (m *GPUMiner) SetAlgorithm(algo string) error {
+	running := atomic.LoadInt32(&m.running) != 0
+	if !CanHash(algo) && !running {
+		return fmt.Errorf("Algorithm '%v' is not implemented by the GPU kernels", miner.NormalizeAlgorithm(algo))
+	}
+	previous := m.Algorithm()
+	if err := m.Miner.SetAlgorithm(algo); err != nil {
+		return err
+	}
+	variant, ok := xmrig_crypto.AlgorithmVariant(m.Algorithm())
+	if !ok {
+		if CanHash(previous) {
+			m.lastHashed.Store(previous)
+		}
+		return nil
+	}
+	if !running {
+		m.Context.Variant = variant
+		return nil
+	}
+	atomic.StoreInt32(&m.pendingVariant, int32(variant)+1)
+	return nil
+}
+
+// launchNonce returns the first nonce of a launch starting at nonce. The
+// kernels write the whole nonce into the blob, so with nicehash the launch
+// starts within the nonces of the byte that the pool reserved in work
+func (m *GPUMiner) launchNonce(work *xmrig_crypto.XMRigWork, nonce uint32) uint32 {
+	if work.Nicehash {
+		return xmrig_crypto.NicehashNonce(nonce, work.Data)
+	}
+	return nonce
+}
+
+// scratchpad returns the size of the scratchpad of each thread of this GPU
+// with the variant that its kernels are built for
+func (m *GPUMiner) scratchpad() int {
+	memory, _, _ := amdgpu.VariantMemory(m.Context.Variant)
+	return int(memory)
+}
+
+// ApplyAlgoProfile reinitializes this GPU with the intensity and batch size
+// of profile after switching algorithms from one to another. Without an
+// intensity in the profile, the intensity is scaled so that the scratchpads
+// take up the same amount of memory as before
+func (m *GPUMiner) ApplyAlgoProfile(from, to string, profile *miner.AlgoProfile) error {
+	if !CanHash(to) {
+		// The kernels are kept for when the pool switches back
+		return nil
+	}
+	if !CanHash(from) {
+		// Coming back from idling, the kernels were last built for
+		// lastHashed
+		from = m.lastHashed.Load().(string)
+	}
+	intensity := 0
+	if profile != nil {
+		intensity = profile.Intensity
+		if profile.BatchSize > 0 {
+			atomic.StoreInt32(&m.pendingBatchSize, int32(profile.BatchSize))
+		}
+	}
+	if intensity <= 0 {
+		intensity = miner.ScaleIntensity(m.Intensity, m.WorkSize, from, to)
+	}
+	log.Infof("miner-%d: GPU #%d using intensity %d for %v", m.Id(), m.Context.DeviceIndex, intensity, to)
+	atomic.StoreInt32(&m.pendingIntensity, int32(intensity))
+	m.requestRecovery()
+	return nil
+}
+
+// SetIntensity validates intensity against the memory of this GPU and
+// reinitializes it with the new intensity. If the buffers can't be
+// reallocated, the previous intensity is restored
+func (m *GPUMiner) SetIntensity(intensity int) error {
+	if err := m.Context.ValidateIntensity(intensity, m.scratchpad()); err != nil {
+		return err
+	}
+	if amdgpu.UseC {
+		return fmt.Errorf("Changing the intensity is not supported when initializing OpenCL with C")
+	}
+	log.Infof("miner-%d: Changing intensity of GPU #%d to %d", m.Id(), m.Context.DeviceIndex, intensity)
+	atomic.StoreInt32(&m.pendingIntensity, int32(intensity))
+	m.requestRecovery()
+	return nil
+}
+
+// SetPinnedResults makes this GPU read its results back through pinned host
+// memory. Pinned memory is a limited resource, so this is off by default
+func (m *GPUMiner) SetPinnedResults(pinned bool) {
+	if pinned && amdgpu.UseC {
+		log.Warnf("miner-%d: Pinned results are not supported when initializing OpenCL with C, ignoring", m.Id())
+		return
+	}
+	m.Context.PinnedResults = pinned
+}
+
+// SetBufferSets makes this GPU alternate between sets of output buffers, so
+// that the next kernel launch is enqueued before the results of the previous
+// one are processed. A value of 1 runs one launch at a time
+func (m *GPUMiner) SetBufferSets(sets int) {
+	if sets > 1 && amdgpu.UseC {
+		log.Warnf("miner-%d: Multiple buffer sets are not supported when initializing OpenCL with C, ignoring", m.Id())
+		return
+	}
+	m.Context.BufferSets = sets
+}
+
+// SetPollInterval makes this GPU check whether its kernels are done every
+// interval instead of blocking until they are. Blocking is the fastest, but
+// some drivers busy-wait and keep a CPU core at 100% while doing so
+func (m *GPUMiner) SetPollInterval(interval time.Duration) {
+	if interval > 0 && amdgpu.UseC {
+		log.Warnf("miner-%d: Polling is not supported when initializing OpenCL with C, ignoring", m.Id())
+		return
+	}
+	m.Context.PollInterval = interval
+}
+
+// requestRecovery asks the run loop to recover this GPU. Multiple requests
+// that arrive before the run loop gets to them are coalesced.
+func (m *GPUMiner) requestRecovery() {
+	select {
+	case m.recover <- struct{}{}:
+	default:
+	}
+}
+
+// Restart reinitializes the OpenCL objects of this GPU the next time around
+// the run loop, after the results of the launch in flight are reported. It
+// is used by the watchdog when the GPU stops producing hashes
+func (m *GPUMiner) Restart() error {
+	m.requestRecovery()
+	return nil
+}
+
+// recoverFromComputeErrors reinitializes the OpenCL objects of this GPU,
+// optionally at a reduced intensity, and sets up work on it again.
+// Call with workLock acquired
+func (m *GPUMiner) recoverFromComputeErrors(work *xmrig_crypto.XMRigWork) error {
+	if batchSize := atomic.SwapInt32(&m.pendingBatchSize, 0); batchSize > 0 {
+		m.SetBatchSize(int(batchSize))
+	}
+	if variant := atomic.SwapInt32(&m.pendingVariant, 0); variant > 0 {
+		m.Context.Variant = int(variant - 1)
+	}
+	previous := m.Context.RawIntensity
+	if intensity := atomic.SwapInt32(&m.pendingIntensity, 0); intensity > 0 {
+		m.Context.RawIntensity = int(intensity)
+		m.Intensity = m.Context.RawIntensity
+	} else if ComputeErrorIntensityStep > 0 && m.Context.RawIntensity > ComputeErrorIntensityStep {
+		m.Context.RawIntensity -= ComputeErrorIntensityStep
+		m.Intensity = m.Context.RawIntensity
+	}
+	m.Context.Height = work.Height
+	log.Infof("miner-%d: Reinitializing GPU #%d with intensity %d", m.Id(), m.Context.DeviceIndex, m.Context.RawIntensity)
+	if err := amdgpu.ReinitOpenCLGPU(m.Context); err != nil {
+		if m.Context.RawIntensity == previous {
+			return err
+		}
+		log.Errorf("miner-%d: Failed to reinitialize GPU #%d with intensity %d, going back to %d: %v", m.Id(), m.Context.DeviceIndex, m.Context.RawIntensity, previous, err)
+		m.Context.RawIntensity = previous
+		m.Intensity = previous
+		if err := amdgpu.ReinitOpenCLGPU(m.Context); err != nil {
+			return err
+		}
+	}
+	work.Variant = m.Context.Variant
+	return amdgpu.SetWork(m.Context, work.Data, work.Size, work.Target)
+}
+
+// needsRebuild returns true if the kernels of this GPU were built for the
+// random math of a different height than that of work. Call with workLock
+// acquired
+func (m *GPUMiner) needsRebuild(work *xmrig_crypto.XMRigWork) bool {
+	return m.Context.Variant == xmrig_crypto.VariantR && m.Context.Height != work.Height
+}
+
+// rebuildKernels reinitializes this GPU with kernels built for the random
+// math of the height of work, and sets up work on it again. Call with
+// workLock acquired
+func (m *GPUMiner) rebuildKernels(work *xmrig_crypto.XMRigWork) error {
+	previous := m.Context.Height
+	m.Context.Height = work.Height
+	if err := amdgpu.ReinitOpenCLGPU(m.Context); err != nil {
+		// Try again the next time around
+		m.Context.Height = previous
+		return err
+	}
+	return amdgpu.SetWork(m.Context, work.Data, work.Size, work.Target)
+}
+
+// SetWarmup makes this GPU start at fraction of its intensity after it is
+// initialized or recovered, ramping up to full intensity over duration
+func (m *GPUMiner) SetWarmup(fraction float64, duration time.Duration) {
+	m.warmup = Warmup{Fraction: fraction, Duration: duration}
+}
+
+func (m *GPUMiner) startWarmup() {
+	if !m.warmup.Enabled() {
+		return
+	}
+	log.Infof("miner-%d: Warming up GPU #%d from %.0f%% intensity over %v", m.Id(), m.Context.DeviceIndex, m.warmup.Fraction*100, m.warmup.Duration)
+	m.warmup.Start()
+}
+
 type CLResult []cl.CL_int
 
 func (clr CLResult) Bytes() []byte {
@@ -74,14 +338,33 @@ func (clr CLResult) Zero() {
 	}
 }
 
+// launch is a kernel run whose results haven't been processed yet
+type launch struct {
+	set  int
+	size int
+	work *xmrig_crypto.XMRigWork
+}
+
 func (m *GPUMiner) Run() error {
 	runtime.LockOSThread()
-	results := make(CLResult, 0x100)
+	atomic.StoreInt32(&m.running, 1)
+	sets := m.Context.BufferSets
+	if sets < 1 {
+		sets = 1
+	}
+	results := make([]CLResult, sets)
+	for i := range results {
+		results[i] = make(CLResult, 0x100)
+	}
 
-	defaultNonce := 0xffffffff / int(TotalMiners) * (int(m.Id()))
-	log.Debugf("miner-%d: defaultNonce=%X", m.Id(), defaultNonce)
+	nonceRange := miner.RigNonceShard.Partition(m.Id(), miner.MinerCount())
+	nonces := miner.NonceCounter{}
+	log.Debugf("miner-%d: nonceRange=%X-%X", m.Id(), nonceRange.Start, nonceRange.End)
 	workLock := sync.Mutex{}
 	work := xmrig_crypto.NewXMRigWork()
+	// The variant only changes when the kernels are rebuilt
+	work.Variant = m.Context.Variant
+	work.Nicehash = miner.RigNicehash
 	var newWork *stratum.Work
 
 	workChan := make(chan *stratum.Work, 0)
@@ -90,19 +373,27 @@ func (m *GPUMiner) Run() error {
 	initialWg.Add(1)
 	gotFirstJob := false
 
-	m.StratumContext.RegisterWorkListener(workChan)
+	m.WorkProvider.RegisterWorkListener(workChan)
 
 	// Call with workLock acquired
 	consumeWork := func() {
-		if newWork == nil || strings.Compare(newWork.JobID, work.JobID) == 0 {
+		if !miner.IsNewJob(work.Work, newWork) {
+			return
+		}
+		m.LogNewWork(m.WorkProvider, newWork)
+		if err := xmrig_crypto.ValidateBlob(newWork.Data, newWork.Size); err != nil {
+			// Keep hashing the previous job rather than submitting
+			// shares that the pool would reject as invalid
+			log.Errorf("miner-%d: Skipping job %v: %v", m.Id(), newWork.JobID, err)
 			return
 		}
-		m.LogNewWork(m.StratumContext, newWork)
 		//log.Debugf("Thread-%d: Got new work - %s", m.id, newWork.JobID)
 		//log.Debugf("Thread-%d: blob: %v", stratum.BinToStr(newWork.Data))
 		stratum.WorkCopy(work.Work, newWork)
+		work.Height, _ = miner.JobHeight(newWork.JobID)
 		work.UpdateCData()
-		m.Context.Nonce = uint32(defaultNonce)
+		nonces.Reset(nonceRange)
+		m.Context.Nonce = m.launchNonce(work, uint32(nonceRange.Start))
 		amdgpu.SetWork(m.Context, work.Data, work.Size, work.Target)
 	}
 
@@ -123,43 +414,164 @@ func (m *GPUMiner) Run() error {
 
 	initialWg.Wait()
 	log.Debugf("Got first job")
+	m.startWarmup()
+
+	var (
+		pending *launch
+		nextSet int
+	)
+
+	// finishLaunch waits for the results of l and submits them
+	finishLaunch := func(l *launch) {
+		if err := amdgpu.WaitWork(m.Context, l.set, results[l.set]); err != nil {
+			log.Errorf("miner-%d: Failed to read results: %v", m.Id(), err)
+			return
+		}
+		found := int(results[l.set][0xFF])
+		// There is only room for 0xFF results
+		if found > 0xFF {
+			found = 0xFF
+		}
+		for i := 0; i < found; i++ {
+			w := l.work.Clone()
+			w.SetNonce(uint32(results[l.set][i]))
+			m.SubmitWork(w)
+		}
+		m.InformHashrate(uint32(l.size))
+	}
+
+	// drain processes the results of the pending launch, if any
+	drain := func() {
+		if pending != nil {
+			finishLaunch(pending)
+			pending = nil
+		}
+	}
 
 	callCount := 0
 	callCountTime := time.Now()
 	var (
 		runWorkDuration int64
+		resultsDuration int64
 		tempTime        time.Time
+		noncesExhausted bool
+		idling          bool
 	)
 
 	// Main loop
 	for {
-		results.Zero()
+		select {
+		case <-m.recover:
+			// The buffers are about to be released
+			drain()
+			workLock.Lock()
+			err := m.recoverFromComputeErrors(work)
+			workLock.Unlock()
+			if err != nil {
+				log.Errorf("miner-%d: Failed to recover GPU: %v", m.Id(), err)
+			} else {
+				m.startWarmup()
+			}
+		default:
+		}
 
-		if m.debug {
-			tempTime = time.Now()
-			amdgpu.RunWork(m.Context, results)
-			// amdgpu.RunWork(m.Context, results)
-			runWorkDuration += time.Now().Sub(tempTime).Nanoseconds()
-			callCount++
-		} else {
-			amdgpu.RunWork(m.Context, results)
+		// The kernels are rebuilt by ApplyAlgoProfile when the pool
+		// switches back to an algorithm that they implement
+		if !CanHash(m.Algorithm()) {
+			drain()
+			if !idling {
+				log.Warnf("miner-%d: GPU #%d idles while the pool mines %v, which the kernels don't implement", m.Id(), m.Context.DeviceIndex, m.Algorithm())
+				idling = true
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
 		}
+		idling = false
 
-		for i := 0; i < int(results[0xFF]); i++ {
-			w := work.Clone()
-			*w.NoncePtr = uint32(results[i])
-			m.SubmitWork(w)
+		// cn/r compiles the random math of the block height into the
+		// kernels, so they are rebuilt when a job of a new height arrives
+		workLock.Lock()
+		rebuild := m.needsRebuild(work)
+		workLock.Unlock()
+		if rebuild {
+			drain()
+			workLock.Lock()
+			err := m.rebuildKernels(work)
+			workLock.Unlock()
+			if err != nil {
+				log.Errorf("miner-%d: Failed to rebuild the kernels of GPU #%d for height %d: %v", m.Id(), m.Context.DeviceIndex, work.Height, err)
+				time.Sleep(time.Second)
+				continue
+			}
 		}
 
+		// Don't produce results faster than the hash checker can check them
+		if waitForHashChecker() {
+			log.Debugf("miner-%d: Throttled until the hash checker caught up", m.Id())
+		}
+
+		workLock.Lock()
+		// Work is only switched between kernel runs, so a smaller launch
+		// size lets us move on to a new job sooner
+		launchSize := m.Context.LaunchSize()
+		if m.warmup.Active() {
+			launchSize = m.warmup.Scale(launchSize, m.WorkSize)
+		}
+		nonce, ok := nonces.Reserve(uint32(launchSize))
+		var launchWork *xmrig_crypto.XMRigWork
+		if ok {
+			m.Context.Nonce = m.launchNonce(work, nonce)
+			m.Context.Threads = launchSize
+			launchWork = work.Clone()
+		}
+		workLock.Unlock()
+		if !ok {
+			drain()
+			// Reusing nonces would only produce duplicate shares, so idle
+			// until we get a new job
+			if !noncesExhausted {
+				log.Warnf("miner-%d: Exhausted nonces for job %v, waiting for new job", m.Id(), work.JobID)
+				noncesExhausted = true
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		noncesExhausted = false
+
+		set := nextSet
+		nextSet = (nextSet + 1) % sets
+		results[set].Zero()
+
+		tempTime = time.Now()
+		err := amdgpu.EnqueueWork(m.Context, set, results[set])
+		runWorkDuration += time.Now().Sub(tempTime).Nanoseconds()
+		if err != nil {
+			log.Errorf("miner-%d: Failed to run work: %v", m.Id(), err)
+			continue
+		}
+
+		// With multiple buffer sets, the results of the previous launch are
+		// processed while the GPU is still busy with this one
+		tempTime = time.Now()
+		drain()
+		pending = &launch{set, launchSize, launchWork}
+		if sets == 1 {
+			drain()
+		}
+		resultsDuration += time.Now().Sub(tempTime).Nanoseconds()
+		callCount++
+
 		now := time.Now()
 		if m.debug && now.Sub(callCountTime) > 10*time.Second {
 			log.Infof("calls=%d", callCount)
 			log.Infof("s/iter XMRunWork=%.2f", time.Duration(runWorkDuration/int64(callCount)).Seconds())
+			log.Infof("s/iter results=%.4f buffer sets=%d", time.Duration(resultsDuration/int64(callCount)).Seconds(), sets)
+			log.Infof("pending results=%d (this GPU %d)", PendingResults(), m.PendingResults())
 			runWorkDuration = 0
+			resultsDuration = 0
 			callCount = 0
 			callCountTime = now
 		}
-		m.InformHashrate(uint32(m.Context.RawIntensity))
 	}
 }
 
@@ -167,9 +579,18 @@ func (m *GPUMiner) Run() error {
 func (m *GPUMiner) SubmitWork(work *xmrig_crypto.XMRigWork) error {
 	hashResult := &HashResult{
 		m.Id(),
-		m.StratumContext,
+		m.WorkProvider,
 		work,
+		m,
 	}
+	atomic.AddInt32(&pendingResults, 1)
+	atomic.AddInt32(&m.pendingResults, 1)
 	HashCheckChan <- hashResult
 	return nil
 }
+
+// PendingResults returns the number of results submitted by this GPU that
+// are waiting to be checked
+func (m *GPUMiner) PendingResults() int {
+	return int(atomic.LoadInt32(&m.pendingResults))
+}
@@ -0,0 +1,49 @@
+package gpuminer
+
+import (
+	"time"
+)
+
+// Warmup ramps the number of threads launched per kernel run from a fraction
+// of the configured intensity up to the full intensity over a duration
+type Warmup struct {
+	Fraction float64
+	Duration time.Duration
+	start    time.Time
+}
+
+// Enabled returns true if this warmup has any effect
+func (w *Warmup) Enabled() bool {
+	return w.Fraction > 0 && w.Fraction < 1 && w.Duration > 0
+}
+
+// Start (re)starts the ramp
+func (w *Warmup) Start() {
+	w.start = time.Now()
+}
+
+// Active returns true if the ramp is still in progress
+func (w *Warmup) Active() bool {
+	return w.Enabled() && !w.start.IsZero() && time.Since(w.start) < w.Duration
+}
+
+// Scale returns the number of threads to launch out of launchSize at this
+// point of the ramp. The result is a multiple of workSize
+func (w *Warmup) Scale(launchSize, workSize int) int {
+	if !w.Active() {
+		return launchSize
+	}
+	progress := float64(time.Since(w.start)) / float64(w.Duration)
+	fraction := w.Fraction + (1-w.Fraction)*progress
+	ret := int(float64(launchSize) * fraction)
+	if workSize > 0 {
+		ret = ((ret + workSize - 1) / workSize) * workSize
+		if ret == 0 {
+			ret = workSize
+		}
+	}
+	if ret > launchSize {
+		ret = launchSize
+	}
+	return ret
+}
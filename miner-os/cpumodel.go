@@ -0,0 +1,68 @@
+package mineros
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// cpuFeatures are the CPU features that matter for hashing, by the flag
+// that /proc/cpuinfo lists them as
+var cpuFeatures = []struct {
+	flag string
+	name string
+}{
+	{"aes", "AES-NI"},
+	{"avx", "AVX"},
+	{"avx2", "AVX2"},
+}
+
+// cpuInfoField returns the value of the first field called one of names in
+// /proc/cpuinfo
+func cpuInfoField(r io.Reader, names ...string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(fields[0])
+		for _, name := range names {
+			if key == name {
+				return strings.TrimSpace(fields[1]), nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("No %v in cpuinfo", strings.Join(names, " or "))
+}
+
+// parseCPUInfo returns the model name of the first processor listed in
+// /proc/cpuinfo
+func parseCPUInfo(r io.Reader) (string, error) {
+	return cpuInfoField(r, "model name")
+}
+
+// parseCPUFeatures returns the names of the features in cpuFeatures that
+// the first processor listed in /proc/cpuinfo has. x86 processors list
+// them as flags and ARM processors as Features
+func parseCPUFeatures(r io.Reader) ([]string, error) {
+	value, err := cpuInfoField(r, "flags", "Features")
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]bool)
+	for _, flag := range strings.Fields(value) {
+		flags[flag] = true
+	}
+	features := make([]string, 0)
+	for _, feature := range cpuFeatures {
+		if flags[feature.flag] {
+			features = append(features, feature.name)
+		}
+	}
+	return features, nil
+}
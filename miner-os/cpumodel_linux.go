@@ -0,0 +1,24 @@
+package mineros
+
+import "os"
+
+// CPUModel returns the model name of the processor
+func CPUModel() (string, error) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseCPUInfo(f)
+}
+
+// CPUFeatures returns the hashing related features that the processor has,
+// such as AES-NI and AVX2
+func CPUFeatures() ([]string, error) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseCPUFeatures(f)
+}
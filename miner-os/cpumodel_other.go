@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package mineros
+
+import "fmt"
+
+// CPUModel returns the model name of the processor. It is only known on Linux
+func CPUModel() (string, error) {
+	return "", fmt.Errorf("CPU model detection is not supported on this platform")
+}
+
+// CPUFeatures returns the hashing related features that the processor has.
+// They are only known on Linux
+func CPUFeatures() ([]string, error) {
+	return nil, fmt.Errorf("CPU feature detection is not supported on this platform")
+}
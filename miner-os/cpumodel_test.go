@@ -0,0 +1,42 @@
+package mineros
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	require := require.New(t)
+
+	cpuinfo := `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz
+cache size	: 12288 KB
+
+processor	: 1
+model name	: Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz
+`
+	model, err := parseCPUInfo(strings.NewReader(cpuinfo))
+	require.Nil(err)
+	require.Equal("Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz", model)
+
+	_, err = parseCPUInfo(strings.NewReader("processor	: 0\n"))
+	require.NotNil(err)
+}
+
+func TestParseCPUFeatures(t *testing.T) {
+	require := require.New(t)
+
+	features, err := parseCPUFeatures(strings.NewReader("model name	: Test CPU\nflags		: fpu sse2 aes avx2 bmi2\n"))
+	require.Nil(err)
+	require.Equal([]string{"AES-NI", "AVX2"}, features)
+
+	features, err = parseCPUFeatures(strings.NewReader("Features	: fp asimd aes pmull\n"))
+	require.Nil(err)
+	require.Equal([]string{"AES-NI"}, features)
+
+	_, err = parseCPUFeatures(strings.NewReader("processor	: 0\n"))
+	require.NotNil(err)
+}
@@ -0,0 +1,55 @@
+package mineros
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DaemonEnv is set in the environment of a process spawned by Daemonize
+const DaemonEnv = "GO_CRYPTONIGHT_MINER_DAEMON"
+
+// IsDaemon returns true if this process was spawned by Daemonize
+func IsDaemon() bool {
+	return os.Getenv(DaemonEnv) == "1"
+}
+
+// Daemonize re-spawns the current process with the same arguments, detached
+// from the terminal, and returns the pid of the new process.
+// The caller is expected to exit once this returns successfully.
+func Daemonize() (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return -1, fmt.Errorf("Failed to find executable: %v", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), DaemonEnv+"=1")
+	cmd.SysProcAttr = detachedSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("Failed to start background process: %v", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+	return pid, nil
+}
+
+// WritePIDFile writes the pid of the current process to path
+func WritePIDFile(path string) error {
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+}
+
+// ReadPIDFile returns the pid stored in path
+func ReadPIDFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return -1, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1, fmt.Errorf("Invalid PID file '%v': %v", path, err)
+	}
+	return pid, nil
+}
@@ -0,0 +1,28 @@
+package mineros
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIDFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "pid-file")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "miner.pid")
+	require.Nil(WritePIDFile(path))
+	pid, err := ReadPIDFile(path)
+	require.Nil(err)
+	require.Equal(os.Getpid(), pid)
+
+	require.Nil(ioutil.WriteFile(path, []byte("garbage"), 0644))
+	_, err = ReadPIDFile(path)
+	require.NotNil(err)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package mineros
+
+import "syscall"
+
+func detachedSysProcAttr() *syscall.SysProcAttr {
+	// Start a new session so that the process does not receive the
+	// terminal's signals
+	return &syscall.SysProcAttr{Setsid: true}
+}
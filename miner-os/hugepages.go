@@ -0,0 +1,58 @@
+package mineros
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HugePagesInfo is the state of the huge page pool as reported by
+// /proc/meminfo
+type HugePagesInfo struct {
+	Total int
+	Free  int
+	// Size of a huge page in bytes
+	PageSize int
+}
+
+// Needed returns the number of huge pages that size bytes take up
+func (h *HugePagesInfo) Needed(size int) int {
+	if h.PageSize == 0 {
+		return 0
+	}
+	return (size + h.PageSize - 1) / h.PageSize
+}
+
+// parseMeminfo reads the huge page fields out of /proc/meminfo
+func parseMeminfo(r io.Reader) (*HugePagesInfo, error) {
+	info := &HugePagesInfo{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "HugePages_Total:":
+			info.Total = value
+		case "HugePages_Free:":
+			info.Free = value
+		case "Hugepagesize:":
+			// Reported in kB
+			info.PageSize = value * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if info.PageSize == 0 {
+		return nil, fmt.Errorf("Huge pages are not supported by this kernel")
+	}
+	return info, nil
+}
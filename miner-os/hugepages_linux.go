@@ -0,0 +1,51 @@
+package mineros
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const nrHugePagesPath = "/proc/sys/vm/nr_hugepages"
+
+func readMeminfo() (*HugePagesInfo, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMeminfo(f)
+}
+
+// ReserveHugePages makes sure that enough huge pages are free to back size
+// bytes, reserving more if running as root. The error explains how to
+// reserve them by hand if that isn't possible
+func ReserveHugePages(size int) error {
+	info, err := readMeminfo()
+	if err != nil {
+		return err
+	}
+	needed := info.Needed(size)
+	if info.Free >= needed {
+		return nil
+	}
+	total := info.Total + needed - info.Free
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%d huge pages are needed but only %d are free. Run as root to reserve them automatically, or run 'sudo sysctl -w vm.nr_hugepages=%d'", needed, info.Free, total)
+	}
+
+	log.Infof("Reserving %d huge pages", total)
+	if err := ioutil.WriteFile(nrHugePagesPath, []byte(strconv.Itoa(total)), 0644); err != nil {
+		return fmt.Errorf("Failed to reserve %d huge pages: %v", total, err)
+	}
+	if info, err = readMeminfo(); err != nil {
+		return err
+	}
+	if info.Free < needed {
+		return fmt.Errorf("%d huge pages are needed but only %d could be reserved, memory may be too fragmented. Reserve them at boot by adding 'vm.nr_hugepages=%d' to /etc/sysctl.conf", needed, info.Free, total)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package mineros
+
+// ReserveHugePages makes sure that enough huge pages are free to back size
+// bytes. Huge pages only need to be reserved on Linux
+func ReserveHugePages(size int) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package mineros
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	require := require.New(t)
+
+	meminfo := `MemTotal:       16318404 kB
+MemFree:         1048576 kB
+HugePages_Total:       4
+HugePages_Free:        3
+HugePages_Rsvd:        0
+HugePages_Surp:        0
+Hugepagesize:       2048 kB
+`
+	info, err := parseMeminfo(strings.NewReader(meminfo))
+	require.Nil(err)
+	require.Equal(4, info.Total)
+	require.Equal(3, info.Free)
+	require.Equal(2*1024*1024, info.PageSize)
+
+	require.Equal(5, info.Needed(5*2*1024*1024))
+	require.Equal(3, info.Needed(2*2*1024*1024+1))
+
+	_, err = parseMeminfo(strings.NewReader("MemTotal: 1024 kB\n"))
+	require.NotNil(err)
+}
@@ -0,0 +1,40 @@
+package mineros
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// inputDevices are the device nodes whose access times reflect user input
+var inputDevices = []string{"/dev/input/*", "/dev/pts/*", "/dev/tty*"}
+
+// UserIdleTime returns how long it has been since the last user input, based
+// on the most recent access to an input device or terminal
+func UserIdleTime() (time.Duration, error) {
+	var last time.Time
+	for _, pattern := range inputDevices {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return 0, err
+		}
+		for _, path := range matches {
+			var st syscall.Stat_t
+			if err := syscall.Stat(path, &st); err != nil {
+				continue
+			}
+			if atime := time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)); atime.After(last) {
+				last = atime
+			}
+		}
+	}
+	if last.IsZero() {
+		return 0, fmt.Errorf("No input devices found")
+	}
+	idle := time.Since(last)
+	if idle < 0 {
+		idle = 0
+	}
+	return idle, nil
+}
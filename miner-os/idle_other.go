@@ -0,0 +1,15 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package mineros
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// UserIdleTime returns how long it has been since the last user input
+func UserIdleTime() (time.Duration, error) {
+	return 0, fmt.Errorf("Unimplemented for OS '%v'", runtime.GOOS)
+}
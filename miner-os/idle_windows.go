@@ -0,0 +1,32 @@
+package mineros
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	user32           = syscall.NewLazyDLL("user32.dll")
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	getLastInputInfo = user32.NewProc("GetLastInputInfo")
+	getTickCount     = kernel32.NewProc("GetTickCount")
+)
+
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// UserIdleTime returns how long it has been since the last keyboard or
+// mouse input
+func UserIdleTime() (time.Duration, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if ret, _, err := getLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); ret == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo failed: %v", err)
+	}
+	now, _, _ := getTickCount.Call()
+	// Both are milliseconds since boot and wrap around after 49.7 days
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
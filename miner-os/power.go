@@ -0,0 +1,142 @@
+package mineros
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PowerMeter reads the power draw of a device, such as a GPU or a CPU package
+type PowerMeter interface {
+	Name() string
+	// Watts returns the current power draw of the device
+	Watts() (float64, error)
+}
+
+// readUint64 reads a file that holds a single number, as sysfs files do
+func readUint64(path string) (uint64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// raplMeter measures the power draw of a CPU package from the energy
+// counter of its RAPL domain, averaged since the previous reading
+type raplMeter struct {
+	name string
+	path string
+	// The energy counter wraps around after maxEnergy µJ
+	maxEnergy  uint64
+	lastEnergy uint64
+	lastTime   time.Time
+}
+
+func (m *raplMeter) Name() string {
+	return m.name
+}
+
+func (m *raplMeter) Watts() (float64, error) {
+	energy, err := readUint64(filepath.Join(m.path, "energy_uj"))
+	if err != nil {
+		return 0, err
+	}
+	return m.sample(energy, time.Now())
+}
+
+// sample returns the average power since the previous sample given that
+// the counter read energy at now
+func (m *raplMeter) sample(energy uint64, now time.Time) (float64, error) {
+	delta := energy - m.lastEnergy
+	if energy < m.lastEnergy {
+		delta = m.maxEnergy - m.lastEnergy + energy
+	}
+	elapsed := now.Sub(m.lastTime).Seconds()
+	m.lastEnergy, m.lastTime = energy, now
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("No time passed since the previous reading")
+	}
+	return float64(delta) / 1e6 / elapsed, nil
+}
+
+// raplMeters returns a meter for every CPU package with a readable RAPL
+// domain under root, usually /sys/class/powercap. The energy counters are
+// only readable by root on most systems
+func raplMeters(root string) []PowerMeter {
+	dirs, _ := filepath.Glob(filepath.Join(root, "intel-rapl:*"))
+	sort.Strings(dirs)
+	meters := make([]PowerMeter, 0)
+	for _, dir := range dirs {
+		// Subdomains such as intel-rapl:0:0 are part of their package
+		if strings.Count(filepath.Base(dir), ":") != 1 {
+			continue
+		}
+		energy, err := readUint64(filepath.Join(dir, "energy_uj"))
+		if err != nil {
+			continue
+		}
+		maxEnergy, err := readUint64(filepath.Join(dir, "max_energy_range_uj"))
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(dir)
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "name")); err == nil {
+			name = strings.TrimSpace(string(b))
+		}
+		meters = append(meters, &raplMeter{"cpu " + name, dir, maxEnergy, energy, time.Now()})
+	}
+	return meters
+}
+
+// hwmonMeter reads the power draw that a GPU driver reports through hwmon,
+// in µW
+type hwmonMeter struct {
+	name string
+	path string
+}
+
+func (m *hwmonMeter) Name() string {
+	return m.name
+}
+
+func (m *hwmonMeter) Watts() (float64, error) {
+	microwatts, err := readUint64(m.path)
+	if err != nil {
+		return 0, err
+	}
+	return float64(microwatts) / 1e6, nil
+}
+
+// hwmonMeters returns a meter for every GPU under root, usually
+// /sys/class/drm, whose driver reports its power draw
+func hwmonMeters(root string) []PowerMeter {
+	cards, _ := filepath.Glob(filepath.Join(root, "card*"))
+	sort.Strings(cards)
+	meters := make([]PowerMeter, 0)
+	for _, card := range cards {
+		name := filepath.Base(card)
+		// Skip connectors such as card0-DP-1
+		if _, err := strconv.Atoi(strings.TrimPrefix(name, "card")); err != nil {
+			continue
+		}
+		hwmons, _ := filepath.Glob(filepath.Join(card, "device", "hwmon", "hwmon*"))
+		sort.Strings(hwmons)
+	hwmon:
+		for _, hwmon := range hwmons {
+			// amdgpu reports power1_average, other drivers power1_input
+			for _, file := range []string{"power1_average", "power1_input"} {
+				path := filepath.Join(hwmon, file)
+				if _, err := readUint64(path); err == nil {
+					meters = append(meters, &hwmonMeter{"gpu " + name, path})
+					break hwmon
+				}
+			}
+		}
+	}
+	return meters
+}
@@ -0,0 +1,7 @@
+package mineros
+
+// PowerMeters returns meters for the power draw of the GPUs and the CPU
+// packages that can be read. Devices whose power can't be read are left out
+func PowerMeters() []PowerMeter {
+	return append(hwmonMeters("/sys/class/drm"), raplMeters("/sys/class/powercap")...)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package mineros
+
+// PowerMeters returns meters for the power draw of the devices. Power can
+// only be read on Linux
+func PowerMeters() []PowerMeter {
+	return nil
+}
@@ -0,0 +1,79 @@
+package mineros
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeSysfsFile(t *testing.T, path string, contents string) {
+	require := require.New(t)
+
+	require.Nil(os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(ioutil.WriteFile(path, []byte(contents+"\n"), 0644))
+}
+
+func TestRAPLMeters(t *testing.T) {
+	require := require.New(t)
+
+	root, err := ioutil.TempDir("", "powercap")
+	require.Nil(err)
+	defer os.RemoveAll(root)
+
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:0", "name"), "package-0")
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:0", "energy_uj"), "1000000")
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:0", "max_energy_range_uj"), "262143328850")
+	// Subdomains are part of the package
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:0:0", "energy_uj"), "500000")
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:0:0", "max_energy_range_uj"), "262143328850")
+	// Unreadable domains are left out
+	writeSysfsFile(t, filepath.Join(root, "intel-rapl:1", "name"), "package-1")
+
+	meters := raplMeters(root)
+	require.Equal(1, len(meters))
+	require.Equal("cpu package-0", meters[0].Name())
+
+	meter := meters[0].(*raplMeter)
+	start := meter.lastTime
+	watts, err := meter.sample(31000000, start.Add(2*time.Second))
+	require.Nil(err)
+	require.Equal(15.0, watts)
+
+	// The counter wraps around
+	meter.maxEnergy = 32000000
+	watts, err = meter.sample(1000000, start.Add(3*time.Second))
+	require.Nil(err)
+	require.Equal(2.0, watts)
+
+	_, err = meter.sample(2000000, start.Add(3*time.Second))
+	require.NotNil(err)
+}
+
+func TestHwmonMeters(t *testing.T) {
+	require := require.New(t)
+
+	root, err := ioutil.TempDir("", "drm")
+	require.Nil(err)
+	defer os.RemoveAll(root)
+
+	writeSysfsFile(t, filepath.Join(root, "card0", "device", "hwmon", "hwmon3", "power1_average"), "152000000")
+	writeSysfsFile(t, filepath.Join(root, "card1", "device", "hwmon", "hwmon4", "power1_input"), "98500000")
+	// Connectors and GPUs without power readings are left out
+	writeSysfsFile(t, filepath.Join(root, "card0-DP-1", "device", "hwmon", "hwmon3", "power1_average"), "152000000")
+	writeSysfsFile(t, filepath.Join(root, "card2", "device", "hwmon", "hwmon5", "temp1_input"), "65000")
+
+	meters := hwmonMeters(root)
+	require.Equal(2, len(meters))
+	require.Equal("gpu card0", meters[0].Name())
+	watts, err := meters[0].Watts()
+	require.Nil(err)
+	require.Equal(152.0, watts)
+	require.Equal("gpu card1", meters[1].Name())
+	watts, err = meters[1].Watts()
+	require.Nil(err)
+	require.Equal(98.5, watts)
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package mineros
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleResetSignal calls reset every time the process receives SIGUSR2
+func HandleResetSignal(reset func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	go func() {
+		for range c {
+			reset()
+		}
+	}()
+}
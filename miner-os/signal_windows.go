@@ -0,0 +1,5 @@
+package mineros
+
+// HandleResetSignal is a no-op on Windows, which has no SIGUSR2
+func HandleResetSignal(reset func()) {
+}
@@ -0,0 +1,152 @@
+package miner
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var algoScratchpads = map[string]int{
+	"cn/0":            2 * 1024 * 1024,
+	"cn/2":            2 * 1024 * 1024,
+	"cn/r":            2 * 1024 * 1024,
+	"cn/half":         2 * 1024 * 1024,
+	"cn/gpu":          2 * 1024 * 1024,
+	"cn-lite/0":       1 * 1024 * 1024,
+	"cn-heavy/0":      4 * 1024 * 1024,
+	"cn-pico/trtl":    256 * 1024,
+	"rx/0":            2 * 1024 * 1024,
+	"argon2/chukwa":   512 * 1024,
+	"argon2/chukwav2": 1024 * 1024,
+	// The buffers of the longest second stage
+	"astrobwt": 21 * 1024 * 1024,
+}
+
+// ScratchpadSize returns the size in bytes of the scratchpad each hash of
+// algo needs. Unknown algorithms are assumed to use the cn/0 scratchpad
+func ScratchpadSize(algo string) int {
+	if size, ok := algoScratchpads[NormalizeAlgorithm(algo)]; ok {
+		return size
+	}
+	return algoScratchpads[DefaultAlgorithm]
+}
+
+// ScaleIntensity scales an intensity tuned for the algorithm from so that it
+// takes up the same amount of memory when running the algorithm to. The
+// result is rounded down to a multiple of workSize
+func ScaleIntensity(intensity, workSize int, from, to string) int {
+	scaled := intensity * ScratchpadSize(from) / ScratchpadSize(to)
+	if workSize > 0 {
+		scaled -= scaled % workSize
+		if scaled < workSize {
+			scaled = workSize
+		}
+	}
+	return scaled
+}
+
+// JobAlgorithm returns the algorithm announced by the pool in a job
+// notification or login response, if any
+func JobAlgorithm(line []byte) (string, bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return "", false
+	}
+	var job map[string]interface{}
+	if method, _ := message["method"].(string); method == "job" {
+		job, _ = message["params"].(map[string]interface{})
+	} else if result, ok := message["result"].(map[string]interface{}); ok {
+		job, _ = result["job"].(map[string]interface{})
+	}
+	algo, ok := job["algo"].(string)
+	if !ok || len(algo) == 0 {
+		return "", false
+	}
+	return algo, true
+}
+
+// ProfileApplier is implemented by miners whose settings can be changed when
+// they switch algorithms. A nil profile means that none is configured for
+// the algorithm
+type ProfileApplier interface {
+	ApplyAlgoProfile(from, to string, profile *AlgoProfile) error
+}
+
+// AlgoSwitcher switches miners over to the algorithm announced by the pool,
+// applying the algo-perf profile configured for it
+type AlgoSwitcher struct {
+	sync.Mutex
+	profiles map[string]AlgoProfile
+	miners   []Interface
+}
+
+// NewAlgoSwitcher returns an AlgoSwitcher for miners. The keys of profiles
+// may use any of the names of an algorithm
+func NewAlgoSwitcher(profiles map[string]AlgoProfile, miners []Interface) *AlgoSwitcher {
+	normalized := make(map[string]AlgoProfile, len(profiles))
+	for algo, profile := range profiles {
+		normalized[NormalizeAlgorithm(algo)] = profile
+	}
+	return &AlgoSwitcher{
+		sync.Mutex{},
+		normalized,
+		miners,
+	}
+}
+
+// Profile returns the profile configured for algo, or nil if there is none
+func (s *AlgoSwitcher) Profile(algo string) *AlgoProfile {
+	profile, ok := s.profiles[NormalizeAlgorithm(algo)]
+	if !ok {
+		return nil
+	}
+	return &profile
+}
+
+// Switch moves every miner that isn't already running algo over to it
+func (s *AlgoSwitcher) Switch(algo string) {
+	s.Lock()
+	defer s.Unlock()
+	algo = NormalizeAlgorithm(algo)
+	profile := s.Profile(algo)
+	for _, m := range s.miners {
+		from := m.Algorithm()
+		if from == algo {
+			continue
+		}
+		if err := m.SetAlgorithm(algo); err != nil {
+			log.Errorf("miner-%d: Failed to switch to algorithm '%v': %v", m.Id(), algo, err)
+			continue
+		}
+		if profile != nil {
+			log.Infof("miner-%d: Switched from %v to %v, applying algo-perf profile %+v", m.Id(), from, algo, *profile)
+		} else {
+			log.Infof("miner-%d: Switched from %v to %v, no algo-perf profile configured", m.Id(), from, algo)
+		}
+		if applier, ok := m.(ProfileApplier); ok {
+			if err := applier.ApplyAlgoProfile(from, algo, profile); err != nil {
+				log.Errorf("miner-%d: Failed to apply algo-perf profile for %v: %v", m.Id(), algo, err)
+			}
+		}
+	}
+}
+
+// HandleEvent switches algorithms on AlgorithmChanged events
+func (s *AlgoSwitcher) HandleEvent(event *Event) {
+	if event.Kind != AlgorithmChanged {
+		return
+	}
+	if algo, ok := event.Payload.(string); ok {
+		s.Switch(algo)
+	}
+}
+
+// Run switches algorithms whenever the pool does. This function is expected
+// to be run in a goroutine
+func (s *AlgoSwitcher) Run() {
+	eventChan := make(chan *Event, 10)
+	RegisterEventListener(eventChan)
+	for event := range eventChan {
+		s.HandleEvent(event)
+	}
+}
@@ -0,0 +1,92 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type profiledMiner struct {
+	*Miner
+	from    string
+	to      string
+	profile *AlgoProfile
+}
+
+func (m *profiledMiner) Run() error {
+	return nil
+}
+
+func (m *profiledMiner) ApplyAlgoProfile(from, to string, profile *AlgoProfile) error {
+	m.from = from
+	m.to = to
+	m.profile = profile
+	return nil
+}
+
+func TestScaleIntensity(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(2*1024*1024, ScratchpadSize("cryptonight"))
+	require.Equal(4*1024*1024, ScratchpadSize("cryptonight-heavy"))
+	require.Equal(2*1024*1024, ScratchpadSize("unknown"))
+
+	require.Equal(512, ScaleIntensity(1024, 8, "cn/0", "cn-heavy/0"))
+	require.Equal(2048, ScaleIntensity(1024, 8, "cn/0", "cn-lite/0"))
+	require.Equal(8192, ScaleIntensity(1024, 8, "cn/0", "cn-pico/trtl"))
+	// Rounded down to a multiple of the worksize
+	require.Equal(496, ScaleIntensity(1000, 16, "cn/0", "cn-heavy/0"))
+	require.Equal(16, ScaleIntensity(8, 16, "cn/0", "cn-heavy/0"))
+}
+
+func TestJobAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	algo, ok := JobAlgorithm([]byte(`{"jsonrpc":"2.0","method":"job","params":{"job_id":"1","algo":"cn-heavy/0"}}`))
+	require.True(ok)
+	require.Equal("cn-heavy/0", algo)
+
+	algo, ok = JobAlgorithm([]byte(`{"id":1,"result":{"id":"abc","job":{"job_id":"1","algo":"cn/0"}}}`))
+	require.True(ok)
+	require.Equal("cn/0", algo)
+
+	_, ok = JobAlgorithm([]byte(`{"jsonrpc":"2.0","method":"job","params":{"job_id":"1"}}`))
+	require.False(ok)
+	_, ok = JobAlgorithm([]byte(`{"id":2,"result":{"status":"OK"}}`))
+	require.False(ok)
+}
+
+func TestAlgoSwitcher(t *testing.T) {
+	require := require.New(t)
+
+	supported := SupportedAlgorithms
+	SupportedAlgorithms = append([]string{"cn-heavy/0"}, supported...)
+	defer func() { SupportedAlgorithms = supported }()
+
+	m0 := &profiledMiner{New(0), "", "", nil}
+	m1 := &profiledMiner{New(1), "", "", nil}
+	s := NewAlgoSwitcher(map[string]AlgoProfile{
+		"cryptonight-heavy": AlgoProfile{Intensity: 256},
+	}, []Interface{m0, m1})
+
+	s.HandleEvent(&Event{AlgorithmChanged, time.Now(), 0, "cn-heavy/0"})
+	for _, m := range []*profiledMiner{m0, m1} {
+		require.Equal("cn-heavy/0", m.Algorithm())
+		require.Equal("cn/0", m.from)
+		require.Equal("cn-heavy/0", m.to)
+		require.NotNil(m.profile)
+		require.Equal(256, m.profile.Intensity)
+	}
+
+	// Switching back without a profile
+	s.HandleEvent(&Event{AlgorithmChanged, time.Now(), 0, "cn/0"})
+	require.Equal("cn/0", m0.Algorithm())
+	require.Nil(m0.profile)
+
+	// Unsupported algorithms are not switched to
+	m0.to = ""
+	s.HandleEvent(&Event{AlgorithmChanged, time.Now(), 0, "cn/fast"})
+	require.Equal("cn/0", m0.Algorithm())
+	require.Equal("", m0.to)
+}
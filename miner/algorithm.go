@@ -0,0 +1,141 @@
+package miner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// AlgorithmJob is what an Algorithm needs to know about a job to hash its
+// blobs
+type AlgorithmJob struct {
+	// Algorithm is the name of the algorithm, as NormalizeAlgorithm names it
+	Algorithm string
+	// Height is the block height of the job, 0 if the pool didn't send one
+	Height uint64
+	// Seed is the seed hash of the job, nil if the pool didn't send one
+	Seed []byte
+}
+
+// NewAlgorithmJob returns the AlgorithmJob of the job with the given id that
+// is hashed with algo, with the height and seed hash that the pool sent
+func NewAlgorithmJob(algo string, jobID string) *AlgorithmJob {
+	height, _ := JobHeight(jobID)
+	seed, _ := JobSeed(jobID)
+	return &AlgorithmJob{
+		NormalizeAlgorithm(algo),
+		height,
+		seed,
+	}
+}
+
+// Algorithm hashes the blobs of jobs. Implementations register themselves by
+// name with RegisterAlgorithm, usually from the init function of their
+// package, so that miners can hash them without knowing about them
+type Algorithm interface {
+	// VariantOf returns the variant of the algorithm that job is hashed with.
+	// Init is only called again for a job of another variant, so the variant
+	// has to cover everything that Init depends on, e.g. the block height of
+	// cn/r
+	VariantOf(job *AlgorithmJob) string
+	// Init prepares the algorithm to hash the blobs of job
+	Init(job *AlgorithmJob) error
+	// Hash returns the 32-byte hash of blob. The returned slice may be
+	// overwritten by the next call
+	Hash(blob []byte) ([]byte, error)
+}
+
+// AlgorithmFactory creates an Algorithm. Every thread that hashes has its own
+type AlgorithmFactory func() Algorithm
+
+// algorithms are the factories of the registered algorithms by name
+var algorithms = struct {
+	sync.Mutex
+	factories map[string]AlgorithmFactory
+}{
+	factories: make(map[string]AlgorithmFactory),
+}
+
+// RegisterAlgorithm makes the algorithm that factory creates available by
+// name, as NormalizeAlgorithm names it. Registering a name twice panics
+func RegisterAlgorithm(name string, factory AlgorithmFactory) {
+	algorithms.Lock()
+	defer algorithms.Unlock()
+	name = NormalizeAlgorithm(name)
+	if _, ok := algorithms.factories[name]; ok {
+		panic(fmt.Sprintf("Algorithm '%v' is registered twice", name))
+	}
+	algorithms.factories[name] = factory
+}
+
+// IsAlgorithmRegistered returns true if an implementation of algo was
+// registered
+func IsAlgorithmRegistered(algo string) bool {
+	algorithms.Lock()
+	defer algorithms.Unlock()
+	_, ok := algorithms.factories[NormalizeAlgorithm(algo)]
+	return ok
+}
+
+// RegisteredAlgorithms returns the names of the registered algorithms in
+// sorted order
+func RegisteredAlgorithms() []string {
+	algorithms.Lock()
+	defer algorithms.Unlock()
+	names := make([]string, 0, len(algorithms.factories))
+	for name := range algorithms.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAlgorithm creates the registered implementation of algo
+func NewAlgorithm(algo string) (Algorithm, error) {
+	algorithms.Lock()
+	factory, ok := algorithms.factories[NormalizeAlgorithm(algo)]
+	algorithms.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Algorithm '%v' is not implemented", NormalizeAlgorithm(algo))
+	}
+	return factory(), nil
+}
+
+// AlgorithmHasher hashes the blobs of jobs of any registered algorithm. It
+// creates an Algorithm for every algorithm that it hashes and keeps it, and
+// initializes it again whenever the variant of the jobs changes. An
+// AlgorithmHasher must not be used from more than one goroutine at a time
+type AlgorithmHasher struct {
+	algorithms map[string]Algorithm
+	variants   map[string]string
+}
+
+// NewAlgorithmHasher returns an AlgorithmHasher that hasn't hashed anything
+func NewAlgorithmHasher() *AlgorithmHasher {
+	return &AlgorithmHasher{
+		make(map[string]Algorithm),
+		make(map[string]string),
+	}
+}
+
+// Hash returns the hash of blob, which belongs to job. The returned slice may
+// be overwritten by the next call
+func (h *AlgorithmHasher) Hash(job *AlgorithmJob, blob []byte) ([]byte, error) {
+	algo, ok := h.algorithms[job.Algorithm]
+	if !ok {
+		var err error
+		if algo, err = NewAlgorithm(job.Algorithm); err != nil {
+			return nil, err
+		}
+		h.algorithms[job.Algorithm] = algo
+	}
+	variant := algo.VariantOf(job)
+	if current, ok := h.variants[job.Algorithm]; !ok || current != variant {
+		if err := algo.Init(job); err != nil {
+			delete(h.variants, job.Algorithm)
+			return nil, err
+		}
+		h.variants[job.Algorithm] = variant
+	}
+	return algo.Hash(blob)
+}
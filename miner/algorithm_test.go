@@ -0,0 +1,92 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testAlgorithm hashes a blob into its variant and length, and counts how
+// often it was initialized
+type testAlgorithm struct {
+	variant string
+	inits   int
+}
+
+func (a *testAlgorithm) VariantOf(job *AlgorithmJob) string {
+	return fmt.Sprintf("%v@%d", job.Algorithm, job.Height)
+}
+
+func (a *testAlgorithm) Init(job *AlgorithmJob) error {
+	if job.Height == 0 {
+		return fmt.Errorf("No height")
+	}
+	a.variant = a.VariantOf(job)
+	a.inits++
+	return nil
+}
+
+func (a *testAlgorithm) Hash(blob []byte) ([]byte, error) {
+	return []byte(fmt.Sprintf("%v:%d:%d", a.variant, len(blob), a.inits)), nil
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	require.False(IsAlgorithmRegistered("test/registry"))
+	_, err := NewAlgorithm("test/registry")
+	require.NotNil(err)
+
+	RegisterAlgorithm("Test/Registry", func() Algorithm { return &testAlgorithm{} })
+	require.True(IsAlgorithmRegistered("test/registry"))
+	require.Contains(RegisteredAlgorithms(), "test/registry")
+	a, err := NewAlgorithm(" TEST/registry")
+	require.Nil(err)
+	require.NotNil(a)
+
+	require.Panics(func() {
+		RegisterAlgorithm("test/registry", func() Algorithm { return &testAlgorithm{} })
+	})
+}
+
+func TestAlgorithmHasher(t *testing.T) {
+	require := require.New(t)
+
+	RegisterAlgorithm("test/hasher", func() Algorithm { return &testAlgorithm{} })
+	h := NewAlgorithmHasher()
+
+	job := &AlgorithmJob{"test/hasher", 10, nil}
+	hash, err := h.Hash(job, make([]byte, 3))
+	require.Nil(err)
+	require.Equal("test/hasher@10:3:1", string(hash))
+
+	// The same variant is hashed without initializing again
+	hash, err = h.Hash(&AlgorithmJob{"test/hasher", 10, []byte{1}}, make([]byte, 4))
+	require.Nil(err)
+	require.Equal("test/hasher@10:4:1", string(hash))
+
+	hash, err = h.Hash(&AlgorithmJob{"test/hasher", 11, nil}, make([]byte, 4))
+	require.Nil(err)
+	require.Equal("test/hasher@11:4:2", string(hash))
+
+	// A failed initialization is tried again with the next job
+	_, err = h.Hash(&AlgorithmJob{"test/hasher", 0, nil}, nil)
+	require.NotNil(err)
+	hash, err = h.Hash(&AlgorithmJob{"test/hasher", 11, nil}, nil)
+	require.Nil(err)
+	require.Equal("test/hasher@11:0:3", string(hash))
+
+	_, err = h.Hash(&AlgorithmJob{"test/unknown", 1, nil}, nil)
+	require.NotNil(err)
+}
+
+func TestNewAlgorithmJob(t *testing.T) {
+	require := require.New(t)
+
+	RecordJobSeed("algorithm-job", []byte{1, 2})
+	job := NewAlgorithmJob("RandomX", "algorithm-job")
+	require.Equal("rx/0", job.Algorithm)
+	require.Equal([]byte{1, 2}, job.Seed)
+	require.Equal(uint64(0), job.Height)
+}
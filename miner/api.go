@@ -0,0 +1,87 @@
+package miner
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// APIServer serves the status of the miner and lets it be controlled over
+// HTTP. Responses are JSON
+type APIServer struct {
+	mux      *http.ServeMux
+	listener net.Listener
+}
+
+// NewAPIServer returns an APIServer listening on address that serves:
+//
+//	GET  /status  the current Status
+//	POST /reset   reset the stats
+func NewAPIServer(address string) (*APIServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	a := &APIServer{
+		http.NewServeMux(),
+		listener,
+	}
+	a.Handle("/status", http.MethodGet, func(r *http.Request) (interface{}, error) {
+		return DefaultStatusTracker.Status(), nil
+	})
+	a.Handle("/reset", http.MethodPost, func(r *http.Request) (interface{}, error) {
+		ResetStats()
+		return DefaultStatusTracker.Status(), nil
+	})
+	return a, nil
+}
+
+// APIHandler handles an API request. The returned value is sent back as JSON.
+// Errors are sent back with a 400 status
+type APIHandler func(r *http.Request) (interface{}, error)
+
+// Handle registers handler for requests to path with the given method
+func (a *APIServer) Handle(path string, method string, handler APIHandler) {
+	a.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+			return
+		}
+		result, err := handler(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// Addr returns the address the server is listening on
+func (a *APIServer) Addr() string {
+	return a.listener.Addr().String()
+}
+
+// Close stops the server
+func (a *APIServer) Close() error {
+	return a.listener.Close()
+}
+
+// Run serves requests until the server is closed.
+// This function is expected to be run in a goroutine
+func (a *APIServer) Run() {
+	log.Infof("API listening on %v", a.Addr())
+	if err := http.Serve(a.listener, a.mux); err != nil {
+		log.Debugf("API stopped: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("API: Failed to write response: %v", err)
+	}
+}
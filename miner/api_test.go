@@ -0,0 +1,48 @@
+package miner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIServer(t *testing.T) {
+	require := require.New(t)
+
+	api, err := NewAPIServer("127.0.0.1:0")
+	require.Nil(err)
+	defer api.Close()
+	api.Handle("/fail", http.MethodGet, func(r *http.Request) (interface{}, error) {
+		return nil, fmt.Errorf("Failed")
+	})
+	go api.Run()
+
+	url := "http://" + api.Addr()
+	resp, err := http.Get(url + "/status")
+	require.Nil(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	var status Status
+	require.Nil(json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+
+	resp, err = http.Get(url + "/reset")
+	require.Nil(err)
+	require.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+
+	DefaultStats.HandleEvent(NewEvent(ShareAccepted, 0, nil))
+	resp, err = http.Post(url+"/reset", "application/json", nil)
+	require.Nil(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Nil(json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	require.Equal(ShareCounts{}, status.Shares)
+
+	resp, err = http.Get(url + "/fail")
+	require.Nil(err)
+	require.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
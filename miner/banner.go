@@ -0,0 +1,105 @@
+package miner
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Build identifies the build of the miner, e.g. the commit it was built
+// from. It is set when linking with
+// -ldflags "-X github.com/gurupras/go-cryptonight-miner/miner.Build=..."
+var Build = "unknown"
+
+// BannerDevice is a GPU listed in the startup banner
+type BannerDevice struct {
+	Index int
+	Name  string
+	// Global memory in bytes
+	Memory uint64
+}
+
+// Banner describes the miner and the machine it runs on. It is logged at
+// startup so that bug reports include it
+type Banner struct {
+	Version   string
+	Build     string
+	GoVersion string
+	OS        string
+	Arch      string
+	CPU       string
+	// CPU features that matter for hashing, e.g. AES-NI
+	CPUFeatures []string
+	// Whether huge pages back the scratchpads. Empty if not applicable
+	HugePages string
+	Algorithm string
+	Threads   int
+	Devices   []BannerDevice
+	Pools     []string
+}
+
+// NewBanner returns a Banner for this build of the miner running config.
+// The CPU, huge pages, threads and devices are left for the caller to fill
+func NewBanner(config *Config) *Banner {
+	b := &Banner{
+		Version:   Version,
+		Build:     Build,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Algorithm: config.Algorithm,
+	}
+	for _, pool := range config.Pools {
+		b.Pools = append(b.Pools, pool.Url)
+	}
+	return b
+}
+
+// Lines returns the banner as lines of a label and a value
+func (b *Banner) Lines() []string {
+	var lines []string
+	add := func(label string, format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(" * %-11s %s", label, fmt.Sprintf(format, args...)))
+	}
+	add("VERSION", "go-cryptonight-miner %v (build %v)", b.Version, b.Build)
+	add("GO", "%v %v/%v", b.GoVersion, b.OS, b.Arch)
+	cpu := b.CPU
+	if len(cpu) == 0 {
+		cpu = "unknown"
+	}
+	if len(b.CPUFeatures) != 0 {
+		cpu = fmt.Sprintf("%v (%v)", cpu, strings.Join(b.CPUFeatures, " "))
+	}
+	add("CPU", "%v, %d logical cores", cpu, runtime.NumCPU())
+	if len(b.HugePages) != 0 {
+		add("HUGE PAGES", "%v", b.HugePages)
+	}
+	add("ALGO", "%v", b.Algorithm)
+	if b.Threads != 0 {
+		add("THREADS", "%d", b.Threads)
+	}
+	for _, device := range b.Devices {
+		add(fmt.Sprintf("GPU #%d", device.Index), "%v, %d MB", device.Name, device.Memory/(1024*1024))
+	}
+	for i, pool := range b.Pools {
+		add(fmt.Sprintf("POOL #%d", i+1), "%v", pool)
+	}
+	return lines
+}
+
+// WriteBanner writes the lines of b to w
+func WriteBanner(w io.Writer, b *Banner) {
+	for _, line := range b.Lines() {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// LogBanner logs the lines of b
+func LogBanner(b *Banner) {
+	for _, line := range b.Lines() {
+		log.Infof("%v", line)
+	}
+}
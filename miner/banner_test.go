@@ -0,0 +1,44 @@
+package miner
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanner(t *testing.T) {
+	require := require.New(t)
+
+	config := &Config{Algorithm: "cn/1"}
+	config.Pools = []Pool{{Url: "stratum+tcp://pool:3333"}}
+	b := NewBanner(config)
+	require.Equal(Version, b.Version)
+	require.Equal(runtime.GOOS, b.OS)
+	b.CPU = "Test CPU"
+	b.CPUFeatures = []string{"AES-NI", "AVX2"}
+	b.HugePages = "enabled"
+	b.Threads = 4
+	b.Devices = []BannerDevice{{0, "Ellesmere", 8 * 1024 * 1024 * 1024}}
+
+	var buf bytes.Buffer
+	WriteBanner(&buf, b)
+	out := buf.String()
+	require.Contains(out, " * VERSION     go-cryptonight-miner "+Version)
+	require.Contains(out, runtime.Version())
+	require.Contains(out, "Test CPU (AES-NI AVX2)")
+	require.Contains(out, " * HUGE PAGES  enabled")
+	require.Contains(out, " * ALGO        cn/1")
+	require.Contains(out, " * THREADS     4")
+	require.Contains(out, " * GPU #0      Ellesmere, 8192 MB")
+	require.Contains(out, " * POOL #1     stratum+tcp://pool:3333")
+
+	// Settings that don't apply are left out
+	b = NewBanner(config)
+	buf.Reset()
+	WriteBanner(&buf, b)
+	require.NotContains(buf.String(), "HUGE PAGES")
+	require.NotContains(buf.String(), "THREADS")
+	require.Contains(buf.String(), " * CPU         unknown")
+}
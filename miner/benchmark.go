@@ -0,0 +1,263 @@
+package miner
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// benchmarkJobID is the id of the job that benchmarks mine
+	benchmarkJobID = "benchmark"
+	// benchmarkBlob is the hashing blob of a monero block, which every
+	// algorithm is benchmarked with
+	benchmarkBlob = "0707f7a4f0d605b303260816ba3f10902e1a145ac5fad3aa3af6ea44c11869dc4f853f002b2eea0000000077b206a02ca5b1d4ce6bbfdf0acac38bded34d2dcdeef95cd20cefc12f61d56109"
+	// benchmarkHeight is the block height of the job, for cn/r
+	benchmarkHeight = 1806260
+)
+
+var (
+	// BenchmarkWarmup is how long a benchmark waits after the miners have
+	// started hashing an algorithm before it starts measuring, so that GPUs
+	// have rebuilt their kernels and the hashrate has settled
+	BenchmarkWarmup = 5 * time.Second
+
+	// BenchmarkStartTimeout is how long a benchmark waits for the miners to
+	// start hashing an algorithm, which includes building the RandomX
+	// dataset. Miners that haven't started by then are measured at 0 H/s
+	BenchmarkStartTimeout = 10 * time.Minute
+
+	// benchmarkSeed is the RandomX seed hash of the job
+	benchmarkSeed = []byte("go-cryptonight-miner benchmark!!")
+)
+
+// BenchmarkSource is a WorkProvider that feeds the miners of a benchmark one
+// job that they never find a share for. Every listener receives the job as
+// soon as it registers
+type BenchmarkSource struct {
+	sync.Mutex
+	job       *stratum.Work
+	listeners []chan<- *stratum.Work
+}
+
+// NewBenchmarkSource returns a BenchmarkSource. The job carries a block
+// height and a seed hash, so that cn/r and RandomX can be benchmarked too
+func NewBenchmarkSource() *BenchmarkSource {
+	job := stratum.NewWork()
+	job.Data, _ = hex.DecodeString(benchmarkBlob)
+	job.Size = len(job.Data)
+	// Padding that the miners hash the blob in
+	job.Data = append(job.Data, make([]byte, 128)...)
+	job.JobID = benchmarkJobID
+	// Hashes meet this target about once in 2^64 tries
+	job.Target = 1
+	RecordJobHeight(job.JobID, benchmarkHeight)
+	RecordJobSeed(job.JobID, benchmarkSeed)
+	return &BenchmarkSource{
+		sync.Mutex{},
+		job,
+		nil,
+	}
+}
+
+// RegisterWorkListener registers workChan and sends it the job
+func (s *BenchmarkSource) RegisterWorkListener(workChan chan<- *stratum.Work) {
+	s.Lock()
+	defer s.Unlock()
+	s.listeners = append(s.listeners, workChan)
+	go func() {
+		workChan <- s.job
+	}()
+}
+
+// SubmitWork drops shares, there is no pool to submit them to
+func (s *BenchmarkSource) SubmitWork(work *stratum.Work, hash string) error {
+	return nil
+}
+
+// BenchmarkColumn is a group of miners whose hashrates are added up in one
+// column of the table of a benchmark, e.g. all the CPU threads or one GPU
+type BenchmarkColumn struct {
+	Name   string
+	Miners []Interface
+	// CanHash returns true if the miners implement algo
+	CanHash func(algo string) bool
+}
+
+// BenchmarkResult is the hashrate in H/s of every column of a benchmark with
+// an algorithm, by the name of the column. Columns that can't hash the
+// algorithm are left out
+type BenchmarkResult struct {
+	Algorithm string
+	HashRates map[string]float64
+}
+
+// Benchmark measures the hashrate of columns of miners with one algorithm
+// after another. The miners switch algorithms the way they do when the pool
+// switches, applying the algo-perf profiles, so the hashrates are what the
+// miners reach on a pool
+type Benchmark struct {
+	columns  []BenchmarkColumn
+	profiles map[string]AlgoProfile
+	duration time.Duration
+	// hashes counts the hashes of every miner by id
+	hashes map[uint32]*uint64
+}
+
+// NewBenchmark returns a Benchmark that measures every algorithm for
+// duration. It listens to the hashrate of the miners of columns, so call it
+// before starting them
+func NewBenchmark(columns []BenchmarkColumn, profiles map[string]AlgoProfile, duration time.Duration) *Benchmark {
+	b := &Benchmark{
+		columns,
+		profiles,
+		duration,
+		make(map[uint32]*uint64),
+	}
+	for _, column := range columns {
+		for _, m := range column.Miners {
+			count := new(uint64)
+			b.hashes[m.Id()] = count
+			hrChan := make(chan *HashRate, 16)
+			m.RegisterHashrateListener(hrChan)
+			go func() {
+				for hr := range hrChan {
+					atomic.AddUint64(count, uint64(hr.Hashes))
+				}
+			}()
+		}
+	}
+	return b
+}
+
+// snapshot returns the number of hashes of every miner so far
+func (b *Benchmark) snapshot() map[uint32]uint64 {
+	ret := make(map[uint32]uint64, len(b.hashes))
+	for id, count := range b.hashes {
+		ret[id] = atomic.LoadUint64(count)
+	}
+	return ret
+}
+
+// waitForHashes waits until all miners have reported hashes since start, or
+// until timeout. It returns false on timeout
+func (b *Benchmark) waitForHashes(miners []Interface, start map[uint32]uint64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		started := true
+		for _, m := range miners {
+			if atomic.LoadUint64(b.hashes[m.Id()]) == start[m.Id()] {
+				started = false
+				break
+			}
+		}
+		if started {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Run measures the hashrate of the columns with each of algos, which are
+// given the way NormalizeAlgorithm names them or by an alias. The miners
+// have to be running. Columns that can't hash an algorithm are paused while
+// it is measured
+func (b *Benchmark) Run(algos []string) []BenchmarkResult {
+	results := make([]BenchmarkResult, 0, len(algos))
+	for _, algo := range algos {
+		algo = NormalizeAlgorithm(algo)
+		result := BenchmarkResult{algo, make(map[string]float64)}
+		measured := make([]BenchmarkColumn, 0, len(b.columns))
+		miners := make([]Interface, 0)
+		for _, column := range b.columns {
+			if column.CanHash(algo) {
+				measured = append(measured, column)
+				miners = append(miners, column.Miners...)
+			}
+		}
+		if len(measured) == 0 {
+			log.Infof("benchmark: Skipping %v, which none of the miners implement", algo)
+			results = append(results, result)
+			continue
+		}
+
+		for _, column := range b.columns {
+			canHash := column.CanHash(algo)
+			for _, m := range column.Miners {
+				if p, ok := m.(Pausable); ok {
+					if canHash {
+						p.Resume()
+					} else {
+						p.Pause()
+					}
+				}
+			}
+			if canHash {
+				NewAlgoSwitcher(b.profiles, column.Miners).Switch(algo)
+			}
+		}
+
+		log.Infof("benchmark: Measuring %v for %v", algo, b.duration)
+		if !b.waitForHashes(miners, b.snapshot(), BenchmarkStartTimeout) {
+			log.Warnf("benchmark: Not all miners started hashing %v within %v", algo, BenchmarkStartTimeout)
+		}
+		time.Sleep(BenchmarkWarmup)
+
+		before := b.snapshot()
+		start := time.Now()
+		time.Sleep(b.duration)
+		after := b.snapshot()
+		elapsed := time.Since(start).Seconds()
+		for _, column := range measured {
+			hashes := uint64(0)
+			for _, m := range column.Miners {
+				hashes += after[m.Id()] - before[m.Id()]
+			}
+			result.HashRates[column.Name] = float64(hashes) / elapsed
+			log.Infof("benchmark: %v %v: %.1f H/s", algo, column.Name, result.HashRates[column.Name])
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// WriteBenchmarkTable writes results as a table of the hashrate of every
+// column with every algorithm, and of all columns together. Columns that
+// can't hash an algorithm are shown as -
+func WriteBenchmarkTable(w io.Writer, columns []string, results []BenchmarkResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Algorithm\t")
+	for _, name := range columns {
+		fmt.Fprintf(tw, "%v H/s\t", name)
+	}
+	fmt.Fprintf(tw, "Total H/s\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v\t", r.Algorithm)
+		total := 0.0
+		for _, name := range columns {
+			rate, ok := r.HashRates[name]
+			if !ok {
+				fmt.Fprintf(tw, "-\t")
+				continue
+			}
+			total += rate
+			fmt.Fprintf(tw, "%.1f\t", rate)
+		}
+		if len(r.HashRates) == 0 {
+			fmt.Fprintf(tw, "-\t\n")
+		} else {
+			fmt.Fprintf(tw, "%.1f\t\n", total)
+		}
+	}
+	tw.Flush()
+}
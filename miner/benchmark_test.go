@@ -0,0 +1,95 @@
+package miner
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkedMiner reports a batch of hashes every millisecond, whose size
+// is the length of the name of its algorithm
+type benchmarkedMiner struct {
+	*Miner
+	provider WorkProvider
+	jobs     int32
+}
+
+func (m *benchmarkedMiner) Run() error {
+	workChan := make(chan *stratum.Work)
+	m.provider.RegisterWorkListener(workChan)
+	<-workChan
+	atomic.AddInt32(&m.jobs, 1)
+	for {
+		m.InformHashrate(uint32(len(m.Algorithm())))
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBenchmarkSource(t *testing.T) {
+	require := require.New(t)
+
+	source := NewBenchmarkSource()
+	workChan := make(chan *stratum.Work)
+	source.RegisterWorkListener(workChan)
+	job := <-workChan
+	require.Equal(len(benchmarkBlob)/2, job.Size)
+	require.Equal(uint64(1), job.Target)
+	height, ok := JobHeight(job.JobID)
+	require.True(ok)
+	require.Equal(uint64(benchmarkHeight), height)
+	seed, ok := JobSeed(job.JobID)
+	require.True(ok)
+	require.Equal(benchmarkSeed, seed)
+	require.Nil(source.SubmitWork(job, "00"))
+}
+
+func TestBenchmark(t *testing.T) {
+	require := require.New(t)
+
+	warmup := BenchmarkWarmup
+	BenchmarkWarmup = 10 * time.Millisecond
+	defer func() {
+		BenchmarkWarmup = warmup
+	}()
+
+	source := NewBenchmarkSource()
+	cpu := &benchmarkedMiner{New(NextMinerID()), source, 0}
+	gpu := &benchmarkedMiner{New(NextMinerID()), source, 0}
+	columns := []BenchmarkColumn{
+		{"CPU", []Interface{cpu}, func(algo string) bool { return true }},
+		{"GPU #0", []Interface{gpu}, func(algo string) bool { return strings.HasPrefix(algo, "cn") }},
+	}
+	b := NewBenchmark(columns, nil, 200*time.Millisecond)
+	StartMiners([]Interface{cpu, gpu}, 0)
+
+	results := b.Run([]string{"cryptonight_v8", "chukwa", "cn-pico"})
+	require.Equal(3, len(results))
+	require.Equal("cn/2", results[0].Algorithm)
+	require.Equal(2, len(results[0].HashRates))
+	require.True(results[0].HashRates["CPU"] > 0)
+	require.True(results[0].HashRates["GPU #0"] > 0)
+	// The GPU can't hash chukwa, so it is paused and left out
+	require.Equal("argon2/chukwa", results[1].Algorithm)
+	require.Equal(1, len(results[1].HashRates))
+	require.True(results[1].HashRates["CPU"] > 0)
+	// and resumed for the next algorithm
+	require.Equal(2, len(results[2].HashRates))
+	require.False(gpu.Paused())
+	require.Equal("cn-pico/trtl", gpu.Algorithm())
+	require.Equal(int32(1), atomic.LoadInt32(&gpu.jobs))
+
+	buf := bytes.Buffer{}
+	WriteBenchmarkTable(&buf, []string{"CPU", "GPU #0"}, append(results, BenchmarkResult{"rx/0", map[string]float64{}}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(5, len(lines))
+	require.Contains(lines[0], "GPU #0 H/s")
+	require.Contains(lines[0], "Total H/s")
+	require.True(strings.HasPrefix(strings.TrimSpace(lines[2]), "argon2/chukwa"))
+	require.Contains(lines[2], " - ")
+	require.Equal([]string{"rx/0", "-", "-", "-"}, strings.Fields(lines[4]))
+}
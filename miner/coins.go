@@ -0,0 +1,81 @@
+package miner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// coinAlgorithms maps the coins that pools can be configured with to the
+// algorithm they are mined with
+var coinAlgorithms = map[string]string{
+	"monero":      "rx/0",
+	"electroneum": "cn/0",
+	"bytecoin":    "cn/0",
+	"masari":      "cn/half",
+	"stellite":    "cn/half",
+	"aeon":        "cn-lite/0",
+	"turtlecoin":  "argon2/chukwav2",
+	"sumokoin":    "cn-heavy/0",
+	"haven":       "cn-heavy/0",
+	"ryo":         "cn/gpu",
+	"dero":        "astrobwt",
+}
+
+// coinAliases maps tickers onto the coin names in coinAlgorithms
+var coinAliases = map[string]string{
+	"xmr":  "monero",
+	"etn":  "electroneum",
+	"bcn":  "bytecoin",
+	"msr":  "masari",
+	"xtl":  "stellite",
+	"trtl": "turtlecoin",
+	"sumo": "sumokoin",
+	"xhv":  "haven",
+}
+
+// SupportedCoins returns the sorted names of the coins with a known algorithm
+func SupportedCoins() []string {
+	coins := make([]string, 0, len(coinAlgorithms))
+	for coin := range coinAlgorithms {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+	return coins
+}
+
+// CoinAlgorithm returns the algorithm that coin is mined with. The coin can
+// be given by name or ticker
+func CoinAlgorithm(coin string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(coin))
+	if alias, ok := coinAliases[name]; ok {
+		name = alias
+	}
+	algo, ok := coinAlgorithms[name]
+	if !ok {
+		return "", fmt.Errorf("Unknown coin '%v', supported coins are: %v", coin, strings.Join(SupportedCoins(), ", "))
+	}
+	return algo, nil
+}
+
+// ApplyCoin sets the algorithm to the one of the first pool with a coin if
+// no algorithm was configured. Every coin has to be known
+func (c *Config) ApplyCoin() error {
+	algo := ""
+	for _, pool := range c.Pools {
+		if pool.Coin == nil || len(*pool.Coin) == 0 {
+			continue
+		}
+		coinAlgo, err := CoinAlgorithm(*pool.Coin)
+		if err != nil {
+			return fmt.Errorf("Pool %v: %v", pool.Url, err)
+		}
+		if len(algo) == 0 {
+			algo = coinAlgo
+		}
+	}
+	if len(c.Algorithm) == 0 {
+		c.Algorithm = algo
+	}
+	return nil
+}
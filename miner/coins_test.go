@@ -0,0 +1,67 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	algo, err := CoinAlgorithm("monero")
+	require.Nil(err)
+	require.Equal("rx/0", algo)
+
+	algo, err = CoinAlgorithm(" AEON ")
+	require.Nil(err)
+	require.Equal("cn-lite/0", algo)
+	require.Equal(1024*1024, ScratchpadSize(algo))
+
+	algo, err = CoinAlgorithm("trtl")
+	require.Nil(err)
+	require.Equal("argon2/chukwav2", algo)
+
+	algo, err = CoinAlgorithm("msr")
+	require.Nil(err)
+	require.Equal("cn/half", algo)
+
+	algo, err = CoinAlgorithm("RYO")
+	require.Nil(err)
+	require.Equal("cn/gpu", algo)
+
+	algo, err = CoinAlgorithm("dero")
+	require.Nil(err)
+	require.Equal("astrobwt", algo)
+
+	algo, err = CoinAlgorithm("xhv")
+	require.Nil(err)
+	require.Equal("cn-heavy/0", algo)
+
+	_, err = CoinAlgorithm("dogecoin")
+	require.NotNil(err)
+	require.Contains(err.Error(), "dogecoin")
+	for _, coin := range SupportedCoins() {
+		require.Contains(err.Error(), coin)
+	}
+}
+
+func TestParseConfigCoin(t *testing.T) {
+	require := require.New(t)
+
+	var config Config
+	_, err := ParseConfig([]byte(`{"pools": [{"url": "pool:3333"}, {"url": "pool:5555", "coin": "aeon"}]}`), &config)
+	require.Nil(err)
+	require.Equal("cn-lite/0", config.Algorithm)
+
+	// An explicit algorithm wins
+	config = Config{}
+	_, err = ParseConfig([]byte(`{"algo": "cn/0", "pools": [{"url": "pool:5555", "coin": "aeon"}]}`), &config)
+	require.Nil(err)
+	require.Equal("cn/0", config.Algorithm)
+
+	config = Config{}
+	_, err = ParseConfig([]byte(`{"pools": [{"url": "pool:5555", "coin": "dogecoin"}]}`), &config)
+	require.NotNil(err)
+	require.Contains(err.Error(), "monero")
+}
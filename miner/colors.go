@@ -0,0 +1,50 @@
+package miner
+
+import (
+	"os"
+	"runtime"
+
+	colorable "github.com/mattn/go-colorable"
+	log "github.com/sirupsen/logrus"
+)
+
+// colorsEnabled is false if messages that carry their own color codes, like
+// the hashrate, should have them stripped
+var colorsEnabled = true
+
+// StripColors removes ANSI color codes from s
+func StripColors(s string) string {
+	return ansiEscapeRegex.ReplaceAllString(s, "")
+}
+
+// isTerminal returns true if f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetupColors sets up colored console output. A nil colors detects whether
+// stdout is a terminal, while true and false force colors on or off
+func SetupColors(colors *bool) {
+	enabled := false
+	if colors != nil {
+		enabled = *colors
+	} else {
+		// Windows consoles get colors through go-colorable
+		enabled = runtime.GOOS == "windows" || isTerminal(os.Stdout)
+	}
+	colorsEnabled = enabled
+
+	if enabled {
+		log.SetFormatter(&log.TextFormatter{ForceColors: true})
+		if runtime.GOOS == "windows" {
+			log.SetOutput(colorable.NewColorableStdout())
+		}
+	} else {
+		log.SetFormatter(&log.TextFormatter{DisableColors: true})
+		log.SetOutput(os.Stdout)
+	}
+}
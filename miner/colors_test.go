@@ -0,0 +1,14 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripColors(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("speed 15s/60s/15m  n/a H/s", StripColors("\x1B[01;37mspeed\x1B[0m 15s/60s/15m \x1B[01;36m n/a\x1B[0m H/s"))
+	require.Equal("plain", StripColors("plain"))
+}
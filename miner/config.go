@@ -1,5 +1,23 @@
 package miner
 
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultWorkSize is the worksize of GPU threads that don't set one
+var DefaultWorkSize = 8
+
+// DefaultIntensity is the intensity of GPU threads running cn/0 that don't
+// set one. It is scaled by the scratchpad size of other algorithms, so that
+// the smaller scratchpads of cryptonight-lite and -pico run more threads
+var DefaultIntensity = 1024
+
+// DefaultMaxPendingResults is the number of GPU results waiting to be
+// checked above which the GPUs are throttled
+var DefaultMaxPendingResults = 64
+
 // Config structure representing config JSON file
 // Add any relevant fields here
 // Config structure representing config JSON file
@@ -7,7 +25,7 @@ package miner
 type Config struct {
 	Algorithm         string      `json:"algo" yaml:"algo"`
 	Background        bool        `json:"background" yaml:"background"`
-	Colors            bool        `json:"colors" yaml:"colors"`
+	Colors            *bool       `json:"colors" yaml:"colors"`
 	DonateLevel       float64     `json:"donate-level" yaml:"donate-level"`
 	LogFile           *string     `json:"log-file" yaml:"log-file"`
 	PrintTime         int         `json:"print-time" yaml:"print-time"`
@@ -24,15 +42,146 @@ type Config struct {
 	User  string `json:"user" yaml:"user"`
 	Pass  string `json:"pass" yaml:"pass"`
 	Proxy string `json:"proxy" yaml:"proxy"`
+	// GPU compute error recovery. A limit of 0 disables recovery
+	ComputeErrorLimit         int `json:"compute-error-limit" yaml:"compute-error-limit"`
+	ComputeErrorIntensityStep int `json:"compute-error-intensity-step" yaml:"compute-error-intensity-step"`
+	// Aggregate hashrate limit in H/s, split evenly across all threads.
+	// 0 means unlimited
+	MaxHashRate float64 `json:"max-hashrate" yaml:"max-hashrate"`
+	// Log file settings. Sizes are in MB and only apply if LogFile is set
+	LogToStdout    bool `json:"log-stdout" yaml:"log-stdout"`
+	LogFileMaxSize int  `json:"log-file-max-size" yaml:"log-file-max-size"`
+	LogFileBackups int  `json:"log-file-backups" yaml:"log-file-backups"`
+	// Compress rotated log files with gzip
+	LogFileCompress bool `json:"log-file-compress" yaml:"log-file-compress"`
+	// File to write the process id to. Useful along with Background
+	PIDFile string `json:"pid-file" yaml:"pid-file"`
+	// Algorithm run by the CPU threads. Defaults to Algorithm
+	CPUAlgorithm string `json:"cpu-algo" yaml:"cpu-algo"`
+	// RandomX mode of each CPU thread, full or light. Threads past the end
+	// of the list use its last entry, and all threads use full mode if it
+	// is empty
+	CPURandomXModes []string `json:"cpu-rx-modes" yaml:"cpu-rx-modes"`
+	// Restart miners that report no hashes for this many seconds.
+	// 0 disables the watchdog
+	WatchdogTimeout int `json:"watchdog-timeout" yaml:"watchdog-timeout"`
+	// Per-algorithm overrides applied when the pool switches algorithms,
+	// keyed by algorithm name
+	AlgoPerf map[string]AlgoProfile `json:"algo-perf" yaml:"algo-perf"`
+	// Suppress the periodic hashrate lines
+	Quiet bool `json:"quiet" yaml:"quiet"`
+	// Local IP address or network interface that pool connections are
+	// made from
+	BindAddress string `json:"bind-address" yaml:"bind-address"`
+	// Pause the miners while the machine is in use and resume them after
+	// IdleThreshold seconds without user input
+	PauseWhenActive bool `json:"pause-when-active" yaml:"pause-when-active"`
+	IdleThreshold   int  `json:"idle-threshold" yaml:"idle-threshold"`
+	// Agent reported to the pool instead of the miner's own
+	UserAgent string `json:"user-agent" yaml:"user-agent"`
+	// Total scratchpad memory in MB that CPU threads may use. The number of
+	// threads is reduced to fit. 0 means unlimited
+	MaxMemory int `json:"max-memory" yaml:"max-memory"`
+	// Address the status and control API listens on, e.g. 127.0.0.1:8080.
+	// The API is disabled if empty
+	APIAddress string `json:"api-bind" yaml:"api-bind"`
+	// Fail over to the next pool when more than this fraction of the shares
+	// submitted over RejectWindow seconds is rejected, and come back to the
+	// first pool after FailbackCooldown seconds. 0 disables failover
+	RejectThreshold  float64 `json:"reject-threshold" yaml:"reject-threshold"`
+	RejectWindow     int     `json:"reject-window" yaml:"reject-window"`
+	FailbackCooldown int     `json:"failback-cooldown" yaml:"failback-cooldown"`
+	// Address to serve net/http/pprof profiles on. Disabled if empty
+	PprofAddress string `json:"pprof-listen" yaml:"pprof-listen"`
+	// Mine only the nonces [NonceOffset, NonceOffset+NonceStride) so that
+	// rigs given offsets that are NonceStride apart never duplicate work.
+	// NonceStride 0 means up to the end of the nonce space
+	NonceOffset uint64 `json:"nonce-offset" yaml:"nonce-offset"`
+	NonceStride uint64 `json:"nonce-stride" yaml:"nonce-stride"`
+	// Keep the next pool connected and logged in, so that switching to it
+	// when the current pool fails or is failed over from is instantaneous
+	Standby bool `json:"standby" yaml:"standby"`
+	// Stop launching GPU kernels while this many results are waiting to be
+	// checked on the CPU. A negative value disables throttling
+	MaxPendingResults int `json:"max-pending-results" yaml:"max-pending-results"`
+	// When the connection to the pool drops, reconnect and resume the
+	// session within this many milliseconds while the miners keep hashing
+	// the current job. A negative value disables resuming
+	ResumeWindow int `json:"resume-window" yaml:"resume-window"`
+	// Log the hashrate every this many hashrate samples instead of every
+	// 30 seconds, for short runs. 0 logs by time
+	PrintSamples int `json:"print-samples" yaml:"print-samples"`
+	// Tag every share with this worker name, so that pools that support it
+	// show per-thread stats for a single login. {id} is replaced with the id
+	// of the miner that found the share. GPU threads can set their own
+	WorkerTag string `json:"worker-tag" yaml:"worker-tag"`
+	// Unit that the hashrate is logged in: H/s, kH/s, MH/s or auto. Empty
+	// logs H/s
+	HashRateUnit string `json:"hashrate-unit" yaml:"hashrate-unit"`
+	// Seconds that connecting to the pool, waiting for a message from it and
+	// sending a message to it may take before the connection is dropped and
+	// made again. A negative value disables the respective timeout
+	DialTimeout  int `json:"dial-timeout" yaml:"dial-timeout"`
+	ReadTimeout  int `json:"read-timeout" yaml:"read-timeout"`
+	WriteTimeout int `json:"write-timeout" yaml:"write-timeout"`
+	// Warn with a diagnosis if the pool hasn't accepted a share this many
+	// seconds after connecting. The timeout is extended when the hashrate
+	// is too low to find a share in time. 0 disables the check
+	FirstShareTimeout int `json:"first-share-timeout" yaml:"first-share-timeout"`
+	// Append a JSON record of every share the pool answered to this file
+	ShareLog string `json:"share-log" yaml:"share-log"`
+	// Withhold shares below this difficulty instead of submitting them.
+	// 0 submits every share that meets the pool target
+	MinShareDifficulty uint64 `json:"min-share-difficulty" yaml:"min-share-difficulty"`
+	// Milliseconds to wait between starting one miner thread and the next
+	ThreadStagger int `json:"thread-stagger" yaml:"thread-stagger"`
+	// Read the power draw of the GPUs and CPUs, where possible, and report
+	// the efficiency in H/s per watt
+	ReportPower bool `json:"report-power" yaml:"report-power"`
+	// Seconds to wait on shutdown for shares already found to be submitted
+	// and answered. A negative value exits right away
+	ShutdownGrace int `json:"shutdown-grace" yaml:"shutdown-grace"`
+	// Share log rotation. The size is in MB and rotated share logs are
+	// compressed with gzip if ShareLogCompress is set
+	ShareLogMaxSize  int  `json:"share-log-max-size" yaml:"share-log-max-size"`
+	ShareLogBackups  int  `json:"share-log-backups" yaml:"share-log-backups"`
+	ShareLogCompress bool `json:"share-log-compress" yaml:"share-log-compress"`
+}
+
+// AlgoProfile structure representing the thread settings for an algorithm.
+// Zero values keep the current setting, except that an intensity of 0 is
+// scaled by the scratchpad size of the algorithm
+type AlgoProfile struct {
+	Intensity int `json:"intensity" yaml:"intensity"`
+	BatchSize int `json:"batch_size" yaml:"batch_size"`
 }
 
 // GPUThread structure representing a GPU thread
 type GPUThread struct {
 	Index       int  `json:"index" yaml:"index"`
 	DeviceIndex *int `json:"device_index" yaml:"device_index"`
+	// Defaults to DefaultIntensity scaled to the algorithm of the thread
 	Intensity   int  `json:"intensity" yaml:"intensity"`
 	WorkSize    int  `json:"worksize" yaml:"worksize"`
 	AffineToCPU bool `json:"affine_to_cpu" yaml:"affine_to_cpu"`
+	// Maximum number of threads per kernel launch. 0 means intensity
+	BatchSize int `json:"batch_size" yaml:"batch_size"`
+	// Start at this fraction of the intensity after (re)initialization and
+	// ramp up to the full intensity over WarmupSeconds. 0 disables warmup
+	WarmupFraction float64 `json:"warmup_fraction" yaml:"warmup_fraction"`
+	WarmupSeconds  int     `json:"warmup_seconds" yaml:"warmup_seconds"`
+	// Algorithm run by this thread. Defaults to the global algo
+	Algorithm string `json:"algo" yaml:"algo"`
+	// Read results back through pinned host memory
+	PinnedResults bool `json:"pinned_results" yaml:"pinned_results"`
+	// Number of output buffers that kernel launches alternate between.
+	// 2 or more overlaps result processing with compute
+	BufferSets int `json:"buffer_sets" yaml:"buffer_sets"`
+	// Check whether the GPU is done every this many microseconds instead of
+	// blocking in the driver, which busy-waits on some platforms. 0 blocks
+	PollInterval int `json:"poll_interval_us" yaml:"poll_interval_us"`
+	// Worker tag of the shares of this thread. Defaults to the global one
+	WorkerTag string `json:"worker_tag" yaml:"worker_tag"`
 }
 
 // Pool structure representing a pool
@@ -46,4 +195,147 @@ type Pool struct {
 	PoolName   *string `json:"pool_name" yaml:"pool_name"`
 	WalletName *string `json:"wallet_name" yaml:"wallet_name"`
 	Label      *string `json:"label" yaml:"label"`
+	// Path to a file whose user, pass and wallet_name override the ones above
+	CredentialsFile string `json:"credentials_file" yaml:"credentials_file"`
+	// Mine solo against a monerod-style daemon at Url instead of a pool.
+	// User is the wallet address that blocks are paid out to
+	Daemon bool `json:"daemon" yaml:"daemon"`
+	// Client certificate and key presented to pools that require mutual
+	// TLS, and the CA bundle that the certificate of the pool is verified
+	// against instead of the system roots. Only used with stratum+ssl:// urls
+	TLSCert string `json:"tls_cert" yaml:"tls_cert"`
+	TLSKey  string `json:"tls_key" yaml:"tls_key"`
+	TLSCA   string `json:"tls_ca" yaml:"tls_ca"`
+}
+
+// ApplyDefaults fills in the documented defaults of settings that were
+// omitted from the config
+func (c *Config) ApplyDefaults() {
+	if len(c.Algorithm) == 0 {
+		c.Algorithm = DefaultAlgorithm
+	}
+	if c.LogFileMaxSize == 0 {
+		c.LogFileMaxSize = DefaultLogFileMaxSize
+	}
+	if c.LogFileBackups == 0 {
+		c.LogFileBackups = DefaultLogFileBackups
+	}
+	if c.IdleThreshold == 0 {
+		c.IdleThreshold = DefaultIdleThreshold
+	}
+	if c.RejectWindow == 0 {
+		c.RejectWindow = DefaultRejectWindow
+	}
+	if c.FailbackCooldown == 0 {
+		c.FailbackCooldown = DefaultFailbackCooldown
+	}
+	if c.MaxPendingResults == 0 {
+		c.MaxPendingResults = DefaultMaxPendingResults
+	}
+	if c.ResumeWindow == 0 {
+		c.ResumeWindow = DefaultResumeWindow
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = DefaultDialTimeout
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = DefaultReadTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = DefaultWriteTimeout
+	}
+	if c.ShareLogMaxSize == 0 {
+		c.ShareLogMaxSize = DefaultShareLogMaxSize
+	}
+	if c.ShareLogBackups == 0 {
+		c.ShareLogBackups = DefaultShareLogBackups
+	}
+	if c.ShutdownGrace == 0 {
+		c.ShutdownGrace = DefaultShutdownGrace
+	}
+	for i := range c.Threads {
+		if c.Threads[i].WorkSize == 0 {
+			c.Threads[i].WorkSize = DefaultWorkSize
+		}
+		if c.Threads[i].Intensity == 0 {
+			algo := c.Threads[i].Algorithm
+			if len(algo) == 0 {
+				algo = c.Algorithm
+			}
+			c.Threads[i].Intensity = ScaleIntensity(DefaultIntensity, c.Threads[i].WorkSize, DefaultAlgorithm, algo)
+		}
+	}
+}
+
+// ApplyNonceShard makes the miners mine the nonce shard set by NonceOffset
+// and NonceStride. The shard has to fit in the nonces left by nicehash if
+// any of the pools is a nicehash pool
+func (c *Config) ApplyNonceShard() error {
+	nicehash := false
+	for _, pool := range c.Pools {
+		nicehash = nicehash || pool.Nicehash
+	}
+	return SetNonceShard(NonceShard{c.NonceOffset, c.NonceStride}, nicehash)
+}
+
+// CheckMinerSections checks the config against the kinds of miners that the
+// binary runs. Settings for miners that it doesn't run are returned as
+// warnings, since they are ignored. A config that leaves the binary with
+// nothing to mine is an error
+func (c *Config) CheckMinerSections(cpu, gpu bool) ([]string, error) {
+	var warnings []string
+	if !gpu {
+		if len(c.Threads) != 0 {
+			warnings = append(warnings, "threads configures GPU threads, which are only run by the GPU miner. Ignoring them, use cpu_threads to set the number of CPU threads")
+		}
+		if len(c.DeviceInstanceIDs) != 0 {
+			warnings = append(warnings, "device_instance_ids is only used by the GPU miner, ignoring it")
+		}
+	}
+	if !cpu {
+		if c.CPUThreads != 0 {
+			warnings = append(warnings, "cpu_threads is only used by the CPU miner, ignoring it")
+		}
+		if len(c.CPUAlgorithm) != 0 {
+			warnings = append(warnings, "cpu-algo is only used by the CPU miner, ignoring it")
+		}
+		if c.MaxMemory != 0 {
+			warnings = append(warnings, "max-memory is only used by the CPU miner, ignoring it")
+		}
+		if len(c.CPURandomXModes) != 0 {
+			warnings = append(warnings, "cpu-rx-modes is only used by the CPU miner, ignoring it")
+		}
+	}
+	if gpu && !cpu && len(c.Threads) == 0 {
+		return warnings, fmt.Errorf("Config has no GPU threads, add at least one to threads")
+	}
+	if gpu && cpu && len(c.Threads) == 0 && c.CPUThreads == 0 {
+		return warnings, fmt.Errorf("Config has neither GPU threads nor cpu_threads, set at least one of them")
+	}
+	return warnings, nil
+}
+
+// ParseConfig parses a YAML config into config and applies defaults.
+// Unknown keys, which are usually typos, don't stop the config from being
+// parsed and are returned as warnings instead
+func ParseConfig(data []byte, config *Config) ([]string, error) {
+	var warnings []string
+	if err := yaml.UnmarshalStrict(data, &Config{}); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		warnings = typeErr.Errors
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return warnings, err
+	}
+	if err := config.ApplyCoin(); err != nil {
+		return warnings, err
+	}
+	if err := config.checkRandomXModes(); err != nil {
+		return warnings, err
+	}
+	config.ApplyDefaults()
+	return warnings, nil
 }
@@ -0,0 +1,105 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	require := require.New(t)
+
+	data := []byte(`{"threads": [{"index": 0, "intensity": 1024}], "pools": [{"url": "pool:3333", "user": "wallet"}]}`)
+	var config Config
+	warnings, err := ParseConfig(data, &config)
+	require.Nil(err)
+	require.Equal(0, len(warnings))
+	require.Equal(1024, config.Threads[0].Intensity)
+	require.Equal("pool:3333", config.Pools[0].Url)
+
+	// Defaults
+	require.Equal(DefaultAlgorithm, config.Algorithm)
+	require.Equal(DefaultWorkSize, config.Threads[0].WorkSize)
+	require.Equal(DefaultLogFileMaxSize, config.LogFileMaxSize)
+	require.Equal(DefaultLogFileBackups, config.LogFileBackups)
+	require.Equal(DefaultMaxPendingResults, config.MaxPendingResults)
+	require.Equal(DefaultResumeWindow, config.ResumeWindow)
+	require.Equal(DefaultReadTimeout, config.ReadTimeout)
+}
+
+func TestParseConfigUnknownKeys(t *testing.T) {
+	require := require.New(t)
+
+	data := []byte(`{"threads": [{"index": 0, "intensty": 1024, "worksize": 16}], "algo": "cn/0"}`)
+	var config Config
+	warnings, err := ParseConfig(data, &config)
+	require.Nil(err)
+	require.NotZero(len(warnings))
+	require.Contains(warnings[0], "intensty")
+
+	// The rest of the config is still parsed
+	require.Equal(16, config.Threads[0].WorkSize)
+	require.Equal(DefaultIntensity, config.Threads[0].Intensity)
+}
+
+func TestParseConfigDefaultIntensity(t *testing.T) {
+	require := require.New(t)
+
+	data := []byte(`{"algo": "cn-heavy/0", "threads": [{"index": 0}, {"index": 1, "algo": "cn-pico/trtl"}, {"index": 2, "intensity": 640}]}`)
+	var config Config
+	_, err := ParseConfig(data, &config)
+	require.Nil(err)
+
+	// Scaled by the scratchpad of the algorithm of each thread
+	require.Equal(DefaultIntensity/2, config.Threads[0].Intensity)
+	require.Equal(DefaultIntensity*8, config.Threads[1].Intensity)
+	require.Equal(640, config.Threads[2].Intensity)
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	require := require.New(t)
+
+	var config Config
+	_, err := ParseConfig([]byte(`{"threads": "none"}`), &config)
+	require.NotNil(err)
+}
+
+func TestCheckMinerSections(t *testing.T) {
+	require := require.New(t)
+
+	data := []byte(`{"cpu_threads": 4, "threads": [{"index": 0, "intensity": 1024}], "pools": [{"url": "pool:3333"}]}`)
+	var config Config
+	_, err := ParseConfig(data, &config)
+	require.Nil(err)
+
+	// The CPU miner ignores the GPU threads
+	warnings, err := config.CheckMinerSections(true, false)
+	require.Nil(err)
+	require.Equal(1, len(warnings))
+	require.Contains(warnings[0], "threads")
+
+	// The GPU miner ignores the CPU threads
+	warnings, err = config.CheckMinerSections(false, true)
+	require.Nil(err)
+	require.Equal(1, len(warnings))
+	require.Contains(warnings[0], "cpu_threads")
+
+	// A binary running both uses everything
+	warnings, err = config.CheckMinerSections(true, true)
+	require.Nil(err)
+	require.Equal(0, len(warnings))
+
+	// A GPU miner without GPU threads has nothing to do
+	config.Threads = nil
+	_, err = config.CheckMinerSections(false, true)
+	require.NotNil(err)
+	_, err = config.CheckMinerSections(true, false)
+	require.Nil(err)
+
+	// A binary running both needs at least one of them
+	_, err = config.CheckMinerSections(true, true)
+	require.Nil(err)
+	config.CPUThreads = 0
+	_, err = config.CheckMinerSections(true, true)
+	require.NotNil(err)
+}
@@ -0,0 +1,62 @@
+package miner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Credentials holds the secrets of a pool that may be kept in a separate
+// file from the rest of the config
+type Credentials struct {
+	User       *string `json:"user" yaml:"user"`
+	Pass       *string `json:"pass" yaml:"pass"`
+	WalletName *string `json:"wallet_name" yaml:"wallet_name"`
+}
+
+// ReadCredentials parses the credentials file at path
+func ReadCredentials(path string) (*Credentials, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		log.Warnf("Credentials file '%v' is accessible by other users (mode %v)", path, info.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials Credentials
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("Failed to parse credentials file '%v': %v", path, err)
+	}
+	return &credentials, nil
+}
+
+// LoadCredentials overrides the inline credentials of every pool that
+// references a credentials file with the ones found in that file
+func (c *Config) LoadCredentials() error {
+	for idx := range c.Pools {
+		pool := &c.Pools[idx]
+		if len(pool.CredentialsFile) == 0 {
+			continue
+		}
+		credentials, err := ReadCredentials(pool.CredentialsFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load credentials of pool %v: %v", pool.Url, err)
+		}
+		if credentials.User != nil {
+			pool.User = *credentials.User
+		}
+		if credentials.Pass != nil {
+			pool.Pass = *credentials.Pass
+		}
+		if credentials.WalletName != nil {
+			pool.WalletName = credentials.WalletName
+		}
+	}
+	return nil
+}
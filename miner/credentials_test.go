@@ -0,0 +1,39 @@
+package miner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "credentials")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets.yaml")
+	require.Nil(ioutil.WriteFile(path, []byte(`{"user": "wallet", "wallet_name": "main"}`), 0600))
+
+	config := Config{}
+	config.Pools = []Pool{
+		{Url: "pool-a:3333", User: "inline", Pass: "x", CredentialsFile: path},
+		{Url: "pool-b:3333", User: "other", Pass: "y"},
+	}
+	require.Nil(config.LoadCredentials())
+
+	require.Equal("wallet", config.Pools[0].User)
+	// Pass is not in the credentials file and must be left alone
+	require.Equal("x", config.Pools[0].Pass)
+	require.Equal("main", *config.Pools[0].WalletName)
+
+	require.Equal("other", config.Pools[1].User)
+	require.Equal("y", config.Pools[1].Pass)
+
+	config.Pools[1].CredentialsFile = filepath.Join(dir, "missing.yaml")
+	require.NotNil(config.LoadCredentials())
+}
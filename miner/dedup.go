@@ -0,0 +1,83 @@
+package miner
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSubmitJobs is the number of jobs whose submitted nonces are remembered
+var maxSubmitJobs = 16
+
+// SubmitCache remembers the nonces submitted for recent jobs so that the same
+// share is never submitted twice. Pools reject duplicate shares, and finding
+// one points at a bug in nonce or job handling
+type SubmitCache struct {
+	sync.Mutex
+	maxJobs    int
+	nonces     map[string]map[uint32]bool
+	order      []string
+	duplicates uint64
+}
+
+// NewSubmitCache returns a SubmitCache that remembers the nonces of the
+// last maxJobs jobs
+func NewSubmitCache(maxJobs int) *SubmitCache {
+	return &SubmitCache{
+		maxJobs: maxJobs,
+		nonces:  make(map[string]map[uint32]bool),
+	}
+}
+
+// Add records the submission of nonce for a job. It returns false if the
+// nonce was already submitted for that job
+func (c *SubmitCache) Add(jobID string, nonce uint32) bool {
+	c.Lock()
+	defer c.Unlock()
+	nonces, ok := c.nonces[jobID]
+	if !ok {
+		nonces = make(map[uint32]bool)
+		c.nonces[jobID] = nonces
+		c.order = append(c.order, jobID)
+		for len(c.order) > c.maxJobs {
+			delete(c.nonces, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	if nonces[nonce] {
+		c.duplicates++
+		return false
+	}
+	nonces[nonce] = true
+	return true
+}
+
+// Duplicates returns the number of duplicate submissions that were caught
+func (c *SubmitCache) Duplicates() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.duplicates
+}
+
+// ResetDuplicates zeroes the duplicate count. Submitted nonces are still
+// remembered
+func (c *SubmitCache) ResetDuplicates() {
+	c.Lock()
+	defer c.Unlock()
+	c.duplicates = 0
+}
+
+// DefaultSubmitCache remembers the shares submitted by all miners
+var DefaultSubmitCache = NewSubmitCache(maxSubmitJobs)
+
+// IsDuplicateShare records a share that is about to be submitted and returns
+// true if it was already submitted, in which case it should be dropped.
+// Shares that are submitted are tagged with the worker tag of the miner
+func IsDuplicateShare(minerID uint32, jobID string, nonce uint32) bool {
+	if DefaultSubmitCache.Add(jobID, nonce) {
+		DefaultWorkerTags.Record(minerID, jobID, nonce)
+		return false
+	}
+	log.Warnf("miner-%d: Dropping duplicate share for job %v nonce %08x", minerID, jobID, nonce)
+	return true
+}
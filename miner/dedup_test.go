@@ -0,0 +1,39 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitCache(t *testing.T) {
+	require := require.New(t)
+
+	c := NewSubmitCache(2)
+	require.True(c.Add("job-1", 1))
+	require.True(c.Add("job-1", 2))
+	require.True(c.Add("job-2", 1))
+	require.False(c.Add("job-1", 1))
+	require.Equal(uint64(1), c.Duplicates())
+
+	// job-1 is forgotten once two newer jobs have been seen
+	require.True(c.Add("job-3", 1))
+	require.True(c.Add("job-1", 1))
+	require.False(c.Add("job-3", 1))
+	require.Equal(uint64(2), c.Duplicates())
+
+	c.ResetDuplicates()
+	require.Equal(uint64(0), c.Duplicates())
+	require.False(c.Add("job-3", 1))
+}
+
+func TestIsDuplicateShare(t *testing.T) {
+	require := require.New(t)
+
+	jobID := fmt.Sprintf("dedup-%p", t)
+	duplicates := DefaultSubmitCache.Duplicates()
+	require.False(IsDuplicateShare(0, jobID, 42))
+	require.True(IsDuplicateShare(1, jobID, 42))
+	require.Equal(duplicates+1, DefaultSubmitCache.Duplicates())
+}
@@ -0,0 +1,156 @@
+package miner
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer establishes connections to pools, optionally through a proxy.
+// Supported proxies are:
+//
+//	socks5://[user:pass@]host:port - SOCKS5 proxy
+//	unix:///path/to/socket         - Unix domain socket that leads to the pool
+//
+// Pools with a stratum+ssl:// url are connected to over TLS
+type Dialer struct {
+	sync.Mutex
+	dialer proxy.Dialer
+	direct *net.Dialer
+	socket string
+	// Timeouts of reads from and writes to the pool
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// TLS configurations of pools, by url
+	tlsConfigs map[string]*tls.Config
+}
+
+// NewDialer returns a Dialer that connects through proxyURL.
+// An empty proxyURL results in a Dialer that connects directly
+func NewDialer(proxyURL string) (*Dialer, error) {
+	// Host names that resolve to both IPv4 and IPv6 addresses are connected
+	// to by racing the two address families, as recommended by RFC 6555, so
+	// that an unreachable family doesn't stall the connection
+	direct := &net.Dialer{FallbackDelay: 250 * time.Millisecond}
+	d := &Dialer{
+		dialer: direct,
+		direct: direct,
+	}
+	if len(proxyURL) == 0 {
+		return d, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse proxy '%v': %v", proxyURL, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{
+				User:     u.User.Username(),
+				Password: password,
+			}
+		}
+		if d.dialer, err = proxy.SOCKS5("tcp", u.Host, auth, d.direct); err != nil {
+			return nil, fmt.Errorf("Failed to set up SOCKS5 proxy '%v': %v", u.Host, err)
+		}
+	case "unix":
+		d.socket = u.Path
+	case "":
+		// A bare path is taken to be a unix socket
+		if !strings.HasPrefix(proxyURL, "/") {
+			return nil, fmt.Errorf("Unsupported proxy '%v'", proxyURL)
+		}
+		d.socket = proxyURL
+	default:
+		return nil, fmt.Errorf("Unsupported proxy scheme '%v'", u.Scheme)
+	}
+	return d, nil
+}
+
+// Bind makes connections to the pool, or to the proxy, originate from a
+// local address. address is an IP address, optionally with a port, or the
+// name of a network interface. It has no effect on unix sockets
+func (d *Dialer) Bind(address string) error {
+	addr, err := resolveBindAddress(address)
+	if err != nil {
+		return err
+	}
+	d.direct.LocalAddr = addr
+	return nil
+}
+
+// resolveBindAddress returns the local address that address refers to
+func resolveBindAddress(address string) (*net.TCPAddr, error) {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid bind address '%v': %v", address, err)
+			}
+			return &net.TCPAddr{IP: ip, Port: p}, nil
+		}
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	iface, err := net.InterfaceByName(address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid bind address '%v': not an IP address or interface", address)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get addresses of interface '%v': %v", address, err)
+	}
+	// Prefer IPv4 since most pools don't listen on IPv6
+	var ret *net.TCPAddr
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+		if ret == nil {
+			ret = &net.TCPAddr{IP: ipNet.IP}
+		}
+	}
+	if ret == nil {
+		return nil, fmt.Errorf("Interface '%v' has no IP addresses", address)
+	}
+	return ret, nil
+}
+
+// Dial connects to the pool at address
+func (d *Dialer) Dial(address string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if len(d.socket) > 0 {
+		conn, err = net.DialTimeout("unix", d.socket, d.direct.Timeout)
+	} else {
+		conn, err = d.dialer.Dial("tcp", StripScheme(address))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.withTLS(d.withTimeouts(conn), address)
+}
+
+// StripScheme removes any stratum URL scheme from a pool URL
+func StripScheme(address string) string {
+	if idx := strings.Index(address, "://"); idx != -1 {
+		return address[idx+3:]
+	}
+	return address
+}
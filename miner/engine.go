@@ -0,0 +1,182 @@
+package miner
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// Engine sets up the source of work described by a config, a pool or a
+// daemon for solo mining, and connects to it
+type Engine struct {
+	sync.Mutex
+	config   *Config
+	pool     Pool
+	sc       *stratum.StratumContext
+	solo     *SoloClient
+	provider WorkProvider
+	relay    *Relay
+	// index of pool in config.Pools
+	index int
+	// TLS configurations of the pools, by url
+	tlsConfigs map[string]*tls.Config
+}
+
+// NewEngine returns an Engine for the first pool in config. Miners should be
+// created with the engine's Provider before the engine is started
+func NewEngine(config *Config) (*Engine, error) {
+	if len(config.Pools) == 0 {
+		return nil, fmt.Errorf("No pools configured")
+	}
+	tlsConfigs, err := config.LoadTLS()
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		sync.Mutex{},
+		config,
+		config.Pools[0],
+		nil,
+		nil,
+		nil,
+		nil,
+		0,
+		tlsConfigs,
+	}
+	if e.pool.Daemon {
+		e.solo = NewSoloClient(e.pool.Url, e.pool.User)
+		e.provider = e.solo
+	} else {
+		e.sc = stratum.New()
+		go PublishStratumEvents(e.sc)
+		go RunAlgoMismatchDetector(e.sc, config.Algorithm)
+		e.provider = e.sc
+	}
+	return e, nil
+}
+
+// Pool returns the pool the engine mines on
+func (e *Engine) Pool() Pool {
+	e.Lock()
+	defer e.Unlock()
+	return e.pool
+}
+
+// PoolIndex returns the index in the config of the pool the engine mines on
+func (e *Engine) PoolIndex() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.index
+}
+
+// Provider returns the WorkProvider that miners should get work from
+func (e *Engine) Provider() WorkProvider {
+	return e.provider
+}
+
+// Stratum returns the stratum client connected to the pool. It is nil when
+// solo mining
+func (e *Engine) Stratum() *stratum.StratumContext {
+	return e.sc
+}
+
+// Start connects to the pool and logs in, or starts polling the daemon for
+// block templates when solo mining
+func (e *Engine) Start() error {
+	if e.solo != nil {
+		log.Infof("Solo mining against daemon %v", e.pool.Url)
+		go e.solo.Run()
+		return nil
+	}
+	relay, err := NewPoolRelay(e.pool.Url, e.config.Proxy, e.config.BindAddress)
+	if err != nil {
+		return fmt.Errorf("Failed to set up connection to url :%v  - %v", e.pool.Url, err)
+	}
+	relay.SetResumeWindow(time.Duration(e.config.ResumeWindow) * time.Millisecond)
+	relay.SetRetries(e.config.Retries)
+	relay.dialer.SetTimeouts(time.Duration(e.config.DialTimeout)*time.Second, time.Duration(e.config.ReadTimeout)*time.Second, time.Duration(e.config.WriteTimeout)*time.Second)
+	for url, config := range e.tlsConfigs {
+		relay.dialer.SetTLSConfig(url, config)
+	}
+	e.Lock()
+	e.relay = relay
+	e.Unlock()
+	e.startStandby()
+	if err := e.sc.Connect(relay.Addr()); err != nil {
+		return fmt.Errorf("Failed to connect to url :%v  - %v", e.pool.Url, err)
+	}
+	if err := e.sc.Authorize(e.pool.User, e.pool.Pass); err != nil {
+		return fmt.Errorf("Failed to authorize with server: %v", err)
+	}
+	return nil
+}
+
+// SwitchPool makes the engine mine on the pool at index in the config. The
+// stratum client is reconnected to the new pool and logs in with its
+// credentials. Switching to or from a daemon is not supported
+func (e *Engine) SwitchPool(index int) error {
+	if index < 0 || index >= len(e.config.Pools) {
+		return fmt.Errorf("No pool %d", index)
+	}
+	pool := e.config.Pools[index]
+	if pool.Daemon || e.solo != nil {
+		return fmt.Errorf("Cannot switch pools when solo mining")
+	}
+	e.Lock()
+	relay := e.relay
+	if relay == nil {
+		e.Unlock()
+		return fmt.Errorf("Engine has not been started")
+	}
+	e.pool = pool
+	e.index = index
+	e.Unlock()
+
+	log.Infof("Switching to pool %v", pool.Url)
+	relay.SetAddress(pool.Url)
+	relay.SetLogin(pool.User, pool.Pass)
+	if standby := relay.Standby(); standby == nil || standby.Index() != index {
+		// Otherwise the standby is promoted when the client reconnects
+		e.startStandby()
+	}
+	relay.Reconnect()
+	return nil
+}
+
+// startStandby keeps the pool after the current one connected and logged
+// in if standby is enabled in the config
+func (e *Engine) startStandby() {
+	pools := e.config.Pools
+	if !e.config.Standby || len(pools) < 2 {
+		return
+	}
+	e.Lock()
+	relay := e.relay
+	next := (e.index + 1) % len(pools)
+	e.Unlock()
+	if pools[next].Daemon {
+		return
+	}
+	if standby := relay.Standby(); standby != nil && standby.Index() == next {
+		return
+	}
+	log.Infof("Keeping standby pool %v logged in", pools[next].Url)
+	standby := NewStandby(next, pools[next], relay.dialer)
+	go standby.Run()
+	relay.SetStandby(standby, e.standbyPromoted)
+}
+
+// standbyPromoted is called by the relay when it switched to the standby
+// pool at index
+func (e *Engine) standbyPromoted(index int) {
+	e.Lock()
+	e.pool = e.config.Pools[index]
+	e.index = index
+	e.Unlock()
+	log.Infof("Mining on standby pool %v", e.config.Pools[index].Url)
+	e.startStandby()
+}
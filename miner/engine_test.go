@@ -0,0 +1,85 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func nextWork(t *testing.T, workChan chan *stratum.Work) *stratum.Work {
+	select {
+	case work := <-workChan:
+		return work
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for work")
+	}
+	return nil
+}
+
+func TestNewEngineWithoutPools(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewEngine(&Config{})
+	require.NotNil(err)
+}
+
+func TestEngine(t *testing.T) {
+	require := require.New(t)
+
+	pool := newFakePool(t)
+	defer pool.Close()
+
+	config := &Config{}
+	config.Pools = []Pool{{Url: pool.URL(), User: "wallet", Pass: "x"}}
+	engine, err := NewEngine(config)
+	require.Nil(err)
+	require.NotNil(engine.Stratum())
+
+	workChan := make(chan *stratum.Work, 10)
+	engine.Provider().RegisterWorkListener(workChan)
+	require.Nil(engine.Start())
+
+	login := pool.NextRequest("login", 5*time.Second)
+	require.Equal("wallet", login.Params["login"])
+	require.Equal("x", login.Params["pass"])
+	require.Equal(Agent, login.Params["agent"])
+
+	work := nextWork(t, workChan)
+	require.Equal("job-1", work.JobID)
+
+	jobID := pool.PushJob()
+	work = nextWork(t, workChan)
+	require.Equal(jobID, work.JobID)
+}
+
+func TestEngineReconnect(t *testing.T) {
+	require := require.New(t)
+
+	pool := newFakePool(t)
+	defer pool.Close()
+
+	config := &Config{}
+	config.Pools = []Pool{{Url: pool.URL(), User: "wallet", Pass: "x"}}
+	engine, err := NewEngine(config)
+	require.Nil(err)
+
+	workChan := make(chan *stratum.Work, 10)
+	engine.Provider().RegisterWorkListener(workChan)
+	require.Nil(engine.Start())
+	pool.NextRequest("login", 5*time.Second)
+	nextWork(t, workChan)
+
+	// The client is expected to reconnect and log in again by itself
+	pool.DropConnections()
+	login := pool.NextRequest("login", 30*time.Second)
+	require.Equal("wallet", login.Params["login"])
+
+	jobID := pool.PushJob()
+	for {
+		if work := nextWork(t, workChan); work.JobID == jobID {
+			break
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package miner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+// EventKind identifies the type of an Event
+type EventKind int
+
+const (
+	// JobReceived is published when the pool sends new work.
+	// Payload: *stratum.Work
+	JobReceived EventKind = iota
+	// ShareAccepted is published when the pool accepts a share.
+	// Payload: *stratum.Response
+	ShareAccepted
+	// ShareRejected is published when the pool rejects a share.
+	// Payload: *stratum.Response
+	ShareRejected
+	// ShareStale is published when the pool rejects a share because its job
+	// is no longer valid. Payload: *stratum.Response
+	ShareStale
+	// Connected is published when a connection to the pool is established.
+	// Payload: pool address (string)
+	Connected
+	// Disconnected is published when the connection to the pool is lost.
+	// Payload: pool address (string)
+	Disconnected
+	// HashrateSample is published every time a miner reports hashes.
+	// Payload: *HashRate
+	HashrateSample
+	// AlgorithmChanged is published when the pool switches to a different
+	// algorithm. Payload: normalized algorithm name (string)
+	AlgorithmChanged
+)
+
+var eventKindNames = []string{
+	"JobReceived",
+	"ShareAccepted",
+	"ShareRejected",
+	"ShareStale",
+	"Connected",
+	"Disconnected",
+	"HashrateSample",
+	"AlgorithmChanged",
+}
+
+func (k EventKind) String() string {
+	if int(k) < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+// Event is a typed notification about something that happened while mining
+type Event struct {
+	Kind    EventKind
+	Time    time.Time
+	MinerID uint32
+	Payload interface{}
+}
+
+// NewEvent returns an Event of the given kind timestamped with the current time
+func NewEvent(kind EventKind, minerID uint32, payload interface{}) *Event {
+	return &Event{
+		kind,
+		time.Now(),
+		minerID,
+		payload,
+	}
+}
+
+// EventBus fans out published events to all registered listeners
+type EventBus struct {
+	sync.Mutex
+	listeners []chan *Event
+}
+
+// NewEventBus returns an EventBus without any listeners
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// RegisterEventListener registers eChan to receive every event published on
+// this bus. Listeners are expected to drain their channel promptly and must
+// not do network work in the goroutine that drains it
+func (b *EventBus) RegisterEventListener(eChan chan *Event) {
+	b.Lock()
+	defer b.Unlock()
+	b.listeners = append(b.listeners, eChan)
+}
+
+// Publish sends event to all listeners. HashrateSample events are published
+// from the hashing loops, so they are dropped for listeners whose channel is
+// full instead of stalling every miner
+func (b *EventBus) Publish(event *Event) {
+	b.Lock()
+	listeners := b.listeners
+	b.Unlock()
+	for _, eChan := range listeners {
+		if event.Kind == HashrateSample {
+			select {
+			case eChan <- event:
+			default:
+			}
+			continue
+		}
+		eChan <- event
+	}
+}
+
+// DefaultEventBus is the bus that all miner events are published on
+var DefaultEventBus = NewEventBus()
+
+// RegisterEventListener registers eChan with DefaultEventBus
+func RegisterEventListener(eChan chan *Event) {
+	DefaultEventBus.RegisterEventListener(eChan)
+}
+
+// PublishEvent publishes an event on DefaultEventBus
+func PublishEvent(kind EventKind, minerID uint32, payload interface{}) {
+	DefaultEventBus.Publish(NewEvent(kind, minerID, payload))
+}
+
+// responseErrorMessage returns the error message contained in a response
+func responseErrorMessage(response *stratum.Response) string {
+	if response.Error == nil {
+		return ""
+	}
+	if msg, ok := response.Error["message"].(string); ok {
+		return msg
+	}
+	return fmt.Sprintf("%v", response.Error)
+}
+
+// isStale returns true if the pool rejected a share because its job has expired
+func isStale(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "stale") || strings.Contains(message, "expired") || strings.Contains(message, "job not found")
+}
+
+// Reasons that rejected shares are grouped by
+const (
+	RejectLowDifficulty = "low difficulty"
+	RejectStale         = "stale"
+	RejectDuplicate     = "duplicate"
+	RejectInvalid       = "invalid"
+	RejectOther         = "other"
+)
+
+// RejectReason classifies the error message a pool rejected a share with.
+// Stale shares call for faster job switching, while low difficulty shares
+// point at a problem with target handling
+func RejectReason(message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case isStale(message):
+		return RejectStale
+	case strings.Contains(lower, "low difficulty") || strings.Contains(lower, "low diff") || strings.Contains(lower, "above target"):
+		return RejectLowDifficulty
+	case strings.Contains(lower, "duplicate"):
+		return RejectDuplicate
+	case strings.Contains(lower, "invalid") || strings.Contains(lower, "malformed") || strings.Contains(lower, "bad"):
+		return RejectInvalid
+	}
+	return RejectOther
+}
+
+// ShareResponseKind classifies a response to a submitted share.
+// The second return value is false if the response is not a share response
+func ShareResponseKind(response *stratum.Response) (EventKind, bool) {
+	if response.Error != nil {
+		if isStale(responseErrorMessage(response)) {
+			return ShareStale, true
+		}
+		return ShareRejected, true
+	}
+	if response.Result == nil {
+		return 0, false
+	}
+	if _, ok := response.Result["job"]; ok {
+		// Login response
+		return 0, false
+	}
+	if _, ok := response.Result["id"]; ok {
+		// Login response without a job
+		return 0, false
+	}
+	if status, ok := response.Result["status"].(string); ok && strings.EqualFold(status, "OK") {
+		return ShareAccepted, true
+	}
+	return 0, false
+}
+
+// PublishStratumEvents publishes job and share events received on sc until
+// the process exits. This function is expected to be run in a goroutine
+func PublishStratumEvents(sc *stratum.StratumContext) {
+	workChan := make(chan *stratum.Work, 10)
+	responseChan := make(chan *stratum.Response, 10)
+	sc.RegisterWorkListener(workChan)
+	sc.RegisterResponseListener(responseChan)
+
+	for {
+		select {
+		case work := <-workChan:
+			PublishEvent(JobReceived, 0, work)
+		case response := <-responseChan:
+			if kind, ok := ShareResponseKind(response); ok {
+				PublishEvent(kind, 0, response)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package miner
+
+import (
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	require := require.New(t)
+
+	bus := NewEventBus()
+	c1 := make(chan *Event, 1)
+	c2 := make(chan *Event, 1)
+	bus.RegisterEventListener(c1)
+	bus.RegisterEventListener(c2)
+
+	bus.Publish(NewEvent(Connected, 0, "localhost:3333"))
+	for _, c := range []chan *Event{c1, c2} {
+		event := <-c
+		require.Equal(Connected, event.Kind)
+		require.Equal("localhost:3333", event.Payload)
+	}
+	require.Equal("Connected", Connected.String())
+}
+
+func TestShareResponseKind(t *testing.T) {
+	require := require.New(t)
+
+	kind, ok := ShareResponseKind(&stratum.Response{
+		Result: map[string]interface{}{"status": "OK"},
+	})
+	require.True(ok)
+	require.Equal(ShareAccepted, kind)
+
+	kind, ok = ShareResponseKind(&stratum.Response{
+		Error: map[string]interface{}{"code": -1, "message": "Low difficulty share"},
+	})
+	require.True(ok)
+	require.Equal(ShareRejected, kind)
+
+	kind, ok = ShareResponseKind(&stratum.Response{
+		Error: map[string]interface{}{"code": -1, "message": "Block expired"},
+	})
+	require.True(ok)
+	require.Equal(ShareStale, kind)
+
+	// Login responses are not share responses
+	_, ok = ShareResponseKind(&stratum.Response{
+		Result: map[string]interface{}{"status": "OK", "job": map[string]interface{}{}},
+	})
+	require.False(ok)
+}
+
+func TestEventBusDropsHashrateSamples(t *testing.T) {
+	require := require.New(t)
+
+	bus := NewEventBus()
+	c := make(chan *Event, 1)
+	bus.RegisterEventListener(c)
+
+	// A full listener must not stall the miner publishing hashrate samples
+	bus.Publish(NewEvent(HashrateSample, 0, &HashRate{}))
+	bus.Publish(NewEvent(HashrateSample, 0, &HashRate{}))
+	require.Len(c, 1)
+}
@@ -0,0 +1,161 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+)
+
+// Version is the version of the miner
+const Version = "0.1.0"
+
+// Agent identifies this miner to pools and proxies in the login request and
+// in answers to client.get_version. It can be overridden to mimic another
+// miner for pools that reject unknown agents
+var Agent = fmt.Sprintf("go-cryptonight-miner/%s (%s %s)", Version, runtime.GOOS, runtime.GOARCH)
+
+// LoginAlgorithms are the algorithms sent to the pool as "algo" in the login
+// request. Pools that support the algo extension pick the algorithm of their
+// jobs from them and announce it with every job, which the miners switch to.
+// The login is sent without them if this is empty
+var LoginAlgorithms []string
+
+// decodeMessage decodes a single JSON stratum message. ok is false if line
+// is not a JSON object
+func decodeMessage(line []byte) (message map[string]interface{}, ok bool) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&message); err != nil {
+		return nil, false
+	}
+	return message, true
+}
+
+// updateLogin applies update to the params of a login request. Any other
+// message is returned unmodified
+func updateLogin(line []byte, update func(params map[string]interface{})) []byte {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return line
+	}
+	if method, _ := message["method"].(string); method != "login" {
+		return line
+	}
+	params, ok := message["params"].(map[string]interface{})
+	if !ok {
+		return line
+	}
+	update(params)
+	b, err := json.Marshal(message)
+	if err != nil {
+		return line
+	}
+	return append(b, '\n')
+}
+
+// SetLoginAgent sets the agent of a login request to Agent. Any other
+// message is returned unmodified
+func SetLoginAgent(line []byte) []byte {
+	return updateLogin(line, func(params map[string]interface{}) {
+		params["agent"] = Agent
+	})
+}
+
+// SetLoginAlgorithms sets the algorithms of a login request to algos, unless
+// algos is empty. Any other message is returned unmodified
+func SetLoginAlgorithms(line []byte, algos []string) []byte {
+	if len(algos) == 0 {
+		return line
+	}
+	return updateLogin(line, func(params map[string]interface{}) {
+		params["algo"] = algos
+	})
+}
+
+// NegotiatedAlgorithms returns the supported algorithms that canHash returns
+// true for, starting with preferred. Pools that support several of them
+// usually pick the first, which is the configured algorithm
+func NegotiatedAlgorithms(preferred string, canHash func(algo string) bool) []string {
+	preferred = NormalizeAlgorithm(preferred)
+	algos := make([]string, 0, len(SupportedAlgorithms))
+	if canHash(preferred) && IsAlgorithmSupported(preferred) {
+		algos = append(algos, preferred)
+	}
+	for _, algo := range SupportedAlgorithms {
+		if algo != preferred && canHash(algo) {
+			algos = append(algos, algo)
+		}
+	}
+	return algos
+}
+
+// SetLoginCredentials sets the user and password of a login request. Any
+// other message is returned unmodified
+func SetLoginCredentials(line []byte, user, pass string) []byte {
+	return updateLogin(line, func(params map[string]interface{}) {
+		params["login"] = user
+		params["pass"] = pass
+	})
+}
+
+// ParseReconnect returns the address that a client.reconnect message asks us
+// to reconnect to. ok is false if line is not a client.reconnect message.
+// An empty address means reconnecting to the same pool
+func ParseReconnect(line []byte) (address string, ok bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return "", false
+	}
+	if method, _ := message["method"].(string); method != "client.reconnect" {
+		return "", false
+	}
+	var host, port string
+	switch params := message["params"].(type) {
+	case []interface{}:
+		// [host, port, wait]
+		if len(params) >= 2 {
+			host, _ = jsonString(params[0])
+			port, _ = jsonString(params[1])
+		}
+	case map[string]interface{}:
+		host, _ = jsonString(params["host"])
+		port, _ = jsonString(params["port"])
+	}
+	if len(host) == 0 || len(port) == 0 {
+		return "", true
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", true
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// VersionReply returns the response to a client.get_version request from the
+// pool, reporting Agent as our version. ok is false if line is not a
+// client.get_version request
+func VersionReply(line []byte) (reply []byte, ok bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return nil, false
+	}
+	if method, _ := message["method"].(string); method != "client.get_version" {
+		return nil, false
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"id":      message["id"],
+		"jsonrpc": "2.0",
+		"error":   nil,
+		"result":  Agent,
+	})
+	if err != nil {
+		return nil, false
+	}
+	return append(b, '\n'), true
+}
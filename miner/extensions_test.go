@@ -0,0 +1,174 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLoginAgent(t *testing.T) {
+	require := require.New(t)
+
+	login := `{"id":1,"method":"login","params":{"login":"wallet","pass":"x","agent":"go-stratum-client"}}` + "\n"
+	var message map[string]interface{}
+	require.Nil(json.Unmarshal(SetLoginAgent([]byte(login)), &message))
+	params := message["params"].(map[string]interface{})
+	require.Equal(Agent, params["agent"])
+	require.Equal("wallet", params["login"])
+
+	submit := `{"id":2,"method":"submit","params":{"id":"abc","job_id":"1","nonce":"00000000","result":"00"}}` + "\n"
+	require.Equal(submit, string(SetLoginAgent([]byte(submit))))
+}
+
+func TestSetLoginAlgorithms(t *testing.T) {
+	require := require.New(t)
+
+	login := `{"id":1,"method":"login","params":{"login":"wallet","pass":"x","agent":"go-stratum-client"}}` + "\n"
+	require.Equal(login, string(SetLoginAlgorithms([]byte(login), nil)))
+
+	var message map[string]interface{}
+	require.Nil(json.Unmarshal(SetLoginAlgorithms([]byte(login), []string{"cn/2", "cn/0"}), &message))
+	params := message["params"].(map[string]interface{})
+	require.Equal([]interface{}{"cn/2", "cn/0"}, params["algo"])
+	require.Equal("wallet", params["login"])
+
+	submit := `{"id":2,"method":"submit","params":{"id":"abc","job_id":"1","nonce":"00000000","result":"00"}}` + "\n"
+	require.Equal(submit, string(SetLoginAlgorithms([]byte(submit), []string{"cn/0"})))
+}
+
+func TestNegotiatedAlgorithms(t *testing.T) {
+	require := require.New(t)
+
+	cryptonight := func(algo string) bool {
+		return strings.HasPrefix(algo, "cn")
+	}
+	algos := NegotiatedAlgorithms("cryptonight_v8", cryptonight)
+	require.Equal("cn/2", algos[0])
+	require.Contains(algos, DefaultAlgorithm)
+	require.NotContains(algos, "rx/0")
+	// Every algorithm is only offered once
+	count := 0
+	for _, algo := range algos {
+		if algo == "cn/2" {
+			count++
+		}
+	}
+	require.Equal(1, count)
+
+	// The preferred algorithm is left out if it can't be hashed
+	algos = NegotiatedAlgorithms("rx/0", cryptonight)
+	require.Equal(DefaultAlgorithm, algos[0])
+}
+
+func TestVersionReply(t *testing.T) {
+	require := require.New(t)
+
+	reply, ok := VersionReply([]byte(`{"id":7,"method":"client.get_version","params":[]}`))
+	require.True(ok)
+	var message map[string]interface{}
+	require.Nil(json.Unmarshal(reply, &message))
+	require.Equal(float64(7), message["id"])
+	require.Equal(Agent, message["result"])
+	require.Nil(message["error"])
+
+	_, ok = VersionReply([]byte(`{"id":1,"method":"job","params":{}}`))
+	require.False(ok)
+}
+
+func TestRelayAnswersGetVersion(t *testing.T) {
+	require := require.New(t)
+
+	pool, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer pool.Close()
+	replies := make(chan string, 1)
+	go func() {
+		conn, err := pool.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, `{"id":"v1","method":"client.get_version","params":[]}`+"\n")
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		replies <- line
+	}()
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay(pool.Addr().String(), dialer)
+	require.Nil(err)
+	defer relay.Close()
+
+	conn, err := net.Dial("tcp", relay.Addr())
+	require.Nil(err)
+	defer conn.Close()
+
+	var message map[string]interface{}
+	require.Nil(json.Unmarshal([]byte(<-replies), &message))
+	require.Equal("v1", message["id"])
+	require.Equal(Agent, message["result"])
+}
+
+func TestParseReconnect(t *testing.T) {
+	require := require.New(t)
+
+	address, ok := ParseReconnect([]byte(`{"method":"client.reconnect","params":["pool.example.com",3333,0]}`))
+	require.True(ok)
+	require.Equal("pool.example.com:3333", address)
+
+	address, ok = ParseReconnect([]byte(`{"method":"client.reconnect","params":{"host":"10.0.0.1","port":"4444"}}`))
+	require.True(ok)
+	require.Equal("10.0.0.1:4444", address)
+
+	address, ok = ParseReconnect([]byte(`{"method":"client.reconnect","params":[]}`))
+	require.True(ok)
+	require.Equal("", address)
+
+	_, ok = ParseReconnect([]byte(`{"method":"job","params":{}}`))
+	require.False(ok)
+}
+
+func TestRelayReconnect(t *testing.T) {
+	require := require.New(t)
+
+	// The first pool redirects us to the second one
+	second, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer second.Close()
+	go echoServer(t, second)
+
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer first.Close()
+	go func() {
+		conn, err := first.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		host, port, _ := net.SplitHostPort(second.Addr().String())
+		fmt.Fprintf(conn, `{"method":"client.reconnect","params":["%s",%s,0]}`+"\n", host, port)
+		bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay(first.Addr().String(), dialer)
+	require.Nil(err)
+	defer relay.Close()
+
+	conn, err := net.Dial("tcp", relay.Addr())
+	require.Nil(err)
+	// The reconnect message is not forwarded, the connection is closed instead
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	require.NotNil(err)
+	conn.Close()
+
+	require.Equal(second.Addr().String(), relay.Address())
+	testRelayEcho(t, relay)
+}
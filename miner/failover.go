@@ -0,0 +1,187 @@
+package miner
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultRejectWindow is the number of seconds over which the reject
+	// rate is measured
+	DefaultRejectWindow = 300
+	// DefaultFailbackCooldown is the number of seconds spent on a backup
+	// pool before switching back to the first one
+	DefaultFailbackCooldown = 600
+
+	// minRejectSamples is the number of share responses needed within the
+	// window before the reject rate is trusted
+	minRejectSamples = 10
+)
+
+// RejectMonitor measures the fraction of shares rejected by the pool over a
+// sliding window. Stale shares are not counted as they are expected
+// whenever a new block is found
+type RejectMonitor struct {
+	sync.Mutex
+	window    time.Duration
+	responses []shareResponse
+}
+
+type shareResponse struct {
+	time     time.Time
+	rejected bool
+}
+
+// NewRejectMonitor returns a RejectMonitor over the given window
+func NewRejectMonitor(window time.Duration) *RejectMonitor {
+	return &RejectMonitor{
+		window: window,
+	}
+}
+
+// HandleEvent records share responses
+func (m *RejectMonitor) HandleEvent(event *Event) {
+	if event.Kind != ShareAccepted && event.Kind != ShareRejected {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.responses = append(m.responses, shareResponse{event.Time, event.Kind == ShareRejected})
+}
+
+// RejectRate returns the fraction of rejected shares within the window
+// ending at now, along with the number of shares it is based on
+func (m *RejectMonitor) RejectRate(now time.Time) (float64, int) {
+	m.Lock()
+	defer m.Unlock()
+	start := 0
+	for start < len(m.responses) && now.Sub(m.responses[start].time) > m.window {
+		start++
+	}
+	m.responses = m.responses[start:]
+	if len(m.responses) == 0 {
+		return 0, 0
+	}
+	rejected := 0
+	for _, r := range m.responses {
+		if r.rejected {
+			rejected++
+		}
+	}
+	return float64(rejected) / float64(len(m.responses)), len(m.responses)
+}
+
+// Reset forgets all share responses
+func (m *RejectMonitor) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.responses = nil
+}
+
+// Failover moves an Engine to the next pool when its current pool rejects
+// too many shares, and back to the first pool after a cooldown
+type Failover struct {
+	engine    *Engine
+	monitor   *RejectMonitor
+	threshold float64
+	cooldown  time.Duration
+	// When the engine was moved off the first pool
+	switched time.Time
+	// The pool the engine was last seen on, to notice switches made by the
+	// engine itself
+	index int
+}
+
+// NewFailover returns a Failover that switches pools when more than
+// threshold of the shares over window are rejected
+func NewFailover(engine *Engine, threshold float64, window time.Duration, cooldown time.Duration) *Failover {
+	return &Failover{
+		engine,
+		NewRejectMonitor(window),
+		threshold,
+		cooldown,
+		time.Time{},
+		0,
+	}
+}
+
+// HandleEvent records event and switches pools if needed. It returns true
+// if the engine was switched to another pool
+func (f *Failover) HandleEvent(event *Event) bool {
+	f.monitor.HandleEvent(event)
+	return f.Check(event.Time)
+}
+
+// Check switches pools if the reject rate is over the threshold or the
+// cooldown on a backup pool has expired. It returns true if the engine was
+// switched to another pool
+func (f *Failover) Check(now time.Time) bool {
+	pools := f.engine.config.Pools
+	current := f.engine.PoolIndex()
+	if current != f.index {
+		// The engine switched to a standby pool by itself
+		f.index = current
+		f.switched = now
+		f.monitor.Reset()
+	}
+	if current != 0 && now.Sub(f.switched) >= f.cooldown {
+		log.Infof("Cooldown of %v expired, switching back to %v", f.cooldown, pools[0].Url)
+		return f.switchTo(0, now)
+	}
+	rate, samples := f.monitor.RejectRate(now)
+	if len(pools) < 2 || samples < minRejectSamples || rate <= f.threshold {
+		return false
+	}
+	next := (current + 1) % len(pools)
+	log.Warnf("%v rejected %.0f%% of the last %d shares, failing over to %v", pools[current].Url, rate*100, samples, pools[next].Url)
+	return f.switchTo(next, now)
+}
+
+func (f *Failover) switchTo(index int, now time.Time) bool {
+	if err := f.engine.SwitchPool(index); err != nil {
+		log.Errorf("Failed to switch pools: %v", err)
+		return false
+	}
+	f.index = index
+	if index != 0 {
+		f.switched = now
+	}
+	// The new pool starts with a clean slate
+	f.monitor.Reset()
+	return true
+}
+
+// Run watches share responses published on DefaultEventBus until the process
+// exits. Switching pools dials the new pool, so it is done on a goroutine of
+// its own rather than the one draining events. This function is expected to
+// be run in a goroutine
+func (f *Failover) Run() {
+	eventChan := make(chan *Event, 100)
+	RegisterEventListener(eventChan)
+	checkChan := make(chan struct{}, 1)
+	go func() {
+		for event := range eventChan {
+			if event.Kind != ShareAccepted && event.Kind != ShareRejected {
+				continue
+			}
+			f.monitor.HandleEvent(event)
+			select {
+			case checkChan <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-checkChan:
+			f.Check(time.Now())
+		case now := <-ticker.C:
+			f.Check(now)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectMonitor(t *testing.T) {
+	require := require.New(t)
+
+	m := NewRejectMonitor(time.Minute)
+	now := time.Now()
+	m.HandleEvent(&Event{ShareRejected, now, 0, nil})
+	m.HandleEvent(&Event{ShareAccepted, now.Add(30 * time.Second), 0, nil})
+	m.HandleEvent(&Event{ShareStale, now.Add(30 * time.Second), 0, nil})
+	m.HandleEvent(&Event{ShareRejected, now.Add(40 * time.Second), 0, nil})
+
+	rate, samples := m.RejectRate(now.Add(50 * time.Second))
+	require.Equal(3, samples)
+	require.InDelta(2.0/3, rate, 0.001)
+
+	// The first reject falls out of the window
+	rate, samples = m.RejectRate(now.Add(61 * time.Second))
+	require.Equal(2, samples)
+	require.InDelta(0.5, rate, 0.001)
+
+	m.Reset()
+	_, samples = m.RejectRate(now)
+	require.Equal(0, samples)
+}
+
+func TestFailover(t *testing.T) {
+	require := require.New(t)
+
+	primary := newFakePool(t)
+	defer primary.Close()
+	backup := newFakePool(t)
+	defer backup.Close()
+
+	config := &Config{}
+	config.Pools = []Pool{
+		{Url: primary.URL(), User: "wallet", Pass: "x"},
+		{Url: backup.URL(), User: "backup-wallet", Pass: "y"},
+	}
+	engine, err := NewEngine(config)
+	require.Nil(err)
+	workChan := make(chan *stratum.Work, 10)
+	engine.Provider().RegisterWorkListener(workChan)
+	require.Nil(engine.Start())
+	primary.NextRequest("login", 5*time.Second)
+
+	f := NewFailover(engine, 0.5, time.Minute, 10*time.Minute)
+	now := time.Now()
+	// Too few shares to judge the pool
+	for i := 0; i < minRejectSamples-1; i++ {
+		require.False(f.HandleEvent(&Event{ShareRejected, now, 0, nil}))
+	}
+	f.monitor.Reset()
+	for i := 0; i < minRejectSamples/2; i++ {
+		require.False(f.HandleEvent(&Event{ShareAccepted, now, 0, nil}))
+		require.False(f.HandleEvent(&Event{ShareRejected, now, 0, nil}))
+	}
+	// Over the threshold
+	require.True(f.HandleEvent(&Event{ShareRejected, now, 0, nil}))
+	require.Equal(1, engine.PoolIndex())
+
+	login := backup.NextRequest("login", 30*time.Second)
+	require.Equal("backup-wallet", login.Params["login"])
+	require.Equal("y", login.Params["pass"])
+
+	// Back to the primary after the cooldown
+	require.False(f.Check(now.Add(5 * time.Minute)))
+	require.True(f.Check(now.Add(10 * time.Minute)))
+	require.Equal(0, engine.PoolIndex())
+	login = primary.NextRequest("login", 30*time.Second)
+	require.Equal("wallet", login.Params["login"])
+}
@@ -0,0 +1,174 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePoolRequest is a request received by a fakePool
+type fakePoolRequest struct {
+	ID     interface{}            `json:"id"`
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// fakePool is an in-process stratum pool for tests. It answers logins with
+// the current job, accepts every share and can be told to push jobs to its
+// clients or to drop their connections
+type fakePool struct {
+	sync.Mutex
+	t        *testing.T
+	listener net.Listener
+	conns    []net.Conn
+	job      map[string]interface{}
+	jobs     int
+	sessions int
+	requests chan *fakePoolRequest
+}
+
+// newFakePool starts a fakePool listening on a random local port
+func newFakePool(t *testing.T) *fakePool {
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	p := &fakePool{
+		t:        t,
+		listener: listener,
+		requests: make(chan *fakePoolRequest, 100),
+	}
+	p.job = p.newJob()
+	go p.run()
+	return p
+}
+
+// URL returns the url that miners should connect to
+func (p *fakePool) URL() string {
+	return "stratum+tcp://" + p.listener.Addr().String()
+}
+
+// Close stops accepting connections and drops all current ones
+func (p *fakePool) Close() {
+	p.listener.Close()
+	p.DropConnections()
+}
+
+// DropConnections closes the connections of all clients, as a pool going
+// away would
+func (p *fakePool) DropConnections() {
+	p.Lock()
+	defer p.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// newJob returns a new job with a unique job id. Call with the lock held or
+// before the pool is started
+func (p *fakePool) newJob() map[string]interface{} {
+	p.jobs++
+	return map[string]interface{}{
+		"blob":   testBlob,
+		"job_id": fmt.Sprintf("job-%d", p.jobs),
+		"target": "b88d0600",
+	}
+}
+
+// PushJob sends a new job to all clients and returns its job id
+func (p *fakePool) PushJob() string {
+	p.Lock()
+	defer p.Unlock()
+	p.job = p.newJob()
+	for _, conn := range p.conns {
+		p.send(conn, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "job",
+			"params":  p.job,
+		})
+	}
+	return p.job["job_id"].(string)
+}
+
+// NextRequest returns the next request with the given method, skipping any
+// other requests. The test fails if none arrives within timeout
+func (p *fakePool) NextRequest(method string, timeout time.Duration) *fakePoolRequest {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case request := <-p.requests:
+			if request.Method == method {
+				return request
+			}
+		case <-deadline:
+			p.t.Fatalf("fakePool: Timed out waiting for a %v request", method)
+			return nil
+		}
+	}
+}
+
+func (p *fakePool) send(conn net.Conn, message interface{}) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		p.t.Errorf("fakePool: Failed to marshal message: %v", err)
+		return
+	}
+	conn.Write(append(b, '\n'))
+}
+
+func (p *fakePool) run() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.Lock()
+		p.conns = append(p.conns, conn)
+		p.Unlock()
+		go p.handle(conn)
+	}
+}
+
+func (p *fakePool) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		request := &fakePoolRequest{}
+		if err := json.Unmarshal(line, request); err != nil {
+			p.t.Errorf("fakePool: Received malformed request %q: %v", line, err)
+			continue
+		}
+
+		p.Lock()
+		result := map[string]interface{}{
+			"status": "OK",
+		}
+		switch request.Method {
+		case "login":
+			p.sessions++
+			result["id"] = fmt.Sprintf("session-%d", p.sessions)
+			result["job"] = p.job
+		case "keepalived":
+			result["status"] = "KEEPALIVED"
+		}
+		p.send(conn, map[string]interface{}{
+			"id":      request.ID,
+			"jsonrpc": "2.0",
+			"error":   nil,
+			"result":  result,
+		})
+		p.Unlock()
+		p.requests <- request
+	}
+}
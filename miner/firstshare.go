@@ -0,0 +1,185 @@
+package miner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// firstShareIntervals is how many of the intervals in which a share is
+// expected at the pool difficulty pass before warning, if that is longer
+// than the timeout. No share is found in that time with a probability of
+// about 5%
+var firstShareIntervals = 3.0
+
+// FirstShareCheck warns when the pool hasn't accepted a share within a
+// timeout of connecting to it, with a diagnosis of what may be wrong, so that
+// a misconfigured miner doesn't go unnoticed. The timeout is extended for
+// miners whose hashrate is too low to find a share in time at the pool
+// difficulty
+type FirstShareCheck struct {
+	sync.Mutex
+	timeout time.Duration
+	algo    string
+	// When the miner connected to the pool, or got its first job when solo
+	// mining
+	start   time.Time
+	address string
+	// Difficulty of the last job and the number of jobs received
+	difficulty uint64
+	jobs       int
+	// Hashes reported by the miners between the first and the last sample
+	hashes      uint64
+	firstSample time.Time
+	lastSample  time.Time
+	// Responses to shares that were not accepted, by RejectReason
+	rejects  map[string]int
+	accepted bool
+	done     bool
+}
+
+// NewFirstShareCheck returns a FirstShareCheck that warns if no share is
+// accepted within timeout of connecting. algo is the configured algorithm
+func NewFirstShareCheck(timeout time.Duration, algo string) *FirstShareCheck {
+	return &FirstShareCheck{
+		timeout: timeout,
+		algo:    algo,
+		rejects: make(map[string]int),
+	}
+}
+
+// HandleEvent records the connection, jobs, hashes and share responses
+func (c *FirstShareCheck) HandleEvent(event *Event) {
+	c.Lock()
+	defer c.Unlock()
+	switch event.Kind {
+	case Connected:
+		if c.start.IsZero() {
+			c.start = event.Time
+			c.address, _ = event.Payload.(string)
+		}
+	case JobReceived:
+		if c.start.IsZero() {
+			c.start = event.Time
+		}
+		c.jobs++
+		if work, ok := event.Payload.(*stratum.Work); ok && work != nil {
+			c.difficulty = TargetDifficulty(work.Target)
+		}
+	case HashrateSample:
+		if hr, ok := event.Payload.(*HashRate); ok && hr != nil {
+			if c.firstSample.IsZero() {
+				c.firstSample = hr.Time
+			} else {
+				c.hashes += uint64(hr.Hashes)
+			}
+			c.lastSample = hr.Time
+		}
+	case ShareAccepted:
+		c.accepted = true
+	case ShareRejected:
+		reason := RejectOther
+		if response, ok := event.Payload.(*stratum.Response); ok && response != nil {
+			reason = RejectReason(responseErrorMessage(response))
+		}
+		c.rejects[reason]++
+	case ShareStale:
+		c.rejects[RejectStale]++
+	}
+}
+
+// hashRate returns the hashrate measured so far. Call with the lock held
+func (c *FirstShareCheck) hashRate() float64 {
+	elapsed := c.lastSample.Sub(c.firstSample).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(c.hashes) / elapsed
+}
+
+// Timeout returns how long after connecting a share has to be accepted.
+// It is the configured timeout, or firstShareIntervals times the expected
+// time to find a share if that is longer
+func (c *FirstShareCheck) Timeout() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return c.scaledTimeout()
+}
+
+// scaledTimeout implements Timeout. Call with the lock held
+func (c *FirstShareCheck) scaledTimeout() time.Duration {
+	rate := c.hashRate()
+	if rate <= 0 || c.difficulty == 0 {
+		return c.timeout
+	}
+	expected := time.Duration(firstShareIntervals * float64(c.difficulty) / rate * float64(time.Second))
+	if expected > c.timeout {
+		return expected
+	}
+	return c.timeout
+}
+
+// Check returns the diagnosis if no share was accepted within the timeout.
+// It is only returned once, and never after a share was accepted
+func (c *FirstShareCheck) Check(now time.Time) []string {
+	c.Lock()
+	defer c.Unlock()
+	if c.done || c.accepted || c.start.IsZero() {
+		return nil
+	}
+	timeout := c.scaledTimeout()
+	if now.Sub(c.start) < timeout {
+		return nil
+	}
+	c.done = true
+
+	lines := []string{fmt.Sprintf("No share was accepted within %v of connecting", timeout)}
+	if len(c.address) != 0 {
+		lines[0] += fmt.Sprintf(" to %v", c.address)
+	}
+	if c.jobs == 0 {
+		lines = append(lines, "No job was received, check the pool url, port and login and that the pool is reachable")
+		return lines
+	}
+	rate := c.hashRate()
+	if rate <= 0 {
+		lines = append(lines, "The miners haven't reported any hashes, check the log for errors from the miners")
+		return lines
+	}
+	lines = append(lines, fmt.Sprintf("Hashrate is %.1f H/s at pool difficulty %d, a share is expected every %v", rate, c.difficulty, time.Duration(float64(c.difficulty)/rate*float64(time.Second)).Round(time.Second)))
+	if len(c.rejects) != 0 {
+		reasons := make([]string, 0, len(c.rejects))
+		for reason, count := range c.rejects {
+			reasons = append(reasons, fmt.Sprintf("%v: %d", reason, count))
+		}
+		sort.Strings(reasons)
+		lines = append(lines, fmt.Sprintf("Shares were rejected (%v), check that the algorithm %v is the one the pool mines", strings.Join(reasons, ", "), c.algo))
+	} else {
+		lines = append(lines, fmt.Sprintf("No share was rejected either, check that the algorithm %v is the one the pool mines and that the difficulty isn't too high for this hashrate", c.algo))
+	}
+	return lines
+}
+
+// Run checks for the first share using the events published on
+// DefaultEventBus. This function is expected to be run in a goroutine
+func (c *FirstShareCheck) Run() {
+	eventChan := make(chan *Event, 100)
+	RegisterEventListener(eventChan)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-eventChan:
+			c.HandleEvent(event)
+		case now := <-ticker.C:
+			for _, line := range c.Check(now) {
+				log.Warnf("first share: %v", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstShareCheck(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now()
+	c := NewFirstShareCheck(time.Minute, "cn/1")
+	// Nothing to check before connecting
+	require.Nil(c.Check(start.Add(time.Hour)))
+
+	c.HandleEvent(&Event{Connected, start, 0, "pool:3333"})
+	require.Nil(c.Check(start.Add(30 * time.Second)))
+	lines := c.Check(start.Add(time.Minute))
+	require.Equal(2, len(lines))
+	require.Contains(lines[0], "to pool:3333")
+	require.Contains(lines[1], "No job was received")
+	// The diagnosis is only logged once
+	require.Nil(c.Check(start.Add(2 * time.Minute)))
+
+	// An accepted share passes the check
+	c = NewFirstShareCheck(time.Minute, "cn/1")
+	c.HandleEvent(&Event{Connected, start, 0, "pool:3333"})
+	c.HandleEvent(&Event{ShareAccepted, start.Add(10 * time.Second), 0, &stratum.Response{}})
+	require.Nil(c.Check(start.Add(time.Hour)))
+
+	// Rejected shares are reported with the algorithm
+	c = NewFirstShareCheck(time.Minute, "cn/1")
+	c.HandleEvent(&Event{Connected, start, 0, "pool:3333"})
+	c.HandleEvent(&Event{JobReceived, start, 0, &stratum.Work{Target: 0xFFFFFFFFFFFFFFFF / 1000}})
+	c.HandleEvent(&Event{HashrateSample, start, 0, &HashRate{100, start}})
+	c.HandleEvent(&Event{HashrateSample, start, 0, &HashRate{1000, start.Add(time.Second)}})
+	c.HandleEvent(&Event{ShareRejected, start, 0, &stratum.Response{Error: map[string]interface{}{"message": "Low difficulty share"}}})
+	lines = c.Check(start.Add(time.Minute))
+	require.Equal(3, len(lines))
+	require.Contains(lines[1], "difficulty 1000")
+	require.Contains(lines[2], "cn/1")
+}
+
+func TestFirstShareCheckScalesWithDifficulty(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now()
+	c := NewFirstShareCheck(time.Minute, "cn/1")
+	c.HandleEvent(&Event{Connected, start, 0, "pool:3333"})
+	c.HandleEvent(&Event{JobReceived, start, 0, &stratum.Work{Target: 0xFFFFFFFFFFFFFFFF / 100000}})
+	// 10 H/s at difficulty 100000 finds a share every 10000s
+	c.HandleEvent(&Event{HashrateSample, start, 0, &HashRate{10, start}})
+	c.HandleEvent(&Event{HashrateSample, start, 0, &HashRate{100, start.Add(10 * time.Second)}})
+	timeout := c.Timeout()
+	require.True(timeout > 8*time.Hour && timeout < 9*time.Hour, timeout.String())
+	require.Nil(c.Check(start.Add(time.Hour)))
+	require.NotNil(c.Check(start.Add(9 * time.Hour)))
+}
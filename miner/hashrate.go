@@ -2,7 +2,9 @@ package miner
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,11 +19,19 @@ type HashRate struct {
 	Time   time.Time
 }
 
+// HashRateTracker measures the hashrate over a duration. It may be read
+// while another goroutine adds samples to it
 type HashRateTracker struct {
+	sync.Mutex
 	hashRates []*HashRate
 	duration  time.Duration
 	hashes    uint32
 	max       uint32
+	// Exponentially weighted moving average of the hashrate with a time
+	// constant of duration
+	ewma     float64
+	first    time.Time
+	lastTime time.Time
 }
 
 func NewHashRateTracker(duration time.Duration) *HashRateTracker {
@@ -33,6 +43,8 @@ func NewHashRateTracker(duration time.Duration) *HashRateTracker {
 }
 
 func (hrt *HashRateTracker) Add(hr *HashRate) {
+	hrt.Lock()
+	defer hrt.Unlock()
 	hrt.hashRates = append(hrt.hashRates, hr)
 	duration := hr.Time.Sub(hrt.hashRates[0].Time)
 	if duration > hrt.duration*2 {
@@ -40,6 +52,70 @@ func (hrt *HashRateTracker) Add(hr *HashRate) {
 		hrt.hashRates = hrt.hashRates[1:]
 	}
 	hrt.hashes += hr.Hashes
+	hrt.addToEWMA(hr)
+}
+
+func (hrt *HashRateTracker) addToEWMA(hr *HashRate) {
+	if hrt.first.IsZero() {
+		hrt.first = hr.Time
+		hrt.lastTime = hr.Time
+	}
+	tau := hrt.duration.Seconds()
+	dt := hr.Time.Sub(hrt.lastTime).Seconds()
+	if dt < 0 {
+		// Samples from different miners may arrive slightly out of order
+		dt = 0
+	}
+	decay := math.Exp(-dt / tau)
+	// Weight of this sample's hashes. Tends to 1/tau as dt goes to 0, which
+	// is what makes bursts of samples from several miners add up correctly
+	weight := 1 / tau
+	if dt > 0 {
+		weight = (1 - decay) / dt
+	}
+	hrt.ewma = hrt.ewma*decay + weight*float64(hr.Hashes)
+	if hr.Time.After(hrt.lastTime) {
+		hrt.lastTime = hr.Time
+	}
+	if avg := hrt.smoothed(); avg > hrt.max {
+		hrt.max = avg
+	}
+}
+
+// Smoothed returns the exponentially weighted moving average of the hashrate.
+// Unlike Average, it doesn't jump around as samples enter and leave the
+// window, which makes it better suited for display. Like Average, it returns 0
+// until samples spanning the tracker's duration have been seen
+func (hrt *HashRateTracker) Smoothed() uint32 {
+	hrt.Lock()
+	defer hrt.Unlock()
+	return hrt.smoothed()
+}
+
+// smoothed returns Smoothed. Call with the tracker locked
+func (hrt *HashRateTracker) smoothed() uint32 {
+	elapsed := hrt.lastTime.Sub(hrt.first).Seconds()
+	if hrt.first.IsZero() || elapsed < hrt.duration.Seconds() {
+		return 0
+	}
+	// Correct for the average having started out at 0
+	return uint32(hrt.ewma / (1 - math.Exp(-elapsed/hrt.duration.Seconds())))
+}
+
+// Max returns the highest smoothed hashrate seen so far
+func (hrt *HashRateTracker) Max() uint32 {
+	hrt.Lock()
+	defer hrt.Unlock()
+	return hrt.max
+}
+
+// SmoothedAsString returns Smoothed as a string, or n/a if it is unavailable
+func (hrt *HashRateTracker) SmoothedAsString() string {
+	avg := hrt.Smoothed()
+	if avg == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d", avg)
 }
 
 func (hrt *HashRateTracker) durationDiff() time.Duration {
@@ -48,6 +124,8 @@ func (hrt *HashRateTracker) durationDiff() time.Duration {
 }
 
 func (hrt *HashRateTracker) Average() uint32 {
+	hrt.Lock()
+	defer hrt.Unlock()
 	duration := hrt.durationDiff()
 	if duration < hrt.duration {
 		return 0
@@ -62,11 +140,7 @@ func (hrt *HashRateTracker) Average() uint32 {
 			break
 		}
 	}
-	avg := uint32(float64(totalHashes) / duration.Seconds())
-	if avg > hrt.max {
-		hrt.max = avg
-	}
-	return avg
+	return uint32(float64(totalHashes) / duration.Seconds())
 }
 
 func (hrt *HashRateTracker) AverageAsString() string {
@@ -94,6 +168,8 @@ func (hrt *HashRateTracker) DurationString() string {
 }
 
 func (hrt *HashRateTracker) Hashes() []uint32 {
+	hrt.Lock()
+	defer hrt.Unlock()
 	hashes := make([]uint32, len(hrt.hashRates))
 	for idx, hr := range hrt.hashRates {
 		hashes[idx] = hr.Hashes
@@ -102,6 +178,8 @@ func (hrt *HashRateTracker) Hashes() []uint32 {
 }
 
 func (hrt *HashRateTracker) Times() []float64 {
+	hrt.Lock()
+	defer hrt.Unlock()
 	times := make([]float64, len(hrt.hashRates))
 	zeroOffset := hrt.hashRates[0].Time
 	for idx, hr := range hrt.hashRates {
@@ -120,28 +198,28 @@ func (o HashRateTrackerArray) String() string {
 	buf = append(buf, fmt.Sprintf("\x1B[01;37mspeed"))
 
 	durationStrings := make([]string, len(o))
-	hashRateStrings := make([]string, len(o))
+	hashRates := make([]uint32, len(o))
 	maxHashRate := uint32(0)
 
 	for idx, hrt := range o {
 		durationStrings[idx] = hrt.DurationString()
-		hashRateStrings[idx] = fmt.Sprintf("\x1B[01;36m%4s", hrt.AverageAsString())
-		if hrt.max > maxHashRate {
-			maxHashRate = hrt.max
+		hashRates[idx] = hrt.Smoothed()
+		if max := hrt.Max(); max > maxHashRate {
+			maxHashRate = max
 		}
 	}
+	// All rates are shown in the same unit, picked by the largest of them
+	divisor, unit := hashRateScale(hashRateUnit, float64(maxHashRate))
+	hashRateStrings := make([]string, len(o))
+	for idx, hashRate := range hashRates {
+		hashRateStrings[idx] = fmt.Sprintf("\x1B[01;36m%4s", formatHashRate(float64(hashRate), divisor))
+	}
 	buf = append(buf, fmt.Sprintf("\x1B[0m %v", strings.Join(durationStrings, "/")))
 	buf = append(buf, strings.Join(hashRateStrings, "\x1B[0m "))
-	buf = append(buf, "\x1B[01;36mH/s")
+	buf = append(buf, "\x1B[01;36m"+unit)
 
 	// max
-	var maxHashRateStr string
-	if maxHashRate == 0 {
-		maxHashRateStr = "n/a"
-	} else {
-		maxHashRateStr = fmt.Sprintf("%v", maxHashRate)
-	}
-	buf = append(buf, fmt.Sprintf("\x1B[0m max: \x1B[01;36m%s H/s", maxHashRateStr))
+	buf = append(buf, fmt.Sprintf("\x1B[0m max: \x1B[01;36m%s %s", formatHashRate(float64(maxHashRate), divisor), unit))
 	buf = append(buf, "\x1B[0m ")
 	ret := strings.Join(buf, "\x1B[0m ")
 	// log.Infof("\x1B[01;37mspeed\x1B[0m 15s/60s/15m \x1B[01;36m%s\x1B[0m \x1B[22;36m%s %s \x1B[01;36mH/s\x1B[0m max: \x1B[01;36m%s H/s\x1B[0m ", fifteenSecondTracker.AverageAsString(), minuteTracker.AverageAsString(), fifteenMinuteTracker.AverageAsString(), "n/a")
@@ -159,14 +237,24 @@ func (o HashRateTrackerArray) Add(hr *HashRate) {
 // inChan as a source of HashRate events. Every duration, the hashrate trackers
 // are published to outChan as a HashRateTrackerArray
 func SetupHashRateTrackers(duration time.Duration, trackerDurations []time.Duration, inChan <-chan *HashRate, outChan chan<- HashRateTrackerArray) {
-	trackers := make(HashRateTrackerArray, len(trackerDurations))
-	for idx, duration := range trackerDurations {
-		trackers[idx] = NewHashRateTracker(duration)
+	newTrackers := func() HashRateTrackerArray {
+		trackers := make(HashRateTrackerArray, len(trackerDurations))
+		for idx, duration := range trackerDurations {
+			trackers[idx] = NewHashRateTracker(duration)
+		}
+		return trackers
 	}
+	trackers := newTrackers()
+	generation := StatsGeneration()
 
 	var startTime time.Time
 	firstHash := true
 	for hr := range inChan {
+		if g := StatsGeneration(); g != generation {
+			// Stats were reset, start over
+			trackers = newTrackers()
+			generation = g
+		}
 		if firstHash {
 			startTime = time.Now()
 			firstHash = false
@@ -181,14 +269,274 @@ func SetupHashRateTrackers(duration time.Duration, trackerDurations []time.Durat
 	}
 }
 
+// SampleHashRate is the hashrate measured over a number of hashrate samples
+type SampleHashRate struct {
+	Samples int
+	// Rate in H/s since the previous measurement. 0 if no time has passed
+	Rate float64
+	// Hashes since the trackers were started
+	Total uint64
+}
+
+func (s SampleHashRate) String() string {
+	divisor, unit := hashRateScale(hashRateUnit, s.Rate)
+	rate := "n/a"
+	if s.Rate > 0 {
+		rate = fmt.Sprintf("%.1f", s.Rate)
+		if divisor != 1 {
+			rate = formatHashRate(s.Rate, divisor)
+		}
+	}
+	return fmt.Sprintf("\x1B[01;37mspeed\x1B[0m %d samples \x1B[01;36m%s %s\x1B[0m total: \x1B[01;36m%d\x1B[0m hashes", s.Samples, rate, unit, s.Total)
+}
+
+// SampleWindow measures the hashrate over every n hashrate samples rather
+// than over time, which gives output right away on short runs
+type SampleWindow struct {
+	n       int
+	samples int
+	hashes  uint64
+	total   uint64
+	start   time.Time
+}
+
+// NewSampleWindow returns a SampleWindow that measures every n samples
+func NewSampleWindow(n int) *SampleWindow {
+	return &SampleWindow{n: n}
+}
+
+// Add adds hr to the window. ok is true when it is the nth sample since the
+// previous measurement, which is returned in rate
+func (s *SampleWindow) Add(hr *HashRate) (rate SampleHashRate, ok bool) {
+	if s.start.IsZero() {
+		s.start = hr.Time
+	}
+	s.samples++
+	s.hashes += uint64(hr.Hashes)
+	s.total += uint64(hr.Hashes)
+	if s.samples < s.n {
+		return SampleHashRate{}, false
+	}
+	rate = SampleHashRate{s.samples, 0, s.total}
+	if elapsed := hr.Time.Sub(s.start).Seconds(); elapsed > 0 {
+		rate.Rate = float64(s.hashes) / elapsed
+	}
+	s.samples = 0
+	s.hashes = 0
+	s.start = hr.Time
+	return rate, true
+}
+
+// SetupSampleHashRateLogger measures the hashrate of every n HashRate
+// samples read from inChan and publishes it to outChan
+func SetupSampleHashRateLogger(n int, inChan <-chan *HashRate, outChan chan<- SampleHashRate) {
+	window := NewSampleWindow(n)
+	generation := StatsGeneration()
+	for hr := range inChan {
+		if g := StatsGeneration(); g != generation {
+			// Stats were reset, start over
+			window = NewSampleWindow(n)
+			generation = g
+		}
+		if rate, ok := window.Add(hr); ok {
+			outChan <- rate
+		}
+	}
+}
+
+// HashRateUnits are the units that the hashrate can be logged in. auto
+// picks the largest unit in which the hashrate is at least 1
+var HashRateUnits = []string{"auto", "H/s", "kH/s", "MH/s"}
+
+// hashRateUnit is the unit that the hashrate is logged in
+var hashRateUnit = "H/s"
+
+// SetHashRateUnit makes the hashrate be logged in unit, one of
+// HashRateUnits. The hashrate is reported in H/s everywhere else. Call
+// before starting the trackers
+func SetHashRateUnit(unit string) error {
+	for _, u := range HashRateUnits {
+		if strings.EqualFold(u, unit) {
+			hashRateUnit = u
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown hashrate unit %v, expected one of %v", unit, strings.Join(HashRateUnits, ", "))
+}
+
+// hashRateScale returns what a hashrate in H/s is divided by to show it in
+// unit, and the name of the unit. auto picks the unit by rate
+func hashRateScale(unit string, rate float64) (float64, string) {
+	switch unit {
+	case "kH/s":
+		return 1e3, unit
+	case "MH/s":
+		return 1e6, unit
+	case "auto":
+		if rate >= 1e6 {
+			return 1e6, "MH/s"
+		}
+		if rate >= 1e3 {
+			return 1e3, "kH/s"
+		}
+	}
+	return 1, "H/s"
+}
+
+// formatHashRate formats rate, in H/s, divided by divisor. H/s are shown as
+// whole numbers. A rate of 0 is shown as n/a
+func formatHashRate(rate float64, divisor float64) string {
+	if rate == 0 {
+		return "n/a"
+	}
+	if divisor == 1 {
+		return fmt.Sprintf("%d", uint64(rate))
+	}
+	return fmt.Sprintf("%.2f", rate/divisor)
+}
+
+// quiet suppresses the periodic hashrate and share lines
+var quiet bool
+
+// printSamples makes the hashrate be logged every this many samples
+// instead of periodically
+var printSamples int
+
+// SetPrintSamples makes RunDefaultHashRateTrackers log the hashrate every n
+// hashrate samples instead of every 30 seconds. 0 logs by time. Call before
+// starting the trackers
+func SetPrintSamples(n int) {
+	printSamples = n
+}
+
+// SetQuiet suppresses the routine hashrate and share lines printed by
+// RunDefaultHashRateTrackers. Warnings, errors and all other messages are
+// logged as usual. Call before starting the trackers
+func SetQuiet(q bool) {
+	quiet = q
+}
+
 // RunDefaultHashRateTrackers sets up the default hashrate trackers as defined
 // by DefaultTrackerDurations and runs an infinite loop listening for hashrate
 // events and printing them.
 // This function is expected to be run in a goroutine
 func RunDefaultHashRateTrackers(inChan <-chan *HashRate) {
+	if printSamples > 0 {
+		runSampleHashRateLogger(inChan)
+		return
+	}
 	outChan := make(chan HashRateTrackerArray)
 	go SetupHashRateTrackers(30*time.Second, DefaultTrackerDurations, inChan, outChan)
 	for array := range outChan {
-		log.Infof(array.String())
+		if quiet {
+			continue
+		}
+		if colorsEnabled {
+			log.Info(array.String())
+		} else {
+			log.Info(StripColors(array.String()))
+		}
+		if groups := FormatHashRateGroups(); len(groups) != 0 {
+			log.Infof("%v", groups)
+		}
+		if len(array) > 0 && DefaultPowerTracker.Sample(float64(array[0].Smoothed())) {
+			log.Infof("%v", DefaultPowerTracker)
+		}
+		if found, withheld := DefaultShareStats.Found(), WithheldShares(); found > 0 || withheld > 0 {
+			counts := DefaultStats.Counts()
+			line := fmt.Sprintf("shares: %d accepted: %d rejected: %d stale: %d best: %d", found, counts.Accepted, counts.Rejected, counts.Stale, DefaultShareStats.Best())
+			if withheld > 0 {
+				line += fmt.Sprintf(" withheld: %d", withheld)
+			}
+			log.Infof("%v", line)
+			if reasons := DefaultStats.RejectReasons(); len(reasons) > 0 {
+				log.Infof("rejects: %v", FormatRejectReasons(reasons))
+			}
+		}
+	}
+}
+
+// runSampleHashRateLogger logs the hashrate every printSamples samples read
+// from inChan
+func runSampleHashRateLogger(inChan <-chan *HashRate) {
+	outChan := make(chan SampleHashRate)
+	go SetupSampleHashRateLogger(printSamples, inChan, outChan)
+	for rate := range outChan {
+		if quiet {
+			continue
+		}
+		if colorsEnabled {
+			log.Info(rate.String())
+		} else {
+			log.Info(StripColors(rate.String()))
+		}
+	}
+}
+
+// hashRateGroup tracks the hashrate of a group of miners, e.g. the CPU
+// miners, in a process that runs several kinds of miners
+type hashRateGroup struct {
+	sync.Mutex
+	name       string
+	tracker    *HashRateTracker
+	generation uint64
+}
+
+// hashRateGroups are the groups whose hashrate is broken down after the
+// hashrate lines
+var (
+	hashRateGroupsLock sync.Mutex
+	hashRateGroups     []*hashRateGroup
+)
+
+// NewHashRateGroup returns a channel for the miners of a group, e.g. the CPU
+// miners, to register as their hashrate listener. Their samples are
+// forwarded to out, which gets the samples of all groups, and the hashrate
+// of the group is broken down after the hashrate lines
+func NewHashRateGroup(name string, out chan<- *HashRate) chan *HashRate {
+	g := &hashRateGroup{
+		name:       name,
+		tracker:    NewHashRateTracker(DefaultTrackerDurations[1]),
+		generation: StatsGeneration(),
+	}
+	hashRateGroupsLock.Lock()
+	hashRateGroups = append(hashRateGroups, g)
+	hashRateGroupsLock.Unlock()
+
+	in := make(chan *HashRate, 10)
+	go func() {
+		for hr := range in {
+			g.Lock()
+			if gen := StatsGeneration(); gen != g.generation {
+				// Stats were reset, start over
+				g.tracker = NewHashRateTracker(DefaultTrackerDurations[1])
+				g.generation = gen
+			}
+			g.tracker.Add(hr)
+			g.Unlock()
+			out <- hr
+		}
+	}()
+	return in
+}
+
+// FormatHashRateGroups returns the smoothed hashrate of every group created
+// with NewHashRateGroup on one line, or an empty string if there are none
+func FormatHashRateGroups() string {
+	hashRateGroupsLock.Lock()
+	groups := append([]*hashRateGroup(nil), hashRateGroups...)
+	hashRateGroupsLock.Unlock()
+	if len(groups) == 0 {
+		return ""
+	}
+	buf := make([]string, len(groups))
+	for idx, g := range groups {
+		g.Lock()
+		rate := float64(g.tracker.Smoothed())
+		duration := g.tracker.DurationString()
+		g.Unlock()
+		divisor, unit := hashRateScale(hashRateUnit, rate)
+		buf[idx] = fmt.Sprintf("%v %v %v %v", g.name, duration, formatHashRate(rate, divisor), unit)
 	}
+	return strings.Join(buf, ", ")
 }
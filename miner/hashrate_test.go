@@ -77,7 +77,7 @@ func TestFixedHashRate(t *testing.T) {
 		// All trackers have to report successful hashrate
 		result := 0
 		for array := range outChan {
-			log.Infof(array.String())
+			log.Info(array.String())
 			for idx, hrt := range array {
 				avg := int(hrt.Average())
 				if avg == 0 {
@@ -121,3 +121,132 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+func TestSmoothedHashRate(t *testing.T) {
+	require := require.New(t)
+
+	hrt := NewHashRateTracker(10 * time.Second)
+	start := time.Now()
+	// 4 miners each reporting 250 hashes every 100ms at almost the same time
+	// for a total of 10000H/s
+	for i := 0; i < 600; i++ {
+		for j := 0; j < 4; j++ {
+			hrt.Add(&HashRate{250, start.Add(time.Duration(i)*100*time.Millisecond + time.Duration(j)*time.Millisecond)})
+		}
+		if i < 100 {
+			require.Equal(uint32(0), hrt.Smoothed())
+		}
+	}
+	smoothed := float64(hrt.Smoothed())
+	require.True(math.Abs(smoothed-10000) < 200, fmt.Sprintf("smoothed=%v", smoothed))
+
+	// A burst of hashes barely moves the smoothed value
+	hrt.Add(&HashRate{5000, start.Add(60 * time.Second)})
+	burst := float64(hrt.Smoothed())
+	require.True(burst-smoothed < 600, fmt.Sprintf("smoothed=%v burst=%v", smoothed, burst))
+}
+
+func TestHashRateTrackerConcurrentReads(t *testing.T) {
+	require := require.New(t)
+
+	trackers := HashRateTrackerArray{NewHashRateTracker(time.Second)}
+	start := time.Now()
+	done := make(chan struct{})
+	// The trackers are printed while the tracker goroutine adds samples
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			trackers.Add(&HashRate{100, start.Add(time.Duration(i) * 10 * time.Millisecond)})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = trackers.String()
+	}
+	<-done
+	// The maximum is kept as samples are added rather than when read
+	require.NotZero(trackers[0].Max())
+	require.True(trackers[0].Max() >= trackers[0].Smoothed())
+}
+
+func TestSampleWindow(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	w := NewSampleWindow(3)
+	_, ok := w.Add(&HashRate{100, now})
+	require.False(ok)
+	_, ok = w.Add(&HashRate{100, now.Add(500 * time.Millisecond)})
+	require.False(ok)
+	rate, ok := w.Add(&HashRate{100, now.Add(time.Second)})
+	require.True(ok)
+	require.Equal(3, rate.Samples)
+	require.Equal(300.0, rate.Rate)
+	require.Equal(uint64(300), rate.Total)
+
+	// The next window starts where the previous one ended
+	w.Add(&HashRate{50, now.Add(1500 * time.Millisecond)})
+	w.Add(&HashRate{50, now.Add(2 * time.Second)})
+	rate, ok = w.Add(&HashRate{50, now.Add(2 * time.Second)})
+	require.True(ok)
+	require.Equal(150.0, rate.Rate)
+	require.Equal(uint64(450), rate.Total)
+	require.Contains(StripColors(rate.String()), "speed 3 samples 150.0 H/s total: 450 hashes")
+
+	// Samples that arrive at once have no rate
+	w = NewSampleWindow(1)
+	rate, ok = w.Add(&HashRate{10, now})
+	require.True(ok)
+	require.Contains(StripColors(rate.String()), "n/a")
+}
+
+func TestHashRateUnit(t *testing.T) {
+	require := require.New(t)
+	defer SetHashRateUnit("H/s")
+
+	require.NotNil(SetHashRateUnit("GH/s"))
+
+	rate := SampleHashRate{1, 2500, 2500}
+	require.Contains(StripColors(rate.String()), "2500.0 H/s")
+	require.Nil(SetHashRateUnit("kh/s"))
+	require.Contains(StripColors(rate.String()), "2.50 kH/s")
+	require.Nil(SetHashRateUnit("MH/s"))
+	require.Contains(StripColors(rate.String()), "0.00 MH/s")
+
+	// auto scales by the rate
+	require.Nil(SetHashRateUnit("auto"))
+	require.Contains(StripColors(rate.String()), "2.50 kH/s")
+	rate.Rate = 1500000
+	require.Contains(StripColors(rate.String()), "1.50 MH/s")
+	rate.Rate = 500
+	require.Contains(StripColors(rate.String()), "500.0 H/s")
+}
+
+func TestHashRateGroups(t *testing.T) {
+	require := require.New(t)
+	defer func() {
+		hashRateGroupsLock.Lock()
+		hashRateGroups = nil
+		hashRateGroupsLock.Unlock()
+	}()
+
+	require.Equal("", FormatHashRateGroups())
+
+	out := make(chan *HashRate, 200)
+	cpu := NewHashRateGroup("cpu", out)
+	gpu := NewHashRateGroup("gpu", out)
+
+	start := time.Now()
+	for i := 0; i <= 60; i++ {
+		cpu <- &HashRate{100, start.Add(time.Duration(i) * time.Second)}
+		gpu <- &HashRate{1000, start.Add(time.Duration(i) * time.Second)}
+	}
+	// Samples of both groups are forwarded
+	for i := 0; i < 2*61; i++ {
+		<-out
+	}
+	line := FormatHashRateGroups()
+	require.Contains(line, "cpu 1m ")
+	require.Contains(line, ", gpu 1m ")
+	require.Contains(line, " H/s")
+	require.NotContains(line, "n/a")
+}
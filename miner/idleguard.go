@@ -0,0 +1,100 @@
+package miner
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultIdleThreshold is how long, in seconds, the user must be idle
+	// before paused miners are resumed
+	DefaultIdleThreshold = 60
+	// IdleGuardInterval is how often an IdleGuard checks for user activity
+	IdleGuardInterval = time.Second
+)
+
+// Pausable is implemented by miners that can stop hashing for a while
+type Pausable interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// IdleTimeFunc returns how long the user has not used the machine
+type IdleTimeFunc func() (time.Duration, error)
+
+// IdleGuard pauses miners while the machine is in active use and resumes
+// them once the user has been idle for a while, so that mining doesn't make
+// a desktop unusable
+type IdleGuard struct {
+	sync.Mutex
+	threshold time.Duration
+	miners    []Pausable
+	idleTime  IdleTimeFunc
+	paused    bool
+}
+
+// NewIdleGuard returns an IdleGuard for the pausable miners among miners.
+// They are paused whenever idleTime reports less than threshold
+func NewIdleGuard(threshold time.Duration, miners []Interface, idleTime IdleTimeFunc) *IdleGuard {
+	g := &IdleGuard{
+		threshold: threshold,
+		idleTime:  idleTime,
+	}
+	for _, m := range miners {
+		if pausable, ok := m.(Pausable); ok {
+			g.miners = append(g.miners, pausable)
+		} else {
+			log.Warnf("miner-%d: Cannot be paused while the machine is in use", m.Id())
+		}
+	}
+	return g
+}
+
+// Check pauses or resumes the miners depending on how long the user has
+// been idle and returns true if they are paused
+func (g *IdleGuard) Check() (bool, error) {
+	idle, err := g.idleTime()
+	if err != nil {
+		return false, err
+	}
+	g.Lock()
+	defer g.Unlock()
+	active := idle < g.threshold
+	if active && !g.paused {
+		log.Infof("Machine is in use, pausing miners until it has been idle for %v", g.threshold)
+		for _, m := range g.miners {
+			m.Pause()
+		}
+	} else if !active && g.paused {
+		log.Infof("Machine has been idle for %v, resuming miners", idle.Truncate(time.Second))
+		for _, m := range g.miners {
+			m.Resume()
+		}
+	}
+	g.paused = active
+	return g.paused, nil
+}
+
+// Run checks for user activity periodically until the process exits. If
+// the idle time can't be determined, the miners are left running.
+// This function is expected to be run in a goroutine
+func (g *IdleGuard) Run() {
+	ticker := time.NewTicker(IdleGuardInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := g.Check(); err != nil {
+			log.Errorf("Failed to detect user activity, miners will not be paused: %v", err)
+			g.Lock()
+			for _, m := range g.miners {
+				m.Resume()
+			}
+			g.paused = false
+			g.Unlock()
+			return
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,62 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleGuard(t *testing.T) {
+	require := require.New(t)
+
+	m0 := &restartableMiner{New(0), 0}
+	m1 := &restartableMiner{New(1), 0}
+	idle := time.Duration(0)
+	g := NewIdleGuard(time.Minute, []Interface{m0, m1}, func() (time.Duration, error) {
+		return idle, nil
+	})
+
+	// The machine is in use
+	paused, err := g.Check()
+	require.Nil(err)
+	require.True(paused)
+	require.True(m0.Paused())
+	require.True(m1.Paused())
+
+	idle = 30 * time.Second
+	paused, err = g.Check()
+	require.Nil(err)
+	require.True(paused)
+
+	idle = time.Minute
+	paused, err = g.Check()
+	require.Nil(err)
+	require.False(paused)
+	require.False(m0.Paused())
+	require.False(m1.Paused())
+
+	// Any input pauses the miners again
+	idle = time.Second
+	paused, err = g.Check()
+	require.Nil(err)
+	require.True(paused)
+	require.True(m0.Paused())
+}
+
+func TestIdleGuardError(t *testing.T) {
+	require := require.New(t)
+
+	m := &restartableMiner{New(0), 0}
+	g := NewIdleGuard(time.Minute, []Interface{m}, func() (time.Duration, error) {
+		return 0, fmt.Errorf("Unsupported")
+	})
+	_, err := g.Check()
+	require.NotNil(err)
+	require.False(m.Paused())
+
+	// Run gives up without pausing the miners
+	g.Run()
+	require.False(m.Paused())
+}
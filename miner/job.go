@@ -0,0 +1,239 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// minBlobSize is the smallest hashing blob that has room for the nonce
+	minBlobSize = 43
+)
+
+// jsonString converts a string or number JSON value to a string
+func jsonString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// jsonUint64 converts a string or number JSON value to a uint64
+func jsonUint64(value interface{}) (uint64, bool) {
+	s, ok := jsonString(value)
+	if !ok {
+		return 0, false
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f >= 0 {
+		return uint64(f), true
+	}
+	return 0, false
+}
+
+// targetHex encodes a 64-bit target the way pools send 8-byte targets
+func targetHex(target uint64) string {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, target)
+	return hex.EncodeToString(b)
+}
+
+// normalizeTarget converts the various target encodings used by pools into
+// the 4-byte or 8-byte little-endian hex encoding. A full 256-bit target is
+// returned as well, since the 8-byte encoding only carries its most
+// significant bits
+func normalizeTarget(job map[string]interface{}) (string, *Target, error) {
+	value, ok := job["target"]
+	if !ok {
+		// Some pools only send the difficulty
+		difficulty, ok := jsonUint64(job["difficulty"])
+		if !ok || difficulty == 0 {
+			return "", nil, fmt.Errorf("Job has neither target nor difficulty")
+		}
+		// The 64-bit target loses precision at very high difficulties, so
+		// the exact target is kept as well
+		return targetHex(0xFFFFFFFFFFFFFFFF / difficulty), TargetFromDifficulty(difficulty), nil
+	}
+	if _, isString := value.(string); !isString {
+		// A numeric target is the 64-bit target itself
+		target, ok := jsonUint64(value)
+		if !ok || target == 0 {
+			return "", nil, fmt.Errorf("Invalid target: %v", value)
+		}
+		return targetHex(target), nil, nil
+	}
+	s := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(value.(string), "0x"), "0X"))
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", nil, fmt.Errorf("Invalid target '%v': %v", value, err)
+	}
+	switch {
+	case len(s) == 8 || len(s) == 16:
+		return s, nil, nil
+	case len(s) == 64:
+		// Full 256-bit big-endian target. Only the most significant 64 bits
+		// are compared against the hash
+		target, _ := strconv.ParseUint(s[:16], 16, 64)
+		if target == 0 {
+			return "", nil, fmt.Errorf("Invalid target '%v'", value)
+		}
+		full, err := ParseTarget(s)
+		if err != nil {
+			return "", nil, err
+		}
+		return targetHex(target), full, nil
+	}
+	return "", nil, fmt.Errorf("Invalid target length %d: '%v'", len(s), value)
+}
+
+// applyJobDifficulty checks the target of a job against the difficulty that
+// proxies send alongside it. A proxy that assigns its own difficulty may
+// leave the target of the upstream pool in the job, and shares below its
+// difficulty are rejected as low difficulty. The harder of the two is used
+func applyJobDifficulty(job map[string]interface{}, target string, full *Target) (string, *Target) {
+	if _, ok := job["target"]; !ok {
+		// The target was already derived from the difficulty
+		return target, full
+	}
+	difficulty, ok := jsonUint64(job["difficulty"])
+	if !ok || difficulty == 0 {
+		return target, full
+	}
+	current := full
+	if current == nil {
+		var err error
+		if current, err = ParseTarget(target); err != nil {
+			return target, full
+		}
+	}
+	targetDifficulty := DifficultyFromTarget(current)
+	if targetDifficulty >= difficulty {
+		return target, full
+	}
+	log.Debugf("Job difficulty %d is above the difficulty %d of its target, using it", difficulty, targetDifficulty)
+	return targetHex(0xFFFFFFFFFFFFFFFF / difficulty), TargetFromDifficulty(difficulty)
+}
+
+// NormalizeJob converts a job sent by a pool into the schema understood by
+// the stratum client: a string job_id, a lowercase hex blob and a 4 or 8 byte
+// hex target. Jobs that can't be normalized are returned as errors rather
+// than being mined against
+func NormalizeJob(job map[string]interface{}) (map[string]interface{}, error) {
+	ret := make(map[string]interface{}, len(job))
+	for k, v := range job {
+		ret[k] = v
+	}
+
+	var jobID string
+	for _, key := range []string{"job_id", "jobid", "jobId"} {
+		if value, ok := job[key]; ok {
+			if id, ok := jsonString(value); ok && len(id) != 0 {
+				jobID = id
+				break
+			}
+		}
+	}
+	if len(jobID) == 0 {
+		return nil, fmt.Errorf("Job is missing job_id")
+	}
+	delete(ret, "jobid")
+	delete(ret, "jobId")
+	ret["job_id"] = jobID
+
+	var blob string
+	for _, key := range []string{"blob", "hashing_blob"} {
+		if value, ok := job[key].(string); ok && len(value) != 0 {
+			blob = strings.ToLower(value)
+			break
+		}
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("Job %v is missing blob", jobID)
+	}
+	if b, err := hex.DecodeString(blob); err != nil {
+		return nil, fmt.Errorf("Job %v has an invalid blob: %v", jobID, err)
+	} else if len(b) < minBlobSize {
+		return nil, fmt.Errorf("Job %v has a blob of only %d bytes", jobID, len(b))
+	}
+	delete(ret, "hashing_blob")
+	ret["blob"] = blob
+
+	target, full, err := normalizeTarget(job)
+	if err != nil {
+		return nil, fmt.Errorf("Job %v: %v", jobID, err)
+	}
+	target, full = applyJobDifficulty(job, target, full)
+	if full != nil {
+		RecordJobTarget(jobID, full)
+	} else {
+		// A job sent again with a new target must not be checked against
+		// the full target it had before
+		forgetJobTarget(jobID)
+	}
+	ret["target"] = target
+	if height, ok := jsonUint64(job["height"]); ok {
+		RecordJobHeight(jobID, height)
+	}
+	if seed, ok := job["seed_hash"].(string); ok {
+		recordJobSeedHex(jobID, seed)
+	}
+	return ret, nil
+}
+
+// NormalizeMessage normalizes any job contained in a message sent by a pool.
+// Messages without jobs are returned unmodified. A job notification that
+// can't be normalized is dropped by returning nil
+func NormalizeMessage(line []byte) []byte {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return line
+	}
+
+	if method, _ := message["method"].(string); method == "job" {
+		params, ok := message["params"].(map[string]interface{})
+		if !ok {
+			log.Errorf("Dropping job notification without params: %s", bytes.TrimSpace(line))
+			return nil
+		}
+		job, err := NormalizeJob(params)
+		if err != nil {
+			log.Errorf("Dropping malformed job: %v", err)
+			return nil
+		}
+		message["params"] = job
+	} else if result, ok := message["result"].(map[string]interface{}); ok {
+		params, ok := result["job"].(map[string]interface{})
+		if !ok {
+			return line
+		}
+		job, err := NormalizeJob(params)
+		if err != nil {
+			// Keep the login response so that we wait for the next job
+			log.Errorf("Ignoring malformed login job: %v", err)
+			delete(result, "job")
+		} else {
+			result["job"] = job
+		}
+	} else {
+		return line
+	}
+
+	b, err := json.Marshal(message)
+	if err != nil {
+		return line
+	}
+	return append(b, '\n')
+}
@@ -0,0 +1,140 @@
+package miner
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBlob = "0707f7a4f0d605b303260816ba3f10902e1a145ac5fad3aa3af6ea44c11869dc4f853f002b2eea0000000077b206a02ca5b1d4ce6bbfdf0acac38bded34d2dcdeef95cd20cefc12f61d56109"
+
+func normalizeTestMessage(t *testing.T, message string) map[string]interface{} {
+	require := require.New(t)
+
+	b := NormalizeMessage([]byte(message + "\n"))
+	if b == nil {
+		return nil
+	}
+	require.True(strings.HasSuffix(string(b), "\n"))
+	var ret map[string]interface{}
+	require.Nil(json.Unmarshal(b, &ret))
+	return ret
+}
+
+func TestNormalizeMessage(t *testing.T) {
+	require := require.New(t)
+
+	// Captured from a variety of pools, with wallets and ids shortened
+	testCases := []struct {
+		name    string
+		message string
+		jobID   string
+		target  string
+	}{
+		{
+			"monero pool job",
+			`{"jsonrpc":"2.0","method":"job","params":{"blob":"` + testBlob + `","job_id":"NxQ5PBw6hFmAj4nB0vuzv5AjDcTl","target":"b88d0600","id":"817125"}}`,
+			"NxQ5PBw6hFmAj4nB0vuzv5AjDcTl",
+			"b88d0600",
+		},
+		{
+			"nicehash job with an 8-byte target",
+			`{"method":"job","params":{"blob":"` + strings.ToUpper(testBlob) + `","job_id":"0000000b8a7c2f41","target":"e4a63d0000000000","height":1663722}}`,
+			"0000000b8a7c2f41",
+			"e4a63d0000000000",
+		},
+		{
+			"numeric job id",
+			`{"jsonrpc":"2.0","method":"job","params":{"blob":"` + testBlob + `","job_id":174502,"target":"0x711b0d00"}}`,
+			"174502",
+			"711b0d00",
+		},
+		{
+			"difficulty instead of target",
+			`{"jsonrpc":"2.0","method":"job","params":{"hashing_blob":"` + testBlob + `","jobid":"a1b2","difficulty":5000}}`,
+			"a1b2",
+			targetHex(0xFFFFFFFFFFFFFFFF / 5000),
+		},
+		{
+			"256-bit big-endian target",
+			`{"jsonrpc":"2.0","method":"job","params":{"blob":"` + testBlob + `","job_id":"xyz","target":"0000346dc5d63886594af4f0d844d013a92a305532617c1bda5119ce075f6fd2"}}`,
+			"xyz",
+			targetHex(0x0000346dc5d63886),
+		},
+		{
+			"xmrig-proxy login response",
+			`{"id":1,"jsonrpc":"2.0","error":null,"result":{"id":"2bb1a7b5","job":{"blob":"` + testBlob + `","job_id":"DLb0A1+0yXq8C+RZ","target":"9bc40700","algo":"cn/0","height":1663723,"seed_hash":""},"extensions":["algo","nicehash"],"status":"OK"}}`,
+			"DLb0A1+0yXq8C+RZ",
+			"9bc40700",
+		},
+	}
+
+	for _, tc := range testCases {
+		message := normalizeTestMessage(t, tc.message)
+		require.NotNil(message, tc.name)
+		job, ok := message["params"].(map[string]interface{})
+		if !ok {
+			job = message["result"].(map[string]interface{})["job"].(map[string]interface{})
+		}
+		require.Equal(tc.jobID, job["job_id"], tc.name)
+		require.Equal(testBlob, job["blob"], tc.name)
+		require.Equal(tc.target, job["target"], tc.name)
+	}
+}
+
+func TestNormalizeMessageMalformed(t *testing.T) {
+	require := require.New(t)
+
+	// Truncated blob
+	require.Nil(normalizeTestMessage(t, `{"method":"job","params":{"blob":"0707f7a4","job_id":"1","target":"b88d0600"}}`))
+	// Missing job id
+	require.Nil(normalizeTestMessage(t, `{"method":"job","params":{"blob":"`+testBlob+`","target":"b88d0600"}}`))
+	// Garbage target
+	require.Nil(normalizeTestMessage(t, `{"method":"job","params":{"blob":"`+testBlob+`","job_id":"1","target":"zz"}}`))
+
+	// A login response with a malformed job is kept, minus the job
+	message := normalizeTestMessage(t, `{"id":1,"result":{"id":"abc","job":{"blob":"","job_id":"1"},"status":"OK"}}`)
+	require.NotNil(message)
+	_, ok := message["result"].(map[string]interface{})["job"]
+	require.False(ok)
+}
+
+func TestNormalizeMessagePassthrough(t *testing.T) {
+	require := require.New(t)
+
+	for _, message := range []string{
+		`{"id":2,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}`,
+		`{"id":3,"jsonrpc":"2.0","error":{"code":-1,"message":"Low difficulty share"}}`,
+		`not json`,
+	} {
+		require.Equal(message+"\n", string(NormalizeMessage([]byte(message+"\n"))))
+	}
+}
+
+func TestNormalizeMessageProxyDifficulty(t *testing.T) {
+	require := require.New(t)
+
+	// Captured from a proxy that assigns its own difficulty but passes the
+	// target of the upstream pool through
+	message := normalizeTestMessage(t, `{"jsonrpc":"2.0","method":"job","params":{"blob":"`+testBlob+`","job_id":"pxy-4f1c","target":"b88d0600","difficulty":40000,"id":"a81f3b"}}`)
+	require.NotNil(message)
+	job := message["params"].(map[string]interface{})
+	require.Equal(targetHex(0xFFFFFFFFFFFFFFFF/40000), job["target"])
+	require.Equal(uint64(40000), DifficultyFromTarget(JobTarget("pxy-4f1c", 0)))
+
+	// A hash at the difficulty of the upstream target doesn't meet the
+	// difficulty of the proxy
+	hash := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hash[24:], 0xFFFFFFFFFFFFFFFF/20000)
+	require.False(MeetsTarget("pxy-4f1c", 0, hash))
+	binary.LittleEndian.PutUint64(hash[24:], 0xFFFFFFFFFFFFFFFF/40001)
+	require.True(MeetsTarget("pxy-4f1c", 0, hash))
+
+	// A difficulty below that of the target doesn't lower it
+	message = normalizeTestMessage(t, `{"jsonrpc":"2.0","method":"job","params":{"blob":"`+testBlob+`","job_id":"pxy-4f1d","target":"b88d0600","difficulty":5000}}`)
+	require.NotNil(message)
+	require.Equal("b88d0600", message["params"].(map[string]interface{})["target"])
+}
@@ -0,0 +1,40 @@
+package miner
+
+import "sync"
+
+// maxJobHeights is the number of job heights that are kept
+var maxJobHeights = 32
+
+// jobHeights remembers the block heights that pools send with jobs. The
+// stratum client doesn't carry them, and algorithms like cn/r need them to
+// hash the job
+var jobHeights = struct {
+	sync.Mutex
+	heights map[string]uint64
+	order   []string
+}{
+	heights: make(map[string]uint64),
+}
+
+// RecordJobHeight remembers the block height of a job
+func RecordJobHeight(jobID string, height uint64) {
+	jobHeights.Lock()
+	defer jobHeights.Unlock()
+	if _, ok := jobHeights.heights[jobID]; !ok {
+		jobHeights.order = append(jobHeights.order, jobID)
+	}
+	jobHeights.heights[jobID] = height
+	for len(jobHeights.order) > maxJobHeights {
+		delete(jobHeights.heights, jobHeights.order[0])
+		jobHeights.order = jobHeights.order[1:]
+	}
+}
+
+// JobHeight returns the block height of the job with the given id. ok is
+// false if the pool didn't send one
+func JobHeight(jobID string) (height uint64, ok bool) {
+	jobHeights.Lock()
+	defer jobHeights.Unlock()
+	height, ok = jobHeights.heights[jobID]
+	return height, ok
+}
@@ -0,0 +1,37 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHeight(t *testing.T) {
+	require := require.New(t)
+
+	_, ok := JobHeight("height-unknown")
+	require.False(ok)
+
+	job, err := NormalizeJob(map[string]interface{}{
+		"job_id": "height-1",
+		"blob":   testBlob,
+		"target": "b88d0600",
+		"height": float64(1806260),
+	})
+	require.Nil(err)
+	require.NotNil(job)
+	height, ok := JobHeight("height-1")
+	require.True(ok)
+	require.Equal(uint64(1806260), height)
+
+	// Only the most recent jobs are kept
+	for i := 0; i < maxJobHeights; i++ {
+		RecordJobHeight(fmt.Sprintf("height-%d", i+2), uint64(i))
+	}
+	_, ok = JobHeight("height-1")
+	require.False(ok)
+	height, ok = JobHeight(fmt.Sprintf("height-%d", maxJobHeights+1))
+	require.True(ok)
+	require.Equal(uint64(maxJobHeights-1), height)
+}
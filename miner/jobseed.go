@@ -0,0 +1,52 @@
+package miner
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// maxJobSeeds is the number of job seeds that are kept
+var maxJobSeeds = 32
+
+// jobSeeds remembers the RandomX seed hashes that pools send with jobs. Like
+// the block heights in jobHeights, the stratum client doesn't carry them
+var jobSeeds = struct {
+	sync.Mutex
+	seeds map[string][]byte
+	order []string
+}{
+	seeds: make(map[string][]byte),
+}
+
+// RecordJobSeed remembers the seed hash of a job
+func RecordJobSeed(jobID string, seed []byte) {
+	jobSeeds.Lock()
+	defer jobSeeds.Unlock()
+	if _, ok := jobSeeds.seeds[jobID]; !ok {
+		jobSeeds.order = append(jobSeeds.order, jobID)
+	}
+	jobSeeds.seeds[jobID] = seed
+	for len(jobSeeds.order) > maxJobSeeds {
+		delete(jobSeeds.seeds, jobSeeds.order[0])
+		jobSeeds.order = jobSeeds.order[1:]
+	}
+}
+
+// JobSeed returns the seed hash of the job with the given id. ok is false if
+// the pool didn't send one
+func JobSeed(jobID string) (seed []byte, ok bool) {
+	jobSeeds.Lock()
+	defer jobSeeds.Unlock()
+	seed, ok = jobSeeds.seeds[jobID]
+	return seed, ok
+}
+
+// recordJobSeedHex remembers the hex encoded seed hash of a job. Seeds that
+// aren't valid hex are ignored
+func recordJobSeedHex(jobID string, seedHex string) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) == 0 {
+		return
+	}
+	RecordJobSeed(jobID, seed)
+}
@@ -0,0 +1,48 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobSeed(t *testing.T) {
+	require := require.New(t)
+
+	_, ok := JobSeed("seed-unknown")
+	require.False(ok)
+
+	job, err := NormalizeJob(map[string]interface{}{
+		"job_id":    "seed-1",
+		"blob":      testBlob,
+		"target":    "b88d0600",
+		"seed_hash": "3132333435363738393031323334353637383930313233343536373839303132",
+	})
+	require.Nil(err)
+	require.NotNil(job)
+	seed, ok := JobSeed("seed-1")
+	require.True(ok)
+	require.Equal([]byte("12345678901234567890123456789012"), seed)
+
+	// Invalid seeds are ignored
+	_, err = NormalizeJob(map[string]interface{}{
+		"job_id":    "seed-invalid",
+		"blob":      testBlob,
+		"target":    "b88d0600",
+		"seed_hash": "not hex",
+	})
+	require.Nil(err)
+	_, ok = JobSeed("seed-invalid")
+	require.False(ok)
+
+	// Only the most recent jobs are kept
+	for i := 0; i < maxJobSeeds; i++ {
+		RecordJobSeed(fmt.Sprintf("seed-%d", i+2), []byte{byte(i)})
+	}
+	_, ok = JobSeed("seed-1")
+	require.False(ok)
+	seed, ok = JobSeed(fmt.Sprintf("seed-%d", maxJobSeeds+1))
+	require.True(ok)
+	require.Equal([]byte{byte(maxJobSeeds - 1)}, seed)
+}
@@ -0,0 +1,211 @@
+package miner
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultLogFileMaxSize is the size in MB a log file is allowed to grow
+	// to before it is rotated
+	DefaultLogFileMaxSize = 10
+	// DefaultLogFileBackups is the number of rotated log files that are kept
+	DefaultLogFileBackups = 3
+
+	ansiEscapeRegex = regexp.MustCompile("\x1B\\[[0-9;]*m")
+)
+
+// RotatingFile is an io.WriteCloser that appends to a file and rotates it
+// once it grows past maxSize bytes. Rotated files are named path.1, path.2..
+// with path.1 being the most recent one, and get a .gz suffix if they are
+// compressed
+type RotatingFile struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	compress   bool
+	file       *os.File
+	size       int64
+}
+
+// OpenRotatingFile opens path for appending, creating it if necessary
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// SetCompress sets whether rotated files are compressed with gzip
+func (f *RotatingFile) SetCompress(compress bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.compress = compress
+}
+
+// backup returns the name of the i-th rotated file
+func (f *RotatingFile) backup(i int) string {
+	name := fmt.Sprintf("%s.%d", f.path, i)
+	if f.compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// compressFile writes src compressed with gzip to dst and removes src
+func compressFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(dst+".tmp", dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			os.Rename(f.backup(i), f.backup(i+1))
+		}
+		if f.compress {
+			if err := compressFile(f.path, f.backup(1)); err != nil {
+				return err
+			}
+		} else if err := os.Rename(f.path, f.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Write appends p to the file, rotating it first if p would push the file
+// past its maximum size
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("Failed to rotate log file: %v", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file
+func (f *RotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Close()
+}
+
+// FileHook is a logrus hook that writes every log entry to a file without
+// any color codes, irrespective of the formatter used for the console
+type FileHook struct {
+	writer    io.Writer
+	formatter log.Formatter
+}
+
+// NewFileHook returns a FileHook writing to w
+func NewFileHook(w io.Writer) *FileHook {
+	return &FileHook{
+		w,
+		&log.TextFormatter{DisableColors: true, FullTimestamp: true},
+	}
+}
+
+// Levels returns all log levels
+func (h *FileHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire writes entry to the file
+func (h *FileHook) Fire(entry *log.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	// Some messages such as the hashrate carry their own color codes
+	_, err = h.writer.Write(ansiEscapeRegex.ReplaceAll(b, nil))
+	return err
+}
+
+// SetupLogFile directs log output to config.LogFile if it is set. Console
+// output is kept only if config.LogToStdout is set. The returned file should
+// be closed on exit and is nil if no log file is configured
+func SetupLogFile(config *Config) (*RotatingFile, error) {
+	if config.LogFile == nil || len(*config.LogFile) == 0 {
+		return nil, nil
+	}
+	maxSize := config.LogFileMaxSize
+	if maxSize == 0 {
+		maxSize = DefaultLogFileMaxSize
+	}
+	backups := config.LogFileBackups
+	if backups == 0 {
+		backups = DefaultLogFileBackups
+	}
+	f, err := OpenRotatingFile(*config.LogFile, int64(maxSize)*1024*1024, backups)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open log file '%v': %v", *config.LogFile, err)
+	}
+	f.SetCompress(config.LogFileCompress)
+	log.AddHook(NewFileHook(f))
+	if !config.LogToStdout {
+		log.SetOutput(ioutil.Discard)
+	}
+	return f, nil
+}
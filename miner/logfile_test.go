@@ -0,0 +1,107 @@
+package miner
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "rotating-file")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "miner.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	require.Nil(err)
+	defer f.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("line-%d\n", i)))
+		require.Nil(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(err)
+	require.Equal("line-3\n", string(data))
+
+	data, err = ioutil.ReadFile(path + ".1")
+	require.Nil(err)
+	require.Equal("line-2\n", string(data))
+
+	data, err = ioutil.ReadFile(path + ".2")
+	require.Nil(err)
+	require.Equal("line-1\n", string(data))
+
+	// Only 2 backups are kept
+	_, err = os.Stat(path + ".3")
+	require.True(os.IsNotExist(err))
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "rotating-file")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "miner.log")
+	require.Nil(ioutil.WriteFile(path, []byte("existing\n"), 0644))
+
+	f, err := OpenRotatingFile(path, 1024, 1)
+	require.Nil(err)
+	_, err = f.Write([]byte("new\n"))
+	require.Nil(err)
+	require.Nil(f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(err)
+	require.Equal("existing\nnew\n", string(data))
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "rotating-file")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "miner.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	require.Nil(err)
+	f.SetCompress(true)
+	defer f.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("line-%d\n", i)))
+		require.Nil(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(err)
+	require.Equal("line-3\n", string(data))
+
+	for i, expected := range []string{"line-2\n", "line-1\n"} {
+		gz, err := os.Open(fmt.Sprintf("%s.%d.gz", path, i+1))
+		require.Nil(err)
+		zr, err := gzip.NewReader(gz)
+		require.Nil(err)
+		data, err := ioutil.ReadAll(zr)
+		gz.Close()
+		require.Nil(err)
+		require.Equal(expected, string(data))
+	}
+
+	// Neither uncompressed backups nor partial files are left behind
+	for _, name := range []string{".1", ".1.gz.tmp", ".3.gz"} {
+		_, err = os.Stat(path + name)
+		require.True(os.IsNotExist(err), name)
+	}
+}
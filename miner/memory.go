@@ -0,0 +1,18 @@
+package miner
+
+// FitThreads returns the number of threads, at most threads, whose
+// scratchpads for algo fit in maxMemory MB. A maxMemory of 0 means
+// unlimited. At least one thread is always returned
+func FitThreads(threads int, algo string, maxMemory int) int {
+	if maxMemory <= 0 {
+		return threads
+	}
+	fit := maxMemory * 1024 * 1024 / ScratchpadSize(algo)
+	if fit < 1 {
+		fit = 1
+	}
+	if fit < threads {
+		return fit
+	}
+	return threads
+}
@@ -0,0 +1,22 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitThreads(t *testing.T) {
+	require := require.New(t)
+
+	// Unlimited
+	require.Equal(8, FitThreads(8, "cn/0", 0))
+
+	require.Equal(8, FitThreads(8, "cn/0", 16))
+	require.Equal(4, FitThreads(8, "cn/0", 9))
+	require.Equal(2, FitThreads(8, "cn-heavy/0", 9))
+	require.Equal(8, FitThreads(8, "cn-lite/0", 9))
+
+	// A single scratchpad that doesn't fit still leaves one thread
+	require.Equal(1, FitThreads(8, "cn-heavy/0", 1))
+}
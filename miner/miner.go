@@ -1,6 +1,9 @@
 package miner
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/set"
@@ -11,19 +14,66 @@ import (
 type Miner struct {
 	id                uint32
 	hashrateListeners set.Interface
+	throttle          atomic.Value // *Throttle
+	algo              atomic.Value // string
+	pauseLock         sync.Mutex
+	pauseCond         *sync.Cond
+	paused            bool
+	restart           chan struct{}
 }
 
 type Interface interface {
 	Id() uint32
 	Run() error
 	RegisterHashrateListener(chan *HashRate)
+	SetMaxHashRate(float64)
+	Algorithm() string
+	SetAlgorithm(string) error
+	Restart() error
+}
+
+// minerCount is the number of ids handed out by NextMinerID
+var minerCount uint32
+
+// NextMinerID returns the id of a new miner. CPU and GPU miners share the
+// ids, so that miners of both kinds can run in one process and split the
+// nonce space among all of them
+func NextMinerID() uint32 {
+	return atomic.AddUint32(&minerCount, 1) - 1
+}
+
+// MinerCount returns the number of miners that were given an id by
+// NextMinerID
+func MinerCount() uint32 {
+	return atomic.LoadUint32(&minerCount)
+}
+
+// StartMiners runs every miner in its own goroutine, waiting stagger between
+// starting one miner and the next so that they don't all allocate their
+// scratchpads at once
+func StartMiners(miners []Interface, stagger time.Duration) {
+	for i, m := range miners {
+		if i > 0 && stagger > 0 {
+			time.Sleep(stagger)
+		}
+		go m.Run()
+	}
 }
 
 func New(id uint32) *Miner {
 	m := &Miner{
 		id,
 		set.New(),
+		atomic.Value{},
+		atomic.Value{},
+		sync.Mutex{},
+		nil,
+		false,
+		make(chan struct{}, 1),
 	}
+	m.throttle.Store((*Throttle)(nil))
+	m.algo.Store(DefaultAlgorithm)
+	m.pauseCond = sync.NewCond(&m.pauseLock)
 	return m
 }
 
@@ -35,6 +85,97 @@ func (m *Miner) RegisterHashrateListener(hrChan chan *HashRate) {
 	m.hashrateListeners.Add(hrChan)
 }
 
+// SetMaxHashRate limits this miner to maxHashRate H/s. A value <= 0 removes
+// any limit. It may be called while the miner is running
+func (m *Miner) SetMaxHashRate(maxHashRate float64) {
+	if maxHashRate <= 0 {
+		m.throttle.Store((*Throttle)(nil))
+		return
+	}
+	m.throttle.Store(NewThrottle(maxHashRate))
+}
+
+// Algorithm returns the algorithm this miner runs. It may be called while
+// another goroutine switches algorithms
+func (m *Miner) Algorithm() string {
+	return m.algo.Load().(string)
+}
+
+// SetAlgorithm sets the algorithm this miner runs. An empty algo selects
+// DefaultAlgorithm. Run loops cache the algorithm, so a change restarts them
+// to pick it up
+func (m *Miner) SetAlgorithm(algo string) error {
+	algo = NormalizeAlgorithm(algo)
+	if !IsAlgorithmSupported(algo) {
+		return fmt.Errorf("Unsupported algorithm '%v'", algo)
+	}
+	previous := m.Algorithm()
+	m.algo.Store(algo)
+	if previous != algo {
+		m.Restart()
+	}
+	return nil
+}
+
+// Pause stops this miner the next time it reports hashes, until Resume is
+// called
+func (m *Miner) Pause() {
+	m.pauseLock.Lock()
+	defer m.pauseLock.Unlock()
+	if !m.paused {
+		log.Infof("miner-%d: Paused", m.id)
+	}
+	m.paused = true
+}
+
+// Resume lets a paused miner continue
+func (m *Miner) Resume() {
+	m.pauseLock.Lock()
+	defer m.pauseLock.Unlock()
+	if m.paused {
+		log.Infof("miner-%d: Resumed", m.id)
+	}
+	m.paused = false
+	m.pauseCond.Broadcast()
+}
+
+// Paused returns true if this miner has been paused
+func (m *Miner) Paused() bool {
+	m.pauseLock.Lock()
+	defer m.pauseLock.Unlock()
+	return m.paused
+}
+
+// waitWhilePaused blocks for as long as this miner is paused
+func (m *Miner) waitWhilePaused() {
+	m.pauseLock.Lock()
+	defer m.pauseLock.Unlock()
+	for m.paused {
+		m.pauseCond.Wait()
+	}
+}
+
+// Restart asks the run loop of this miner to stop hashing, set up its
+// context again and carry on with the current job. The other miners are not
+// affected. Requests that arrive before the run loop gets to them are
+// coalesced
+func (m *Miner) Restart() error {
+	select {
+	case m.restart <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Restarting returns a channel that receives a value when Restart has been
+// called. Run loops should check it between batches of hashes
+func (m *Miner) Restarting() <-chan struct{} {
+	return m.restart
+}
+
+// InformHashrate reports hashes computed by this miner. It blocks while the
+// miner is throttled or paused, so run loops should call it after every
+// batch of hashes
 func (m *Miner) InformHashrate(hashes uint32) {
 	data := &HashRate{
 		hashes,
@@ -44,8 +185,17 @@ func (m *Miner) InformHashrate(hashes uint32) {
 		hrChan := obj.(chan *HashRate)
 		hrChan <- data
 	}
+	DefaultEventBus.Publish(&Event{HashrateSample, data.Time, m.id, data})
+	if throttle := m.throttle.Load().(*Throttle); throttle != nil {
+		throttle.Wait(hashes)
+	}
+	m.waitWhilePaused()
 }
 
-func (m *Miner) LogNewWork(sc *stratum.StratumContext, work *stratum.Work) {
-	log.Debugf("miner-%d: New work from %s diff %d", m.Id(), sc.Conn.RemoteAddr(), uint32(work.Difficulty))
+func (m *Miner) LogNewWork(source WorkSource, work *stratum.Work) {
+	from := "daemon"
+	if sc, ok := source.(*stratum.StratumContext); ok && sc.Conn != nil {
+		from = sc.Conn.RemoteAddr().String()
+	}
+	log.Debugf("miner-%d: New work from %s diff %d", m.Id(), from, uint32(work.Difficulty))
 }
@@ -0,0 +1,156 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	m := New(0)
+	require.Equal(DefaultAlgorithm, m.Algorithm())
+
+	require.Nil(m.SetAlgorithm("cryptonight"))
+	require.Equal("cn/0", m.Algorithm())
+
+	require.NotNil(m.SetAlgorithm("unknown-algo"))
+	require.Equal("cn/0", m.Algorithm())
+}
+
+func TestSetAlgorithmRestarts(t *testing.T) {
+	require := require.New(t)
+
+	m := New(0)
+	// Run loops only look the algorithm up again when they are restarted
+	require.Nil(m.SetAlgorithm("cn/0"))
+	require.Len(m.Restarting(), 0)
+	require.Nil(m.SetAlgorithm("cn/2"))
+	require.Len(m.Restarting(), 1)
+	<-m.Restarting()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.SetAlgorithm("cn/r")
+			m.SetAlgorithm("cn/half")
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		m.Algorithm()
+	}
+	<-done
+}
+
+func TestSetMaxHashRateWhileMining(t *testing.T) {
+	m := New(0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.InformHashrate(1)
+		}
+	}()
+	// The limits are high enough for the miner not to be slowed down
+	for i := 0; i < 1000; i++ {
+		m.SetMaxHashRate(1e9)
+		m.SetMaxHashRate(0)
+	}
+	<-done
+}
+
+func TestPause(t *testing.T) {
+	require := require.New(t)
+
+	m := New(0)
+	require.False(m.Paused())
+
+	m.Pause()
+	require.True(m.Paused())
+
+	done := make(chan struct{})
+	go func() {
+		m.InformHashrate(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+		require.Fail("InformHashrate returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m.Resume()
+	require.False(m.Paused())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail("InformHashrate did not return after resuming")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	require := require.New(t)
+
+	m := New(0)
+	select {
+	case <-m.Restarting():
+		require.Fail("Restarting before Restart was called")
+	default:
+	}
+
+	// Requests are coalesced until the run loop gets to them
+	require.Nil(m.Restart())
+	require.Nil(m.Restart())
+	select {
+	case <-m.Restarting():
+	default:
+		require.Fail("Restart was not requested")
+	}
+	select {
+	case <-m.Restarting():
+		require.Fail("Restart was requested twice")
+	default:
+	}
+}
+
+type startedMiner struct {
+	*Miner
+	started chan time.Time
+}
+
+func (m *startedMiner) Run() error {
+	m.started <- time.Now()
+	return nil
+}
+
+func TestStartMiners(t *testing.T) {
+	require := require.New(t)
+
+	started := make(chan time.Time, 3)
+	miners := []Interface{
+		&startedMiner{New(0), started},
+		&startedMiner{New(1), started},
+		&startedMiner{New(2), started},
+	}
+	start := time.Now()
+	StartMiners(miners, 20*time.Millisecond)
+	require.True(time.Since(start) >= 40*time.Millisecond)
+	for i := 0; i < len(miners); i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			require.Fail("Miner was not started")
+		}
+	}
+
+	// Without a stagger all miners are started at once
+	start = time.Now()
+	StartMiners(miners, 0)
+	require.True(time.Since(start) < 20*time.Millisecond)
+	for i := 0; i < len(miners); i++ {
+		<-started
+	}
+}
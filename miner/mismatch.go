@@ -0,0 +1,196 @@
+package miner
+
+import (
+	"strings"
+	"sync"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// AlgoMismatchRejectLimit is the number of consecutive rejected shares
+	// after a (re)connect, without any accepted share, after which an
+	// algorithm mismatch is reported
+	AlgoMismatchRejectLimit = 5
+
+	// DefaultAlgorithm is the algorithm implemented by the miners
+	DefaultAlgorithm = "cn/0"
+
+	algoAliases = map[string]string{
+		"":                     DefaultAlgorithm,
+		"cn":                   DefaultAlgorithm,
+		"cryptonight":          DefaultAlgorithm,
+		"cryptonight/0":        DefaultAlgorithm,
+		"cryptonight-lite":     "cn-lite/0",
+		"cryptonight_lite":     "cn-lite/0",
+		"cryptonight-heavy":    "cn-heavy/0",
+		"cryptonight_heavy":    "cn-heavy/0",
+		"cryptonight/2":        "cn/2",
+		"cryptonight_v8":       "cn/2",
+		"cryptonight-v8":       "cn/2",
+		"cryptonight-monerov8": "cn/2",
+		"cryptonight/r":        "cn/r",
+		"cryptonight_r":        "cn/r",
+		"cryptonight-r":        "cn/r",
+		"cn-r":                 "cn/r",
+		"cryptonight/half":     "cn/half",
+		"cryptonight_half":     "cn/half",
+		"cryptonight-half":     "cn/half",
+		"cn-half":              "cn/half",
+		"cryptonight/gpu":      "cn/gpu",
+		"cryptonight_gpu":      "cn/gpu",
+		"cryptonight-gpu":      "cn/gpu",
+		"cn-gpu":               "cn/gpu",
+		"rx":                   "rx/0",
+		"randomx":              "rx/0",
+		"rx/monero":            "rx/0",
+		"cn-pico":              "cn-pico/trtl",
+		"cn-trtl":              "cn-pico/trtl",
+		"cryptonight-turtle":   "cn-pico/trtl",
+		"cryptonight_turtle":   "cn-pico/trtl",
+		"chukwa":               "argon2/chukwa",
+		"argon2-chukwa":        "argon2/chukwa",
+		"argon2_chukwa":        "argon2/chukwa",
+		"chukwav2":             "argon2/chukwav2",
+		"argon2-chukwav2":      "argon2/chukwav2",
+		"argon2_chukwav2":      "argon2/chukwav2",
+		"astrobwt/dero":        "astrobwt",
+		"astro-bwt":            "astrobwt",
+	}
+)
+
+// SupportedAlgorithms is the set of algorithms that miners can run. RandomX,
+// the Argon2 algorithms and AstroBWT only run on the CPU
+var SupportedAlgorithms = []string{DefaultAlgorithm, "cn/2", "cn/r", "cn/half", "cn/gpu", "cn-heavy/0", "cn-lite/0", "cn-pico/trtl", "rx/0", "argon2/chukwa", "argon2/chukwav2", "astrobwt"}
+
+// IsAlgorithmSupported returns true if algo is in SupportedAlgorithms
+func IsAlgorithmSupported(algo string) bool {
+	algo = NormalizeAlgorithm(algo)
+	for _, supported := range SupportedAlgorithms {
+		if algo == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeAlgorithm maps the various names of an algorithm used by pools
+// and configs onto a single name
+func NormalizeAlgorithm(algo string) string {
+	algo = strings.ToLower(strings.TrimSpace(algo))
+	if alias, ok := algoAliases[algo]; ok {
+		return alias
+	}
+	return algo
+}
+
+// LoginAlgorithm returns the algorithm that the pool announced in its login
+// response, if any
+func LoginAlgorithm(response *stratum.Response) (string, bool) {
+	if response.Result == nil {
+		return "", false
+	}
+	job, ok := response.Result["job"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	algo, ok := job["algo"].(string)
+	if !ok || len(algo) == 0 {
+		return "", false
+	}
+	return algo, true
+}
+
+// AlgoMismatchDetector turns a run of rejected shares right after connecting
+// into an actionable warning about a possible algorithm mismatch
+type AlgoMismatchDetector struct {
+	sync.Mutex
+	algo     string
+	rejects  int
+	accepted bool
+	reported bool
+}
+
+// NewAlgoMismatchDetector returns a detector for miners running algo
+func NewAlgoMismatchDetector(algo string) *AlgoMismatchDetector {
+	return &AlgoMismatchDetector{
+		algo: NormalizeAlgorithm(algo),
+	}
+}
+
+// HandleEvent updates the detector with event and returns true if a mismatch
+// was reported as a result of it
+func (d *AlgoMismatchDetector) HandleEvent(event *Event) bool {
+	d.Lock()
+	defer d.Unlock()
+	switch event.Kind {
+	case Connected:
+		d.rejects = 0
+		d.accepted = false
+		d.reported = false
+	case ShareAccepted:
+		d.accepted = true
+	case ShareRejected:
+		if d.accepted || d.reported {
+			return false
+		}
+		d.rejects++
+		if d.rejects < AlgoMismatchRejectLimit {
+			return false
+		}
+		d.reported = true
+		reason := ""
+		if response, ok := event.Payload.(*stratum.Response); ok {
+			reason = responseErrorMessage(response)
+		}
+		log.Errorf("**********************************************************************")
+		log.Errorf("The pool rejected the first %d shares since connecting: %v", d.rejects, reason)
+		log.Errorf("This usually means the pool expects a different algorithm than '%v'", d.algo)
+		log.Errorf("**********************************************************************")
+		return true
+	}
+	return false
+}
+
+// HandleLogin checks the algorithm announced by the pool in its login
+// response against the one we are running and returns false on a mismatch.
+// An algorithm that we offered in LoginAlgorithms is no mismatch, since the
+// miners switch to it
+func (d *AlgoMismatchDetector) HandleLogin(response *stratum.Response) bool {
+	algo, ok := LoginAlgorithm(response)
+	if !ok {
+		return true
+	}
+	if NormalizeAlgorithm(algo) == d.algo {
+		return true
+	}
+	for _, offered := range LoginAlgorithms {
+		if NormalizeAlgorithm(algo) == offered {
+			log.Infof("Pool selected algorithm '%v' out of the ones we offered", NormalizeAlgorithm(algo))
+			return true
+		}
+	}
+	log.Errorf("Pool expects algorithm '%v' but miners are running '%v'. Set 'algo: %v' in the config if it is supported", algo, d.algo, algo)
+	return false
+}
+
+// RunAlgoMismatchDetector watches sc and DefaultEventBus for signs that algo
+// is not what the pool expects. This function is expected to be run in a
+// goroutine
+func RunAlgoMismatchDetector(sc *stratum.StratumContext, algo string) {
+	d := NewAlgoMismatchDetector(algo)
+	eventChan := make(chan *Event, 10)
+	responseChan := make(chan *stratum.Response, 10)
+	RegisterEventListener(eventChan)
+	sc.RegisterResponseListener(responseChan)
+
+	for {
+		select {
+		case event := <-eventChan:
+			d.HandleEvent(event)
+		case response := <-responseChan:
+			d.HandleLogin(response)
+		}
+	}
+}
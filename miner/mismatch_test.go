@@ -0,0 +1,83 @@
+package miner
+
+import (
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("cn/0", NormalizeAlgorithm(""))
+	require.Equal("cn/0", NormalizeAlgorithm("Cryptonight"))
+	require.Equal("cn/r", NormalizeAlgorithm("cn/r"))
+	require.Equal("cn/2", NormalizeAlgorithm("cryptonight_v8"))
+	require.Equal("cn/2", NormalizeAlgorithm("CryptoNight-MoneroV8"))
+	require.True(IsAlgorithmSupported("cn/2"))
+	require.Equal("cn/r", NormalizeAlgorithm("cryptonight_r"))
+	require.True(IsAlgorithmSupported("cn/r"))
+	require.Equal("cn-heavy/0", NormalizeAlgorithm("cryptonight_heavy"))
+	require.True(IsAlgorithmSupported("cryptonight-heavy"))
+	require.Equal("cn-pico/trtl", NormalizeAlgorithm("cn-pico"))
+	require.True(IsAlgorithmSupported("cryptonight_turtle"))
+	require.Equal("cn/half", NormalizeAlgorithm("CryptoNight/Half"))
+	require.True(IsAlgorithmSupported("cn-half"))
+	require.Equal("cn/gpu", NormalizeAlgorithm("cryptonight_gpu"))
+	require.True(IsAlgorithmSupported("cn-gpu"))
+	require.Equal("rx/0", NormalizeAlgorithm("RandomX"))
+	require.True(IsAlgorithmSupported("rx/0"))
+	require.Equal("argon2/chukwa", NormalizeAlgorithm("chukwa"))
+	require.Equal("argon2/chukwav2", NormalizeAlgorithm("argon2_chukwav2"))
+	require.Equal("astrobwt", NormalizeAlgorithm("AstroBWT/Dero"))
+	require.True(IsAlgorithmSupported("astrobwt"))
+	require.False(IsAlgorithmSupported("cn/fast"))
+}
+
+func TestAlgoMismatchDetector(t *testing.T) {
+	require := require.New(t)
+
+	rejected := NewEvent(ShareRejected, 0, &stratum.Response{
+		Error: map[string]interface{}{"code": -1, "message": "Low difficulty share"},
+	})
+
+	d := NewAlgoMismatchDetector("cryptonight")
+	d.HandleEvent(NewEvent(Connected, 0, nil))
+	for i := 0; i < AlgoMismatchRejectLimit-1; i++ {
+		require.False(d.HandleEvent(rejected))
+	}
+	require.True(d.HandleEvent(rejected))
+	// Reported only once per connection
+	require.False(d.HandleEvent(rejected))
+
+	// Rejects after an accepted share are not a mismatch
+	d.HandleEvent(NewEvent(Connected, 0, nil))
+	d.HandleEvent(NewEvent(ShareAccepted, 0, nil))
+	for i := 0; i < AlgoMismatchRejectLimit; i++ {
+		require.False(d.HandleEvent(rejected))
+	}
+}
+
+func TestAlgoMismatchDetectorLogin(t *testing.T) {
+	require := require.New(t)
+
+	d := NewAlgoMismatchDetector("")
+	login := func(algo string) *stratum.Response {
+		return &stratum.Response{
+			Result: map[string]interface{}{
+				"status": "OK",
+				"job":    map[string]interface{}{"algo": algo},
+			},
+		}
+	}
+	require.True(d.HandleLogin(login("cn/0")))
+	require.False(d.HandleLogin(login("rx/0")))
+	// Offered algorithms are switched to
+	LoginAlgorithms = []string{"cn/0", "rx/0"}
+	defer func() { LoginAlgorithms = nil }()
+	require.True(d.HandleLogin(login("RandomX")))
+	require.False(d.HandleLogin(login("cn/2")))
+	// No algo announced
+	require.True(d.HandleLogin(&stratum.Response{Result: map[string]interface{}{"status": "OK"}}))
+}
@@ -0,0 +1,150 @@
+package miner
+
+import "fmt"
+
+const (
+	// NonceSpace is the number of distinct 32-bit nonces
+	NonceSpace = uint64(1) << 32
+
+	// nicehashNonceSpace is the part of the nonce space left to the miner by
+	// nicehash-style pools, which reserve the most significant nonce byte
+	nicehashNonceSpace = uint64(1) << 24
+)
+
+// NonceRange is the half-open range [Start, End) of nonces assigned to a
+// miner. The bounds are 64-bit so that a range can extend to the very end of
+// the 32-bit nonce space without overflowing.
+type NonceRange struct {
+	Start uint64
+	End   uint64
+}
+
+// PartitionNonceSpace splits the nonce space into total disjoint ranges and
+// returns the one belonging to index. The last range absorbs the remainder
+// so that the whole nonce space is covered
+func PartitionNonceSpace(index, total uint32) NonceRange {
+	return NonceRange{0, NonceSpace}.Partition(index, total)
+}
+
+// Partition splits r into total disjoint ranges and returns the one
+// belonging to index. The last range absorbs the remainder so that all of r
+// is covered
+func (r NonceRange) Partition(index, total uint32) NonceRange {
+	if total == 0 {
+		total = 1
+	}
+	size := r.Size() / uint64(total)
+	start := r.Start + size*uint64(index)
+	end := start + size
+	if index == total-1 {
+		end = r.End
+	}
+	return NonceRange{start, end}
+}
+
+// NonceShard is the slice of the nonce space mined by this rig when several
+// rigs that don't coordinate otherwise mine the same jobs. Rig i of a
+// cluster uses Offset i*Stride, which makes the slices disjoint. Stride 0
+// extends the slice to the end of the nonce space
+type NonceShard struct {
+	Offset uint64
+	Stride uint64
+}
+
+// Range returns the nonces of the shard
+func (s NonceShard) Range() NonceRange {
+	if s.Stride == 0 {
+		return NonceRange{s.Offset, NonceSpace}
+	}
+	return NonceRange{s.Offset, s.Offset + s.Stride}
+}
+
+// Validate returns an error if the shard doesn't fit in the nonce space.
+// Nicehash-style pools reserve the most significant nonce byte to shard the
+// nonce space among their own clients, so with nicehash the shard must lie
+// within the 24 bits below that byte
+func (s NonceShard) Validate(nicehash bool) error {
+	space := NonceSpace
+	if nicehash {
+		space = nicehashNonceSpace
+	}
+	r := s.Range()
+	if s.Stride == 0 {
+		r.End = space
+	}
+	if r.Start >= r.End || r.End > space {
+		if nicehash {
+			return fmt.Errorf("Nonce offset %#x and stride %#x don't fit in the %#x nonces left by nicehash", s.Offset, s.Stride, space)
+		}
+		return fmt.Errorf("Nonce offset %#x and stride %#x don't fit in the nonce space", s.Offset, s.Stride)
+	}
+	return nil
+}
+
+// Partition returns the part of the shard mined by miner index out of total
+func (s NonceShard) Partition(index, total uint32) NonceRange {
+	return s.Range().Partition(index, total)
+}
+
+// RigNonceShard is the slice of the nonce space that the miners of this rig
+// partition among themselves. It must be set before the miners are started
+var RigNonceShard = NonceShard{0, 0}
+
+// RigNicehash is true if the miners of this rig mine for a nicehash-style
+// pool, so that they keep the nonce byte that the pool reserved in the job.
+// It is set along with RigNonceShard
+var RigNicehash = false
+
+// SetNonceShard makes the miners of this rig mine only nonce shard s
+func SetNonceShard(s NonceShard, nicehash bool) error {
+	if err := s.Validate(nicehash); err != nil {
+		return err
+	}
+	if nicehash && s.Stride == 0 {
+		s.Stride = nicehashNonceSpace - s.Offset
+	}
+	RigNonceShard = s
+	RigNicehash = nicehash
+	return nil
+}
+
+// Size returns the number of nonces in the range
+func (r NonceRange) Size() uint64 {
+	return r.End - r.Start
+}
+
+// NonceCounter hands out the nonces of a NonceRange in order and reports
+// when the range has been exhausted rather than wrapping around and reusing
+// nonces, which would only produce duplicate shares
+type NonceCounter struct {
+	NonceRange
+	next uint64
+}
+
+// Reset starts handing out nonces from the beginning of r
+func (c *NonceCounter) Reset(r NonceRange) {
+	c.NonceRange = r
+	c.next = r.Start
+}
+
+// Remaining returns the number of nonces that have not been handed out yet
+func (c *NonceCounter) Remaining() uint64 {
+	return c.End - c.next
+}
+
+// Next returns the next nonce in the range.
+// The second return value is false if the range has been exhausted
+func (c *NonceCounter) Next() (uint32, bool) {
+	return c.Reserve(1)
+}
+
+// Reserve reserves n consecutive nonces and returns the first of them.
+// The second return value is false if fewer than n nonces remain
+func (c *NonceCounter) Reserve(n uint32) (uint32, bool) {
+	if c.Remaining() < uint64(n) || n == 0 {
+		return 0, false
+	}
+	nonce := uint32(c.next)
+	c.next += uint64(n)
+	return nonce, true
+}
@@ -0,0 +1,122 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionNonceSpace(t *testing.T) {
+	require := require.New(t)
+
+	total := uint32(3)
+	covered := uint64(0)
+	prevEnd := uint64(0)
+	for i := uint32(0); i < total; i++ {
+		r := PartitionNonceSpace(i, total)
+		require.Equal(prevEnd, r.Start)
+		covered += r.Size()
+		prevEnd = r.End
+	}
+	require.Equal(NonceSpace, covered)
+	require.Equal(NonceSpace, prevEnd)
+}
+
+func TestNonceCounterBoundary(t *testing.T) {
+	require := require.New(t)
+
+	// The last partition ends at the very end of the 32-bit nonce space
+	c := NonceCounter{}
+	c.Reset(NonceRange{NonceSpace - 2, NonceSpace})
+
+	nonce, ok := c.Next()
+	require.True(ok)
+	require.Equal(uint32(0xFFFFFFFE), nonce)
+
+	nonce, ok = c.Next()
+	require.True(ok)
+	require.Equal(uint32(0xFFFFFFFF), nonce)
+
+	// Must not wrap around to 0
+	_, ok = c.Next()
+	require.False(ok)
+	require.Equal(uint64(0), c.Remaining())
+
+	// A new job resets the range
+	c.Reset(NonceRange{0, 10})
+	nonce, ok = c.Next()
+	require.True(ok)
+	require.Equal(uint32(0), nonce)
+}
+
+func TestNonceCounterReserve(t *testing.T) {
+	require := require.New(t)
+
+	c := NonceCounter{}
+	c.Reset(NonceRange{100, 110})
+
+	nonce, ok := c.Reserve(8)
+	require.True(ok)
+	require.Equal(uint32(100), nonce)
+
+	// Only 2 nonces remain
+	_, ok = c.Reserve(8)
+	require.False(ok)
+	nonce, ok = c.Reserve(2)
+	require.True(ok)
+	require.Equal(uint32(108), nonce)
+}
+
+func TestNonceShard(t *testing.T) {
+	require := require.New(t)
+
+	// Four rigs with their threads cover the nonce space exactly once
+	stride := NonceSpace / 4
+	prevEnd := uint64(0)
+	for rig := uint64(0); rig < 4; rig++ {
+		shard := NonceShard{rig * stride, stride}
+		require.Nil(shard.Validate(false))
+		for i := uint32(0); i < 3; i++ {
+			r := shard.Partition(i, 3)
+			require.Equal(prevEnd, r.Start)
+			prevEnd = r.End
+		}
+		require.Equal(shard.Offset+stride, prevEnd)
+	}
+	require.Equal(NonceSpace, prevEnd)
+
+	// The default shard is the whole nonce space
+	require.Equal(PartitionNonceSpace(1, 3), NonceShard{}.Partition(1, 3))
+	require.Equal(NonceRange{0x100, NonceSpace}, NonceShard{0x100, 0}.Range())
+
+	require.NotNil(NonceShard{NonceSpace, 0}.Validate(false))
+	require.NotNil(NonceShard{stride * 3, stride + 1}.Validate(false))
+
+	// Nicehash leaves only the low 24 bits to the miner
+	require.Nil(NonceShard{0x800000, 0x800000}.Validate(true))
+	require.NotNil(NonceShard{0x800000, 0x800001}.Validate(true))
+	require.NotNil(NonceShard{stride, stride}.Validate(true))
+}
+
+func TestSetNonceShard(t *testing.T) {
+	require := require.New(t)
+	defer func() {
+		RigNonceShard = NonceShard{}
+		RigNicehash = false
+	}()
+
+	require.NotNil(SetNonceShard(NonceShard{0x1000000, 0}, true))
+	require.Equal(NonceShard{}, RigNonceShard)
+
+	require.Nil(SetNonceShard(NonceShard{0x400000, 0}, true))
+	require.Equal(NonceRange{0x400000, 0x1000000}, RigNonceShard.Range())
+	require.True(RigNicehash)
+
+	config := Config{NonceOffset: 0x80000000, NonceStride: 0x40000000}
+	require.Nil(config.ApplyNonceShard())
+	require.Equal(NonceRange{0x80000000, 0xc0000000}, RigNonceShard.Range())
+	require.False(RigNicehash)
+
+	config.Pools = []Pool{{Nicehash: true}}
+	require.NotNil(config.ApplyNonceShard())
+}
@@ -0,0 +1,222 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultProbePings is the number of keepalive round trips ProbePool
+	// times
+	DefaultProbePings = 5
+
+	// probeTimeout is how long ProbePools waits for a pool to answer
+	probeTimeout = 10 * time.Second
+)
+
+// PoolProbe is how a pool answered ProbePool
+type PoolProbe struct {
+	Pool Pool
+	// Connect is the time to connect, including any TLS handshake, and
+	// Login the time from sending the login to its response
+	Connect time.Duration
+	Login   time.Duration
+	// Round trips of the keepalive requests sent after logging in
+	Pings []time.Duration
+	// Difficulty of the job sent with the login
+	Difficulty uint64
+	Algorithm  string
+	Err        error
+}
+
+// Latency returns the average keepalive round trip, or the login round trip
+// if no keepalive was answered
+func (p *PoolProbe) Latency() time.Duration {
+	if len(p.Pings) == 0 {
+		return p.Login
+	}
+	var total time.Duration
+	for _, ping := range p.Pings {
+		total += ping
+	}
+	return total / time.Duration(len(p.Pings))
+}
+
+// Jitter returns the spread between the fastest and slowest keepalive
+// round trip
+func (p *PoolProbe) Jitter() time.Duration {
+	if len(p.Pings) == 0 {
+		return 0
+	}
+	min, max := p.Pings[0], p.Pings[0]
+	for _, ping := range p.Pings[1:] {
+		if ping < min {
+			min = ping
+		}
+		if ping > max {
+			max = ping
+		}
+	}
+	return max - min
+}
+
+// probeRequest sends a request with the given id to the pool and waits for
+// its response, skipping any notifications sent in between
+func probeRequest(conn net.Conn, reader *bufio.Reader, id int, method string, params interface{}, timeout time.Duration) (map[string]interface{}, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"id":      id,
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if reply, ok := VersionReply(line); ok {
+			conn.Write(reply)
+			continue
+		}
+		message, ok := decodeMessage(line)
+		if !ok {
+			continue
+		}
+		if responseID, ok := jsonUint64(message["id"]); ok && responseID == uint64(id) {
+			return message, nil
+		}
+	}
+}
+
+// ProbePool connects and logs in to pool and times the given number of
+// keepalive round trips. Pools that don't know keepalives still answer them
+// with an error, which is timed all the same
+func ProbePool(pool Pool, dialer *Dialer, pings int, timeout time.Duration) *PoolProbe {
+	probe := &PoolProbe{Pool: pool}
+	start := time.Now()
+	conn, err := dialer.Dial(pool.Url)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	defer conn.Close()
+	probe.Connect = time.Since(start)
+
+	reader := bufio.NewReader(conn)
+	start = time.Now()
+	params := map[string]interface{}{
+		"login": pool.User,
+		"pass":  pool.Pass,
+		"agent": Agent,
+	}
+	if len(LoginAlgorithms) != 0 {
+		// Pools assign the difficulty of the algorithm they pick
+		params["algo"] = LoginAlgorithms
+	}
+	response, err := probeRequest(conn, reader, 1, "login", params, timeout)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	probe.Login = time.Since(start)
+	if response["error"] != nil {
+		probe.Err = fmt.Errorf("Login failed: %v", response["error"])
+		return probe
+	}
+	result, _ := response["result"].(map[string]interface{})
+	session, _ := jsonString(result["id"])
+	if job, ok := result["job"].(map[string]interface{}); ok {
+		if target, full, err := normalizeTarget(job); err == nil {
+			if target, full = applyJobDifficulty(job, target, full); full == nil {
+				full, err = ParseTarget(target)
+			}
+			if err == nil {
+				probe.Difficulty = DifficultyFromTarget(full)
+			}
+		}
+		probe.Algorithm, _ = job["algo"].(string)
+	}
+
+	for i := 0; i < pings; i++ {
+		start = time.Now()
+		if _, err := probeRequest(conn, reader, i+2, "keepalived", map[string]interface{}{"id": session}, timeout); err != nil {
+			log.Debugf("Keepalive to %v failed: %v", pool.Url, err)
+			break
+		}
+		probe.Pings = append(probe.Pings, time.Since(start))
+	}
+	return probe
+}
+
+// ProbePools probes every pool in config in turn, through the proxy and
+// bind address in config, and returns the probes ordered from the lowest
+// latency to the highest. Pools that failed come last
+func ProbePools(config *Config, pings int) ([]*PoolProbe, error) {
+	dialer, err := NewDialer(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.BindAddress) != 0 {
+		if err := dialer.Bind(config.BindAddress); err != nil {
+			return nil, err
+		}
+	}
+	dialer.SetTimeouts(time.Duration(config.DialTimeout)*time.Second, time.Duration(config.ReadTimeout)*time.Second, time.Duration(config.WriteTimeout)*time.Second)
+	tlsConfigs, err := config.LoadTLS()
+	if err != nil {
+		return nil, err
+	}
+	for url, tlsConfig := range tlsConfigs {
+		dialer.SetTLSConfig(url, tlsConfig)
+	}
+
+	var probes []*PoolProbe
+	for _, pool := range config.Pools {
+		if pool.Daemon {
+			log.Infof("Skipping daemon %v", pool.Url)
+			continue
+		}
+		log.Infof("Testing %v", pool.Url)
+		probes = append(probes, ProbePool(pool, dialer, pings, probeTimeout))
+	}
+	sort.SliceStable(probes, func(i, j int) bool {
+		if (probes[i].Err == nil) != (probes[j].Err == nil) {
+			return probes[i].Err == nil
+		}
+		return probes[i].Latency() < probes[j].Latency()
+	})
+	return probes, nil
+}
+
+// WritePoolProbes writes probes as a table comparing the pools
+func WritePoolProbes(w io.Writer, probes []*PoolProbe) {
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Pool\tConnect ms\tLogin ms\tLatency ms\tJitter ms\tDiff\tAlgo\t\n")
+	for _, p := range probes {
+		if p.Err != nil {
+			fmt.Fprintf(tw, "%v\tfailed: %v\t\t\t\t\t\t\n", p.Pool.Url, p.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%d\t%v\t\n", p.Pool.Url, ms(p.Connect), ms(p.Login), ms(p.Latency()), ms(p.Jitter()), p.Difficulty, p.Algorithm)
+	}
+	tw.Flush()
+}
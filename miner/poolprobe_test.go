@@ -0,0 +1,69 @@
+package miner
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbePools(t *testing.T) {
+	require := require.New(t)
+
+	pool := newFakePool(t)
+	defer pool.Close()
+
+	// Nothing listens on the port of a closed listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	closed := "stratum+tcp://" + listener.Addr().String()
+	listener.Close()
+
+	config := &Config{Pools: []Pool{
+		{Url: closed, User: "wallet"},
+		{Url: pool.URL(), User: "wallet"},
+		{Url: "http://127.0.0.1:18081", Daemon: true},
+	}}
+	config.ApplyDefaults()
+
+	probes, err := ProbePools(config, 3)
+	require.Nil(err)
+	require.Equal(2, len(probes))
+
+	// The pool that answered comes first
+	p := probes[0]
+	require.Nil(p.Err)
+	require.Equal(pool.URL(), p.Pool.Url)
+	require.Equal(3, len(p.Pings))
+	require.Equal(uint64(10000), p.Difficulty)
+	require.True(p.Latency() > 0)
+	require.True(p.Jitter() <= p.Latency()*3)
+	require.Equal("wallet", pool.NextRequest("login", time.Second).Params["login"])
+
+	require.NotNil(probes[1].Err)
+	require.Equal(closed, probes[1].Pool.Url)
+
+	var b bytes.Buffer
+	WritePoolProbes(&b, probes)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Equal(3, len(lines))
+	require.True(strings.HasPrefix(lines[0], "Pool"))
+	require.True(strings.HasPrefix(lines[1], pool.URL()))
+	require.True(strings.Contains(lines[1], "10000"))
+	require.True(strings.Contains(lines[2], "failed"))
+}
+
+func TestPoolProbeLatency(t *testing.T) {
+	require := require.New(t)
+
+	p := &PoolProbe{Login: 30 * time.Millisecond}
+	require.Equal(30*time.Millisecond, p.Latency())
+	require.Equal(time.Duration(0), p.Jitter())
+
+	p.Pings = []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	require.Equal(20*time.Millisecond, p.Latency())
+	require.Equal(20*time.Millisecond, p.Jitter())
+}
@@ -0,0 +1,91 @@
+package miner
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PowerMeter reads the power draw of a device, such as a GPU or a CPU package
+type PowerMeter interface {
+	Name() string
+	Watts() (float64, error)
+}
+
+// PowerTracker samples the power draw of the devices that mine, to report
+// the efficiency of the miner in H/s per watt
+type PowerTracker struct {
+	sync.Mutex
+	meters []PowerMeter
+	// Total power draw and efficiency at the last sample
+	watts      float64
+	efficiency float64
+}
+
+// NewPowerTracker returns a PowerTracker that reads meters
+func NewPowerTracker(meters []PowerMeter) *PowerTracker {
+	return &PowerTracker{meters: meters}
+}
+
+// SetMeters replaces the meters that are read
+func (p *PowerTracker) SetMeters(meters []PowerMeter) {
+	p.Lock()
+	defer p.Unlock()
+	p.meters = meters
+	p.watts = 0
+	p.efficiency = 0
+}
+
+// Sample reads the meters and computes the efficiency at hashRate, in H/s.
+// Meters that can't be read are left out of the total. It returns false if
+// none could be read
+func (p *PowerTracker) Sample(hashRate float64) bool {
+	p.Lock()
+	defer p.Unlock()
+	watts := 0.0
+	read := 0
+	for _, meter := range p.meters {
+		w, err := meter.Watts()
+		if err != nil {
+			log.Debugf("power: Failed to read %v: %v", meter.Name(), err)
+			continue
+		}
+		watts += w
+		read++
+	}
+	if read == 0 || watts <= 0 {
+		p.watts = 0
+		p.efficiency = 0
+		return false
+	}
+	p.watts = watts
+	p.efficiency = hashRate / watts
+	return true
+}
+
+// Watts returns the total power draw at the last sample. It is 0 if power
+// can't be read
+func (p *PowerTracker) Watts() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.watts
+}
+
+// Efficiency returns the H/s per watt at the last sample. It is 0 if power
+// can't be read
+func (p *PowerTracker) Efficiency() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.efficiency
+}
+
+func (p *PowerTracker) String() string {
+	p.Lock()
+	defer p.Unlock()
+	return fmt.Sprintf("power: %.1f W efficiency: %.2f H/s/W", p.watts, p.efficiency)
+}
+
+// DefaultPowerTracker is sampled along with the periodic hashrate lines. It
+// has no meters, and reports nothing, unless SetMeters is called
+var DefaultPowerTracker = NewPowerTracker(nil)
@@ -0,0 +1,49 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPowerMeter struct {
+	watts float64
+	err   error
+}
+
+func (m *testPowerMeter) Name() string {
+	return "test"
+}
+
+func (m *testPowerMeter) Watts() (float64, error) {
+	return m.watts, m.err
+}
+
+func TestPowerTracker(t *testing.T) {
+	require := require.New(t)
+
+	// Without meters nothing is reported
+	p := NewPowerTracker(nil)
+	require.False(p.Sample(1000))
+	require.Equal(0.0, p.Efficiency())
+
+	gpu := &testPowerMeter{150, nil}
+	cpu := &testPowerMeter{50, nil}
+	p.SetMeters([]PowerMeter{gpu, cpu})
+	require.True(p.Sample(2000))
+	require.Equal(200.0, p.Watts())
+	require.Equal(10.0, p.Efficiency())
+	require.Equal("power: 200.0 W efficiency: 10.00 H/s/W", p.String())
+
+	// Meters that fail are left out
+	cpu.err = fmt.Errorf("permission denied")
+	require.True(p.Sample(1500))
+	require.Equal(150.0, p.Watts())
+	require.Equal(10.0, p.Efficiency())
+
+	gpu.err = fmt.Errorf("permission denied")
+	require.False(p.Sample(1500))
+	require.Equal(0.0, p.Watts())
+	require.Equal(0.0, p.Efficiency())
+}
@@ -0,0 +1,27 @@
+package miner
+
+import (
+	"net"
+	"net/http"
+	// Registers the profiling handlers on http.DefaultServeMux
+	_ "net/http/pprof"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StartPprof serves the net/http/pprof handlers on address so that CPU,
+// heap and goroutine profiles can be taken from a running miner, e.g. with
+// 'go tool pprof http://address/debug/pprof/profile'
+func StartPprof(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Infof("pprof listening on http://%v/debug/pprof/", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, http.DefaultServeMux); err != nil {
+			log.Errorf("pprof stopped: %v", err)
+		}
+	}()
+	return nil
+}
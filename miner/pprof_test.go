@@ -0,0 +1,37 @@
+package miner
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartPprof(t *testing.T) {
+	require := require.New(t)
+
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	require.Nil(StartPprof(address))
+	resp, err := http.Get("http://" + address + "/debug/pprof/goroutine?debug=1")
+	require.Nil(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+
+	// The API doesn't expose the profiles
+	api, err := NewAPIServer("127.0.0.1:0")
+	require.Nil(err)
+	defer api.Close()
+	go api.Run()
+	resp, err = http.Get("http://" + api.Addr() + "/debug/pprof/")
+	require.Nil(err)
+	resp.Body.Close()
+	require.Equal(http.StatusNotFound, resp.StatusCode)
+
+	require.NotNil(StartPprof(address))
+}
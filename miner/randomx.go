@@ -0,0 +1,46 @@
+package miner
+
+import "fmt"
+
+// RandomX modes of the CPU threads
+const (
+	// RandomXFull hashes against the 2080MB dataset shared by all threads
+	RandomXFull = "full"
+	// RandomXLight hashes against the 256MB cache that the dataset is built
+	// from. It is several times slower, but lets machines without the
+	// memory for the dataset mine
+	RandomXLight = "light"
+)
+
+// CPURandomXMode returns the RandomX mode of the CPU thread with the given
+// index
+func (c *Config) CPURandomXMode(thread int) string {
+	if len(c.CPURandomXModes) == 0 {
+		return RandomXFull
+	}
+	if thread >= len(c.CPURandomXModes) {
+		thread = len(c.CPURandomXModes) - 1
+	}
+	return c.CPURandomXModes[thread]
+}
+
+// CPURandomXLightThreads returns how many of threads CPU threads use light
+// mode
+func (c *Config) CPURandomXLightThreads(threads int) int {
+	light := 0
+	for i := 0; i < threads; i++ {
+		if c.CPURandomXMode(i) == RandomXLight {
+			light++
+		}
+	}
+	return light
+}
+
+func (c *Config) checkRandomXModes() error {
+	for i, mode := range c.CPURandomXModes {
+		if mode != RandomXFull && mode != RandomXLight {
+			return fmt.Errorf("Invalid RandomX mode '%v' of CPU thread %d, must be %v or %v", mode, i, RandomXFull, RandomXLight)
+		}
+	}
+	return nil
+}
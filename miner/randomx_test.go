@@ -0,0 +1,31 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPURandomXMode(t *testing.T) {
+	require := require.New(t)
+
+	var config Config
+	_, err := ParseConfig([]byte(`{"cpu_threads": 4}`), &config)
+	require.Nil(err)
+	require.Equal(RandomXFull, config.CPURandomXMode(0))
+	require.Equal(0, config.CPURandomXLightThreads(4))
+
+	// The last mode applies to the rest of the threads
+	config = Config{}
+	_, err = ParseConfig([]byte(`{"cpu_threads": 4, "cpu-rx-modes": ["full", "light"]}`), &config)
+	require.Nil(err)
+	require.Equal(RandomXFull, config.CPURandomXMode(0))
+	require.Equal(RandomXLight, config.CPURandomXMode(1))
+	require.Equal(RandomXLight, config.CPURandomXMode(3))
+	require.Equal(3, config.CPURandomXLightThreads(4))
+
+	config = Config{}
+	_, err = ParseConfig([]byte(`{"cpu-rx-modes": ["fast"]}`), &config)
+	require.NotNil(err)
+	require.Contains(err.Error(), "fast")
+}
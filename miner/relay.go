@@ -0,0 +1,470 @@
+package miner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Relay listens on a local address and forwards every connection it accepts
+// to a pool through a Dialer. The stratum client connects to the relay,
+// which lets us control how the connection to the pool is established.
+type Relay struct {
+	sync.Mutex
+	address  string
+	dialer   *Dialer
+	listener net.Listener
+	// algo is the last algorithm announced by the pool
+	algo string
+	// Credentials that logins are rewritten with, if set
+	user string
+	pass string
+	// Client connections currently being relayed
+	conns map[net.Conn]bool
+	// Backup pool that is kept logged in, and the function called when it
+	// is switched to
+	standby  *Standby
+	promoted func(index int)
+	// How long to try resuming the session with the pool when the
+	// connection drops, before the stratum client is disconnected
+	resumeWindow time.Duration
+	// Consecutive failed connection attempts after which exhausted is
+	// closed. 0 retries forever
+	retries   int
+	failures  int
+	exhausted chan struct{}
+}
+
+// NewRelay starts a relay to the pool at address
+func NewRelay(address string, dialer *Dialer) (*Relay, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &Relay{
+		sync.Mutex{},
+		address,
+		dialer,
+		listener,
+		"",
+		"",
+		"",
+		make(map[net.Conn]bool),
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Address returns the address of the pool that new connections are
+// forwarded to
+func (r *Relay) Address() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.address
+}
+
+// SetAddress changes the pool that new connections are forwarded to
+func (r *Relay) SetAddress(address string) {
+	r.Lock()
+	defer r.Unlock()
+	r.address = address
+}
+
+// SetLogin makes logins use user and pass instead of the credentials the
+// stratum client was given. Empty credentials leave logins unchanged
+func (r *Relay) SetLogin(user, pass string) {
+	r.Lock()
+	defer r.Unlock()
+	r.user = user
+	r.pass = pass
+}
+
+// Reconnect drops all relayed connections, which makes the stratum client
+// reconnect and log in again to the current address
+func (r *Relay) Reconnect() {
+	r.Lock()
+	defer r.Unlock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+}
+
+// SetStandby makes the relay switch to standby when a connection to its
+// pool is set up, or when the current pool can't be reached. promoted is
+// called with the index of the standby pool when that happens. A previous
+// standby is closed
+func (r *Relay) SetStandby(standby *Standby, promoted func(index int)) {
+	r.Lock()
+	previous := r.standby
+	r.standby = standby
+	r.promoted = promoted
+	r.Unlock()
+	if previous != nil && previous != standby {
+		previous.Close()
+	}
+}
+
+// SetResumeWindow makes the relay reconnect and log in again by itself when
+// the connection to the pool drops, for up to window. The stratum client
+// stays connected and keeps mining its job meanwhile, and what it sends is
+// passed on once the session is resumed. 0 disables resuming
+func (r *Relay) SetResumeWindow(window time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	r.resumeWindow = window
+}
+
+// Standby returns the standby pool, or nil if there is none
+func (r *Relay) Standby() *Standby {
+	r.Lock()
+	defer r.Unlock()
+	return r.standby
+}
+
+// takeStandby takes the connection of the standby pool if it is logged in.
+// Unless any is set, the standby is only taken if it is a connection to
+// address. The relay then forwards new connections to the standby pool
+func (r *Relay) takeStandby(address string, any bool) *StandbyConn {
+	r.Lock()
+	standby := r.standby
+	promoted := r.promoted
+	r.Unlock()
+	if standby == nil || (!any && standby.Pool().Url != address) {
+		return nil
+	}
+	conn := standby.Take()
+	if conn == nil {
+		return nil
+	}
+	pool := standby.Pool()
+	r.Lock()
+	r.standby = nil
+	r.address = pool.Url
+	r.user = pool.User
+	r.pass = pool.Pass
+	r.Unlock()
+	if promoted != nil {
+		promoted(standby.Index())
+	}
+	return conn
+}
+
+// Addr returns the local address that the stratum client should connect to
+func (r *Relay) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Close stops accepting new connections
+func (r *Relay) Close() error {
+	return r.listener.Close()
+}
+
+func (r *Relay) run() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.handle(conn)
+	}
+}
+
+func (r *Relay) handle(conn net.Conn) {
+	defer conn.Close()
+	r.Lock()
+	r.conns[conn] = true
+	r.Unlock()
+	defer func() {
+		r.Lock()
+		delete(r.conns, conn)
+		r.Unlock()
+	}()
+
+	address := r.Address()
+	var upstream net.Conn
+	var fromUpstream io.Reader
+	standby := r.takeStandby(address, false)
+	if standby == nil {
+		var err error
+		upstream, err = r.dialer.Dial(address)
+		if err != nil {
+			if standby = r.takeStandby(address, true); standby == nil {
+				log.Errorf("relay: Failed to connect to %v: %v", address, err)
+				r.connectFailed()
+				return
+			}
+			log.Warnf("relay: Failed to connect to %v: %v, switching to standby pool", address, err)
+		}
+	}
+	r.connected()
+	if standby != nil {
+		address = r.Address()
+		upstream = standby.Conn
+		fromUpstream = standby.Reader
+		log.Infof("relay: Switched to standby pool %v (%v) from %v", address, upstream.RemoteAddr(), upstream.LocalAddr())
+	} else {
+		fromUpstream = upstream
+		log.Infof("relay: Connected to %v (%v) from %v", address, upstream.RemoteAddr(), upstream.LocalAddr())
+	}
+	PublishEvent(Connected, 0, address)
+	defer PublishEvent(Disconnected, 0, address)
+
+	// Both the client and the relay itself write to the pool, and the relay
+	// answers the login itself when switching to a standby pool
+	toPool := newPoolWriter(upstream)
+	defer toPool.Close()
+	toClient := &lockedWriter{w: conn}
+	submits := NewSubmitTracker()
+	targets := NewSetTargetTracker()
+	defer func() {
+		if n := submits.Abandon(); n > 0 {
+			log.Warnf("relay: %d shares submitted to %v were not answered", n, address)
+		}
+	}()
+	var fromPool messageFilter
+	fromClient := func(line []byte) ([]byte, error) {
+		if standby != nil {
+			if reply, ok := standby.LoginReply(line); ok {
+				// The standby pool is already logged in
+				standby = nil
+				if login, err := r.fromClient(line); err == nil {
+					toPool.setLogin(login)
+				}
+				if reply, err := fromPool(reply); err != nil || reply == nil {
+					return nil, err
+				} else if _, err := toClient.Write(reply); err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+		}
+		line, err := r.fromClient(line)
+		if line != nil {
+			submits.Sent(line)
+			if message, ok := decodeMessage(line); ok && message["method"] == "login" {
+				toPool.setLogin(line)
+			}
+		}
+		return line, err
+	}
+	fromPool = func(line []byte) ([]byte, error) {
+		if reply, ok := VersionReply(line); ok {
+			// The stratum client doesn't answer these, so the relay does
+			_, err := toPool.Write(reply)
+			return nil, err
+		}
+		if line = targets.Received(line); line == nil {
+			return nil, nil
+		}
+		line, err := r.fromPool(line)
+		if line != nil {
+			if result, ok := submits.Received(line); ok {
+				LogSubmitResult(result)
+				if err := recordShare(address, result); err != nil {
+					log.Errorf("relay: Failed to write share log: %v", err)
+				}
+			}
+			if session, ok := LoginSession(line); ok {
+				toPool.setSession(session)
+			}
+		}
+		return line, err
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		forwardMessages(toPool, conn, fromClient)
+		// Unblock the other direction
+		toPool.Close()
+		conn.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		defer conn.Close()
+		defer toPool.Close()
+		for {
+			err := forwardMessages(toClient, fromUpstream, fromPool)
+			if fromUpstream, err = r.resume(address, toPool, toClient, fromPool, err); err != nil {
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+// resume logs in again to the pool at address after the connection to it
+// dropped with err, and forwards the job the pool sent with the login to
+// the stratum client. It returns a reader of the messages the pool sends
+// on the new connection. An error is returned if the session can't be
+// resumed, including when the connection was closed on purpose
+func (r *Relay) resume(address string, toPool *poolWriter, toClient io.Writer, fromPool messageFilter, err error) (io.Reader, error) {
+	r.Lock()
+	window := r.resumeWindow
+	r.Unlock()
+	login := toPool.Login()
+	if window <= 0 || err == errReconnect || toPool.Closed() || login == nil {
+		return nil, err
+	}
+	toPool.Suspend()
+	log.Warnf("relay: Lost connection to %v: %v, resuming the session", address, err)
+	upstream, reader, result, err := r.resumeSession(address, login, time.Now().Add(window))
+	if err != nil {
+		log.Errorf("relay: Failed to resume the session with %v: %v", address, err)
+		return nil, err
+	}
+	session, _ := jsonString(result["id"])
+	if err := toPool.Resume(upstream, session); err != nil {
+		return nil, err
+	}
+	log.Infof("relay: Resumed the session with %v (%v)", address, upstream.RemoteAddr())
+	if job, ok := result["job"]; ok {
+		line, err := jobNotification(job)
+		if err != nil {
+			return nil, err
+		}
+		if line, err = fromPool(line); err != nil {
+			return nil, err
+		}
+		if line != nil {
+			if _, err := toClient.Write(line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return reader, nil
+}
+
+// lockedWriter serializes writes to w so that whole messages from several
+// goroutines don't interleave
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.w.Write(b)
+}
+
+// messageFilter transforms a message before it is forwarded. Returning nil
+// drops the message and returning an error ends the connection
+type messageFilter func(line []byte) ([]byte, error)
+
+// fromClient handles messages sent by the stratum client to the pool
+func (r *Relay) fromClient(line []byte) ([]byte, error) {
+	line = SetLoginAgent(line)
+	line = SetLoginAlgorithms(line, LoginAlgorithms)
+	line = DefaultWorkerTags.TagSubmit(line)
+	r.Lock()
+	user, pass := r.user, r.pass
+	r.Unlock()
+	if len(user) != 0 {
+		line = SetLoginCredentials(line, user, pass)
+	}
+	return line, nil
+}
+
+// fromPool handles messages sent by the pool to the stratum client
+func (r *Relay) fromPool(line []byte) ([]byte, error) {
+	if address, ok := ParseReconnect(line); ok {
+		if len(address) != 0 {
+			log.Infof("relay: Pool asked us to reconnect to %v", address)
+			r.SetAddress(address)
+		} else {
+			log.Infof("relay: Pool asked us to reconnect")
+		}
+		// Dropping the connection makes the stratum client reconnect, which
+		// gets it connected to the new address
+		return nil, errReconnect
+	}
+	line = NormalizeMessage(line)
+	if algo, ok := JobAlgorithm(line); ok {
+		r.setAlgorithm(algo)
+	}
+	return line, nil
+}
+
+// setAlgorithm records the algorithm announced by the pool and publishes an
+// AlgorithmChanged event if it differs from the previous one
+func (r *Relay) setAlgorithm(algo string) {
+	algo = NormalizeAlgorithm(algo)
+	r.Lock()
+	changed := algo != r.algo
+	r.algo = algo
+	r.Unlock()
+	if changed {
+		PublishEvent(AlgorithmChanged, 0, algo)
+	}
+}
+
+var errReconnect = fmt.Errorf("Reconnect requested")
+
+// forwardMessages forwards the newline delimited messages read from src to
+// dst, passing each of them through filter
+func forwardMessages(dst io.Writer, src io.Reader, filter messageFilter) error {
+	reader := bufio.NewReader(src)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			msg, ferr := filter(line)
+			if ferr != nil {
+				return ferr
+			}
+			if msg != nil {
+				if _, err := dst.Write(msg); err != nil {
+					return err
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// NewPoolRelay starts a Relay to the pool at url. Connections go through
+// proxyURL and originate from bindAddress if they are set
+func NewPoolRelay(url string, proxyURL string, bindAddress string) (*Relay, error) {
+	dialer, err := NewDialer(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(bindAddress) != 0 {
+		if err := dialer.Bind(bindAddress); err != nil {
+			return nil, err
+		}
+	}
+	relay, err := NewRelay(url, dialer)
+	if err != nil {
+		return nil, err
+	}
+	if len(proxyURL) != 0 {
+		log.Infof("Connecting to %v through proxy %v", url, proxyURL)
+	}
+	return relay, nil
+}
+
+// ConnectAddress starts a Relay to the pool at url and returns the address
+// that the stratum client should connect to. Connections go through
+// proxyURL and originate from bindAddress if they are set
+func ConnectAddress(url string, proxyURL string, bindAddress string) (string, error) {
+	relay, err := NewPoolRelay(url, proxyURL, bindAddress)
+	if err != nil {
+		return "", err
+	}
+	return relay.Addr(), nil
+}
@@ -0,0 +1,149 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// CapturedSubmit is a share submission found in captured stratum traffic
+type CapturedSubmit struct {
+	JobID  string
+	Nonce  string
+	Result string
+}
+
+// parseCapturedMessage extracts the job or share submission contained in a
+// single captured stratum message
+func parseCapturedMessage(line []byte) (*stratum.Work, *CapturedSubmit, error) {
+	normalized := NormalizeMessage(line)
+	if normalized == nil {
+		return nil, nil, fmt.Errorf("Malformed job: %s", line)
+	}
+	var message struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(normalized, &message); err != nil {
+		// Not a JSON message
+		return nil, nil, nil
+	}
+
+	var job map[string]interface{}
+	switch message.Method {
+	case "job":
+		if err := json.Unmarshal(message.Params, &job); err != nil {
+			return nil, nil, err
+		}
+	case "submit":
+		var params struct {
+			JobID  string `json:"job_id"`
+			Nonce  string `json:"nonce"`
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, nil, err
+		}
+		return nil, &CapturedSubmit{params.JobID, params.Nonce, params.Result}, nil
+	case "":
+		var result struct {
+			Job map[string]interface{} `json:"job"`
+		}
+		if len(message.Result) == 0 || json.Unmarshal(message.Result, &result) != nil || result.Job == nil {
+			return nil, nil, nil
+		}
+		job = result.Job
+	default:
+		return nil, nil, nil
+	}
+	work, err := stratum.ParseWork(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	return work, nil, nil
+}
+
+// ReadCapture reads newline delimited stratum messages from r, in both
+// directions, and calls onJob for every job and onSubmit for every share
+// submission found. Either callback may be nil
+func ReadCapture(r io.Reader, onJob func(*stratum.Work), onSubmit func(*CapturedSubmit)) error {
+	reader := bufio.NewReader(r)
+	lineNumber := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNumber++
+			work, submit, perr := parseCapturedMessage(line)
+			if perr != nil {
+				log.Errorf("replay: line %d: %v", lineNumber, perr)
+			} else if work != nil && onJob != nil {
+				onJob(work)
+			} else if submit != nil && onSubmit != nil {
+				onSubmit(submit)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ReplaySource is a WorkProvider that feeds the jobs found in captured
+// stratum traffic to the miners. Shares are logged instead of submitted
+type ReplaySource struct {
+	sync.Mutex
+	reader    io.Reader
+	jobDelay  time.Duration
+	listeners []chan<- *stratum.Work
+}
+
+// NewReplaySource returns a ReplaySource reading captured traffic from r.
+// Every job is mined for jobDelay before moving on to the next one
+func NewReplaySource(r io.Reader, jobDelay time.Duration) *ReplaySource {
+	return &ReplaySource{
+		reader:   r,
+		jobDelay: jobDelay,
+	}
+}
+
+// RegisterWorkListener registers workChan to receive every replayed job
+func (s *ReplaySource) RegisterWorkListener(workChan chan<- *stratum.Work) {
+	s.Lock()
+	defer s.Unlock()
+	s.listeners = append(s.listeners, workChan)
+}
+
+// SubmitWork logs the share that would have been submitted
+func (s *ReplaySource) SubmitWork(work *stratum.Work, hash string) error {
+	nonce := "n/a"
+	if len(work.Data) >= nonceOffset+4 {
+		// As the stratum client would submit it
+		nonce = hex.EncodeToString(work.Data[nonceOffset : nonceOffset+4])
+	}
+	log.Infof("replay: Would submit job=%v nonce=%v result=%v", work.JobID, nonce, hash)
+	return nil
+}
+
+// Run replays all jobs and returns once the capture has been exhausted
+func (s *ReplaySource) Run() error {
+	return ReadCapture(s.reader, func(work *stratum.Work) {
+		log.Infof("replay: Job %v target=%016x size=%d", work.JobID, work.Target, work.Size)
+		s.Lock()
+		listeners := s.listeners
+		s.Unlock()
+		for _, workChan := range listeners {
+			workChan <- work
+		}
+		time.Sleep(s.jobDelay)
+	}, nil)
+}
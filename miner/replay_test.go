@@ -0,0 +1,33 @@
+package miner
+
+import (
+	"strings"
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCapture(t *testing.T) {
+	require := require.New(t)
+
+	capture := strings.Join([]string{
+		`{"id":1,"jsonrpc":"2.0","method":"login","params":{"login":"wallet","pass":"x","agent":"test"}}`,
+		`{"id":1,"jsonrpc":"2.0","error":null,"result":{"id":"abc","job":{"blob":"` + testBlob + `","job_id":"1","target":"b88d0600"},"status":"OK"}}`,
+		`{"id":2,"jsonrpc":"2.0","method":"submit","params":{"id":"abc","job_id":"1","nonce":"deadbeef","result":"00ff"}}`,
+		`{"jsonrpc":"2.0","method":"job","params":{"blob":"` + testBlob + `","job_id":2,"target":"b88d0600"}}`,
+		`{"jsonrpc":"2.0","method":"job","params":{"blob":"07","job_id":"3","target":"b88d0600"}}`,
+		`garbage`,
+	}, "\n")
+
+	jobs := make([]string, 0)
+	submits := make([]*CapturedSubmit, 0)
+	err := ReadCapture(strings.NewReader(capture), func(work *stratum.Work) {
+		jobs = append(jobs, work.JobID)
+	}, func(submit *CapturedSubmit) {
+		submits = append(submits, submit)
+	})
+	require.Nil(err)
+	require.Equal([]string{"1", "2"}, jobs)
+	require.Equal([]*CapturedSubmit{{"1", "deadbeef", "00ff"}}, submits)
+}
@@ -0,0 +1,214 @@
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultResumeWindow is how long, in milliseconds, the relay tries to
+// resume a session with the pool after its connection dropped
+var DefaultResumeWindow = 1000
+
+// resumeRetryDelay is the delay between attempts to resume a session
+var resumeRetryDelay = 100 * time.Millisecond
+
+// LoginSession returns the session id in the response to a login. ok is
+// false if line is not a login response
+func LoginSession(line []byte) (session string, ok bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return "", false
+	}
+	result, ok := message["result"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	if _, ok := result["job"]; !ok {
+		return "", false
+	}
+	return jsonString(result["id"])
+}
+
+// SetSessionID replaces the session id from in the params of a request with
+// to. Any other message is returned unmodified
+func SetSessionID(line []byte, from, to string) []byte {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return line
+	}
+	params, ok := message["params"].(map[string]interface{})
+	if !ok {
+		return line
+	}
+	if id, _ := jsonString(params["id"]); id != from {
+		return line
+	}
+	params["id"] = to
+	b, err := json.Marshal(message)
+	if err != nil {
+		return line
+	}
+	return append(b, '\n')
+}
+
+// jobNotification returns a job message for job as the pool would send it
+func jobNotification(job interface{}) ([]byte, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "job",
+		"params":  job,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// poolWriter writes the messages of the stratum client to the pool. While
+// the session is being resumed on a new connection, messages are queued
+// and sent once it is logged in, with the session id the stratum client
+// knows replaced by the one of the new session
+type poolWriter struct {
+	sync.Mutex
+	conn   net.Conn
+	queue  [][]byte
+	closed bool
+	// Last login request of the stratum client
+	login []byte
+	// Session id the stratum client uses and the one of the current
+	// connection
+	clientSession string
+	poolSession   string
+}
+
+func newPoolWriter(conn net.Conn) *poolWriter {
+	return &poolWriter{conn: conn}
+}
+
+func (w *poolWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("Connection to pool is closed")
+	}
+	if w.conn != nil {
+		if err := w.send(b); err == nil {
+			return len(b), nil
+		}
+		// The message is sent again if the session is resumed
+		w.conn.Close()
+		w.conn = nil
+	}
+	w.queue = append(w.queue, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// send writes line to the connection. Call with the lock held
+func (w *poolWriter) send(line []byte) error {
+	if w.clientSession != w.poolSession {
+		line = SetSessionID(line, w.clientSession, w.poolSession)
+	}
+	_, err := w.conn.Write(line)
+	return err
+}
+
+// setLogin records the login request of the stratum client
+func (w *poolWriter) setLogin(line []byte) {
+	w.Lock()
+	defer w.Unlock()
+	w.login = append([]byte(nil), line...)
+}
+
+// Login returns the login request of the stratum client, or nil if it
+// didn't log in
+func (w *poolWriter) Login() []byte {
+	w.Lock()
+	defer w.Unlock()
+	return w.login
+}
+
+// setSession records the session id that the stratum client was given
+func (w *poolWriter) setSession(session string) {
+	w.Lock()
+	defer w.Unlock()
+	w.clientSession = session
+	w.poolSession = session
+}
+
+// Suspend closes the connection and queues messages until Resume is called
+func (w *poolWriter) Suspend() {
+	w.Lock()
+	defer w.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// Resume sends the queued messages over conn, which is logged in as
+// session, and makes it the connection that messages are written to
+func (w *poolWriter) Resume(conn net.Conn, session string) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		conn.Close()
+		return fmt.Errorf("Connection to pool is closed")
+	}
+	w.conn = conn
+	if len(session) != 0 {
+		w.poolSession = session
+	}
+	for len(w.queue) > 0 {
+		if err := w.send(w.queue[0]); err != nil {
+			return err
+		}
+		w.queue = w.queue[1:]
+	}
+	return nil
+}
+
+// Close closes the connection and makes further writes fail
+func (w *poolWriter) Close() {
+	w.Lock()
+	defer w.Unlock()
+	w.closed = true
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
+
+// Closed returns true if Close was called
+func (w *poolWriter) Closed() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.closed
+}
+
+// resumeSession reconnects to the pool at address and sends login again
+// until it is logged in or deadline passes. It returns the new connection, a
+// reader of what the pool sent after the login and the result of the login
+func (r *Relay) resumeSession(address string, login []byte, deadline time.Time) (net.Conn, *bufio.Reader, map[string]interface{}, error) {
+	for {
+		conn, err := r.dialer.Dial(address)
+		if err == nil {
+			conn.SetDeadline(deadline)
+			if _, err = conn.Write(login); err == nil {
+				reader := bufio.NewReader(conn)
+				var result map[string]interface{}
+				if result, err = readLoginResult(reader); err == nil {
+					conn.SetDeadline(time.Time{})
+					return conn, reader, result, nil
+				}
+			}
+			conn.Close()
+		}
+		if time.Now().Add(resumeRetryDelay).After(deadline) {
+			return nil, nil, nil, err
+		}
+		time.Sleep(resumeRetryDelay)
+	}
+}
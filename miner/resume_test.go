@@ -0,0 +1,97 @@
+package miner
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// loginThroughRelay connects to relay and logs in, returning the connection
+// and a reader of what the relay sends after the login response
+func loginThroughRelay(t *testing.T, relay *Relay, pool *fakePool) (net.Conn, *bufio.Reader) {
+	require := require.New(t)
+
+	conn, err := net.Dial("tcp", relay.Addr())
+	require.Nil(err)
+	_, err = conn.Write([]byte(`{"id":1,"jsonrpc":"2.0","method":"login","params":{"login":"wallet","pass":"x"}}` + "\n"))
+	require.Nil(err)
+	pool.NextRequest("login", 5*time.Second)
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := reader.ReadBytes('\n')
+	require.Nil(err)
+	session, ok := LoginSession(line)
+	require.True(ok)
+	require.Equal("session-1", session)
+	return conn, reader
+}
+
+func TestRelayResume(t *testing.T) {
+	require := require.New(t)
+
+	pool := newFakePool(t)
+	defer pool.Close()
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay(pool.URL(), dialer)
+	require.Nil(err)
+	defer relay.Close()
+	relay.SetResumeWindow(time.Second)
+
+	conn, reader := loginThroughRelay(t, relay, pool)
+	defer conn.Close()
+
+	pool.DropConnections()
+	login := pool.NextRequest("login", 5*time.Second)
+	require.Equal("wallet", login.Params["login"])
+
+	// The client stays connected and gets the job it was mining again
+	line, err := reader.ReadBytes('\n')
+	require.Nil(err)
+	message, ok := decodeMessage(line)
+	require.True(ok)
+	require.Equal("job", message["method"])
+	require.Equal("job-1", message["params"].(map[string]interface{})["job_id"])
+
+	// Shares are submitted with the id of the resumed session
+	_, err = conn.Write([]byte(`{"id":2,"jsonrpc":"2.0","method":"submit","params":{"id":"session-1","job_id":"job-1","nonce":"00000000","result":"00"}}` + "\n"))
+	require.Nil(err)
+	submit := pool.NextRequest("submit", 5*time.Second)
+	require.Equal("session-2", submit.Params["id"])
+	require.Equal("job-1", submit.Params["job_id"])
+}
+
+func TestRelayResumeDisabled(t *testing.T) {
+	require := require.New(t)
+
+	pool := newFakePool(t)
+	defer pool.Close()
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay(pool.URL(), dialer)
+	require.Nil(err)
+	defer relay.Close()
+
+	conn, reader := loginThroughRelay(t, relay, pool)
+	defer conn.Close()
+
+	pool.DropConnections()
+	_, err = reader.ReadBytes('\n')
+	require.NotNil(err)
+}
+
+func TestSetSessionID(t *testing.T) {
+	require := require.New(t)
+
+	line := SetSessionID([]byte(`{"id":2,"method":"submit","params":{"id":"a","job_id":"j"}}`+"\n"), "a", "b")
+	message, ok := decodeMessage(line)
+	require.True(ok)
+	require.Equal("b", message["params"].(map[string]interface{})["id"])
+
+	unchanged := []byte(`{"id":3,"method":"keepalived","params":{"id":"c"}}` + "\n")
+	require.Equal(unchanged, SetSessionID(unchanged, "a", "b"))
+}
@@ -0,0 +1,51 @@
+package miner
+
+// ExitReconnectsExhausted is the exit code of the miners when the pool
+// couldn't be reconnected to within the configured retries, so that a
+// supervisor can tell it apart from a crash
+const ExitReconnectsExhausted = 3
+
+// SetRetries makes the relay give up after retries consecutive failed
+// connection attempts to the pool, after which Exhausted is closed. A
+// successful connection resets the count. retries <= 0 retries forever
+func (r *Relay) SetRetries(retries int) {
+	r.Lock()
+	defer r.Unlock()
+	r.retries = retries
+}
+
+// Exhausted returns a channel that is closed when the retries set by
+// SetRetries are exhausted
+func (r *Relay) Exhausted() <-chan struct{} {
+	return r.exhausted
+}
+
+// connectFailed counts a failed connection attempt
+func (r *Relay) connectFailed() {
+	r.Lock()
+	defer r.Unlock()
+	r.failures++
+	if r.retries <= 0 || r.failures != r.retries {
+		return
+	}
+	close(r.exhausted)
+}
+
+// connected resets the count of failed connection attempts
+func (r *Relay) connected() {
+	r.Lock()
+	defer r.Unlock()
+	r.failures = 0
+}
+
+// Exhausted returns a channel that is closed when the pool couldn't be
+// reconnected to within config.Retries attempts. It is never closed when
+// solo mining or before the engine is started
+func (e *Engine) Exhausted() <-chan struct{} {
+	e.Lock()
+	defer e.Unlock()
+	if e.relay == nil {
+		return nil
+	}
+	return e.relay.Exhausted()
+}
@@ -0,0 +1,87 @@
+package miner
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// connectRelay connects to relay and waits for it to close the connection
+func connectRelay(t *testing.T, relay *Relay) {
+	require := require.New(t)
+
+	conn, err := net.Dial("tcp", relay.Addr())
+	require.Nil(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ioutil.ReadAll(conn)
+}
+
+func exhausted(relay *Relay) bool {
+	select {
+	case <-relay.Exhausted():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestRelayRetries(t *testing.T) {
+	require := require.New(t)
+
+	// Nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay("stratum+tcp://"+address, dialer)
+	require.Nil(err)
+	defer relay.Close()
+	relay.SetRetries(3)
+
+	connectRelay(t, relay)
+	connectRelay(t, relay)
+	require.False(exhausted(relay))
+
+	// A successful connection resets the count
+	listener, err = net.Listen("tcp", address)
+	require.Nil(err)
+	go echoServer(t, listener)
+	testRelayEcho(t, relay)
+	listener.Close()
+
+	connectRelay(t, relay)
+	connectRelay(t, relay)
+	require.False(exhausted(relay))
+	connectRelay(t, relay)
+	require.True(exhausted(relay))
+	// Further failures don't close the channel again
+	connectRelay(t, relay)
+	require.True(exhausted(relay))
+}
+
+func TestRelayRetriesForever(t *testing.T) {
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	relay, err := NewRelay("stratum+tcp://"+address, dialer)
+	require.Nil(err)
+	defer relay.Close()
+
+	for i := 0; i < 5; i++ {
+		connectRelay(t, relay)
+	}
+	require.False(exhausted(relay))
+}
@@ -0,0 +1,107 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetTargetTracker applies the raw targets that some pools send in a
+// mining.set_target notification, which the stratum client doesn't know
+// about. The last job of a connection is kept so that a new target can be
+// applied to it right away
+type SetTargetTracker struct {
+	sync.Mutex
+	job    map[string]interface{}
+	target interface{}
+}
+
+// NewSetTargetTracker returns a SetTargetTracker that has seen no jobs
+func NewSetTargetTracker() *SetTargetTracker {
+	return &SetTargetTracker{}
+}
+
+// setTargetParam returns the target of a set_target notification, which
+// is sent either as the only positional param or as a named one
+func setTargetParam(message map[string]interface{}) (interface{}, bool) {
+	switch params := message["params"].(type) {
+	case []interface{}:
+		if len(params) != 0 {
+			return params[0], true
+		}
+	case map[string]interface{}:
+		if target, ok := params["target"]; ok {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// Received handles a message sent by the pool. A set_target notification is
+// turned into a notification of the last job with the new target, or
+// dropped if no job was sent yet. Jobs are remembered, and those that come
+// with neither target nor difficulty get the last raw target. Other messages
+// are returned unmodified
+func (s *SetTargetTracker) Received(line []byte) []byte {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return line
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	var job map[string]interface{}
+	switch method, _ := message["method"].(string); method {
+	case "mining.set_target", "set_target":
+		target, ok := setTargetParam(message)
+		if !ok {
+			log.Errorf("Dropping set_target without a target: %s", bytes.TrimSpace(line))
+			return nil
+		}
+		if _, _, err := normalizeTarget(map[string]interface{}{"target": target}); err != nil {
+			log.Errorf("Dropping set_target: %v", err)
+			return nil
+		}
+		s.target = target
+		if s.job == nil {
+			return nil
+		}
+		job = make(map[string]interface{}, len(s.job))
+		for k, v := range s.job {
+			job[k] = v
+		}
+		delete(job, "difficulty")
+		job["target"] = target
+		log.Debugf("Pool set the target to %v, reissuing job %v", target, job["job_id"])
+		s.job = job
+		reissued, err := jobNotification(job)
+		if err != nil {
+			return line
+		}
+		return reissued
+	case "job":
+		job, _ = message["params"].(map[string]interface{})
+	default:
+		if result, ok := message["result"].(map[string]interface{}); ok {
+			job, _ = result["job"].(map[string]interface{})
+		}
+	}
+	if job == nil {
+		return line
+	}
+	_, hasTarget := job["target"]
+	_, hasDifficulty := job["difficulty"]
+	if !hasTarget && !hasDifficulty && s.target != nil {
+		job["target"] = s.target
+		s.job = job
+		b, err := json.Marshal(message)
+		if err != nil {
+			return line
+		}
+		return append(b, '\n')
+	}
+	s.job = job
+	return line
+}
@@ -0,0 +1,67 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTargetTracker(t *testing.T) {
+	require := require.New(t)
+
+	s := NewSetTargetTracker()
+
+	// Nothing to apply the target to yet
+	require.Nil(s.Received([]byte(`{"jsonrpc":"2.0","method":"mining.set_target","params":["e8030000"]}` + "\n")))
+
+	job := []byte(`{"jsonrpc":"2.0","method":"job","params":{"job_id":"job-1","blob":"00","target":"b88d0600"}}` + "\n")
+	require.Equal(job, s.Received(job))
+
+	// The last job is sent again with the new target
+	line := s.Received([]byte(`{"jsonrpc":"2.0","method":"mining.set_target","params":["10270000"]}` + "\n"))
+	require.NotNil(line)
+	message, ok := decodeMessage(line)
+	require.True(ok)
+	require.Equal("job", message["method"])
+	params := message["params"].(map[string]interface{})
+	require.Equal("job-1", params["job_id"])
+	require.Equal("10270000", params["target"])
+
+	// Named params, and the difficulty of the job no longer applies
+	s.Received([]byte(`{"id":1,"jsonrpc":"2.0","error":null,"result":{"id":"w","job":{"job_id":"job-2","blob":"00","difficulty":5000}}}` + "\n"))
+	line = s.Received([]byte(`{"jsonrpc":"2.0","method":"set_target","params":{"target":"e8030000"}}` + "\n"))
+	message, ok = decodeMessage(line)
+	require.True(ok)
+	params = message["params"].(map[string]interface{})
+	require.Equal("job-2", params["job_id"])
+	require.Equal("e8030000", params["target"])
+	require.Nil(params["difficulty"])
+
+	// Jobs without a target of their own get the last raw target
+	line = s.Received([]byte(`{"jsonrpc":"2.0","method":"job","params":{"job_id":"job-3","blob":"00"}}` + "\n"))
+	message, ok = decodeMessage(line)
+	require.True(ok)
+	require.Equal("e8030000", message["params"].(map[string]interface{})["target"])
+
+	// Invalid targets are dropped and leave the target as it was
+	require.Nil(s.Received([]byte(`{"jsonrpc":"2.0","method":"mining.set_target","params":["xyz"]}` + "\n")))
+	require.Nil(s.Received([]byte(`{"jsonrpc":"2.0","method":"mining.set_target","params":[]}` + "\n")))
+
+	// Other messages are passed through
+	other := []byte(`{"id":2,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}` + "\n")
+	require.Equal(other, s.Received(other))
+}
+
+func TestNormalizeJobForgetsFullTarget(t *testing.T) {
+	require := require.New(t)
+
+	full := "00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	_, err := NormalizeJob(map[string]interface{}{"job_id": "reissued", "blob": testBlob, "target": full})
+	require.Nil(err)
+	require.Equal(full, JobTarget("reissued", 0).String())
+
+	// The job sent again with a compact target is checked against it
+	_, err = NormalizeJob(map[string]interface{}{"job_id": "reissued", "blob": testBlob, "target": "e8030000"})
+	require.Nil(err)
+	require.Equal(NewTarget(0x346dc5d638865).String(), JobTarget("reissued", 0x346dc5d638865).String())
+}
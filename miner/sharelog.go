@@ -0,0 +1,127 @@
+package miner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultShareLogMaxSize is the size in MB the share log is allowed to
+	// grow to before it is rotated
+	DefaultShareLogMaxSize = 10
+	// DefaultShareLogBackups is the number of rotated share logs that are
+	// kept
+	DefaultShareLogBackups = 5
+)
+
+// ShareRecord is the record of a share in the share log
+type ShareRecord struct {
+	Time  time.Time `json:"time"`
+	Pool  string    `json:"pool"`
+	JobID string    `json:"job_id"`
+	Nonce string    `json:"nonce"`
+	Hash  string    `json:"hash"`
+	// Difficulty of the job and actual difficulty of the hash
+	Difficulty      uint64 `json:"difficulty"`
+	ShareDifficulty uint64 `json:"share_difficulty"`
+	Accepted        bool   `json:"accepted"`
+	Error           string `json:"error,omitempty"`
+	LatencyMs       int64  `json:"latency_ms"`
+}
+
+// NewShareRecord returns the record of a share submitted to pool that the
+// pool answered with result at t
+func NewShareRecord(t time.Time, pool string, result *SubmitResult) *ShareRecord {
+	var shareDifficulty uint64
+	if hash, err := hex.DecodeString(result.Hash); err == nil {
+		shareDifficulty = ShareDifficulty(hash)
+	}
+	return &ShareRecord{
+		Time:            t,
+		Pool:            pool,
+		JobID:           result.JobID,
+		Nonce:           result.Nonce,
+		Hash:            result.Hash,
+		Difficulty:      result.Difficulty,
+		ShareDifficulty: shareDifficulty,
+		Accepted:        result.Accepted,
+		Error:           result.Error,
+		LatencyMs:       result.Latency.Nanoseconds() / int64(time.Millisecond),
+	}
+}
+
+// ShareLog writes a JSON record of every share the pool answered, one per
+// line, so that the shares can be reconciled with the records of the pool
+type ShareLog struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewShareLog returns a ShareLog that writes to w
+func NewShareLog(w io.Writer) *ShareLog {
+	return &ShareLog{w: w}
+}
+
+// Record writes record to the log
+func (l *ShareLog) Record(record *ShareRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	_, err = l.w.Write(append(b, '\n'))
+	return err
+}
+
+var (
+	shareLogLock sync.Mutex
+	shareLog     *ShareLog
+)
+
+// SetShareLog makes the relay record every share the pool answers in l. nil
+// stops recording
+func SetShareLog(l *ShareLog) {
+	shareLogLock.Lock()
+	defer shareLogLock.Unlock()
+	shareLog = l
+}
+
+// recordShare records result in the share log, if there is one
+func recordShare(pool string, result *SubmitResult) error {
+	shareLogLock.Lock()
+	l := shareLog
+	shareLogLock.Unlock()
+	if l == nil {
+		return nil
+	}
+	return l.Record(NewShareRecord(time.Now(), pool, result))
+}
+
+// SetupShareLog opens config.ShareLog for appending and makes it the share
+// log. The log is rotated like the log file. The returned file should be
+// closed on exit and is nil if no share log is configured
+func SetupShareLog(config *Config) (*RotatingFile, error) {
+	if len(config.ShareLog) == 0 {
+		return nil, nil
+	}
+	maxSize := config.ShareLogMaxSize
+	if maxSize == 0 {
+		maxSize = DefaultShareLogMaxSize
+	}
+	backups := config.ShareLogBackups
+	if backups == 0 {
+		backups = DefaultShareLogBackups
+	}
+	f, err := OpenRotatingFile(config.ShareLog, int64(maxSize)*1024*1024, backups)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open share log '%v': %v", config.ShareLog, err)
+	}
+	f.SetCompress(config.ShareLogCompress)
+	SetShareLog(NewShareLog(f))
+	return f, nil
+}
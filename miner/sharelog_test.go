@@ -0,0 +1,88 @@
+package miner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLog(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sharelog")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	defer SetShareLog(nil)
+
+	config := &Config{ShareLog: filepath.Join(dir, "shares.log")}
+	f, err := SetupShareLog(config)
+	require.Nil(err)
+
+	// A hash whose most significant 64 bits are 1 has the highest difficulty
+	hash := strings.Repeat("00", 24) + "0100000000000000"
+	require.Nil(recordShare("pool:3333", &SubmitResult{true, 1000, 50 * time.Millisecond, "", "job-1", "78563412", hash}))
+	require.Nil(recordShare("pool:3333", &SubmitResult{false, 1000, 0, "Low difficulty share", "job-1", "00000000", "00"}))
+	require.Nil(f.Close())
+
+	data, err := ioutil.ReadFile(config.ShareLog)
+	require.Nil(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(2, len(lines))
+
+	var record ShareRecord
+	require.Nil(json.Unmarshal([]byte(lines[0]), &record))
+	require.Equal("pool:3333", record.Pool)
+	require.Equal("job-1", record.JobID)
+	require.Equal("78563412", record.Nonce)
+	require.Equal(hash, record.Hash)
+	require.Equal(uint64(1000), record.Difficulty)
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF), record.ShareDifficulty)
+	require.True(record.Accepted)
+	require.Equal(int64(50), record.LatencyMs)
+
+	require.Nil(json.Unmarshal([]byte(lines[1]), &record))
+	require.False(record.Accepted)
+	require.Equal("Low difficulty share", record.Error)
+
+	// Records are appended to an existing log
+	f, err = SetupShareLog(config)
+	require.Nil(err)
+	require.Nil(recordShare("pool:3333", &SubmitResult{Accepted: true}))
+	require.Nil(f.Close())
+	data, err = ioutil.ReadFile(config.ShareLog)
+	require.Nil(err)
+	require.Equal(3, len(strings.Split(strings.TrimSpace(string(data)), "\n")))
+}
+
+func TestShareLogRotation(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sharelog")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	defer SetShareLog(nil)
+
+	config := &Config{ShareLog: filepath.Join(dir, "shares.log"), ShareLogMaxSize: 1, ShareLogBackups: 1, ShareLogCompress: true}
+	f, err := SetupShareLog(config)
+	require.Nil(err)
+	defer f.Close()
+
+	// Each record is a few hundred bytes, so the log rotates once it holds
+	// about 1MB of them
+	for i := 0; i < 8000; i++ {
+		require.Nil(recordShare("pool:3333", &SubmitResult{true, 1000, 0, "", "job-1", "78563412", strings.Repeat("00", 32)}))
+	}
+	info, err := os.Stat(config.ShareLog)
+	require.Nil(err)
+	require.True(info.Size() <= 1024*1024)
+	_, err = os.Stat(config.ShareLog + ".1.gz")
+	require.Nil(err)
+	_, err = os.Stat(config.ShareLog + ".2.gz")
+	require.True(os.IsNotExist(err))
+}
@@ -0,0 +1,98 @@
+package miner
+
+import (
+	"encoding/binary"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ShareDifficulty returns the actual difficulty of a cryptonight hash. Like
+// the target comparison, only the most significant 64 bits of the hash are
+// taken into account
+func ShareDifficulty(hash []byte) uint64 {
+	if len(hash) < 32 {
+		return 0
+	}
+	value := binary.LittleEndian.Uint64(hash[24:32])
+	if value == 0 {
+		return 0xFFFFFFFFFFFFFFFF
+	}
+	return 0xFFFFFFFFFFFFFFFF / value
+}
+
+// TargetDifficulty returns the difficulty equivalent to a 64-bit work target
+func TargetDifficulty(target uint64) uint64 {
+	if target == 0 {
+		return 0
+	}
+	return 0xFFFFFFFFFFFFFFFF / target
+}
+
+// ShareStats tracks the shares found during this session
+type ShareStats struct {
+	sync.Mutex
+	found uint64
+	best  uint64
+}
+
+// NewShareStats returns an empty ShareStats
+func NewShareStats() *ShareStats {
+	return &ShareStats{}
+}
+
+// Add records a share of the given difficulty and returns true if it is the
+// best share found so far
+func (s *ShareStats) Add(difficulty uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	s.found++
+	if difficulty > s.best {
+		s.best = difficulty
+		return true
+	}
+	return false
+}
+
+// Found returns the number of shares found
+func (s *ShareStats) Found() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.found
+}
+
+// Best returns the difficulty of the best share found
+func (s *ShareStats) Best() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.best
+}
+
+// Reset forgets all shares found so far
+func (s *ShareStats) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.found = 0
+	s.best = 0
+}
+
+// DefaultShareStats tracks the shares found by all miners
+var DefaultShareStats = NewShareStats()
+
+// RecordShare computes the difficulty of a share that is about to be
+// submitted, logs it and records it in DefaultShareStats.
+// A share whose difficulty is below the pool difficulty indicates a problem
+// with target handling and is logged as a warning.
+func RecordShare(minerID uint32, hash []byte, target uint64) uint64 {
+	difficulty := ShareDifficulty(hash)
+	poolDifficulty := TargetDifficulty(target)
+	if DefaultShareStats.Add(difficulty) {
+		log.Infof("miner-%d: New best share diff %d (pool diff %d)", minerID, difficulty, poolDifficulty)
+	} else {
+		log.Debugf("miner-%d: Found share diff %d (pool diff %d)", minerID, difficulty, poolDifficulty)
+	}
+	if difficulty < poolDifficulty {
+		log.Warnf("miner-%d: Share diff %d is below pool diff %d, target handling may be broken", minerID, difficulty, poolDifficulty)
+	}
+	return difficulty
+}
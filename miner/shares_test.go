@@ -0,0 +1,42 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareDifficulty(t *testing.T) {
+	require := require.New(t)
+
+	hash := make([]byte, 32)
+	// Top 64-bit word is 0x100 (little-endian)
+	hash[25] = 0x1
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF/0x100), ShareDifficulty(hash))
+
+	// Lower words do not count
+	hash[0] = 0xFF
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF/0x100), ShareDifficulty(hash))
+
+	require.Equal(uint64(0), ShareDifficulty(hash[:16]))
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF), ShareDifficulty(make([]byte, 32)))
+}
+
+func TestTargetDifficulty(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(uint64(1), TargetDifficulty(0xFFFFFFFFFFFFFFFF))
+	require.Equal(uint64(5000), TargetDifficulty(0xFFFFFFFFFFFFFFFF/5000))
+	require.Equal(uint64(0), TargetDifficulty(0))
+}
+
+func TestShareStats(t *testing.T) {
+	require := require.New(t)
+
+	stats := NewShareStats()
+	require.True(stats.Add(100))
+	require.False(stats.Add(50))
+	require.True(stats.Add(200))
+	require.Equal(uint64(3), stats.Found())
+	require.Equal(uint64(200), stats.Best())
+}
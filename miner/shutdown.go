@@ -0,0 +1,55 @@
+package miner
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultShutdownGrace is the number of seconds to wait for shares that
+// were already found to be submitted and answered before exiting
+var DefaultShutdownGrace = 5
+
+// shutdownPoll is how often Shutdown checks for shares still in flight
+var shutdownPoll = 50 * time.Millisecond
+
+// answeredShares returns the number of shares the pool answered so far
+func answeredShares() uint64 {
+	submitCounts.Lock()
+	defer submitCounts.Unlock()
+	return submitCounts.total
+}
+
+// Shutdown pauses the miners that can be paused, so that no new shares are
+// found, and waits up to grace for the shares in flight to be answered.
+// unchecked, if not nil, returns the number of results that were found but
+// not submitted yet. It logs and returns how many shares were answered
+// while waiting and how many were given up on
+func Shutdown(miners []Interface, grace time.Duration, unchecked func() int) (flushed int, abandoned int) {
+	for _, m := range miners {
+		if p, ok := m.(Pausable); ok {
+			p.Pause()
+		}
+	}
+	pending := func() int {
+		n := InFlightShares()
+		if unchecked != nil {
+			n += unchecked()
+		}
+		return n
+	}
+	answered := answeredShares()
+	if n := pending(); n > 0 && grace > 0 {
+		log.Infof("Waiting up to %v for %d shares in flight", grace, n)
+		deadline := time.Now().Add(grace)
+		for pending() > 0 && time.Now().Before(deadline) {
+			time.Sleep(shutdownPoll)
+		}
+	}
+	flushed = int(answeredShares() - answered)
+	abandoned = pending()
+	if flushed > 0 || abandoned > 0 {
+		log.Infof("Shutting down, flushed %d shares and abandoned %d", flushed, abandoned)
+	}
+	return flushed, abandoned
+}
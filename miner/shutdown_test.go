@@ -0,0 +1,63 @@
+package miner
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitTrackerInFlight(t *testing.T) {
+	require := require.New(t)
+
+	s := NewSubmitTracker()
+	before := InFlightShares()
+	s.Sent([]byte(`{"id":2,"method":"submit","params":{"id":"w","job_id":"job-1","nonce":"00000000","result":"00"}}` + "\n"))
+	s.Sent([]byte(`{"id":3,"method":"submit","params":{"id":"w","job_id":"job-1","nonce":"00000001","result":"00"}}` + "\n"))
+	require.Equal(before+2, InFlightShares())
+
+	_, ok := s.Received([]byte(`{"id":2,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}` + "\n"))
+	require.True(ok)
+	require.Equal(before+1, InFlightShares())
+
+	require.Equal(1, s.Abandon())
+	require.Equal(before, InFlightShares())
+	require.Equal(0, s.Abandon())
+}
+
+func TestShutdown(t *testing.T) {
+	require := require.New(t)
+
+	atomic.StoreInt64(&inFlightShares, 0)
+	resetSubmitCounts()
+
+	m := &restartableMiner{New(0), 0}
+	s := NewSubmitTracker()
+	s.Sent([]byte(`{"id":2,"method":"submit","params":{"id":"w","job_id":"job-1","nonce":"00000000","result":"00"}}` + "\n"))
+	s.Sent([]byte(`{"id":3,"method":"submit","params":{"id":"w","job_id":"job-1","nonce":"00000001","result":"00"}}` + "\n"))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		result, _ := s.Received([]byte(`{"id":2,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}` + "\n"))
+		LogSubmitResult(result)
+	}()
+
+	// One share is answered while waiting and the other is given up on
+	flushed, abandoned := Shutdown([]Interface{m}, 200*time.Millisecond, nil)
+	require.True(m.Paused())
+	require.Equal(1, flushed)
+	require.Equal(1, abandoned)
+	s.Abandon()
+
+	// Unchecked results keep Shutdown waiting too
+	flushed, abandoned = Shutdown(nil, 100*time.Millisecond, func() int { return 2 })
+	require.Equal(0, flushed)
+	require.Equal(2, abandoned)
+
+	// Nothing in flight returns right away
+	start := time.Now()
+	flushed, abandoned = Shutdown(nil, time.Minute, nil)
+	require.True(time.Since(start) < time.Second)
+	require.Equal(0, flushed)
+	require.Equal(0, abandoned)
+}
@@ -0,0 +1,245 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// SoloPollInterval is how often the daemon is polled for a new block
+	// template
+	SoloPollInterval = 5 * time.Second
+	// SoloReserveSize is the number of bytes reserved in the block template
+	SoloReserveSize = 8
+	// soloMaxTemplates is the number of block templates kept around so that
+	// shares of slightly older jobs can still be submitted
+	soloMaxTemplates = 4
+)
+
+const (
+	// soloNonceOffset is the offset of the nonce in both the block template
+	// and the hashing blob
+	soloNonceOffset = 39
+	// soloWorkSize is the size of the buffer backing a job
+	soloWorkSize = 128
+)
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      string      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// BlockTemplate is the result of a get_block_template call
+type BlockTemplate struct {
+	BlockTemplateBlob string `json:"blocktemplate_blob"`
+	BlockHashingBlob  string `json:"blockhashing_blob"`
+	Difficulty        uint64 `json:"difficulty"`
+	Height            uint64 `json:"height"`
+	PrevHash          string `json:"prev_hash"`
+	// Key of the RandomX dataset that the block is hashed with
+	SeedHash string `json:"seed_hash"`
+}
+
+// SoloClient is a WorkProvider that mines directly against a monerod-style
+// daemon using the getblocktemplate/submitblock JSON-RPC calls
+type SoloClient struct {
+	sync.Mutex
+	url           string
+	wallet        string
+	client        *http.Client
+	listeners     []chan<- *stratum.Work
+	templates     map[string]*BlockTemplate
+	templateOrder []string
+	current       *BlockTemplate
+}
+
+// NewSoloClient returns a SoloClient talking to the daemon at url. Blocks
+// found are paid out to wallet
+func NewSoloClient(url string, wallet string) *SoloClient {
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	if !strings.HasSuffix(url, "/json_rpc") {
+		url = strings.TrimSuffix(url, "/") + "/json_rpc"
+	}
+	return &SoloClient{
+		url:       url,
+		wallet:    wallet,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		templates: make(map[string]*BlockTemplate),
+	}
+}
+
+func (c *SoloClient) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(&rpcRequest{"2.0", "0", method, params})
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Daemon returned HTTP %v for %v", resp.Status, method)
+	}
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("Failed to decode %v response: %v", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%v failed: %v (code %d)", method, response.Error.Message, response.Error.Code)
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+// GetBlockTemplate fetches a new block template from the daemon
+func (c *SoloClient) GetBlockTemplate() (*BlockTemplate, error) {
+	params := map[string]interface{}{
+		"wallet_address": c.wallet,
+		"reserve_size":   SoloReserveSize,
+	}
+	var template BlockTemplate
+	if err := c.call("get_block_template", params, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// RegisterWorkListener registers workChan to receive every new job
+func (c *SoloClient) RegisterWorkListener(workChan chan<- *stratum.Work) {
+	c.Lock()
+	defer c.Unlock()
+	c.listeners = append(c.listeners, workChan)
+}
+
+func templateJobID(template *BlockTemplate) string {
+	return fmt.Sprintf("%d-%s", template.Height, template.PrevHash)
+}
+
+// templateWork converts a block template into a job
+func templateWork(template *BlockTemplate) (*stratum.Work, error) {
+	blob, err := hex.DecodeString(template.BlockHashingBlob)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hashing blob: %v", err)
+	}
+	if len(blob) < soloNonceOffset+4 || len(blob) > soloWorkSize {
+		return nil, fmt.Errorf("Invalid hashing blob size: %d", len(blob))
+	}
+	work := stratum.NewWork()
+	work.Data = make(stratum.WorkData, soloWorkSize)
+	copy(work.Data, blob)
+	work.Size = len(blob)
+	work.JobID = templateJobID(template)
+	work.Difficulty = float64(template.Difficulty)
+	work.Target = 0xFFFFFFFFFFFFFFFF
+	if template.Difficulty > 0 {
+		work.Target /= template.Difficulty
+	}
+	return work, nil
+}
+
+// update fetches a block template and notifies listeners if it is new
+func (c *SoloClient) update() error {
+	template, err := c.GetBlockTemplate()
+	if err != nil {
+		return err
+	}
+	jobID := templateJobID(template)
+
+	c.Lock()
+	if _, ok := c.templates[jobID]; ok {
+		c.Unlock()
+		return nil
+	}
+	work, err := templateWork(template)
+	if err != nil {
+		c.Unlock()
+		return err
+	}
+	c.templates[jobID] = template
+	RecordJobHeight(jobID, template.Height)
+	recordJobSeedHex(jobID, template.SeedHash)
+	c.templateOrder = append(c.templateOrder, jobID)
+	if len(c.templateOrder) > soloMaxTemplates {
+		delete(c.templates, c.templateOrder[0])
+		c.templateOrder = c.templateOrder[1:]
+	}
+	c.current = template
+	listeners := c.listeners
+	c.Unlock()
+
+	log.Infof("solo: New block template height=%d diff=%d", template.Height, template.Difficulty)
+	PublishEvent(JobReceived, 0, work)
+	for _, workChan := range listeners {
+		workChan <- work
+	}
+	return nil
+}
+
+// Run polls the daemon for new block templates until the process exits.
+// This function is expected to be run in a goroutine
+func (c *SoloClient) Run() {
+	for {
+		if err := c.update(); err != nil {
+			log.Errorf("solo: Failed to get block template: %v", err)
+		}
+		time.Sleep(SoloPollInterval)
+	}
+}
+
+// SubmitWork places the nonce of work into the block template it was
+// created from and submits the block to the daemon
+func (c *SoloClient) SubmitWork(work *stratum.Work, hash string) error {
+	c.Lock()
+	template, ok := c.templates[work.JobID]
+	c.Unlock()
+	if !ok {
+		PublishEvent(ShareStale, 0, work)
+		return fmt.Errorf("Unknown or stale job: %v", work.JobID)
+	}
+	block, err := hex.DecodeString(template.BlockTemplateBlob)
+	if err != nil {
+		return fmt.Errorf("Invalid block template: %v", err)
+	}
+	if len(block) < soloNonceOffset+4 {
+		return fmt.Errorf("Invalid block template size: %d", len(block))
+	}
+	copy(block[soloNonceOffset:soloNonceOffset+4], work.Data[soloNonceOffset:soloNonceOffset+4])
+
+	nonce := binary.LittleEndian.Uint32(work.Data[soloNonceOffset:])
+	log.Infof("solo: Submitting block height=%d nonce=%08x hash=%v", template.Height, nonce, hash)
+	if err := c.call("submit_block", []string{hex.EncodeToString(block)}, nil); err != nil {
+		PublishEvent(ShareRejected, 0, work)
+		return err
+	}
+	PublishEvent(ShareAccepted, 0, work)
+	// Our own block invalidates the current template
+	go c.update()
+	return nil
+}
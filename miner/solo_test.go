@@ -0,0 +1,65 @@
+package miner
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoloClient(t *testing.T) {
+	require := require.New(t)
+
+	blob := strings.Repeat("00", 76)
+	template := strings.Repeat("00", 100)
+	submitted := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("/json_rpc", r.URL.Path)
+		var request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		require.Nil(json.NewDecoder(r.Body).Decode(&request))
+		switch request.Method {
+		case "get_block_template":
+			fmt.Fprintf(w, `{"id":"0","jsonrpc":"2.0","result":{"blocktemplate_blob":"%s","blockhashing_blob":"%s","difficulty":1000,"height":42,"prev_hash":"ab"}}`, template, blob)
+		case "submit_block":
+			var params []string
+			require.Nil(json.Unmarshal(request.Params, &params))
+			submitted <- params[0]
+			fmt.Fprintf(w, `{"id":"0","jsonrpc":"2.0","result":{"status":"OK"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewSoloClient(strings.TrimPrefix(server.URL, "http://"), "wallet")
+	workChan := make(chan *stratum.Work, 1)
+	client.RegisterWorkListener(workChan)
+	require.Nil(client.update())
+
+	work := <-workChan
+	require.Equal("42-ab", work.JobID)
+	require.Equal(76, work.Size)
+	require.Equal(uint64(0xFFFFFFFFFFFFFFFF/1000), work.Target)
+
+	// The same template is not sent out again
+	require.Nil(client.update())
+	require.Equal(0, len(workChan))
+
+	copy(work.Data[soloNonceOffset:], []byte{0xde, 0xad, 0xbe, 0xef})
+	require.Nil(client.SubmitWork(work, "hash"))
+	block, err := hex.DecodeString(<-submitted)
+	require.Nil(err)
+	require.Equal([]byte{0xde, 0xad, 0xbe, 0xef}, block[soloNonceOffset:soloNonceOffset+4])
+	require.Equal(100, len(block))
+
+	work.JobID = "unknown"
+	require.NotNil(client.SubmitWork(work, "hash"))
+}
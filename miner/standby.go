@@ -0,0 +1,263 @@
+package miner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// standbyLoginTimeout is how long the standby pool has to answer a login
+	standbyLoginTimeout = 30 * time.Second
+	// standbyRetryDelay is the delay before reconnecting a standby
+	// connection that failed
+	standbyRetryDelay = 10 * time.Second
+)
+
+// StandbyConn is a connection to a pool that is logged in. Reader returns
+// what the pool sent after the login response
+type StandbyConn struct {
+	Conn   net.Conn
+	Reader io.Reader
+	// Result of the login, with the latest job the pool sent
+	Result map[string]interface{}
+}
+
+// LoginReply returns the response to the login request line, answered with
+// the result of the standby login. ok is false if line is not a login
+func (c *StandbyConn) LoginReply(line []byte) (reply []byte, ok bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return nil, false
+	}
+	if method, _ := message["method"].(string); method != "login" {
+		return nil, false
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"id":      message["id"],
+		"jsonrpc": "2.0",
+		"error":   nil,
+		"result":  c.Result,
+	})
+	if err != nil {
+		return nil, false
+	}
+	return append(b, '\n'), true
+}
+
+// Standby keeps a connection to a backup pool logged in and up to date with
+// its jobs, so that mining can move to the pool without waiting for it to
+// connect and log in
+type Standby struct {
+	sync.Mutex
+	// index of pool in config.Pools
+	index  int
+	pool   Pool
+	dialer *Dialer
+	conn   net.Conn
+	reader *bufio.Reader
+	result map[string]interface{}
+	// The part of a message that was read when the connection was taken
+	partial  []byte
+	ready    bool
+	taken    bool
+	closed   bool
+	released chan struct{}
+}
+
+// NewStandby returns a Standby for the pool at index in the config.
+// Run has to be called to connect it
+func NewStandby(index int, pool Pool, dialer *Dialer) *Standby {
+	return &Standby{
+		index:    index,
+		pool:     pool,
+		dialer:   dialer,
+		released: make(chan struct{}),
+	}
+}
+
+// Index returns the index in the config of the standby pool
+func (s *Standby) Index() int {
+	return s.index
+}
+
+// Pool returns the standby pool
+func (s *Standby) Pool() Pool {
+	return s.pool
+}
+
+// Ready returns true if the standby connection is logged in
+func (s *Standby) Ready() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.ready && !s.taken
+}
+
+// Take hands the standby connection over to the caller. It returns nil if
+// the connection is not logged in. The Standby is done once it was taken
+func (s *Standby) Take() *StandbyConn {
+	s.Lock()
+	if !s.ready || s.taken {
+		s.Unlock()
+		return nil
+	}
+	s.taken = true
+	conn := s.conn
+	s.Unlock()
+
+	// Interrupt the read loop and wait for it to let go of the connection
+	conn.SetReadDeadline(time.Now())
+	<-s.released
+	conn.SetReadDeadline(time.Time{})
+
+	s.Lock()
+	defer s.Unlock()
+	return &StandbyConn{
+		conn,
+		io.MultiReader(bytes.NewReader(s.partial), s.reader),
+		s.result,
+	}
+}
+
+// Close drops the standby connection unless it was taken
+func (s *Standby) Close() {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	if s.conn != nil && !s.taken {
+		s.conn.Close()
+	}
+}
+
+// Run keeps the standby connection logged in until it is taken or closed.
+// This function is expected to be run in a goroutine
+func (s *Standby) Run() {
+	for {
+		err := s.session()
+		s.Lock()
+		done := s.taken || s.closed
+		s.Unlock()
+		if done {
+			return
+		}
+		log.Warnf("standby: Connection to %v failed: %v", s.pool.Url, err)
+		time.Sleep(standbyRetryDelay)
+	}
+}
+
+// session connects and logs in to the pool and follows its jobs until the
+// connection fails or is taken
+func (s *Standby) session() error {
+	conn, err := s.dialer.Dial(s.pool.Url)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		conn.Close()
+		return nil
+	}
+	s.conn = conn
+	s.Unlock()
+
+	toPool := &lockedWriter{w: conn}
+	login, err := json.Marshal(map[string]interface{}{
+		"id":      1,
+		"jsonrpc": "2.0",
+		"method":  "login",
+		"params": map[string]interface{}{
+			"login": s.pool.User,
+			"pass":  s.pool.Pass,
+			"agent": Agent,
+		},
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := toPool.Write(append(login, '\n')); err != nil {
+		conn.Close()
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(standbyLoginTimeout))
+	result, err := readLoginResult(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+	log.Infof("standby: Logged in to %v", s.pool.Url)
+
+	s.Lock()
+	s.reader = reader
+	s.result = result
+	s.ready = true
+	s.Unlock()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			s.Lock()
+			defer s.Unlock()
+			if s.taken {
+				s.partial = line
+				close(s.released)
+				return nil
+			}
+			s.ready = false
+			conn.Close()
+			return err
+		}
+		if reply, ok := VersionReply(line); ok {
+			toPool.Write(reply)
+			continue
+		}
+		message, ok := decodeMessage(line)
+		if !ok {
+			continue
+		}
+		if method, _ := message["method"].(string); method == "job" {
+			if job, ok := message["params"].(map[string]interface{}); ok {
+				s.Lock()
+				s.result["job"] = job
+				s.Unlock()
+			}
+		}
+	}
+}
+
+// readLoginResult reads messages until the response to the login and
+// returns its result
+func readLoginResult(reader *bufio.Reader) (map[string]interface{}, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		message, ok := decodeMessage(line)
+		if !ok {
+			continue
+		}
+		if _, isRequest := message["method"]; isRequest {
+			continue
+		}
+		if message["error"] != nil {
+			return nil, fmt.Errorf("Login failed: %v", message["error"])
+		}
+		result, ok := message["result"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid login response: %s", bytes.TrimSpace(line))
+		}
+		return result, nil
+	}
+}
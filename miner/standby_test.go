@@ -0,0 +1,111 @@
+package miner
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+// startStandbyEngine starts an engine on primary with backup as its standby
+// pool and waits for both to be logged in
+func startStandbyEngine(t *testing.T, primary, backup *fakePool) (*Engine, chan *stratum.Work) {
+	require := require.New(t)
+
+	config := &Config{Standby: true}
+	config.Pools = []Pool{
+		{Url: primary.URL(), User: "wallet", Pass: "x"},
+		{Url: backup.URL(), User: "backup-wallet", Pass: "y"},
+	}
+	engine, err := NewEngine(config)
+	require.Nil(err)
+
+	workChan := make(chan *stratum.Work, 10)
+	engine.Provider().RegisterWorkListener(workChan)
+	require.Nil(engine.Start())
+	primary.NextRequest("login", 5*time.Second)
+	nextWork(t, workChan)
+
+	login := backup.NextRequest("login", 5*time.Second)
+	require.Equal("backup-wallet", login.Params["login"])
+	require.Equal(Agent, login.Params["agent"])
+	for !engine.relay.Standby().Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return engine, workChan
+}
+
+func TestStandbyPromotedOnOutage(t *testing.T) {
+	require := require.New(t)
+
+	primary := newFakePool(t)
+	defer primary.Close()
+	backup := newFakePool(t)
+	defer backup.Close()
+	backup.PushJob()
+
+	engine, workChan := startStandbyEngine(t, primary, backup)
+
+	// The standby follows the jobs of the backup pool
+	jobID := backup.PushJob()
+	time.Sleep(100 * time.Millisecond)
+
+	primary.Close()
+	for {
+		if work := nextWork(t, workChan); work.JobID == jobID {
+			break
+		}
+	}
+	require.Equal(1, engine.PoolIndex())
+
+	// Mining moved to the connection that was already logged in
+	select {
+	case request := <-backup.requests:
+		require.NotEqual("login", request.Method)
+	default:
+	}
+}
+
+func TestStandbyPromotedOnSwitch(t *testing.T) {
+	require := require.New(t)
+
+	primary := newFakePool(t)
+	defer primary.Close()
+	backup := newFakePool(t)
+	defer backup.Close()
+
+	engine, workChan := startStandbyEngine(t, primary, backup)
+
+	jobID := backup.PushJob()
+	require.Nil(engine.SwitchPool(1))
+	for {
+		if work := nextWork(t, workChan); work.JobID == jobID {
+			break
+		}
+	}
+	require.Equal(1, engine.PoolIndex())
+
+	// The primary becomes the standby to fail back to
+	login := primary.NextRequest("login", 5*time.Second)
+	require.Equal("wallet", login.Params["login"])
+	standby := engine.relay.Standby()
+	require.NotNil(standby)
+	require.Equal(0, standby.Index())
+}
+
+func TestStandbyLoginReply(t *testing.T) {
+	require := require.New(t)
+
+	conn := &StandbyConn{Result: map[string]interface{}{"id": "session-1", "status": "OK"}}
+	reply, ok := conn.LoginReply([]byte(`{"id":7,"jsonrpc":"2.0","method":"login","params":{"login":"wallet"}}` + "\n"))
+	require.True(ok)
+	message, ok := decodeMessage(reply)
+	require.True(ok)
+	require.Equal(json.Number("7"), message["id"])
+	require.Equal("session-1", message["result"].(map[string]interface{})["id"])
+
+	_, ok = conn.LoginReply([]byte(`{"id":8,"jsonrpc":"2.0","method":"submit","params":{}}` + "\n"))
+	require.False(ok)
+}
@@ -0,0 +1,149 @@
+package miner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	stratum "github.com/gurupras/go-stratum-client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ShareCounts holds the number of shares the pool responded to, by outcome
+type ShareCounts struct {
+	Accepted uint64 `json:"accepted"`
+	Rejected uint64 `json:"rejected"`
+	Stale    uint64 `json:"stale"`
+}
+
+// Stats counts share outcomes published on an EventBus
+type Stats struct {
+	sync.Mutex
+	counts ShareCounts
+	// Rejected and stale shares by RejectReason
+	reasons map[string]uint64
+}
+
+// NewStats returns zeroed Stats
+func NewStats() *Stats {
+	return &Stats{reasons: make(map[string]uint64)}
+}
+
+// HandleEvent updates the counts with event
+func (s *Stats) HandleEvent(event *Event) {
+	s.Lock()
+	defer s.Unlock()
+	switch event.Kind {
+	case ShareAccepted:
+		s.counts.Accepted++
+	case ShareRejected:
+		s.counts.Rejected++
+		reason := RejectOther
+		if response, ok := event.Payload.(*stratum.Response); ok && response != nil {
+			reason = RejectReason(responseErrorMessage(response))
+		}
+		s.reasons[reason]++
+	case ShareStale:
+		s.counts.Stale++
+		s.reasons[RejectStale]++
+	}
+}
+
+// Counts returns a snapshot of the share counts
+func (s *Stats) Counts() ShareCounts {
+	s.Lock()
+	defer s.Unlock()
+	return s.counts
+}
+
+// RejectReasons returns a snapshot of the number of rejected and stale
+// shares by RejectReason
+func (s *Stats) RejectReasons() map[string]uint64 {
+	s.Lock()
+	defer s.Unlock()
+	reasons := make(map[string]uint64, len(s.reasons))
+	for reason, count := range s.reasons {
+		reasons[reason] = count
+	}
+	return reasons
+}
+
+// Reset zeroes all counts
+func (s *Stats) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.counts = ShareCounts{}
+	s.reasons = make(map[string]uint64)
+}
+
+// FormatRejectReasons formats reject reasons counts as "reason: count"
+// pairs, sorted by reason
+func FormatRejectReasons(reasons map[string]uint64) string {
+	names := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		names = append(names, reason)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, reason := range names {
+		parts[i] = fmt.Sprintf("%s: %d", reason, reasons[reason])
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	// DefaultStats counts the share outcomes of all miners
+	DefaultStats = NewStats()
+
+	// statsGeneration is incremented on every reset so that long running
+	// consumers like the hashrate trackers can notice it
+	statsGeneration uint64
+
+	statsResetLock  sync.Mutex
+	statsResetHooks []func()
+)
+
+// RunStatsCollector feeds DefaultStats and DefaultStatusTracker with the
+// events published on DefaultEventBus.
+// This function is expected to be run in a goroutine
+func RunStatsCollector() {
+	eventChan := make(chan *Event, 10)
+	RegisterEventListener(eventChan)
+	for event := range eventChan {
+		DefaultStats.HandleEvent(event)
+		DefaultStatusTracker.HandleEvent(event)
+	}
+}
+
+// OnStatsReset registers hook to be called whenever the stats are reset.
+// Packages keeping their own stats use this to reset them along with the rest
+func OnStatsReset(hook func()) {
+	statsResetLock.Lock()
+	defer statsResetLock.Unlock()
+	statsResetHooks = append(statsResetHooks, hook)
+}
+
+// StatsGeneration returns the number of times the stats have been reset
+func StatsGeneration() uint64 {
+	return atomic.LoadUint64(&statsGeneration)
+}
+
+// ResetStats zeroes the share counts, best share, hashrate averages and any
+// stats registered through OnStatsReset
+func ResetStats() {
+	statsResetLock.Lock()
+	defer statsResetLock.Unlock()
+	DefaultStats.Reset()
+	DefaultShareStats.Reset()
+	DefaultSubmitCache.ResetDuplicates()
+	resetSubmitCounts()
+	resetWithheldShares()
+	for _, hook := range statsResetHooks {
+		hook()
+	}
+	atomic.AddUint64(&statsGeneration, 1)
+	log.Infof("Stats reset")
+}
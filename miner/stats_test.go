@@ -0,0 +1,83 @@
+package miner
+
+import (
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	require := require.New(t)
+
+	stats := NewStats()
+	stats.HandleEvent(NewEvent(ShareAccepted, 0, nil))
+	stats.HandleEvent(NewEvent(ShareAccepted, 0, nil))
+	stats.HandleEvent(NewEvent(ShareRejected, 0, nil))
+	stats.HandleEvent(NewEvent(ShareStale, 0, nil))
+	stats.HandleEvent(NewEvent(JobReceived, 0, nil))
+	require.Equal(ShareCounts{2, 1, 1}, stats.Counts())
+
+	stats.Reset()
+	require.Equal(ShareCounts{}, stats.Counts())
+}
+
+func TestStatsRejectReasons(t *testing.T) {
+	require := require.New(t)
+
+	rejected := func(message string) *Event {
+		return NewEvent(ShareRejected, 0, &stratum.Response{Error: map[string]interface{}{"code": -1, "message": message}})
+	}
+	stats := NewStats()
+	stats.HandleEvent(rejected("Low difficulty share"))
+	stats.HandleEvent(rejected("Low difficulty share"))
+	stats.HandleEvent(rejected("Duplicate share"))
+	stats.HandleEvent(rejected("Invalid nonce"))
+	stats.HandleEvent(rejected("Unauthenticated"))
+	stats.HandleEvent(NewEvent(ShareRejected, 0, nil))
+	stats.HandleEvent(NewEvent(ShareStale, 0, nil))
+	require.Equal(map[string]uint64{
+		RejectLowDifficulty: 2,
+		RejectDuplicate:     1,
+		RejectInvalid:       1,
+		RejectOther:         2,
+		RejectStale:         1,
+	}, stats.RejectReasons())
+	require.Equal("duplicate: 1 invalid: 1 low difficulty: 2 other: 2 stale: 1", FormatRejectReasons(stats.RejectReasons()))
+
+	stats.Reset()
+	require.Equal(0, len(stats.RejectReasons()))
+}
+
+func TestRejectReason(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(RejectLowDifficulty, RejectReason("Low difficulty share"))
+	require.Equal(RejectLowDifficulty, RejectReason("Share above target"))
+	require.Equal(RejectStale, RejectReason("Block expired"))
+	require.Equal(RejectStale, RejectReason("Invalid job id: job not found"))
+	require.Equal(RejectDuplicate, RejectReason("Duplicate share"))
+	require.Equal(RejectInvalid, RejectReason("Invalid share"))
+	require.Equal(RejectInvalid, RejectReason("Malformed nonce"))
+	require.Equal(RejectOther, RejectReason("IP Address currently banned"))
+}
+
+func TestResetStats(t *testing.T) {
+	require := require.New(t)
+
+	hookCalled := false
+	OnStatsReset(func() {
+		hookCalled = true
+	})
+
+	DefaultStats.HandleEvent(NewEvent(ShareAccepted, 0, nil))
+	DefaultShareStats.Add(1000)
+	generation := StatsGeneration()
+
+	ResetStats()
+	require.Equal(ShareCounts{}, DefaultStats.Counts())
+	require.Equal(uint64(0), DefaultShareStats.Best())
+	require.Equal(uint64(0), DefaultShareStats.Found())
+	require.Equal(generation+1, StatsGeneration())
+	require.True(hookCalled)
+}
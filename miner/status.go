@@ -0,0 +1,117 @@
+package miner
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+// JobStatus describes the job the miners are working on
+type JobStatus struct {
+	JobID string `json:"job_id"`
+	// BlobPrefix is the part of the blob before the nonce, which contains
+	// the hash of the previous block
+	BlobPrefix string    `json:"blob_prefix"`
+	Target     string    `json:"target"`
+	Difficulty uint64    `json:"difficulty"`
+	Received   time.Time `json:"received"`
+}
+
+// NewJobStatus returns the JobStatus of work
+func NewJobStatus(work *stratum.Work, received time.Time) *JobStatus {
+	prefix := work.Data
+	if len(prefix) > nonceOffset {
+		prefix = prefix[:nonceOffset]
+	}
+	target := JobTarget(work.JobID, work.Target)
+	return &JobStatus{
+		work.JobID,
+		hex.EncodeToString(prefix),
+		target.String(),
+		DifficultyFromTarget(target),
+		received,
+	}
+}
+
+// Status is a snapshot of the state of the miner
+type Status struct {
+	Pool      string      `json:"pool"`
+	Connected bool        `json:"connected"`
+	Job       *JobStatus  `json:"job"`
+	Shares    ShareCounts `json:"shares"`
+	Found     uint64      `json:"found"`
+	BestShare uint64      `json:"best_share"`
+	// Shares that were dropped because they had already been submitted
+	Duplicates uint64 `json:"duplicates"`
+	// Rejected and stale shares by reason
+	RejectReasons map[string]uint64 `json:"reject_reasons"`
+	// Power draw in watts and H/s per watt, if power can be read
+	Power      float64 `json:"power,omitempty"`
+	Efficiency float64 `json:"efficiency,omitempty"`
+}
+
+// StatusTracker keeps track of the pool connection and current job from the
+// events published on an EventBus
+type StatusTracker struct {
+	sync.Mutex
+	pool      string
+	connected bool
+	job       *JobStatus
+}
+
+// NewStatusTracker returns a StatusTracker that has not seen any events
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{}
+}
+
+// HandleEvent updates the tracker with event
+func (s *StatusTracker) HandleEvent(event *Event) {
+	switch event.Kind {
+	case JobReceived:
+		work, ok := event.Payload.(*stratum.Work)
+		if !ok || work == nil {
+			return
+		}
+		// Built before taking the lock so that readers never see a job that
+		// is only partially updated
+		job := NewJobStatus(work, event.Time)
+		s.Lock()
+		s.job = job
+		s.Unlock()
+	case Connected, Disconnected:
+		s.Lock()
+		s.pool = fmt.Sprintf("%v", event.Payload)
+		s.connected = event.Kind == Connected
+		s.Unlock()
+	}
+}
+
+// Status returns a snapshot of the current state, including the share
+// counts of DefaultStats and DefaultShareStats
+func (s *StatusTracker) Status() Status {
+	s.Lock()
+	status := Status{
+		Pool:      s.pool,
+		Connected: s.connected,
+	}
+	if s.job != nil {
+		job := *s.job
+		status.Job = &job
+	}
+	s.Unlock()
+	status.Shares = DefaultStats.Counts()
+	status.RejectReasons = DefaultStats.RejectReasons()
+	status.Found = DefaultShareStats.Found()
+	status.BestShare = DefaultShareStats.Best()
+	status.Duplicates = DefaultSubmitCache.Duplicates()
+	status.Power = DefaultPowerTracker.Watts()
+	status.Efficiency = DefaultPowerTracker.Efficiency()
+	return status
+}
+
+// DefaultStatusTracker tracks the state of all miners. It is fed by
+// RunStatsCollector
+var DefaultStatusTracker = NewStatusTracker()
@@ -0,0 +1,46 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusTracker(t *testing.T) {
+	require := require.New(t)
+
+	s := NewStatusTracker()
+	require.Nil(s.Status().Job)
+
+	s.HandleEvent(NewEvent(Connected, 0, "pool:3333"))
+	work := stratum.NewWork()
+	work.JobID = "job-1"
+	work.Target = 0xFFFFFFFFFFFFFFFF / 1000
+	for i := range work.Data {
+		work.Data[i] = byte(i)
+	}
+	now := time.Now()
+	s.HandleEvent(&Event{JobReceived, now, 0, work})
+
+	status := s.Status()
+	require.Equal("pool:3333", status.Pool)
+	require.True(status.Connected)
+	require.Equal("job-1", status.Job.JobID)
+	require.Equal(uint64(1000), status.Job.Difficulty)
+	require.Equal(2*nonceOffset, len(status.Job.BlobPrefix))
+	require.Equal("000102", status.Job.BlobPrefix[:6])
+	require.Equal(NewTarget(work.Target).String(), status.Job.Target)
+	require.Equal(64, len(status.Job.Target))
+	require.Equal(now, status.Job.Received)
+
+	// The snapshot is not affected by later jobs
+	work.JobID = "job-2"
+	s.HandleEvent(NewEvent(JobReceived, 0, work))
+	require.Equal("job-1", status.Job.JobID)
+	require.Equal("job-2", s.Status().Job.JobID)
+
+	s.HandleEvent(NewEvent(Disconnected, 0, "pool:3333"))
+	require.False(s.Status().Connected)
+}
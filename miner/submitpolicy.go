@@ -0,0 +1,86 @@
+package miner
+
+import (
+	"sync"
+	"sync/atomic"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubmitPolicy decides whether a share is submitted to the pool. It is
+// consulted for every hash that meets the target of its job, right before
+// the share is submitted, and must be safe for concurrent use by all miners
+type SubmitPolicy interface {
+	// ShouldSubmit returns false to withhold the share of minerID for work,
+	// whose nonce is already set, with the resulting hash
+	ShouldSubmit(minerID uint32, work *stratum.Work, hash []byte) bool
+}
+
+// SubmitAll submits every share that meets the target. It is the default
+// policy
+type SubmitAll struct{}
+
+// ShouldSubmit always returns true
+func (SubmitAll) ShouldSubmit(minerID uint32, work *stratum.Work, hash []byte) bool {
+	return true
+}
+
+// MinDifficultyPolicy only submits shares of at least a local difficulty
+// floor, to cut the number of submits to pools that set a low difficulty
+type MinDifficultyPolicy struct {
+	MinDifficulty uint64
+}
+
+// NewMinDifficultyPolicy returns a MinDifficultyPolicy with the floor
+// minDifficulty
+func NewMinDifficultyPolicy(minDifficulty uint64) *MinDifficultyPolicy {
+	return &MinDifficultyPolicy{minDifficulty}
+}
+
+// ShouldSubmit returns true if the difficulty of hash is at least the floor
+func (p *MinDifficultyPolicy) ShouldSubmit(minerID uint32, work *stratum.Work, hash []byte) bool {
+	return ShareDifficulty(hash) >= p.MinDifficulty
+}
+
+var (
+	submitPolicyLock sync.Mutex
+	submitPolicy     SubmitPolicy = SubmitAll{}
+	// Number of shares withheld by the policy
+	withheldShares uint64
+)
+
+// SetSubmitPolicy makes the miners consult policy before submitting a
+// share. nil restores the default of submitting all shares
+func SetSubmitPolicy(policy SubmitPolicy) {
+	if policy == nil {
+		policy = SubmitAll{}
+	}
+	submitPolicyLock.Lock()
+	defer submitPolicyLock.Unlock()
+	submitPolicy = policy
+}
+
+// ShouldSubmit consults the submit policy about a share of minerID that
+// meets the target of work. Shares that are withheld are counted
+func ShouldSubmit(minerID uint32, work *stratum.Work, hash []byte) bool {
+	submitPolicyLock.Lock()
+	policy := submitPolicy
+	submitPolicyLock.Unlock()
+	if policy.ShouldSubmit(minerID, work, hash) {
+		return true
+	}
+	atomic.AddUint64(&withheldShares, 1)
+	log.Debugf("miner-%d: Withholding share diff %d for job %v", minerID, ShareDifficulty(hash), work.JobID)
+	return false
+}
+
+// WithheldShares returns the number of shares the submit policy withheld
+func WithheldShares() uint64 {
+	return atomic.LoadUint64(&withheldShares)
+}
+
+// resetWithheldShares zeroes the count of withheld shares
+func resetWithheldShares() {
+	atomic.StoreUint64(&withheldShares, 0)
+}
@@ -0,0 +1,56 @@
+package miner
+
+import (
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+// hashOfDifficulty returns a hash whose difficulty is about 0xFFFFFFFFFFFFFFFF/top
+func hashOfDifficulty(top byte) []byte {
+	hash := make([]byte, 32)
+	hash[31] = top
+	return hash
+}
+
+type rejectMiner uint32
+
+func (id rejectMiner) ShouldSubmit(minerID uint32, work *stratum.Work, hash []byte) bool {
+	return minerID != uint32(id)
+}
+
+func TestMinDifficultyPolicy(t *testing.T) {
+	require := require.New(t)
+
+	work := &stratum.Work{JobID: "1"}
+	low := hashOfDifficulty(0x80)
+	high := hashOfDifficulty(0x01)
+	policy := NewMinDifficultyPolicy(ShareDifficulty(high))
+	require.False(policy.ShouldSubmit(0, work, low))
+	require.True(policy.ShouldSubmit(0, work, high))
+	require.True(SubmitAll{}.ShouldSubmit(0, work, low))
+}
+
+func TestSetSubmitPolicy(t *testing.T) {
+	require := require.New(t)
+	defer SetSubmitPolicy(nil)
+	resetWithheldShares()
+
+	work := &stratum.Work{JobID: "1"}
+	hash := hashOfDifficulty(0x80)
+	require.True(ShouldSubmit(1, work, hash))
+	require.Equal(uint64(0), WithheldShares())
+
+	SetSubmitPolicy(rejectMiner(1))
+	require.False(ShouldSubmit(1, work, hash))
+	require.True(ShouldSubmit(2, work, hash))
+	require.Equal(uint64(1), WithheldShares())
+
+	ResetStats()
+	require.Equal(uint64(0), WithheldShares())
+
+	// nil restores submitting every share
+	SetSubmitPolicy(nil)
+	require.True(ShouldSubmit(1, work, hash))
+}
@@ -0,0 +1,219 @@
+package miner
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingSubmit is a share that was submitted and not answered yet
+type pendingSubmit struct {
+	sent       time.Time
+	difficulty uint64
+	jobID      string
+	nonce      string
+	hash       string
+}
+
+// SubmitResult is the pool's response to a submitted share
+type SubmitResult struct {
+	Accepted   bool
+	Difficulty uint64
+	// Latency is the time from submitting the share to receiving the response
+	Latency time.Duration
+	// Error is the reason the pool gave for rejecting the share
+	Error string
+	// Job, nonce and hash of the share as they were submitted
+	JobID string
+	Nonce string
+	Hash  string
+}
+
+// SubmitTracker follows the messages exchanged on a pool connection and
+// matches the responses of the pool with the shares they answer by request
+// id. Request ids are only unique within a connection, so every connection
+// needs its own tracker
+type SubmitTracker struct {
+	sync.Mutex
+	pending map[string]pendingSubmit
+	// Difficulties of recent jobs, by job id
+	jobs     map[string]uint64
+	jobOrder []string
+	now      func() time.Time
+}
+
+// NewSubmitTracker returns a SubmitTracker with no submitted shares
+func NewSubmitTracker() *SubmitTracker {
+	return &SubmitTracker{
+		pending: make(map[string]pendingSubmit),
+		jobs:    make(map[string]uint64),
+		now:     time.Now,
+	}
+}
+
+// Sent handles a message sent to the pool, recording it if it submits a share
+func (s *SubmitTracker) Sent(line []byte) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return
+	}
+	if method, _ := message["method"].(string); method != "submit" {
+		return
+	}
+	id, ok := jsonString(message["id"])
+	if !ok {
+		return
+	}
+	var jobID, nonce, hash string
+	if params, ok := message["params"].(map[string]interface{}); ok {
+		jobID, _ = jsonString(params["job_id"])
+		nonce, _ = params["nonce"].(string)
+		hash, _ = params["result"].(string)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.pending[id]; !ok {
+		atomic.AddInt64(&inFlightShares, 1)
+	}
+	s.pending[id] = pendingSubmit{s.now(), s.jobs[jobID], jobID, nonce, hash}
+}
+
+// Received handles a message sent by the pool. Jobs are recorded so that the
+// difficulty of the shares submitted for them is known. ok is true if the
+// message is the response to a submitted share
+func (s *SubmitTracker) Received(line []byte) (result *SubmitResult, ok bool) {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return nil, false
+	}
+	if method, _ := message["method"].(string); method == "job" {
+		if params, ok := message["params"].(map[string]interface{}); ok {
+			s.recordJob(params)
+		}
+		return nil, false
+	}
+	if res, ok := message["result"].(map[string]interface{}); ok {
+		if job, ok := res["job"].(map[string]interface{}); ok {
+			// Login response
+			s.recordJob(job)
+			return nil, false
+		}
+	}
+
+	id, ok := jsonString(message["id"])
+	if !ok {
+		return nil, false
+	}
+	s.Lock()
+	submit, ok := s.pending[id]
+	delete(s.pending, id)
+	now := s.now()
+	s.Unlock()
+	if !ok {
+		return nil, false
+	}
+	atomic.AddInt64(&inFlightShares, -1)
+
+	result = &SubmitResult{
+		Difficulty: submit.difficulty,
+		Latency:    now.Sub(submit.sent),
+		JobID:      submit.jobID,
+		Nonce:      submit.nonce,
+		Hash:       submit.hash,
+	}
+	switch e := message["error"].(type) {
+	case nil:
+		result.Accepted = true
+	case map[string]interface{}:
+		result.Error, _ = e["message"].(string)
+	default:
+		result.Error = fmt.Sprintf("%v", e)
+	}
+	return result, true
+}
+
+// Abandon forgets the shares that were not answered, when the connection
+// they were submitted on is closed. It returns how many there were
+func (s *SubmitTracker) Abandon() int {
+	s.Lock()
+	defer s.Unlock()
+	n := len(s.pending)
+	atomic.AddInt64(&inFlightShares, -int64(n))
+	s.pending = make(map[string]pendingSubmit)
+	return n
+}
+
+// inFlightShares is the number of shares submitted on any connection that
+// the pool hasn't answered yet
+var inFlightShares int64
+
+// InFlightShares returns the number of shares that were submitted and not
+// answered yet
+func InFlightShares() int {
+	return int(atomic.LoadInt64(&inFlightShares))
+}
+
+// recordJob remembers the difficulty of a job
+func (s *SubmitTracker) recordJob(job map[string]interface{}) {
+	jobID, ok := jsonString(job["job_id"])
+	if !ok {
+		return
+	}
+	targetStr, ok := job["target"].(string)
+	if !ok {
+		return
+	}
+	target, err := ParseTarget(targetStr)
+	if err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.jobs[jobID]; !ok {
+		s.jobOrder = append(s.jobOrder, jobID)
+	}
+	s.jobs[jobID] = DifficultyFromTarget(target)
+	for len(s.jobOrder) > maxJobTargets {
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+}
+
+// submitCounts counts the shares answered by the pool for the accepted and
+// rejected log lines
+var submitCounts = struct {
+	sync.Mutex
+	accepted uint64
+	total    uint64
+}{}
+
+// resetSubmitCounts zeroes the counts shown in the accepted and rejected
+// log lines
+func resetSubmitCounts() {
+	submitCounts.Lock()
+	defer submitCounts.Unlock()
+	submitCounts.accepted = 0
+	submitCounts.total = 0
+}
+
+// LogSubmitResult counts result and logs it along with the number of shares
+// accepted so far and the round-trip time to the pool
+func LogSubmitResult(result *SubmitResult) {
+	submitCounts.Lock()
+	submitCounts.total++
+	if result.Accepted {
+		submitCounts.accepted++
+	}
+	accepted, total := submitCounts.accepted, submitCounts.total
+	submitCounts.Unlock()
+
+	ms := result.Latency.Nanoseconds() / int64(time.Millisecond)
+	if result.Accepted {
+		log.Infof("accepted (%d/%d) diff %d (%dms)", accepted, total, result.Difficulty, ms)
+	} else {
+		log.Warnf("rejected (%d/%d) diff %d \"%s\" (%dms)", accepted, total, result.Difficulty, result.Error, ms)
+	}
+}
@@ -0,0 +1,64 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitTracker(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1000, 0)
+	s := NewSubmitTracker()
+	s.now = func() time.Time { return now }
+
+	_, ok := s.Received([]byte(`{"id":1,"jsonrpc":"2.0","error":null,"result":{"id":"w","job":{"job_id":"job-1","blob":"00","target":"e8030000"}}}` + "\n"))
+	require.False(ok)
+	_, ok = s.Received([]byte(`{"jsonrpc":"2.0","method":"job","params":{"job_id":"job-2","blob":"00","target":"b88d0600"}}` + "\n"))
+	require.False(ok)
+
+	s.Sent([]byte(`{"id":2,"method":"submit","params":{"id":"w","job_id":"job-1","nonce":"00000000","result":"00"}}` + "\n"))
+	s.Sent([]byte(`{"id":3,"method":"submit","params":{"id":"w","job_id":"job-2","nonce":"00000001","result":"00"}}` + "\n"))
+	s.Sent([]byte(`{"id":4,"method":"keepalived","params":{"id":"w"}}` + "\n"))
+
+	now = now.Add(85 * time.Millisecond)
+	result, ok := s.Received([]byte(`{"id":3,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}` + "\n"))
+	require.True(ok)
+	require.True(result.Accepted)
+	require.Equal(uint64(10000), result.Difficulty)
+	require.Equal(85*time.Millisecond, result.Latency)
+	require.Equal("job-2", result.JobID)
+	require.Equal("00000001", result.Nonce)
+
+	// Each share is only answered once
+	_, ok = s.Received([]byte(`{"id":3,"jsonrpc":"2.0","error":null,"result":{"status":"OK"}}` + "\n"))
+	require.False(ok)
+	_, ok = s.Received([]byte(`{"id":4,"jsonrpc":"2.0","error":null,"result":{"status":"KEEPALIVED"}}` + "\n"))
+	require.False(ok)
+
+	now = now.Add(15 * time.Millisecond)
+	result, ok = s.Received([]byte(`{"id":2,"jsonrpc":"2.0","error":{"code":-1,"message":"Low difficulty share"}}` + "\n"))
+	require.True(ok)
+	require.False(result.Accepted)
+	require.Equal("Low difficulty share", result.Error)
+	require.Equal(100*time.Millisecond, result.Latency)
+}
+
+func TestLogSubmitResult(t *testing.T) {
+	require := require.New(t)
+
+	resetSubmitCounts()
+	LogSubmitResult(&SubmitResult{Accepted: true, Difficulty: 1000, Latency: 50 * time.Millisecond})
+	LogSubmitResult(&SubmitResult{Error: "Low difficulty share", Difficulty: 1000})
+	submitCounts.Lock()
+	require.Equal(uint64(1), submitCounts.accepted)
+	require.Equal(uint64(2), submitCounts.total)
+	submitCounts.Unlock()
+
+	ResetStats()
+	submitCounts.Lock()
+	require.Equal(uint64(0), submitCounts.total)
+	submitCounts.Unlock()
+}
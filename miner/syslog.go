@@ -0,0 +1,20 @@
+package miner
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// SyslogTag is the tag that log messages are sent to syslog with
+var SyslogTag = "go-cryptonight-miner"
+
+// SetupSyslog sends log messages to the local syslog daemon if config.Syslog
+// is set. Where syslog is unavailable, a warning is logged and messages only
+// go to the usual outputs
+func SetupSyslog(config *Config) {
+	if !config.Syslog {
+		return
+	}
+	if err := addSyslogHook(SyslogTag); err != nil {
+		log.Warnf("Failed to set up syslog, logging to the console only: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || nacl || plan9
+// +build windows nacl plan9
+
+package miner
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func addSyslogHook(tag string) error {
+	return fmt.Errorf("Syslog is not supported on %v", runtime.GOOS)
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !nacl && !plan9
+// +build !windows,!nacl,!plan9
+
+package miner
+
+import (
+	"log/syslog"
+
+	log "github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+func addSyslogHook(tag string) error {
+	hook, err := lsyslog.NewSyslogHook("", "", syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return err
+	}
+	log.AddHook(hook)
+	return nil
+}
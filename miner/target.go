@@ -0,0 +1,157 @@
+package miner
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	// maxHashValue is the largest 256-bit hash value
+	maxHashValue = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	// maxJobTargets is the number of full-width job targets that are kept
+	maxJobTargets = 32
+)
+
+// Target is a share target compared against the full 256 bits of a hash.
+// A hash meets the target if, read as a little-endian number, it is at most
+// the target's boundary
+type Target struct {
+	boundary *big.Int
+}
+
+// TargetFromDifficulty returns the Target of a difficulty. Pools check
+// shares against the difficulty, so the boundary is the largest hash for
+// which hash * difficulty doesn't overflow 256 bits
+func TargetFromDifficulty(difficulty uint64) *Target {
+	if difficulty == 0 {
+		return &Target{new(big.Int)}
+	}
+	return &Target{new(big.Int).Div(maxHashValue, new(big.Int).SetUint64(difficulty))}
+}
+
+// DifficultyFromTarget returns the difficulty that a target encodes. It is
+// the inverse of TargetFromDifficulty
+func DifficultyFromTarget(t *Target) uint64 {
+	if t.boundary.Sign() == 0 {
+		return 0
+	}
+	difficulty := new(big.Int).Div(maxHashValue, t.boundary)
+	if !difficulty.IsUint64() {
+		return 0xFFFFFFFFFFFFFFFF
+	}
+	return difficulty.Uint64()
+}
+
+// NewTarget returns the Target for a 64-bit work target, which is checked
+// against the difficulty it encodes
+func NewTarget(target uint64) *Target {
+	return TargetFromDifficulty(TargetDifficulty(target))
+}
+
+// ParseTarget parses a target the way the pool sent it: a compact 4-byte or
+// 8-byte little-endian hex target, or a 32-byte big-endian hex target
+func ParseTarget(s string) (*Target, error) {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid target '%v': %v", s, err)
+	}
+	switch len(b) {
+	case 4:
+		compact := uint64(binary.LittleEndian.Uint32(b))
+		if compact == 0 {
+			return nil, fmt.Errorf("Invalid target '%v'", s)
+		}
+		return TargetFromDifficulty(0xFFFFFFFF / compact), nil
+	case 8:
+		return NewTarget(binary.LittleEndian.Uint64(b)), nil
+	case 32:
+		return &Target{new(big.Int).SetBytes(b)}, nil
+	}
+	return nil, fmt.Errorf("Invalid target length %d: '%v'", len(s), s)
+}
+
+// String returns the target as a 32-byte big-endian hex string
+func (t *Target) String() string {
+	return hex.EncodeToString(t.boundary.FillBytes(make([]byte, 32)))
+}
+
+// hashValue reads a hash as a 256-bit little-endian number
+func hashValue(hash []byte) *big.Int {
+	be := make([]byte, len(hash))
+	for i := range hash {
+		be[len(hash)-1-i] = hash[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+// Meets returns true if hash meets the target
+func (t *Target) Meets(hash []byte) bool {
+	if len(hash) < 32 {
+		return false
+	}
+	return hashValue(hash[:32]).Cmp(t.boundary) <= 0
+}
+
+// jobTargets remembers the targets of recent jobs that were sent with a full
+// 256-bit target, which can't be carried in the 64-bit work target
+var jobTargets = struct {
+	sync.Mutex
+	targets map[string]*Target
+	order   []string
+}{
+	targets: make(map[string]*Target),
+}
+
+// RecordJobTarget remembers the full target of a job
+func RecordJobTarget(jobID string, target *Target) {
+	jobTargets.Lock()
+	defer jobTargets.Unlock()
+	if _, ok := jobTargets.targets[jobID]; !ok {
+		jobTargets.order = append(jobTargets.order, jobID)
+	}
+	jobTargets.targets[jobID] = target
+	for len(jobTargets.order) > maxJobTargets {
+		delete(jobTargets.targets, jobTargets.order[0])
+		jobTargets.order = jobTargets.order[1:]
+	}
+}
+
+// forgetJobTarget forgets the full target of a job
+func forgetJobTarget(jobID string) {
+	jobTargets.Lock()
+	defer jobTargets.Unlock()
+	if _, ok := jobTargets.targets[jobID]; !ok {
+		return
+	}
+	delete(jobTargets.targets, jobID)
+	for i, id := range jobTargets.order {
+		if id == jobID {
+			jobTargets.order = append(jobTargets.order[:i], jobTargets.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// JobTarget returns the full target of the job with the given id, falling
+// back to the 64-bit work target if the pool didn't send a full one
+func JobTarget(jobID string, target uint64) *Target {
+	jobTargets.Lock()
+	defer jobTargets.Unlock()
+	if t, ok := jobTargets.targets[jobID]; ok {
+		return t
+	}
+	return NewTarget(target)
+}
+
+// MeetsTarget returns true if hash meets the target of the job it was
+// computed for. Hashes are pre-filtered on their most significant 64 bits,
+// which is not exact at the boundary
+func MeetsTarget(jobID string, target uint64, hash []byte) bool {
+	return JobTarget(jobID, target).Meets(hash)
+}
@@ -0,0 +1,169 @@
+package miner
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// leHash encodes v as a 32-byte little-endian hash
+func leHash(v *big.Int) []byte {
+	be := v.FillBytes(make([]byte, 32))
+	hash := make([]byte, 32)
+	for i := range be {
+		hash[31-i] = be[i]
+	}
+	return hash
+}
+
+func TestTargetBoundary(t *testing.T) {
+	require := require.New(t)
+
+	for _, difficulty := range []uint64{1, 2, 1000, 120001, 0xFFFFFFFF} {
+		target := NewTarget(0xFFFFFFFFFFFFFFFF / difficulty)
+		d := new(big.Int).SetUint64(TargetDifficulty(0xFFFFFFFFFFFFFFFF / difficulty))
+		boundary := new(big.Int).Div(maxHashValue, d)
+
+		require.True(target.Meets(leHash(boundary)), "difficulty %d", difficulty)
+		require.True(target.Meets(leHash(new(big.Int).Sub(boundary, big.NewInt(1)))), "difficulty %d", difficulty)
+		if difficulty > 1 {
+			require.False(target.Meets(leHash(new(big.Int).Add(boundary, big.NewInt(1)))), "difficulty %d", difficulty)
+		}
+		// The boundary hash is accepted by the pool: hash * difficulty fits in
+		// 256 bits, while the next hash doesn't
+		require.True(new(big.Int).Mul(boundary, d).BitLen() <= 256)
+		if difficulty > 1 {
+			next := new(big.Int).Add(boundary, big.NewInt(1))
+			require.True(new(big.Int).Mul(next, d).BitLen() > 256)
+		}
+	}
+}
+
+func TestTargetTopWordIsNotEnough(t *testing.T) {
+	require := require.New(t)
+
+	// Two hashes whose most significant 64 bits are both equal to the 64-bit
+	// target, one just below and one just above the full boundary
+	work := uint64(0xFFFFFFFFFFFFFFFF / 1000)
+	target := NewTarget(work)
+
+	below := make([]byte, 32)
+	binary.LittleEndian.PutUint64(below[24:], work)
+	require.True(target.Meets(below))
+
+	above := make([]byte, 32)
+	for i := range above {
+		above[i] = 0xFF
+	}
+	binary.LittleEndian.PutUint64(above[24:], work)
+	require.False(target.Meets(above))
+}
+
+func TestParseTarget(t *testing.T) {
+	require := require.New(t)
+
+	// Compact targets are expanded the same way as the stratum client does
+	compact, err := ParseTarget("b88d0600")
+	require.Nil(err)
+	require.Equal(NewTarget(0xFFFFFFFFFFFFFFFF/(0xFFFFFFFF/0x00068db8)).boundary, compact.boundary)
+
+	wide, err := ParseTarget("e4a63d0000000000")
+	require.Nil(err)
+	require.Equal(NewTarget(0x3da6e4).boundary, wide.boundary)
+
+	full := "00000000ffff" + strings.Repeat("0", 52)
+	target, err := ParseTarget(full)
+	require.Nil(err)
+	boundary, _ := new(big.Int).SetString(full, 16)
+	require.True(target.Meets(leHash(boundary)))
+	require.False(target.Meets(leHash(new(big.Int).Add(boundary, big.NewInt(1)))))
+
+	_, err = ParseTarget("00000000")
+	require.NotNil(err)
+	_, err = ParseTarget("abcd")
+	require.NotNil(err)
+	_, err = ParseTarget("zz")
+	require.NotNil(err)
+}
+
+func TestJobTarget(t *testing.T) {
+	require := require.New(t)
+
+	job, err := NormalizeJob(map[string]interface{}{
+		"job_id": "full-target",
+		"blob":   testBlob,
+		"target": "00000000ffff" + strings.Repeat("0", 52),
+	})
+	require.Nil(err)
+	require.Equal("0000ffff00000000", job["target"])
+
+	// A hash equal in its most significant bits but above the full target
+	hash := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hash[24:], 0x00000000ffff0000)
+	hash[0] = 1
+	require.False(MeetsTarget("full-target", 0xffff0000, hash))
+	hash[0] = 0
+	require.True(MeetsTarget("full-target", 0xffff0000, hash))
+
+	// Unknown jobs fall back to the 64-bit target
+	require.True(MeetsTarget("other", 0xffff0000, hash))
+
+	// Jobs that only carry a difficulty are checked against its exact target
+	_, err = NormalizeJob(map[string]interface{}{
+		"job_id":     "difficulty",
+		"blob":       testBlob,
+		"difficulty": json.Number("8589934591"),
+	})
+	require.Nil(err)
+	require.Equal(uint64(0x1FFFFFFFF), DifficultyFromTarget(JobTarget("difficulty", 0)))
+
+	for i := 0; i < maxJobTargets+1; i++ {
+		RecordJobTarget(strings.Repeat("x", i+1), NewTarget(1))
+	}
+	jobTargets.Lock()
+	_, ok := jobTargets.targets["full-target"]
+	require.False(ok)
+	require.Equal(maxJobTargets, len(jobTargets.order))
+	jobTargets.Unlock()
+}
+
+func TestTargetFromDifficulty(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(strings.Repeat("f", 64), TargetFromDifficulty(1).String())
+	require.Equal("7"+strings.Repeat("f", 63), TargetFromDifficulty(2).String())
+	require.Equal("000010c6f7a0b5ed8d36b4c7f34938583621fafc8b0079a2834d26fa3fcc9ea9", TargetFromDifficulty(1000000).String())
+
+	for _, difficulty := range []uint64{1, 2, 1000, 120001, 0xFFFFFFFF, 0xFFFFFFFFFFFFFFFF} {
+		require.Equal(difficulty, DifficultyFromTarget(TargetFromDifficulty(difficulty)), "difficulty %d", difficulty)
+	}
+	require.Equal(uint64(0), DifficultyFromTarget(TargetFromDifficulty(0)))
+}
+
+func TestDifficultyFromTarget(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		target     string
+		difficulty uint64
+	}{
+		// Compact targets
+		{"b88d0600", 10000},
+		{"ffffffff", 1},
+		{"e8030000", 0xFFFFFFFF / 1000},
+		// 8-byte targets
+		{targetHex(0xFFFFFFFFFFFFFFFF / 120001), 120001},
+		{"ffffffffffffffff", 1},
+		// Full targets
+		{"00000000ffff" + strings.Repeat("0", 52), 4295032833},
+		{strings.Repeat("f", 64), 1},
+	} {
+		target, err := ParseTarget(tc.target)
+		require.Nil(err, tc.target)
+		require.Equal(tc.difficulty, DifficultyFromTarget(target), tc.target)
+	}
+}
@@ -0,0 +1,52 @@
+package miner
+
+import (
+	"time"
+)
+
+var (
+	// ThrottleWindow is the duration after which a Throttle forgets about
+	// previously accounted hashes. This prevents long pauses (e.g. waiting for
+	// a job) from being made up for with a burst of unthrottled hashing
+	ThrottleWindow = 10 * time.Second
+)
+
+// Throttle limits the rate at which hashes are computed by sleeping whenever
+// the measured hashrate exceeds the configured maximum
+type Throttle struct {
+	maxHashRate float64
+	start       time.Time
+	hashes      uint64
+	now         func() time.Time
+	sleep       func(time.Duration)
+}
+
+// NewThrottle returns a Throttle that limits hashing to maxHashRate H/s
+func NewThrottle(maxHashRate float64) *Throttle {
+	return &Throttle{
+		maxHashRate: maxHashRate,
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}
+}
+
+// Wait accounts for hashes that were just computed and sleeps for as long as
+// is needed to bring the hashrate back down to the maximum.
+// It returns the duration that was slept
+func (t *Throttle) Wait(hashes uint32) time.Duration {
+	now := t.now()
+	if t.start.IsZero() || now.Sub(t.start) > ThrottleWindow {
+		t.start = now
+		t.hashes = 0
+	}
+	t.hashes += uint64(hashes)
+
+	expected := time.Duration(float64(t.hashes) / t.maxHashRate * float64(time.Second))
+	elapsed := now.Sub(t.start)
+	if expected <= elapsed {
+		return 0
+	}
+	delay := expected - elapsed
+	t.sleep(delay)
+	return delay
+}
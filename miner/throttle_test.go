@@ -0,0 +1,40 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	slept := time.Duration(0)
+
+	throttle := NewThrottle(100)
+	throttle.now = func() time.Time {
+		return now
+	}
+	throttle.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	// 10 hashes at 100H/s should take 100ms
+	require.Equal(100*time.Millisecond, throttle.Wait(10))
+
+	// Hashing slower than the limit should not sleep at all
+	now = now.Add(time.Second)
+	require.Equal(time.Duration(0), throttle.Wait(10))
+
+	// Over a longer period, the hashrate converges on the limit
+	for i := 0; i < 50; i++ {
+		throttle.Wait(10)
+		now = now.Add(10 * time.Millisecond)
+	}
+	elapsed := now.Sub(throttle.start)
+	rate := float64(throttle.hashes) / elapsed.Seconds()
+	require.InDelta(100, rate, 10)
+}
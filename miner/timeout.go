@@ -0,0 +1,108 @@
+package miner
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDialTimeout is the number of seconds that connecting to a pool
+	// may take
+	DefaultDialTimeout = 30
+	// DefaultReadTimeout is the number of seconds without a message from
+	// the pool after which the connection is considered dead. Pools send a
+	// job at least every block, so this is several block times
+	DefaultReadTimeout = 600
+	// DefaultWriteTimeout is the number of seconds that sending a message to
+	// the pool may take
+	DefaultWriteTimeout = 30
+)
+
+// SetTimeouts limits how long connecting to a pool, waiting for a message
+// from it and sending a message to it may take, so that a connection that
+// silently died is dropped and the pool is reconnected to. A timeout <= 0
+// leaves the respective operation unlimited
+func (d *Dialer) SetTimeouts(dial, read, write time.Duration) {
+	if dial < 0 {
+		dial = 0
+	}
+	d.direct.Timeout = dial
+	d.readTimeout = read
+	d.writeTimeout = write
+}
+
+// withTimeouts wraps conn so that its reads and writes time out as set by
+// SetTimeouts
+func (d *Dialer) withTimeouts(conn net.Conn) net.Conn {
+	if d.readTimeout <= 0 && d.writeTimeout <= 0 {
+		return conn
+	}
+	return &timeoutConn{Conn: conn, readTimeout: d.readTimeout, writeTimeout: d.writeTimeout}
+}
+
+// timeoutConn sets a deadline before every read and write. Deadlines that
+// are set explicitly still apply if they are earlier
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// Held while deadlines are set on Conn, so that an explicit deadline set
+	// while a read is starting isn't overwritten
+	sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// earliest returns the earlier of deadline and timeout from now. A zero
+// deadline or timeout doesn't apply
+func earliest(deadline time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return deadline
+	}
+	t := time.Now().Add(timeout)
+	if !deadline.IsZero() && deadline.Before(t) {
+		return deadline
+	}
+	return t
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		c.Lock()
+		c.Conn.SetReadDeadline(earliest(c.readDeadline, c.readTimeout))
+		c.Unlock()
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		c.Lock()
+		c.Conn.SetWriteDeadline(earliest(c.writeDeadline, c.writeTimeout))
+		c.Unlock()
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *timeoutConn) SetDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *timeoutConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *timeoutConn) SetWriteDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(t)
+}
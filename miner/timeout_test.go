@@ -0,0 +1,61 @@
+package miner
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerTimeouts(t *testing.T) {
+	require := require.New(t)
+
+	// A pool that accepts connections and never sends anything
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	dialer.SetTimeouts(time.Second, 100*time.Millisecond, time.Second)
+	conn, err := dialer.Dial(listener.Addr().String())
+	require.Nil(err)
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	require.NotNil(err)
+	netErr, ok := err.(net.Error)
+	require.True(ok)
+	require.True(netErr.Timeout())
+	require.True(time.Since(start) < time.Second)
+
+	// An explicit deadline that is earlier still applies
+	dialer.SetTimeouts(time.Second, time.Minute, time.Second)
+	conn, err = dialer.Dial(listener.Addr().String())
+	require.Nil(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start = time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	require.NotNil(err)
+	require.True(time.Since(start) < time.Second)
+
+	// No timeouts leave the connection as dialed
+	dialer.SetTimeouts(-1, 0, 0)
+	conn, err = dialer.Dial(listener.Addr().String())
+	require.Nil(err)
+	defer conn.Close()
+	_, ok = conn.(*timeoutConn)
+	require.False(ok)
+}
@@ -0,0 +1,120 @@
+package miner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// tlsSchemes are the url schemes of pools that are connected to over TLS
+var tlsSchemes = []string{"stratum+ssl://", "stratum+tls://", "ssl://", "tls://"}
+
+// IsTLSURL returns true if the pool at url is connected to over TLS
+func IsTLSURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range tlsSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSConfig returns the TLS configuration for connecting to the pool, with
+// its client certificate and CA bundle loaded. It is nil for pools that
+// aren't connected to over TLS
+func (p *Pool) TLSConfig() (*tls.Config, error) {
+	if !IsTLSURL(p.Url) {
+		if len(p.TLSCert) != 0 || len(p.TLSKey) != 0 || len(p.TLSCA) != 0 {
+			return nil, fmt.Errorf("Pool %v has TLS certificates but doesn't use a stratum+ssl:// url", p.Url)
+		}
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if host, _, err := net.SplitHostPort(StripScheme(p.Url)); err == nil {
+		config.ServerName = host
+	}
+	if len(p.TLSCert) != 0 || len(p.TLSKey) != 0 {
+		if len(p.TLSCert) == 0 || len(p.TLSKey) == 0 {
+			return nil, fmt.Errorf("Pool %v needs both tls_cert and tls_key for a client certificate", p.Url)
+		}
+		cert, err := tls.LoadX509KeyPair(p.TLSCert, p.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate of pool %v: %v", p.Url, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(p.TLSCA) != 0 {
+		b, err := ioutil.ReadFile(p.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle of pool %v: %v", p.Url, err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("CA bundle '%v' of pool %v has no PEM certificates", p.TLSCA, p.Url)
+		}
+		config.RootCAs = roots
+	}
+	return config, nil
+}
+
+// LoadTLS loads the TLS configuration of every pool, so that missing or
+// mismatched certificates are reported at startup rather than on connecting
+func (c *Config) LoadTLS() (map[string]*tls.Config, error) {
+	configs := make(map[string]*tls.Config)
+	for idx := range c.Pools {
+		pool := &c.Pools[idx]
+		config, err := pool.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			configs[pool.Url] = config
+		}
+	}
+	return configs, nil
+}
+
+// SetTLSConfig makes connections to the pool at address use config. Pools
+// with a stratum+ssl:// url that have no config verify the certificate of
+// the pool against the system roots
+func (d *Dialer) SetTLSConfig(address string, config *tls.Config) {
+	d.Lock()
+	defer d.Unlock()
+	if d.tlsConfigs == nil {
+		d.tlsConfigs = make(map[string]*tls.Config)
+	}
+	d.tlsConfigs[address] = config
+}
+
+// withTLS performs the TLS handshake on conn to the pool at address, if the
+// pool is connected to over TLS. The handshake is limited by the dial timeout
+func (d *Dialer) withTLS(conn net.Conn, address string) (net.Conn, error) {
+	if !IsTLSURL(address) {
+		return conn, nil
+	}
+	d.Lock()
+	config := d.tlsConfigs[address]
+	d.Unlock()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if len(config.ServerName) == 0 {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(StripScheme(address))
+	}
+	tlsConn := tls.Client(conn, config)
+	if d.direct.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.direct.Timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
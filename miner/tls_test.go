@@ -0,0 +1,185 @@
+package miner
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and its key, signed by parent or self-signed
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, ca bool) *testCert {
+	require := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.Nil(err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(err)
+	return &testCert{
+		cert,
+		key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name string, b []byte) string {
+	path := filepath.Join(dir, name)
+	require.New(t).Nil(ioutil.WriteFile(path, b, 0600))
+	return path
+}
+
+func TestDialerMutualTLS(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "tls")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "pool", ca, false)
+	client := newTestCert(t, "miner", ca, false)
+
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	require.Nil(err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	require.Nil(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pool := Pool{
+		Url:     "stratum+ssl://" + listener.Addr().String(),
+		TLSCert: writeTestFile(t, dir, "client.crt", client.certPEM),
+		TLSKey:  writeTestFile(t, dir, "client.key", client.keyPEM),
+		TLSCA:   writeTestFile(t, dir, "ca.crt", ca.certPEM),
+	}
+	config, err := pool.TLSConfig()
+	require.Nil(err)
+	require.NotNil(config)
+
+	dialer, err := NewDialer("")
+	require.Nil(err)
+	dialer.SetTimeouts(5*time.Second, 5*time.Second, 5*time.Second)
+	dialer.SetTLSConfig(pool.Url, config)
+	conn, err := dialer.Dial(pool.Url)
+	require.Nil(err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello\n"))
+	require.Nil(err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.Nil(err)
+	require.Equal("hello\n", line)
+
+	// Without the client certificate the pool refuses the connection
+	pool.TLSCert, pool.TLSKey = "", ""
+	config, err = pool.TLSConfig()
+	require.Nil(err)
+	dialer.SetTLSConfig(pool.Url, config)
+	if conn, err := dialer.Dial(pool.Url); err == nil {
+		// TLS 1.3 reports the rejected certificate on the first read
+		conn.Write([]byte("hello\n"))
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		require.NotNil(err)
+	}
+}
+
+func TestPoolTLSConfig(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "tls")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	client := newTestCert(t, "miner", nil, false)
+	other := newTestCert(t, "other", nil, false)
+	certFile := writeTestFile(t, dir, "client.crt", client.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", client.keyPEM)
+
+	// Plain pools need no TLS config
+	config, err := (&Pool{Url: "stratum+tcp://pool:3333"}).TLSConfig()
+	require.Nil(err)
+	require.Nil(config)
+	_, err = (&Pool{Url: "stratum+tcp://pool:3333", TLSCert: certFile, TLSKey: keyFile}).TLSConfig()
+	require.NotNil(err)
+
+	config, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCert: certFile, TLSKey: keyFile}).TLSConfig()
+	require.Nil(err)
+	require.Equal("pool", config.ServerName)
+	require.Equal(1, len(config.Certificates))
+
+	// Missing files, a missing key and a key of another certificate
+	_, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCert: filepath.Join(dir, "missing.crt"), TLSKey: keyFile}).TLSConfig()
+	require.NotNil(err)
+	_, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCert: certFile}).TLSConfig()
+	require.NotNil(err)
+	otherKey := writeTestFile(t, dir, "other.key", other.keyPEM)
+	_, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCert: certFile, TLSKey: otherKey}).TLSConfig()
+	require.NotNil(err)
+	_, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCA: filepath.Join(dir, "missing.crt")}).TLSConfig()
+	require.NotNil(err)
+	_, err = (&Pool{Url: "stratum+ssl://pool:3333", TLSCA: keyFile}).TLSConfig()
+	require.NotNil(err)
+
+	var c Config
+	c.Pools = []Pool{{Url: "stratum+ssl://pool:3333", TLSCert: certFile, TLSKey: otherKey}}
+	_, err = NewEngine(&c)
+	require.NotNil(err)
+}
@@ -0,0 +1,90 @@
+package miner
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Watchdog restarts miners that have stopped reporting hashrate samples
+type Watchdog struct {
+	sync.Mutex
+	timeout    time.Duration
+	miners     map[uint32]Interface
+	lastSample map[uint32]time.Time
+}
+
+// NewWatchdog returns a watchdog that considers a miner stalled if it hasn't
+// reported any hashes for timeout
+func NewWatchdog(timeout time.Duration, miners []Interface) *Watchdog {
+	w := &Watchdog{
+		timeout:    timeout,
+		miners:     make(map[uint32]Interface),
+		lastSample: make(map[uint32]time.Time),
+	}
+	for _, m := range miners {
+		w.miners[m.Id()] = m
+	}
+	return w
+}
+
+// HandleEvent records hashrate samples
+func (w *Watchdog) HandleEvent(event *Event) {
+	if event.Kind != HashrateSample {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.lastSample[event.MinerID] = event.Time
+}
+
+// Check restarts every miner that has been silent for longer than the
+// timeout and returns their ids. Miners that have not reported any samples
+// yet or that are paused are not considered stalled
+func (w *Watchdog) Check(now time.Time) []uint32 {
+	w.Lock()
+	stalled := make([]uint32, 0)
+	for id, last := range w.lastSample {
+		if now.Sub(last) <= w.timeout {
+			continue
+		}
+		// Give the miner another timeout to recover before trying again. Paused
+		// miners are expected to be silent and get a full timeout once resumed
+		w.lastSample[id] = now
+		if pausable, ok := w.miners[id].(Pausable); ok && pausable.Paused() {
+			continue
+		}
+		stalled = append(stalled, id)
+	}
+	w.Unlock()
+
+	for _, id := range stalled {
+		m, ok := w.miners[id]
+		if !ok {
+			continue
+		}
+		log.Warnf("miner-%d: No hashes for over %v, restarting", id, w.timeout)
+		if err := m.Restart(); err != nil {
+			log.Errorf("miner-%d: Failed to restart: %v", id, err)
+		}
+	}
+	return stalled
+}
+
+// Run checks the miners periodically until the process exits.
+// This function is expected to be run in a goroutine
+func (w *Watchdog) Run() {
+	eventChan := make(chan *Event, 100)
+	RegisterEventListener(eventChan)
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-eventChan:
+			w.HandleEvent(event)
+		case now := <-ticker.C:
+			w.Check(now)
+		}
+	}
+}
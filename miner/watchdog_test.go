@@ -0,0 +1,64 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type restartableMiner struct {
+	*Miner
+	restarts int
+}
+
+func (m *restartableMiner) Run() error {
+	return nil
+}
+
+func (m *restartableMiner) Restart() error {
+	m.restarts++
+	return nil
+}
+
+func TestWatchdog(t *testing.T) {
+	require := require.New(t)
+
+	m0 := &restartableMiner{New(0), 0}
+	m1 := &restartableMiner{New(1), 0}
+	w := NewWatchdog(10*time.Second, []Interface{m0, m1})
+
+	now := time.Now()
+	// Miners that never reported are not stalled
+	require.Equal(0, len(w.Check(now.Add(time.Minute))))
+
+	w.HandleEvent(&Event{HashrateSample, now, 0, nil})
+	w.HandleEvent(&Event{HashrateSample, now.Add(8 * time.Second), 1, nil})
+
+	stalled := w.Check(now.Add(11 * time.Second))
+	require.Equal([]uint32{0}, stalled)
+	require.Equal(1, m0.restarts)
+	require.Equal(0, m1.restarts)
+
+	// A restarted miner gets another timeout before it is restarted again
+	require.Equal(0, len(w.Check(now.Add(15*time.Second))))
+}
+
+func TestWatchdogSkipsPausedMiners(t *testing.T) {
+	require := require.New(t)
+
+	m := &restartableMiner{New(0), 0}
+	w := NewWatchdog(10*time.Second, []Interface{m})
+
+	now := time.Now()
+	w.HandleEvent(&Event{HashrateSample, now, 0, nil})
+	m.Pause()
+	require.Equal(0, len(w.Check(now.Add(time.Minute))))
+	require.Equal(0, m.restarts)
+
+	// Once resumed, the miner gets a full timeout before it is restarted
+	m.Resume()
+	require.Equal(0, len(w.Check(now.Add(time.Minute+5*time.Second))))
+	require.Equal([]uint32{0}, w.Check(now.Add(time.Minute+11*time.Second)))
+	require.Equal(1, m.restarts)
+}
@@ -0,0 +1,51 @@
+package miner
+
+import (
+	"bytes"
+
+	stratum "github.com/gurupras/go-stratum-client"
+)
+
+const (
+	// nonceOffset is the offset of the 32-bit nonce in a hashing blob
+	nonceOffset = 39
+)
+
+// WorkSource delivers jobs to miners. Every registered listener receives
+// every new job
+type WorkSource interface {
+	RegisterWorkListener(chan<- *stratum.Work)
+}
+
+// WorkSubmitter accepts solved work along with the hex encoded hash
+type WorkSubmitter interface {
+	SubmitWork(work *stratum.Work, hash string) error
+}
+
+// WorkProvider is both a WorkSource and a WorkSubmitter. The stratum client
+// as well as SoloClient implement this interface
+type WorkProvider interface {
+	WorkSource
+	WorkSubmitter
+}
+
+// IsNewJob returns true if work is a different job from current, the job a
+// miner is working on. Some pools push the same job again, and restarting
+// its nonce range would only search the same nonces twice. The nonce is
+// ignored when comparing blobs since miners write their own into current
+func IsNewJob(current, work *stratum.Work) bool {
+	if current == nil || work == nil {
+		return work != nil
+	}
+	if current.JobID != work.JobID || current.Target != work.Target || current.Size != work.Size {
+		return true
+	}
+	if len(current.Data) < work.Size || len(work.Data) < work.Size {
+		return true
+	}
+	a, b := current.Data[:work.Size], work.Data[:work.Size]
+	if work.Size < nonceOffset+4 {
+		return !bytes.Equal(a, b)
+	}
+	return !bytes.Equal(a[:nonceOffset], b[:nonceOffset]) || !bytes.Equal(a[nonceOffset+4:], b[nonceOffset+4:])
+}
@@ -0,0 +1,76 @@
+package miner
+
+import (
+	"testing"
+
+	stratum "github.com/gurupras/go-stratum-client"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTestWork(t *testing.T, jobID, target string) *stratum.Work {
+	require := require.New(t)
+
+	work, err := stratum.ParseWork(map[string]interface{}{
+		"job_id": jobID,
+		"blob":   testBlob,
+		"target": target,
+	})
+	require.Nil(err)
+	return work
+}
+
+func TestIsNewJob(t *testing.T) {
+	require := require.New(t)
+
+	current := stratum.NewWork()
+	first := parseTestWork(t, "job-1", "b88d0600")
+	require.True(IsNewJob(current, first))
+	require.True(IsNewJob(nil, first))
+	require.False(IsNewJob(current, nil))
+
+	stratum.WorkCopy(current, first)
+	// The miner writes its own nonce into the blob
+	*current.NoncePtr = 0x12345678
+	require.False(IsNewJob(current, parseTestWork(t, "job-1", "b88d0600")))
+
+	require.True(IsNewJob(current, parseTestWork(t, "job-2", "b88d0600")))
+	require.True(IsNewJob(current, parseTestWork(t, "job-1", "e4a63d00")))
+
+	// Same job id with a different blob
+	changed := parseTestWork(t, "job-1", "b88d0600")
+	changed.Data[0]++
+	require.True(IsNewJob(current, changed))
+}
+
+func TestDuplicateJobKeepsNonces(t *testing.T) {
+	require := require.New(t)
+
+	// Consume jobs the way miners do, only resetting the nonce range for new
+	// jobs
+	nonceRange := PartitionNonceSpace(0, 1)
+	nonces := NonceCounter{}
+	current := stratum.NewWork()
+	consume := func(work *stratum.Work) {
+		if !IsNewJob(current, work) {
+			return
+		}
+		stratum.WorkCopy(current, work)
+		nonces.Reset(nonceRange)
+	}
+
+	consume(parseTestWork(t, "job-1", "b88d0600"))
+	nonce, ok := nonces.Reserve(1000)
+	require.True(ok)
+	require.Equal(uint32(0), nonce)
+	*current.NoncePtr = nonce
+
+	consume(parseTestWork(t, "job-1", "b88d0600"))
+	nonce, ok = nonces.Next()
+	require.True(ok)
+	require.Equal(uint32(1000), nonce)
+
+	consume(parseTestWork(t, "job-2", "b88d0600"))
+	nonce, ok = nonces.Next()
+	require.True(ok)
+	require.Equal(uint32(0), nonce)
+}
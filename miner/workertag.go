@@ -0,0 +1,119 @@
+package miner
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxTaggedShares is the number of submitted shares whose worker tag is
+// remembered until the relay sees their submit request
+var maxTaggedShares = 1024
+
+// WorkerTagParam is the submit parameter that the worker tag is sent in
+var WorkerTagParam = "worker"
+
+// WorkerTag returns the worker tag of a miner from template, in which {id}
+// is replaced with the id of the miner
+func WorkerTag(template string, minerID uint32) string {
+	return strings.Replace(template, "{id}", fmt.Sprintf("%d", minerID), -1)
+}
+
+// WorkerTags attaches a worker tag to the shares of each miner, so that
+// pools that support it can tell threads and devices that share a login
+// apart. Miners record the shares they submit, and the relay adds the tag of
+// the miner that found a share to its submit request
+type WorkerTags struct {
+	sync.Mutex
+	tags map[uint32]string
+	// Tags of submitted shares, by job id and nonce
+	shares map[string]string
+	order  []string
+}
+
+// NewWorkerTags returns WorkerTags with no tags set
+func NewWorkerTags() *WorkerTags {
+	return &WorkerTags{
+		tags:   make(map[uint32]string),
+		shares: make(map[string]string),
+	}
+}
+
+// shareKey identifies a share by its job id and its nonce, hex encoded as
+// in submit requests
+func shareKey(jobID string, nonce string) string {
+	return jobID + "/" + strings.ToLower(nonce)
+}
+
+// SetTag makes the shares of the miner minerID be tagged with tag. An empty
+// tag removes it
+func (w *WorkerTags) SetTag(minerID uint32, tag string) {
+	w.Lock()
+	defer w.Unlock()
+	if len(tag) == 0 {
+		delete(w.tags, minerID)
+		return
+	}
+	w.tags[minerID] = tag
+}
+
+// Record remembers that the miner minerID is about to submit nonce for a
+// job, if the miner has a tag
+func (w *WorkerTags) Record(minerID uint32, jobID string, nonce uint32) {
+	w.Lock()
+	defer w.Unlock()
+	tag, ok := w.tags[minerID]
+	if !ok {
+		return
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, nonce)
+	key := shareKey(jobID, hex.EncodeToString(b))
+	if _, ok := w.shares[key]; !ok {
+		w.order = append(w.order, key)
+	}
+	w.shares[key] = tag
+	for len(w.order) > maxTaggedShares {
+		delete(w.shares, w.order[0])
+		w.order = w.order[1:]
+	}
+}
+
+// TagSubmit adds the tag of the miner that found the share submitted by
+// line to its params. Any other message, and submits of shares that were
+// not recorded, are returned unmodified
+func (w *WorkerTags) TagSubmit(line []byte) []byte {
+	message, ok := decodeMessage(line)
+	if !ok {
+		return line
+	}
+	if method, _ := message["method"].(string); method != "submit" {
+		return line
+	}
+	params, ok := message["params"].(map[string]interface{})
+	if !ok {
+		return line
+	}
+	jobID, _ := jsonString(params["job_id"])
+	nonce, _ := params["nonce"].(string)
+	key := shareKey(jobID, nonce)
+	w.Lock()
+	tag, ok := w.shares[key]
+	delete(w.shares, key)
+	w.Unlock()
+	if !ok {
+		return line
+	}
+	params[WorkerTagParam] = tag
+	b, err := json.Marshal(message)
+	if err != nil {
+		return line
+	}
+	return append(b, '\n')
+}
+
+// DefaultWorkerTags holds the worker tags of all miners
+var DefaultWorkerTags = NewWorkerTags()
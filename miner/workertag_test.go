@@ -0,0 +1,40 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerTag(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("rig1-gpu3", WorkerTag("rig1-gpu{id}", 3))
+	require.Equal("rig1", WorkerTag("rig1", 3))
+}
+
+func TestWorkerTags(t *testing.T) {
+	require := require.New(t)
+
+	w := NewWorkerTags()
+	w.SetTag(1, "gpu1")
+	w.Record(1, "job-1", 0x01020304)
+	// Miners without a tag are not recorded
+	w.Record(2, "job-1", 0x05060708)
+
+	line := w.TagSubmit([]byte(`{"id":5,"method":"submit","params":{"id":"s","job_id":"job-1","nonce":"04030201","result":"00"}}` + "\n"))
+	message, ok := decodeMessage(line)
+	require.True(ok)
+	require.Equal("gpu1", message["params"].(map[string]interface{})[WorkerTagParam])
+
+	// Each share is only tagged once
+	untagged := []byte(`{"id":6,"method":"submit","params":{"id":"s","job_id":"job-1","nonce":"04030201","result":"00"}}` + "\n")
+	require.Equal(untagged, w.TagSubmit(untagged))
+	untagged = []byte(`{"id":7,"method":"submit","params":{"id":"s","job_id":"job-1","nonce":"08070605","result":"00"}}` + "\n")
+	require.Equal(untagged, w.TagSubmit(untagged))
+
+	w.SetTag(1, "")
+	w.Record(1, "job-2", 1)
+	untagged = []byte(`{"id":8,"method":"submit","params":{"id":"s","job_id":"job-2","nonce":"01000000","result":"00"}}` + "\n")
+	require.Equal(untagged, w.TagSubmit(untagged))
+}